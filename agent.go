@@ -0,0 +1,362 @@
+package snmptools
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Agent serves an SMI tree to SNMPv1, SNMPv2c and SNMPv3 managers over UDP.
+//
+// It answers Get, GetNext, GetBulk and Set requests for OIDs beneath the root
+// it is registered at, so it can be used as a standalone agent for a Go
+// service where snmpd is not available.
+type Agent struct {
+	// Community is the community string that grants read access
+	Community string
+	// WriteCommunity, if set, is the community string that grants read and
+	// write access
+	WriteCommunity string
+
+	// Access, if set, controls which communities and SNMPv3 users may read
+	// and write which parts of the tree. It replaces Community,
+	// WriteCommunity and the writable flag of AddUser().
+	Access *VACM
+
+	// EngineID identifies the agent to SNMPv3 managers; NewAgent generates a
+	// random one
+	EngineID []byte
+	// EngineBoots counts how many times the agent's engine has been
+	// restarted. Applications using SNMPv3 should persist it and increment it
+	// on every start.
+	EngineBoots int
+
+	root     OID
+	callback func() SMINode
+
+	mu      sync.Mutex
+	conn    net.PacketConn
+	closed  bool
+	users   map[string]*agentUser
+	started time.Time
+	// usmStats counts the errors reported in each kind of USM Report-PDU
+	usmStats map[string]uint32
+}
+
+// agentUser is an SNMPv3 user known to an Agent.
+type agentUser struct {
+	user     USMUser
+	writable bool
+	// keys are localised to the agent's engine ID, which may change
+	keys         *usmKeys
+	localizedFor []byte
+}
+
+// NewAgent() creates an Agent serving the tree returned by callback at the
+// given root OID, with a read community of "public".
+//
+// The callback is called once for every request, giving client code the
+// opportunity to update the SMINode that is being traversed.
+func NewAgent(root OID, callback func() SMINode) *Agent {
+	return &Agent{
+		Community:   "public",
+		EngineID:    randomEngineID(),
+		EngineBoots: 1,
+		root:        root,
+		callback:    callback,
+		users:       make(map[string]*agentUser),
+		started:     time.Now(),
+		usmStats:    make(map[string]uint32),
+	}
+}
+
+// AddUser() allows an SNMPv3 user to send requests to the agent, at the
+// user's security level. Writable users may also send SET requests.
+func (a *Agent) AddUser(user USMUser, writable bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.users[user.Name] = &agentUser{user: user, writable: writable}
+}
+
+// ListenAndServe() listens on the UDP address addr (usually ":161") and
+// serves requests until Close() is called.
+func (a *Agent) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return a.Serve(conn)
+}
+
+// Serve() answers requests received on conn until Close() is called, at which
+// point it returns nil. If Close() was called first, Serve() closes conn and
+// returns at once.
+func (a *Agent) Serve(conn net.PacketConn) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	a.conn = conn
+	a.mu.Unlock()
+
+	var buf = make([]byte, maxMessageSize)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if resp := a.handlePacket(buf[:n]); resp != nil {
+			if _, err := conn.WriteTo(resp, addr); err != nil {
+				logger.Debug(fmt.Sprintf("Could not respond to %s: %s", addr, err))
+			}
+		}
+	}
+}
+
+// Close() stops the agent.
+func (a *Agent) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closed = true
+	if a.conn == nil {
+		return nil
+	}
+	return a.conn.Close()
+}
+
+// handlePacket answers one request packet, returning the encoded response or
+// nil if there should be no response.
+func (a *Agent) handlePacket(b []byte) []byte {
+	if v, err := messageVersion(b); err == nil && v == Version3 {
+		return a.handleV3(b)
+	}
+
+	m, err := UnmarshalMessage(b)
+	if err != nil {
+		logger.Debug(fmt.Sprintf("Ignoring bad packet: %s", err))
+		return nil
+	}
+
+	ctx := &requestContext{
+		root:     a.root,
+		version:  m.Version,
+		readable: allOIDs,
+		writable: noOIDs,
+	}
+
+	if a.Access != nil {
+		var ok bool
+		ctx.readable, ok = a.Access.viewFunc(m.Version, m.Community, NoAuthNoPriv, ReadView)
+		ctx.writable, _ = a.Access.viewFunc(m.Version, m.Community, NoAuthNoPriv, WriteView)
+		if !ok {
+			logger.Debug(fmt.Sprintf("Ignoring request with unknown community %q", m.Community))
+			return nil
+		}
+	} else if a.WriteCommunity != "" && m.Community == a.WriteCommunity {
+		ctx.writable = allOIDs
+	} else if m.Community != a.Community {
+		logger.Debug(fmt.Sprintf("Ignoring request with bad community %q", m.Community))
+		return nil
+	}
+
+	ctx.tree = a.callback()
+
+	resp := ctx.process(m.PDU)
+	if resp == nil {
+		return nil
+	}
+
+	req := m.PDU
+	m.PDU = resp
+	return marshalResponse(m.Marshal, resp, req)
+}
+
+// marshalResponse encodes a response with the given function, making it small
+// enough to fit into a UDP datagram if need be.
+func marshalResponse(marshal func() ([]byte, error), resp, req *PDU) []byte {
+	for {
+		b, err := marshal()
+
+		if err == nil && len(b) <= maxMessageSize {
+			return b
+		} else if err != nil {
+			// Something in the tree can't be encoded
+			logger.Warning(fmt.Sprintf("Could not encode response: %s", err))
+			resp.ErrorStatus, resp.ErrorIndex = GenErr, 0
+			resp.VarBinds = req.VarBinds
+			if b, err = marshal(); err != nil {
+				return nil
+			}
+			return b
+		}
+
+		if req.Type == AsnGetBulkRequest && len(resp.VarBinds) > 1 {
+			// GetBulk responses may simply be truncated
+			resp.VarBinds = resp.VarBinds[:len(resp.VarBinds)/2]
+		} else {
+			resp.ErrorStatus, resp.ErrorIndex = TooBig, 0
+			resp.VarBinds = nil
+		}
+	}
+}
+
+// engineTime returns the number of seconds since the agent's engine started.
+func (a *Agent) engineTime() int {
+	return int(time.Since(a.started) / time.Second)
+}
+
+// handleV3 answers an SNMPv3 request, applying the User-based Security Model.
+func (a *Agent) handleV3(b []byte) []byte {
+	m, err := unmarshalV3Message(b)
+	if err != nil {
+		logger.Debug(fmt.Sprintf("Ignoring bad SNMPv3 packet: %s", err))
+		return nil
+	} else if m.Flags&(v3FlagAuth|v3FlagPriv) == v3FlagPriv {
+		// Privacy without authentication is not a valid combination
+		return nil
+	}
+
+	a.mu.Lock()
+	u := a.users[m.UserName]
+	if u != nil && !bytes.Equal(u.localizedFor, a.EngineID) {
+		u.keys = u.user.localize(a.EngineID)
+		u.localizedFor = a.EngineID
+	}
+	a.mu.Unlock()
+
+	switch {
+	case !bytes.Equal(m.EngineID, a.EngineID):
+		// Includes engine ID discovery, where the manager sends an empty one
+		return a.report(m, UsmStatsUnknownEngineIDs, nil)
+
+	case u == nil:
+		return a.report(m, UsmStatsUnknownUserNames, nil)
+
+	case m.level() > u.user.SecurityLevel():
+		return a.report(m, UsmStatsUnsupportedSecLevels, nil)
+	}
+
+	if m.level() != NoAuthNoPriv {
+		if !u.keys.verify(m.raw, m.authOffset, m.AuthParams) {
+			return a.report(m, UsmStatsWrongDigests, nil)
+		}
+
+		// Authenticated messages must be within the time window
+		if delta := m.EngineTime - a.engineTime(); m.EngineBoots != a.EngineBoots || delta > timeWindow || delta < -timeWindow {
+			return a.report(m, UsmStatsNotInTimeWindows, u.keys)
+		}
+	}
+
+	// The message's level has been checked against the user's above
+	if err := m.open(u.keys, NoAuthNoPriv); err != nil {
+		return a.report(m, UsmStatsDecryptionErrors, nil)
+	}
+
+	var (
+		resp       *PDU
+		authorized = m.level() >= u.user.SecurityLevel()
+		ctx        = &requestContext{
+			root:     a.root,
+			version:  Version3,
+			readable: allOIDs,
+			writable: noOIDs,
+		}
+	)
+
+	if a.Access != nil {
+		ctx.readable, authorized = a.Access.viewFunc(Version3, m.UserName, m.level(), ReadView)
+		ctx.writable, _ = a.Access.viewFunc(Version3, m.UserName, m.level(), WriteView)
+	} else if u.writable {
+		ctx.writable = allOIDs
+	}
+
+	if !authorized {
+		// The user may not make requests at this security level
+		resp = &PDU{
+			Type:        AsnGetResponse,
+			RequestID:   m.PDU.RequestID,
+			ErrorStatus: AuthorizationError,
+			VarBinds:    m.PDU.VarBinds,
+		}
+	} else {
+		ctx.tree = a.callback()
+		if resp = ctx.process(m.PDU); resp == nil {
+			return nil
+		}
+	}
+
+	req := m.PDU
+	out := a.v3Response(m, resp)
+	return marshalResponse(func() ([]byte, error) { return out.marshal(u.keys) }, resp, req)
+}
+
+// v3Response builds a response to an SNMPv3 request.
+func (a *Agent) v3Response(m *v3Message, pdu *PDU) *v3Message {
+	return &v3Message{
+		MsgID:           m.MsgID,
+		MaxSize:         maxMessageSize,
+		Flags:           m.Flags &^ v3FlagReportable,
+		EngineID:        a.EngineID,
+		EngineBoots:     a.EngineBoots,
+		EngineTime:      a.engineTime(),
+		UserName:        m.UserName,
+		ContextEngineID: a.EngineID,
+		ContextName:     m.ContextName,
+		PDU:             pdu,
+	}
+}
+
+// report builds a Report-PDU incrementing one of the usmStats counters, if
+// the request asked for one. Reports are only authenticated if keys are given.
+func (a *Agent) report(m *v3Message, stat OID, keys *usmKeys) []byte {
+	a.mu.Lock()
+	a.usmStats[stat.String()] += 1
+	count := a.usmStats[stat.String()]
+	a.mu.Unlock()
+
+	logger.Debug(fmt.Sprintf("Reporting %s for SNMPv3 user %q", stat, m.UserName))
+
+	if m.Flags&v3FlagReportable == 0 {
+		return nil
+	}
+
+	pdu := &PDU{
+		Type:     AsnReport,
+		VarBinds: []VarBind{{stat, AsnCounter32, count}},
+	}
+	if m.PDU != nil {
+		pdu.RequestID = m.PDU.RequestID
+	}
+
+	resp := a.v3Response(m, pdu)
+	resp.Flags = 0
+	if keys != nil {
+		resp.Flags = v3FlagAuth
+	}
+
+	b, err := resp.marshal(keys)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// randomEngineID generates an engine ID in the format of RFC 3411, using the
+// net-snmp enterprise number and random octets.
+func randomEngineID() []byte {
+	var id = []byte{0x80, 0x00, 0x1f, 0x88, 0x80, 0, 0, 0, 0, 0, 0, 0, 0}
+	rand.Read(id[5:])
+	return id
+}
@@ -0,0 +1,457 @@
+package snmptools
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+)
+
+var (
+	// Encoding errors
+	MalformedBER = fmt.Errorf("Malformed BER encoding")
+	TrailingData = fmt.Errorf("Unexpected data after BER value")
+)
+
+// berLength encodes the length of a BER value, in short or long form.
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// berTLV builds a complete tag-length-value encoding from a tag and the
+// concatenation of one or more pieces of content.
+func berTLV(tag byte, content ...[]byte) []byte {
+	var n int
+	for _, c := range content {
+		n += len(c)
+	}
+
+	length := berLength(n)
+	b := make([]byte, 0, 1+len(length)+n)
+	b = append(b, tag)
+	b = append(b, length...)
+	for _, c := range content {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// berInt encodes the content of a two's complement INTEGER in as few
+// bytes as possible.
+func berInt(v int64) []byte {
+	var b = []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return b
+}
+
+// berUint encodes the content of an unsigned value (Counter32, Gauge32,
+// Counter64 etc.); these are INTEGERs too, so they may need a leading zero.
+func berUint(v uint64) []byte {
+	var b = []byte{byte(v)}
+	for v > 0x7f {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return b
+}
+
+// berOID encodes the content of an OBJECT IDENTIFIER.
+func berOID(oid OID) ([]byte, error) {
+	var b []byte
+
+	switch {
+	case len(oid) == 0:
+		return []byte{0}, nil
+	case oid[0] > 2 || (len(oid) > 1 && oid[0] < 2 && oid[1] >= 40):
+		return nil, BadOID
+	case len(oid) == 1:
+		b = berBase128(b, oid[0]*40)
+	default:
+		b = berBase128(b, oid[0]*40+oid[1])
+	}
+
+	for i := 2; i < len(oid); i += 1 {
+		b = berBase128(b, oid[i])
+	}
+	return b, nil
+}
+
+func berBase128(b []byte, v uint32) []byte {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i -= 1
+		tmp[i] = 0x80 | byte(v&0x7f)
+	}
+	return append(b, tmp[i:]...)
+}
+
+// berRead reads one tag-length-value from the front of b, returning the tag,
+// the content and whatever follows the value.
+func berRead(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, MalformedBER
+	}
+
+	tag = b[0]
+	if tag&0x1f == 0x1f {
+		// Multi-byte tags are not used by SNMP
+		return 0, nil, nil, MalformedBER
+	}
+
+	var (
+		length = int(b[1])
+		offset = 2
+	)
+
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(b) < 2+n {
+			// Indefinite lengths are not allowed, and nothing is that large
+			return 0, nil, nil, MalformedBER
+		}
+		length = 0
+		for _, c := range b[2 : 2+n] {
+			length = length<<8 | int(c)
+		}
+		offset += n
+	}
+
+	if length < 0 || len(b)-offset < length {
+		return 0, nil, nil, MalformedBER
+	}
+
+	return tag, b[offset : offset+length], b[offset+length:], nil
+}
+
+// berReadFrom reads one complete tag-length-value from a stream, such as a TCP
+// connection. Values larger than maxMessageSize are rejected.
+func berReadFrom(r io.Reader) ([]byte, error) {
+	var header = make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, MalformedBER
+		}
+
+		header = header[:2+n]
+		if _, err := io.ReadFull(r, header[2:]); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, c := range header[2:] {
+			length = length<<8 | int(c)
+		}
+	}
+
+	if length < 0 || length > maxMessageSize {
+		return nil, MalformedBER
+	}
+
+	b := make([]byte, len(header)+length)
+	copy(b, header)
+	if _, err := io.ReadFull(r, b[len(header):]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// berExpect reads one value from the front of b and checks its tag.
+func berExpect(b []byte, tag byte) (content, rest []byte, err error) {
+	var t byte
+	if t, content, rest, err = berRead(b); err != nil {
+		return nil, nil, err
+	} else if t != tag {
+		return nil, nil, fmt.Errorf("%w: expected tag 0x%02x, got 0x%02x", MalformedBER, tag, t)
+	}
+	return content, rest, nil
+}
+
+// berReadInt reads an INTEGER from the front of b.
+func berReadInt(b []byte) (int64, []byte, error) {
+	content, rest, err := berExpect(b, byte(AsnInteger))
+	if err != nil {
+		return 0, nil, err
+	}
+	i, err := berParseInt(content)
+	return i, rest, err
+}
+
+// berParseInt decodes the content of an INTEGER.
+func berParseInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, MalformedBER
+	}
+
+	// Sign-extend from the first byte
+	var v = int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+// berParseUint decodes the content of an unsigned INTEGER.
+func berParseUint(b []byte) (uint64, error) {
+	if len(b) > 0 && b[0] == 0 {
+		// Strip the leading zero that keeps the value positive
+		b = b[1:]
+	}
+	if len(b) > 8 {
+		return 0, MalformedBER
+	}
+
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// berParseOID decodes the content of an OBJECT IDENTIFIER.
+func berParseOID(b []byte) (OID, error) {
+	var (
+		oid = make(OID, 0, len(b)+1)
+		v   uint64
+	)
+
+	for i, c := range b {
+		v = v<<7 | uint64(c&0x7f)
+		if v > math.MaxUint32 {
+			return nil, BadOID
+		}
+
+		if c&0x80 != 0 {
+			if i == len(b)-1 {
+				return nil, BadOID
+			}
+			continue
+		}
+
+		if len(oid) == 0 {
+			// The first sub-identifier packs in the first two arcs
+			switch {
+			case v < 40:
+				oid = append(oid, 0, uint32(v))
+			case v < 80:
+				oid = append(oid, 1, uint32(v-40))
+			default:
+				oid = append(oid, 2, uint32(v-80))
+			}
+		} else {
+			oid = append(oid, uint32(v))
+		}
+		v = 0
+	}
+
+	return oid, nil
+}
+
+// berValue encodes a typed value as a complete tag-length-value.
+//
+// A few Go types are accepted for each AsnType: integers of any size for the
+// numeric types, strings or byte slices for OCTET STRINGs, OIDs or dotted
+// strings for OBJECT IDENTIFIERs, and net.IPs or dotted strings for
+// IpAddresses. Values out of range for their type are rejected.
+func berValue(t AsnType, v interface{}) ([]byte, error) {
+	switch t {
+	case AsnInteger:
+		if i, ok := toInt64(v); !ok || i < math.MinInt32 || i > math.MaxInt32 {
+			return nil, badValue(t, v)
+		} else {
+			return berTLV(byte(t), berInt(i)), nil
+		}
+
+	case AsnCounter32, AsnGauge32, AsnTimeTicks, AsnUinteger32:
+		if u, ok := toUint64(v); !ok || u > math.MaxUint32 {
+			return nil, badValue(t, v)
+		} else {
+			return berTLV(byte(t), berUint(u)), nil
+		}
+
+	case AsnCounter64:
+		if u, ok := toUint64(v); !ok {
+			return nil, badValue(t, v)
+		} else {
+			return berTLV(byte(t), berUint(u)), nil
+		}
+
+	case AsnOctetString, AsnOpaque, AsnBitString, AsnNsapAddress:
+		switch s := v.(type) {
+		case string:
+			return berTLV(byte(t), []byte(s)), nil
+		case []byte:
+			return berTLV(byte(t), s), nil
+		case fmt.Stringer:
+			return berTLV(byte(t), []byte(s.String())), nil
+		}
+
+	case AsnObjectIdentifier:
+		var oid OID
+		switch o := v.(type) {
+		case OID:
+			oid = o
+		case []uint32:
+			oid = o
+		case string:
+			var err error
+			if oid, err = NewOIDFromString(o); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, badValue(t, v)
+		}
+		if b, err := berOID(oid); err != nil {
+			return nil, err
+		} else {
+			return berTLV(byte(t), b), nil
+		}
+
+	case AsnIpAddress:
+		var ip net.IP
+		switch a := v.(type) {
+		case net.IP:
+			ip = a
+		case []byte:
+			ip = net.IP(a)
+		case string:
+			ip = net.ParseIP(a)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return berTLV(byte(t), ip4), nil
+		}
+
+	case AsnNull, AsnNoSuchObject, AsnNoSuchInstance, AsnEndOfMibView:
+		return berTLV(byte(t)), nil
+	}
+
+	return nil, badValue(t, v)
+}
+
+// canonicalValue returns the value of a leaf as berParseValue would decode
+// it, whichever of the forms accepted by berValue it is held in, so that it
+// can be written out as text. It fails for values that cannot be encoded.
+func canonicalValue(leaf *SMILeaf) (interface{}, error) {
+	b, err := berValue(leaf.asnType, leaf.value)
+	if err != nil {
+		return nil, err
+	}
+
+	content, _, err := berExpect(b, byte(leaf.asnType))
+	if err != nil {
+		return nil, err
+	}
+	return berParseValue(leaf.asnType, content)
+}
+
+// berParseValue decodes the content of a typed value.
+//
+// Values are decoded to int for INTEGER, uint32 for Counter32, Gauge32,
+// TimeTicks and UInteger32, uint64 for Counter64, []byte for OCTET STRING,
+// Opaque and BIT STRING, OID for OBJECT IDENTIFIER, net.IP for IpAddress and nil
+// for NULL and the exception types.
+func berParseValue(t AsnType, b []byte) (interface{}, error) {
+	switch t {
+	case AsnInteger:
+		if i, err := berParseInt(b); err != nil || i < math.MinInt32 || i > math.MaxInt32 {
+			return nil, MalformedBER
+		} else {
+			return int(i), nil
+		}
+
+	case AsnCounter32, AsnGauge32, AsnTimeTicks, AsnUinteger32:
+		if u, err := berParseUint(b); err != nil || u > math.MaxUint32 {
+			return nil, MalformedBER
+		} else {
+			return uint32(u), nil
+		}
+
+	case AsnCounter64:
+		return berParseUint(b)
+
+	case AsnOctetString, AsnOpaque, AsnBitString, AsnNsapAddress:
+		v := make([]byte, len(b))
+		copy(v, b)
+		return v, nil
+
+	case AsnObjectIdentifier:
+		return berParseOID(b)
+
+	case AsnIpAddress:
+		if len(b) != 4 {
+			return nil, MalformedBER
+		}
+		return net.IPv4(b[0], b[1], b[2], b[3]).To4(), nil
+
+	case AsnNull, AsnNoSuchObject, AsnNoSuchInstance, AsnEndOfMibView:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown value type 0x%02x", MalformedBER, byte(t))
+}
+
+func badValue(t AsnType, v interface{}) error {
+	return fmt.Errorf("%w: cannot use %T value %v as %s", BadValType, v, v, t.PrettyString())
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch i := v.(type) {
+	case int:
+		return int64(i), true
+	case int8:
+		return int64(i), true
+	case int16:
+		return int64(i), true
+	case int32:
+		return int64(i), true
+	case int64:
+		return i, true
+	case uint8:
+		return int64(i), true
+	case uint16:
+		return int64(i), true
+	case uint32:
+		return int64(i), true
+	case uint:
+		return int64(i), i <= math.MaxInt64
+	case uint64:
+		return int64(i), i <= math.MaxInt64
+	}
+	return 0, false
+}
+
+func toUint64(v interface{}) (uint64, bool) {
+	switch i := v.(type) {
+	case uint:
+		return uint64(i), true
+	case uint8:
+		return uint64(i), true
+	case uint16:
+		return uint64(i), true
+	case uint32:
+		return uint64(i), true
+	case uint64:
+		return i, true
+	}
+	if i, ok := toInt64(v); ok && i >= 0 {
+		return uint64(i), true
+	}
+	return 0, false
+}
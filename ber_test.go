@@ -0,0 +1,130 @@
+package snmptools
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// Test encoding values against known BER encodings
+func TestBERValues(t *testing.T) {
+	type berTest struct {
+		typ     AsnType
+		value   interface{}
+		encoded string
+		decoded interface{}
+	}
+
+	tests := []berTest{
+		{AsnInteger, 0, "020100", 0},
+		{AsnInteger, 127, "02017f", 127},
+		{AsnInteger, 128, "02020080", 128},
+		{AsnInteger, -1, "0201ff", -1},
+		{AsnInteger, -129, "0202ff7f", -129},
+		{AsnCounter32, uint32(4294967295), "410500ffffffff", uint32(4294967295)},
+		{AsnGauge32, 300, "4202012c", uint32(300)},
+		{AsnCounter64, uint64(1) << 63, "4609008000000000000000", uint64(1) << 63},
+		{AsnOctetString, "abc", "0403616263", []byte("abc")},
+		{AsnOctetString, []byte{}, "0400", []byte{}},
+		{AsnObjectIdentifier, NewOID(1, 3, 6, 1, 4, 1, 898889), "06082b06010401b6ee49", NewOID(1, 3, 6, 1, 4, 1, 898889)},
+		{AsnObjectIdentifier, ".1.3.6.1", "06032b0601", NewOID(1, 3, 6, 1)},
+		{AsnIpAddress, "192.168.0.1", "4004c0a80001", net.IP{192, 168, 0, 1}},
+		{AsnNull, nil, "0500", nil},
+		{AsnEndOfMibView, nil, "8200", nil},
+	}
+
+	for _, test := range tests {
+		b, err := berValue(test.typ, test.value)
+		if err != nil {
+			t.Errorf("Encoding %v as %s: %s", test.value, test.typ.PrettyString(), err)
+			continue
+		}
+
+		if enc := hex.EncodeToString(b); enc != test.encoded {
+			t.Errorf("Encoding %v as %s: got %s, wanted %s", test.value, test.typ.PrettyString(), enc, test.encoded)
+		}
+
+		tag, content, rest, err := berRead(b)
+		if err != nil || len(rest) != 0 || AsnType(tag) != test.typ {
+			t.Errorf("Reading back %x: tag %x, rest %x, err %v", b, tag, rest, err)
+			continue
+		}
+
+		if v, err := berParseValue(AsnType(tag), content); err != nil {
+			t.Errorf("Decoding %x: %s", b, err)
+		} else if !reflect.DeepEqual(v, test.decoded) {
+			t.Errorf("Decoding %x: got %#v, wanted %#v", b, v, test.decoded)
+		}
+	}
+}
+
+// Test that values are range-checked against their types
+func TestBERBadValues(t *testing.T) {
+	type berTest struct {
+		typ   AsnType
+		value interface{}
+	}
+
+	tests := []berTest{
+		{AsnInteger, int64(1) << 40},
+		{AsnInteger, "1"},
+		{AsnCounter32, -1},
+		{AsnGauge32, uint64(1) << 32},
+		{AsnIpAddress, "not an address"},
+		{AsnObjectIdentifier, 7},
+		{AsnOctetString, 7},
+	}
+
+	for _, test := range tests {
+		if _, err := berValue(test.typ, test.value); !errors.Is(err, BadValType) {
+			t.Errorf("Encoding %#v as %s: expected BadValType, got %v", test.value, test.typ.PrettyString(), err)
+		}
+	}
+}
+
+// Test long-form lengths
+func TestBERLength(t *testing.T) {
+	content := bytes.Repeat([]byte{'x'}, 300)
+	b := berTLV(byte(AsnOctetString), content)
+
+	if !bytes.Equal(b[:4], []byte{0x04, 0x82, 0x01, 0x2c}) {
+		t.Errorf("Bad long-form length: %x", b[:4])
+	}
+
+	if _, c, _, err := berRead(b); err != nil || !bytes.Equal(c, content) {
+		t.Errorf("Could not read back long-form value: %v", err)
+	}
+
+	if _, _, _, err := berRead(b[:100]); err == nil {
+		t.Error("Expected an error reading a truncated value")
+	}
+}
+
+// Test decoding a typical GetRequest for sysDescr.0
+func TestUnmarshalMessage(t *testing.T) {
+	// As sent by: snmpget -v2c -c public localhost .1.3.6.1.2.1.1.1.0
+	packet, _ := hex.DecodeString("302902010104067075626c6963a01c02040d1b3e6b020100020100300e300c06082b060102010101000500")
+
+	m, err := UnmarshalMessage(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Version != Version2c || m.Community != "public" {
+		t.Errorf("Bad message header: %s %s", m.Version, m.Community)
+	}
+	if m.PDU.Type != AsnGetRequest || m.PDU.RequestID != 0x0d1b3e6b || len(m.PDU.VarBinds) != 1 {
+		t.Fatalf("Bad PDU: %#v", m.PDU)
+	}
+	if vb := m.PDU.VarBinds[0]; !vb.OID.Equals(NewOID(1, 3, 6, 1, 2, 1, 1, 1, 0)) || vb.Type != AsnNull {
+		t.Errorf("Bad varbind: %s", vb)
+	}
+
+	// And it should encode back to exactly the same bytes
+	if b, err := m.Marshal(); err != nil || !bytes.Equal(b, packet) {
+		t.Errorf("Re-encoding gave %x, %v", b, err)
+	}
+}
@@ -0,0 +1,153 @@
+package snmptools
+
+import "fmt"
+
+// VarBind is a variable binding: an OID paired with a typed value, as carried
+// in SNMP PDUs.
+//
+// Exception values such as noSuchObject and endOfMibView are represented by
+// their AsnType with a nil Value.
+type VarBind struct {
+	OID   OID
+	Type  AsnType
+	Value interface{}
+}
+
+// NewVarBind() creates a VarBind from an OID and the SMILeaf found there.
+func NewVarBind(oid OID, leaf *SMILeaf) VarBind {
+	return VarBind{oid, leaf.asnType, leaf.value}
+}
+
+// IsException() reports whether the VarBind holds one of the
+// noSuchObject, noSuchInstance or endOfMibView exceptions rather than a value.
+func (vb VarBind) IsException() bool {
+	return vb.Type == AsnNoSuchObject || vb.Type == AsnNoSuchInstance || vb.Type == AsnEndOfMibView
+}
+
+func (vb VarBind) String() string {
+	return fmt.Sprintf("%s = %s: %v", vb.OID, vb.Type.PrettyString(), vb.Value)
+}
+
+// GetBulk() performs a GETBULK request against an SMI tree, as specified in
+// RFC 3416 section 4.2.3.
+//
+// The OIDs are relative to node, as are the OIDs of the returned VarBinds.
+// The first nonRepeaters OIDs are each answered with a single GETNEXT; the
+// remaining OIDs are each walked for up to maxRepetitions steps.
+//
+// The result is the flattened varbind matrix in the order it is sent over the
+// wire: first the non-repeaters, then one row of repeaters per repetition.
+// Once a repeater walks off the end of the tree it yields endOfMibView with the
+// last OID it reached, and the response is truncated after the first
+// repetition that consists entirely of endOfMibView.
+//
+// maxRepetitions is capped so that the result could still fit in the largest
+// message, however small its varbinds.
+func GetBulk(node SMINode, nonRepeaters, maxRepetitions int, oids []OID) []VarBind {
+	return getBulk(node, nil, nonRepeaters, maxRepetitions, oids, nil)
+}
+
+// minVarBindSize is the size of the smallest encoded varbind, a SEQUENCE
+// holding an empty OID and a NULL, which bounds the varbinds a message can hold.
+const minVarBindSize = 6
+
+// getBulk implements GetBulk for a tree located at root. The requested OIDs
+// and those of the result are absolute, and need not be beneath root. If
+// accept is not nil, leaves it rejects are skipped over.
+func getBulk(node SMINode, root OID, nonRepeaters, maxRepetitions int, oids []OID, accept func(vb VarBind) bool) []VarBind {
+	var (
+		n  = nonRepeaters
+		m  = maxRepetitions
+		it = NewIterator(node)
+	)
+
+	if n < 0 {
+		n = 0
+	} else if n > len(oids) {
+		n = len(oids)
+	}
+	if m < 0 {
+		m = 0
+	}
+
+	var (
+		r      = len(oids) - n
+		result []VarBind
+	)
+
+	// Larger requests could never be answered, and would only use up memory
+	if limit := maxMessageSize/minVarBindSize - n; r > 0 && m > limit/r {
+		m = limit / r
+	}
+
+	// Non-repeaters are a plain GETNEXT each
+	for _, oid := range oids[:n] {
+		seekFrom(it, root, oid)
+		result = append(result, nextVarBind(it, root, oid, accept))
+	}
+
+	if r == 0 {
+		return result
+	}
+
+	// Each repeater gets its own iterator, so that walking it for M steps
+	// does not re-descend the tree
+	var (
+		repeaters = make([]*Iterator, r)
+		last      = make([]OID, r)
+	)
+	for j, oid := range oids[n:] {
+		repeaters[j] = NewIterator(node)
+		seekFrom(repeaters[j], root, oid)
+		last[j] = oid
+	}
+
+	for i := 0; i < m; i += 1 {
+		allEnded := true
+
+		for j, it := range repeaters {
+			vb := nextVarBind(it, root, last[j], accept)
+			if vb.Type != AsnEndOfMibView {
+				allEnded = false
+			}
+			last[j] = vb.OID
+			result = append(result, vb)
+		}
+
+		if allEnded {
+			break
+		}
+	}
+
+	return result
+}
+
+// seekFrom positions an iterator over the tree at root so that it continues
+// after oid, which may be anywhere in the OID space.
+func seekFrom(it *Iterator, root, oid OID) {
+	if rel, err := oid.GetRemainder(root); err == nil {
+		it.Seek(rel)
+	} else if oid.Compare(root) < 0 {
+		// The whole tree comes after oid
+		it.Seek(nil)
+	} else {
+		// The whole tree comes before oid
+		it.exhaust()
+	}
+}
+
+// nextVarBind returns the next leaf from an iterator over the tree at root as a
+// VarBind, or an endOfMibView VarBind named by oid if the iterator is
+// exhausted. If accept is not nil, leaves it rejects are skipped over.
+func nextVarBind(it *Iterator, root, oid OID, accept func(vb VarBind) bool) VarBind {
+	for {
+		next, leaf := it.Next()
+		if next == nil {
+			return VarBind{OID: oid, Type: AsnEndOfMibView}
+		}
+
+		if vb := NewVarBind(root.Add(next...), leaf); accept == nil || accept(vb) {
+			return vb
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package snmptools
+
+import (
+	"testing"
+)
+
+// Test GETBULK with a mix of non-repeaters and repeaters
+func TestGetBulk(t *testing.T) {
+	var O = NewOID
+
+	// Two short "columns" and a scalar
+	tree := NewSMISubtree(
+		NewLeafNode(NewSMILeaf(AsnInteger, 100)),
+		NewSMISubtree(
+			NewLeafNode(NewSMILeaf(AsnInteger, 11)),
+			NewLeafNode(NewSMILeaf(AsnInteger, 12)),
+		),
+		NewSMISubtree(
+			NewLeafNode(NewSMILeaf(AsnInteger, 21)),
+			NewLeafNode(NewSMILeaf(AsnInteger, 22)),
+		),
+	)
+
+	type bulkTest struct {
+		nonRepeaters, maxRepetitions int
+		oids                         []OID
+		expected                     []VarBind
+	}
+
+	var (
+		end = func(oid OID) VarBind { return VarBind{oid, AsnEndOfMibView, nil} }
+		vb  = func(oid OID, v int) VarBind { return VarBind{oid, AsnInteger, v} }
+	)
+
+	tests := []bulkTest{
+		// Plain GETNEXT behaviour
+		{1, 0, []OID{O()}, []VarBind{vb(O(1), 100)}},
+		// Non-repeaters past the end return endOfMibView with the requested OID
+		{1, 5, []OID{O(4)}, []VarBind{end(O(4))}},
+		// Two repeaters side by side
+		{1, 2, []OID{O(), O(2), O(3)}, []VarBind{
+			vb(O(1), 100),
+			vb(O(2, 1), 11), vb(O(3, 1), 21),
+			vb(O(2, 2), 12), vb(O(3, 2), 22),
+		}},
+		// One repeater runs off the end; truncated after an all-endOfMibView row
+		{0, 10, []OID{O(2, 2), O(3)}, []VarBind{
+			vb(O(3, 1), 21), vb(O(3, 1), 21),
+			vb(O(3, 2), 22), vb(O(3, 2), 22),
+			end(O(3, 2)), end(O(3, 2)),
+		}},
+		// Negative values are treated as zero
+		{-1, -1, []OID{O(1)}, []VarBind{}},
+		// More non-repeaters than OIDs
+		{5, 5, []OID{O(1), O(2, 1)}, []VarBind{vb(O(2, 1), 11), vb(O(2, 2), 12)}},
+	}
+
+	for _, test := range tests {
+		result := GetBulk(tree, test.nonRepeaters, test.maxRepetitions, test.oids)
+
+		if len(result) != len(test.expected) {
+			t.Errorf("GetBulk(%d, %d, %v): got %d varbinds %v, wanted %d", test.nonRepeaters, test.maxRepetitions, test.oids, len(result), result, len(test.expected))
+			continue
+		}
+
+		for i, vb := range result {
+			expected := test.expected[i]
+			if !vb.OID.Equals(expected.OID) || vb.Type != expected.Type || vb.Value != expected.Value {
+				t.Errorf("GetBulk(%d, %d, %v): varbind %d is %s, wanted %s", test.nonRepeaters, test.maxRepetitions, test.oids, i, vb, expected)
+			}
+		}
+	}
+}
+
+// Test that huge max-repetitions are capped to what a message could hold
+func TestGetBulkLimit(t *testing.T) {
+	var (
+		column = NewSMISparseSubtree()
+		maxInt = int(^uint(0) >> 1)
+		limit  = maxMessageSize / minVarBindSize
+	)
+
+	for i := uint32(1); i <= uint32(limit)+10; i += 1 {
+		column.SetChild(i, NewLeafNode(NewSMILeaf(AsnInteger, 1)))
+	}
+
+	if result := GetBulk(column, 0, maxInt, []OID{NewOID()}); len(result) != limit {
+		t.Errorf("Expected %d varbinds, got %d", limit, len(result))
+	}
+	if result := GetBulk(column, 1, maxInt, []OID{NewOID(), NewOID(), NewOID()}); len(result) != 1+(limit-1)/2*2 {
+		t.Errorf("Expected %d varbinds, got %d", 1+(limit-1)/2*2, len(result))
+	}
+}
@@ -0,0 +1,449 @@
+package snmptools
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// Client errors
+	RequestTimeout   = fmt.Errorf("Request timed out")
+	NonIncreasingOID = fmt.Errorf("Agent returned a non-increasing OID while walking")
+	UnknownUser      = fmt.Errorf("Agent does not know the SNMPv3 user")
+	UnsupportedLevel = fmt.Errorf("Agent does not support the security level for the SNMPv3 user")
+	NotInTimeWindow  = fmt.Errorf("Message was outside the agent's time window")
+)
+
+// RequestError is returned by a Client when the agent answers a request with
+// an error status.
+type RequestError struct {
+	Status ErrorStatus
+	// Index is the 1-based index of the varbind that caused the error, if any
+	Index int
+	// OID is the OID of that varbind
+	OID OID
+}
+
+func (e *RequestError) Error() string {
+	if e.OID != nil {
+		return fmt.Sprintf("snmp error %s at %s", e.Status, e.OID)
+	}
+	return fmt.Sprintf("snmp error %s", e.Status)
+}
+
+// Unwrap() allows errors.Is to match a RequestError against an ErrorStatus.
+func (e *RequestError) Unwrap() error {
+	return e.Status
+}
+
+// The defaults of NewClient() and NewTrapSender(), which are also used when
+// fields are left zero
+const (
+	defaultTimeout        = 5 * time.Second
+	defaultRetries        = 2
+	defaultMaxRepetitions = 10
+)
+
+// Client is an SNMP manager: it sends requests to a single agent over UDP.
+//
+// A Client may be used from several goroutines, but requests are sent one
+// at a time.
+type Client struct {
+	// Target is the agent's host:port address; the port defaults to 161
+	Target    string
+	Community string
+	Version   SNMPVersion
+
+	// Timeout is how long to wait for each response, and Retries how many
+	// times to resend a request that is not answered. A zero Timeout is five
+	// seconds.
+	Timeout time.Duration
+	Retries int
+
+	// MaxRepetitions is used by BulkWalk and Table for each GetBulk request;
+	// zero means ten
+	MaxRepetitions int
+
+	// User is the SNMPv3 user that requests are sent as, at the highest
+	// security level it supports; it is required for Version3
+	User *USMUser
+	// ContextName is the SNMPv3 context requests are made in
+	ContextName string
+
+	mu   sync.Mutex
+	conn net.Conn
+
+	// The SNMPv3 agent's engine, learned by discovery
+	engineID    []byte
+	engineBoots int
+	engineTime  int
+	timeRef     time.Time
+	keys        *usmKeys
+}
+
+// NewClient() creates a Client with a five second timeout and two retries.
+// No packets are sent until the first request.
+func NewClient(target, community string, version SNMPVersion) *Client {
+	return &Client{
+		Target:         target,
+		Community:      community,
+		Version:        version,
+		Timeout:        defaultTimeout,
+		Retries:        defaultRetries,
+		MaxRepetitions: defaultMaxRepetitions,
+	}
+}
+
+// timeout is how long to wait for each response.
+func (c *Client) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return c.Timeout
+}
+
+// maxRepetitions is the number of objects requested from each column by a
+// GetBulk request of BulkWalk or Table.
+func (c *Client) maxRepetitions() int {
+	if c.MaxRepetitions <= 0 {
+		return defaultMaxRepetitions
+	}
+	return c.MaxRepetitions
+}
+
+// Close() releases the client's socket.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Get() retrieves the values of the given OIDs.
+//
+// With SNMPv2c, OIDs that do not exist are returned as noSuchObject or
+// noSuchInstance exceptions; with SNMPv1 they fail the whole request.
+func (c *Client) Get(oids ...OID) ([]VarBind, error) {
+	return c.request(&PDU{Type: AsnGetRequest, VarBinds: nullVarBinds(oids)})
+}
+
+// GetNext() retrieves the values of the objects following each of the given
+// OIDs.
+func (c *Client) GetNext(oids ...OID) ([]VarBind, error) {
+	return c.request(&PDU{Type: AsnGetNextRequest, VarBinds: nullVarBinds(oids)})
+}
+
+// GetBulk() sends a GetBulk request; see the GetBulk function for the layout
+// of the result. It requires SNMPv2c.
+func (c *Client) GetBulk(nonRepeaters, maxRepetitions int, oids ...OID) ([]VarBind, error) {
+	if c.Version == Version1 {
+		return nil, fmt.Errorf("%w: GetBulk cannot be sent with %s", UnsupportedVersion, c.Version)
+	}
+	return c.request(&PDU{
+		Type:           AsnGetBulkRequest,
+		NonRepeaters:   nonRepeaters,
+		MaxRepetitions: maxRepetitions,
+		VarBinds:       nullVarBinds(oids),
+	})
+}
+
+// Set() changes the values of the given varbinds, returning the agent's
+// response.
+func (c *Client) Set(varBinds ...VarBind) ([]VarBind, error) {
+	return c.request(&PDU{Type: AsnSetRequest, VarBinds: varBinds})
+}
+
+// Walk() calls fn for every object beneath root, using GetNext requests.
+//
+// If fn returns an error the walk stops and that error is returned.
+func (c *Client) Walk(root OID, fn func(vb VarBind) error) error {
+	return c.walk(root, fn, func(oid OID) ([]VarBind, error) {
+		return c.GetNext(oid)
+	})
+}
+
+// BulkWalk() calls fn for every object beneath root, using GetBulk requests
+// of MaxRepetitions objects each. With SNMPv1 it falls back to Walk().
+func (c *Client) BulkWalk(root OID, fn func(vb VarBind) error) error {
+	if c.Version == Version1 {
+		return c.Walk(root, fn)
+	}
+	return c.walk(root, fn, func(oid OID) ([]VarBind, error) {
+		return c.GetBulk(0, c.maxRepetitions(), oid)
+	})
+}
+
+func (c *Client) walk(root OID, fn func(vb VarBind) error, next func(oid OID) ([]VarBind, error)) error {
+	var oid = root
+
+	for {
+		vbs, err := next(oid)
+		if err != nil {
+			if re, ok := err.(*RequestError); ok && re.Status == NoSuchName {
+				// SNMPv1's way of saying endOfMibView
+				return nil
+			}
+			return err
+		} else if len(vbs) == 0 {
+			return nil
+		}
+
+		for _, vb := range vbs {
+			if vb.IsException() {
+				return nil
+			} else if _, err := vb.OID.GetRemainder(root); err != nil || vb.OID.Equals(root) {
+				// Walked out of the subtree
+				return nil
+			} else if vb.OID.Compare(oid) <= 0 {
+				return fmt.Errorf("%w: %s after %s", NonIncreasingOID, vb.OID, oid)
+			}
+
+			if err := fn(vb); err != nil {
+				return err
+			}
+			oid = vb.OID
+		}
+	}
+}
+
+// request sends a request PDU and waits for the matching response.
+func (c *Client) request(pdu *PDU) ([]VarBind, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, err := net.Dial("udp", targetAddress(c.Target))
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+
+	if c.Version == Version3 {
+		return c.requestV3(pdu)
+	}
+
+	pdu.RequestID = nextRequestID()
+
+	b, err := (&Message{c.Version, c.Community, pdu}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *Message
+	err = c.exchange(b, func(b []byte) bool {
+		m, err := UnmarshalMessage(b)
+		if err != nil {
+			logger.Debug(fmt.Sprintf("Ignoring bad response from %s: %s", c.Target, err))
+			return false
+		}
+		// Skip late responses to earlier requests
+		resp = m
+		return m.PDU.Type == AsnGetResponse && m.PDU.RequestID == pdu.RequestID
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.PDU.VarBinds, responseError(resp.PDU)
+}
+
+// exchange sends a request packet and reads packets until accept returns true
+// for one of them, resending the request on each timeout.
+func (c *Client) exchange(b []byte, accept func(b []byte) bool) error {
+	var buf = make([]byte, maxMessageSize)
+
+	for attempt := 0; attempt <= c.Retries; attempt += 1 {
+		if _, err := c.conn.Write(b); err != nil {
+			return err
+		}
+
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout()))
+
+		for {
+			n, err := c.conn.Read(buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			if accept(buf[:n]) {
+				return nil
+			}
+		}
+	}
+
+	return RequestTimeout
+}
+
+// requestV3 sends an SNMPv3 request, discovering the agent's engine first if
+// necessary.
+func (c *Client) requestV3(pdu *PDU) ([]VarBind, error) {
+	if c.User == nil {
+		return nil, UnknownUser
+	}
+
+	// A request may need to be repeated once after re-synchronising with
+	// the agent's engine
+	for attempt := 0; ; attempt += 1 {
+		if c.engineID == nil {
+			if err := c.discover(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := c.exchangeV3(pdu, c.User.SecurityLevel())
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.PDU.Type == AsnGetResponse {
+			return resp.PDU.VarBinds, responseError(resp.PDU)
+		}
+
+		// The agent has sent a report instead
+		var stat OID
+		if len(resp.PDU.VarBinds) > 0 {
+			stat = resp.PDU.VarBinds[0].OID
+		}
+
+		switch {
+		case stat.Equals(UsmStatsNotInTimeWindows) && attempt == 0:
+			// exchangeV3 has already updated the engine time
+			continue
+		case stat.Equals(UsmStatsUnknownEngineIDs) && attempt == 0:
+			c.engineID = nil
+			continue
+		case stat.Equals(UsmStatsNotInTimeWindows):
+			return nil, NotInTimeWindow
+		case stat.Equals(UsmStatsUnknownUserNames):
+			return nil, UnknownUser
+		case stat.Equals(UsmStatsUnsupportedSecLevels):
+			return nil, UnsupportedLevel
+		case stat.Equals(UsmStatsWrongDigests):
+			return nil, AuthenticationFailure
+		case stat.Equals(UsmStatsDecryptionErrors):
+			return nil, DecryptionFailure
+		}
+		return nil, fmt.Errorf("Agent sent a report for %s", stat)
+	}
+}
+
+// discover learns the agent's engine ID, boots and time, as described in
+// RFC 3414 section 4.
+func (c *Client) discover() error {
+	c.engineID = []byte{}
+	c.engineBoots, c.engineTime = 0, 0
+
+	resp, err := c.exchangeV3(&PDU{Type: AsnGetRequest}, NoAuthNoPriv)
+	if err != nil {
+		c.engineID = nil
+		return err
+	} else if resp.PDU.Type != AsnReport || len(resp.EngineID) == 0 {
+		c.engineID = nil
+		return fmt.Errorf("SNMPv3 engine discovery failed")
+	}
+
+	c.engineID = append([]byte(nil), resp.EngineID...)
+	c.engineBoots, c.engineTime, c.timeRef = resp.EngineBoots, resp.EngineTime, time.Now()
+	c.keys = c.User.localize(c.engineID)
+	return nil
+}
+
+// exchangeV3 sends an SNMPv3 request at the given security level and returns
+// the response or report.
+func (c *Client) exchangeV3(pdu *PDU, level SecurityLevel) (*v3Message, error) {
+	var (
+		user = c.User.Name
+		keys = c.keys
+	)
+
+	if level == NoAuthNoPriv && len(c.engineID) == 0 {
+		// Discovery is anonymous
+		user, keys = "", nil
+	}
+
+	pdu.RequestID = nextRequestID()
+	req := &v3Message{
+		MsgID:           nextRequestID(),
+		MaxSize:         maxMessageSize,
+		Flags:           levelFlags(level) | v3FlagReportable,
+		EngineID:        c.engineID,
+		EngineBoots:     c.engineBoots,
+		EngineTime:      c.engineTime + int(time.Since(c.timeRef)/time.Second),
+		UserName:        user,
+		ContextEngineID: c.engineID,
+		ContextName:     c.ContextName,
+		PDU:             pdu,
+	}
+	if c.timeRef.IsZero() {
+		req.EngineTime = 0
+	}
+
+	b, err := req.marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *v3Message
+	err = c.exchange(b, func(b []byte) bool {
+		m, err := unmarshalV3Message(b)
+		if err != nil || m.MsgID != req.MsgID {
+			return false
+		}
+
+		if err := m.open(keys, level); err != nil {
+			logger.Debug(fmt.Sprintf("Ignoring SNMPv3 response from %s: %s", c.Target, err))
+			return false
+		}
+
+		if m.level() != NoAuthNoPriv {
+			// Authenticated messages keep our notion of the agent's time
+			// up to date
+			c.engineBoots, c.engineTime, c.timeRef = m.EngineBoots, m.EngineTime, time.Now()
+		}
+
+		resp = m
+		return true
+	})
+
+	return resp, err
+}
+
+// responseError returns a RequestError for a response with an error status.
+func responseError(p *PDU) error {
+	if p.ErrorStatus == NoError {
+		return nil
+	}
+
+	err := &RequestError{Status: p.ErrorStatus, Index: p.ErrorIndex}
+	if p.ErrorIndex > 0 && p.ErrorIndex <= len(p.VarBinds) {
+		err.OID = p.VarBinds[p.ErrorIndex-1].OID
+	}
+	return err
+}
+
+// nullVarBinds makes request varbinds for a list of OIDs.
+func nullVarBinds(oids []OID) []VarBind {
+	var vbs = make([]VarBind, len(oids))
+	for i, oid := range oids {
+		vbs[i] = VarBind{OID: oid, Type: AsnNull}
+	}
+	return vbs
+}
+
+// targetAddress adds the standard agent port to an address lacking one.
+func targetAddress(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, "161")
+	}
+	return addr
+}
@@ -0,0 +1,250 @@
+package snmptools
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+var testAgentRoot = NewOID(1, 3, 6, 1, 4, 1, 898889)
+
+// writableLeaf is a leaf that accepts integer SETs
+type writableLeaf struct {
+	leaf *SMILeaf
+}
+
+func (w *writableLeaf) Children() []SMINode { return nil }
+func (w *writableLeaf) Value() *SMILeaf     { return w.leaf }
+
+func (w *writableLeaf) Set(oid OID, leaf *SMILeaf) error {
+	if len(oid) != 0 {
+		return NoCreation
+	} else if leaf.Type() != AsnInteger {
+		return WrongType
+	}
+	w.leaf = leaf
+	return nil
+}
+
+// newTestTree builds a small tree:
+//
+//	.1.1 = "test", .1.2 = Counter64 7, .1.3 = writable integer 0
+//	.2.1 ... .2.25 = integers 1 ... 25
+func newTestTree() SMINode {
+	column := NewSMISubtree()
+	for i := 1; i <= 25; i += 1 {
+		column.AddChild(NewLeafNode(NewSMILeaf(AsnInteger, i)))
+	}
+
+	return NewSMISubtree(
+		NewSMISubtree(
+			NewLeafNode(NewSMILeaf(AsnOctetString, "test")),
+			NewLeafNode(&SMILeaf{AsnCounter64, uint64(7)}),
+			&writableLeaf{NewSMILeaf(AsnInteger, 0)},
+		),
+		column,
+	)
+}
+
+// startTestAgent serves the test tree on a local port at testAgentRoot, and
+// returns the agent and its address.
+func startTestAgent(t *testing.T) (*Agent, string) {
+	tree := newTestTree()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := NewAgent(testAgentRoot, func() SMINode { return tree })
+	agent.WriteCommunity = "private"
+	go agent.Serve(conn)
+	t.Cleanup(func() { agent.Close() })
+
+	return agent, conn.LocalAddr().String()
+}
+
+func newTestClient(t *testing.T, addr, community string, version SNMPVersion) *Client {
+	client := NewClient(addr, community, version)
+	client.Timeout = time.Second
+	client.Retries = 0
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Test Get and GetNext with SNMPv2c
+func TestClientGet(t *testing.T) {
+	var (
+		_, addr = startTestAgent(t)
+		client  = newTestClient(t, addr, "public", Version2c)
+		root    = testAgentRoot
+	)
+
+	vbs, err := client.Get(root.Add(1, 1), root.Add(2, 30), root.Add(9, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(vbs[0].Value.([]byte)) != "test" {
+		t.Errorf("Bad value for %s: %s", vbs[0].OID, vbs[0])
+	}
+	if vbs[1].Type != AsnNoSuchInstance || vbs[2].Type != AsnNoSuchObject {
+		t.Errorf("Expected noSuchInstance and noSuchObject, got %v", vbs[1:])
+	}
+
+	vbs, err = client.GetNext(root, root.Add(1, 3), root.Add(2, 25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vbs[0].OID.Equals(root.Add(1, 1)) || !vbs[1].OID.Equals(root.Add(2, 1)) || vbs[2].Type != AsnEndOfMibView {
+		t.Errorf("Bad GetNext results: %v", vbs)
+	}
+}
+
+// Test SNMPv1 error handling
+func TestClientV1(t *testing.T) {
+	var (
+		_, addr = startTestAgent(t)
+		client  = newTestClient(t, addr, "public", Version1)
+		root    = testAgentRoot
+	)
+
+	_, err := client.Get(root.Add(1, 1), root.Add(9, 1))
+	if re, ok := err.(*RequestError); !ok || re.Status != NoSuchName || re.Index != 2 {
+		t.Errorf("Expected noSuchName at index 2, got %v", err)
+	}
+
+	// Counter64 objects are invisible to SNMPv1
+	vbs, err := client.GetNext(root.Add(1, 1))
+	if err != nil || !vbs[0].OID.Equals(root.Add(1, 3)) {
+		t.Errorf("Expected GetNext to skip the Counter64, got %v, %v", vbs, err)
+	}
+
+	var cnt int
+	if err := client.BulkWalk(root, func(vb VarBind) error {
+		cnt += 1
+		return nil
+	}); err != nil || cnt != 27 {
+		t.Errorf("Walked %d objects with error %v, wanted 27", cnt, err)
+	}
+}
+
+// Test GetBulk and BulkWalk
+func TestClientBulkWalk(t *testing.T) {
+	var (
+		_, addr = startTestAgent(t)
+		client  = newTestClient(t, addr, "public", Version2c)
+		root    = testAgentRoot
+	)
+
+	vbs, err := client.GetBulk(1, 3, root.Add(1), root.Add(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vbs) != 4 || !vbs[0].OID.Equals(root.Add(1, 1)) || !vbs[3].OID.Equals(root.Add(2, 3)) {
+		t.Errorf("Bad GetBulk results: %v", vbs)
+	}
+
+	// The agent caps max-repetitions rather than running out of memory
+	if vbs, err := client.GetBulk(0, 1<<30, root.Add(2)); err != nil {
+		t.Fatal(err)
+	} else if len(vbs) == 0 || vbs[len(vbs)-1].Type != AsnEndOfMibView {
+		t.Errorf("Bad GetBulk results with huge max-repetitions: %v", vbs)
+	}
+
+	var walked []VarBind
+	client.MaxRepetitions = 4
+	err = client.BulkWalk(root.Add(2), func(vb VarBind) error {
+		walked = append(walked, vb)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(walked) != 25 {
+		t.Fatalf("Walked %d objects, wanted 25", len(walked))
+	}
+	for i, vb := range walked {
+		if !vb.OID.Equals(root.Add(2, uint32(i+1))) || vb.Value != i+1 {
+			t.Errorf("Bad walk result %d: %s", i, vb)
+		}
+	}
+
+	// A client with no timeout or max-repetitions uses the defaults
+	literal := &Client{Target: addr, Community: "public", Version: Version2c}
+	t.Cleanup(func() { literal.Close() })
+	walked = nil
+	err = literal.BulkWalk(root.Add(2), func(vb VarBind) error {
+		walked = append(walked, vb)
+		return nil
+	})
+	if err != nil || len(walked) != 25 {
+		t.Errorf("Walked %d objects with error %v, wanted 25", len(walked), err)
+	}
+}
+
+// Test Set with and without write access
+func TestClientSet(t *testing.T) {
+	var (
+		_, addr = startTestAgent(t)
+		reader  = newTestClient(t, addr, "public", Version2c)
+		writer  = newTestClient(t, addr, "private", Version2c)
+		target  = testAgentRoot.Add(1, 3)
+	)
+
+	if _, err := reader.Set(VarBind{target, AsnInteger, 5}); !errors.Is(err, NoAccess) {
+		t.Errorf("Expected noAccess with the read community, got %v", err)
+	}
+
+	if _, err := writer.Set(VarBind{target, AsnInteger, 5}); err != nil {
+		t.Fatal(err)
+	}
+	if vbs, err := reader.Get(target); err != nil || vbs[0].Value != 5 {
+		t.Errorf("Set did not take effect: %v, %v", vbs, err)
+	}
+
+	if _, err := writer.Set(VarBind{target, AsnOctetString, "five"}); !errors.Is(err, WrongType) {
+		t.Errorf("Expected wrongType, got %v", err)
+	}
+	if _, err := writer.Set(VarBind{testAgentRoot.Add(1, 1), AsnOctetString, "x"}); !errors.Is(err, NotWritable) {
+		t.Errorf("Expected notWritable, got %v", err)
+	}
+}
+
+// Test that requests with an unknown community time out
+func TestClientTimeout(t *testing.T) {
+	_, addr := startTestAgent(t)
+	client := newTestClient(t, addr, "wrong", Version2c)
+	client.Timeout = 100 * time.Millisecond
+
+	if _, err := client.Get(testAgentRoot.Add(1, 1)); err != RequestTimeout {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
+
+// Test that closing an agent before it serves stops it from serving
+func TestAgentCloseFirst(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := NewAgent(testAgentRoot, newTestTree)
+	agent.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- agent.Serve(conn) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return")
+	}
+	if _, err := conn.WriteTo([]byte{0}, conn.LocalAddr()); err == nil {
+		t.Errorf("Serve() did not close the connection")
+	}
+}
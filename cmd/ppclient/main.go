@@ -0,0 +1,260 @@
+// Ppclient runs a pass persist program and talks to it as snmpd would, to
+// debug extensions without snmpd in the way.
+//
+// Usage:
+//
+//	ppclient [flags] command [arguments] -- program [arguments]
+//
+// The commands are:
+//
+//	ping                 check that the program answers PING
+//	get OID...           get the value of each OID
+//	getnext OID...       get the value after each OID
+//	walk OID             get every value beneath OID
+//	set OID TYPE VALUE   set a value; TYPE is integer, gauge, counter,
+//	                     timeticks, ipaddress, objectid or string
+//
+// Every line sent and received is shown with the time since the command
+// started, followed by the results and the time each command took. Answers
+// that snmpd would not accept - missing or extra lines, unknown types, bad
+// values, and GETNEXT answers that do not increase - are reported as protocol
+// violations, and make ppclient exit with status 2.
+//
+// For example:
+//
+//	ppclient walk .1.3.6.1.4.1.898889 -- ./myextension -flag
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Learnosity/snmptools"
+)
+
+func main() {
+	var (
+		timeout = flag.Duration("timeout", 5*time.Second, "how long to wait for each line of an answer")
+		quiet   = flag.Bool("q", false, "do not show the transcript")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] command [arguments] -- program [arguments]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command, program := splitArgs(flag.Args())
+	if len(command) == 0 || len(program) == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var transcript io.Writer
+	if !*quiet {
+		transcript = os.Stdout
+	}
+
+	err := run(command, program, *timeout, transcript, os.Stdout)
+	switch {
+	case errors.Is(err, snmptools.ProtocolViolation):
+		fmt.Fprintf(os.Stderr, "ppclient: %s\n", err)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "ppclient: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// splitArgs separates the command from the program at "--".
+func splitArgs(args []string) ([]string, []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// run starts the program and runs a command against it, writing the results
+// to out.
+func run(command, program []string, timeout time.Duration, transcript, out io.Writer) error {
+	cmd := exec.Command(program[0], program[1:]...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	defer func() {
+		// snmpd stops its extensions by closing their input
+		stdin.Close()
+
+		done := make(chan struct{})
+		go func() {
+			cmd.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			cmd.Process.Kill()
+			<-done
+		}
+	}()
+
+	client := snmptools.NewPassPersistClient(stdout, stdin)
+	client.Timeout = timeout
+	client.Transcript = transcript
+
+	// Closing catches lines written after the last answer
+	err = runCommand(client, command, out)
+	if closeErr := client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// runCommand runs one command with a client.
+func runCommand(client *snmptools.PassPersistClient, command []string, out io.Writer) error {
+	var (
+		name  = command[0]
+		args  = command[1:]
+		start = time.Now()
+	)
+
+	switch {
+	case name == "ping" && len(args) == 0:
+		if err := client.Ping(); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "PONG (%s)\n", since(start))
+		return nil
+
+	case (name == "get" || name == "getnext") && len(args) > 0:
+		for _, arg := range args {
+			oid, err := snmptools.NewOIDFromString(arg)
+			if err != nil {
+				return err
+			}
+
+			var (
+				vb    snmptools.VarBind
+				ok    bool
+				start = time.Now()
+			)
+			if name == "get" {
+				vb, ok, err = client.Get(oid)
+			} else {
+				vb, ok, err = client.GetNext(oid)
+			}
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				fmt.Fprintf(out, "%s (%s)\n", formatVarBind(vb), since(start))
+			} else {
+				fmt.Fprintf(out, "%s %s: None (%s)\n", name, oid, since(start))
+			}
+		}
+		return nil
+
+	case name == "walk" && len(args) == 1:
+		root, err := snmptools.NewOIDFromString(args[0])
+		if err != nil {
+			return err
+		}
+
+		var count int
+		err = client.Walk(root, func(vb snmptools.VarBind) error {
+			fmt.Fprintln(out, formatVarBind(vb))
+			count += 1
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%d objects (%s)\n", count, since(start))
+		return nil
+
+	case name == "set" && len(args) == 3:
+		vb, err := parseVarBind(args[0], args[1], args[2])
+		if err != nil {
+			return err
+		}
+
+		if err := client.Set(vb); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "DONE (%s)\n", since(start))
+		return nil
+	}
+
+	return fmt.Errorf("bad command %q", strings.Join(command, " "))
+}
+
+func formatVarBind(vb snmptools.VarBind) string {
+	return fmt.Sprintf("%s = %s: %v", vb.OID, vb.Type.PrettyString(), vb.Value)
+}
+
+func since(start time.Time) string {
+	return time.Since(start).Round(time.Microsecond).String()
+}
+
+// parseVarBind parses the arguments of the set command.
+func parseVarBind(oidArg, typeArg, valueArg string) (snmptools.VarBind, error) {
+	var (
+		vb  snmptools.VarBind
+		err error
+	)
+
+	if vb.OID, err = snmptools.NewOIDFromString(oidArg); err != nil {
+		return vb, err
+	}
+
+	switch typeArg {
+	case "integer":
+		vb.Type = snmptools.AsnInteger
+		vb.Value, err = strconv.Atoi(valueArg)
+	case "gauge", "counter", "timeticks":
+		vb.Type = map[string]snmptools.AsnType{
+			"gauge":     snmptools.AsnGauge32,
+			"counter":   snmptools.AsnCounter32,
+			"timeticks": snmptools.AsnTimeTicks,
+		}[typeArg]
+		var u uint64
+		u, err = strconv.ParseUint(valueArg, 10, 32)
+		vb.Value = uint32(u)
+	case "ipaddress":
+		vb.Type = snmptools.AsnIpAddress
+		if vb.Value = net.ParseIP(valueArg).To4(); vb.Value.(net.IP) == nil {
+			err = fmt.Errorf("bad IP address %q", valueArg)
+		}
+	case "objectid":
+		vb.Type = snmptools.AsnObjectIdentifier
+		vb.Value, err = snmptools.NewOIDFromString(valueArg)
+	case "string":
+		vb.Type, vb.Value = snmptools.AsnOctetString, valueArg
+	default:
+		err = fmt.Errorf("unknown type %q", typeArg)
+	}
+
+	return vb, err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Learnosity/snmptools"
+)
+
+// errBadCommand stands for errors in the command itself
+var errBadCommand = errors.New("bad command")
+
+// fakeExtension is a shell pass persist extension with one integer at .1.1.1,
+// that answers GETNEXT from .1.1.1 with itself, and GET of .1.1.3 with an
+// extra line
+const fakeExtension = `
+while read command; do
+	case "$command" in
+	PING) echo PONG ;;
+	get|getnext)
+		read oid
+		if [ "$oid" = .1.1.1 ] || [ "$command" = getnext ]; then
+			printf '.1.1.1\ninteger\n42\n'
+		elif [ "$oid" = .1.1.3 ]; then
+			printf 'NONE\n.1.1.3\n'
+		else
+			echo NONE
+		fi ;;
+	set) read oid; read value; echo not-writable ;;
+	esac
+done
+`
+
+func TestCommands(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+
+	tests := []struct {
+		command string
+		output  []string
+		err     error
+	}{
+		{"ping", []string{"PONG ("}, nil},
+		{"get .1.1.1 .1.1.2", []string{".1.1.1 = integer: 42 (", "get .1.1.2: None ("}, nil},
+		{"get .1.1.3", []string{"get .1.1.3: None ("}, snmptools.ProtocolViolation},
+		{"getnext .1.1", []string{".1.1.1 = integer: 42 ("}, nil},
+		{"walk .1.1", []string{".1.1.1 = integer: 42\n"}, snmptools.ProtocolViolation},
+		{"set .1.1.1 integer 5", nil, snmptools.NotWritable},
+		{"set .1.1.1 float 5", nil, errBadCommand},
+		{"fetch .1.1.1", nil, errBadCommand},
+	}
+
+	for _, test := range tests {
+		var out, transcript bytes.Buffer
+
+		err := run(strings.Fields(test.command), []string{"sh", "-c", fakeExtension}, time.Second, &transcript, &out)
+		switch {
+		case test.err == nil && err != nil:
+			t.Errorf("%s: unexpected error %s", test.command, err)
+		case test.err == errBadCommand && err == nil:
+			t.Errorf("%s: expected an error", test.command)
+		case test.err != nil && test.err != errBadCommand && !errors.Is(err, test.err):
+			t.Errorf("%s: expected %s, got %v", test.command, test.err, err)
+		}
+
+		for _, s := range test.output {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%s: expected %q in %q", test.command, s, out.String())
+			}
+		}
+		if test.err != errBadCommand && !strings.Contains(transcript.String(), "ms > ") {
+			t.Errorf("%s: bad transcript %q", test.command, transcript.String())
+		}
+	}
+}
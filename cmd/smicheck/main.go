@@ -0,0 +1,139 @@
+// Smicheck walks SMI trees and reports anything that would stop them being
+// served properly: walks that are out of order, loop or visit an OID twice,
+// leaves with invalid types or out of range values, and empty subtrees.
+//
+// Usage:
+//
+//	smicheck [flags] file...
+//
+// Each file is a recording or tree document, in any format snmpsim serves:
+//
+//	.snmprec          snmpsim's own format
+//	.snmpwalk, .walk  the output of snmpwalk -On
+//	.json, .yaml      a tree document, as written by snmptools.DumpJSON()
+//
+// The trees built into snmptools can be checked with -builtin, which takes a
+// comma separated list of runtime, host-resources, interfaces, ifx-table and
+// load-averages.
+//
+// Each problem is printed with its OID. Types that pass persist extensions
+// cannot serve, such as Counter64, are only problems with -pass-persist.
+// Smicheck exits with status 1 if there are any problems.
+//
+// For example:
+//
+//	smicheck -pass-persist recordings/*.snmprec
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Learnosity/snmptools"
+)
+
+func main() {
+	var (
+		root        = flag.String("root", ".1.3.6.1", "the OID recordings are located at")
+		builtin     = flag.String("builtin", "", "built-in trees to check, separated by commas")
+		passPersist = flag.Bool("pass-persist", false, "report types that pass persist cannot serve")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 && *builtin == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	rootOID, err := snmptools.NewOIDFromString(*root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "smicheck: bad root: %s\n", err)
+		os.Exit(1)
+	}
+
+	var builtins []string
+	if *builtin != "" {
+		builtins = strings.Split(*builtin, ",")
+	}
+
+	count, err := run(flag.Args(), builtins, rootOID, *passPersist, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "smicheck: %s\n", err)
+		os.Exit(1)
+	} else if count > 0 {
+		os.Exit(1)
+	}
+}
+
+// run checks each file and built-in tree, printing their problems to out, and
+// returns how many problems there were.
+func run(paths, builtins []string, root snmptools.OID, passPersist bool, out io.Writer) (int, error) {
+	var count int
+
+	check := func(name string, tree snmptools.SMINode, root snmptools.OID) {
+		for _, problem := range snmptools.Validate(tree) {
+			if problem.Kind == snmptools.ProblemPassPersist && !passPersist {
+				continue
+			}
+			fmt.Fprintf(out, "%s: %s: %s: %s\n", name, root.Add(problem.OID...), problem.Kind, problem.Description)
+			count += 1
+		}
+	}
+
+	for _, path := range paths {
+		tree, err := snmptools.LoadTreeFile(path, root)
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", path, err)
+		}
+		check(path, tree, root)
+	}
+
+	for _, name := range builtins {
+		tree, treeRoot, err := builtinTree(name)
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", name, err)
+		}
+		check(name, tree, treeRoot)
+	}
+
+	return count, nil
+}
+
+// builtinTree builds one of the trees built into snmptools, returning it and
+// the OID it is served at.
+func builtinTree(name string) (snmptools.SMINode, snmptools.OID, error) {
+	var (
+		hp   = snmptools.NewHostProvider()
+		tree snmptools.SMINode
+		root snmptools.OID
+		err  error
+	)
+
+	switch name {
+	case "runtime":
+		tree, root = snmptools.RuntimeTree(), snmptools.RuntimeRoot
+	case "host-resources":
+		tree, err = hp.HostResources()
+		root = snmptools.HostResourcesRoot
+	case "interfaces":
+		tree, err = hp.Interfaces()
+		root = snmptools.InterfacesRoot
+	case "ifx-table":
+		tree, err = hp.IfXTable()
+		root = snmptools.IfXTableRoot
+	case "load-averages":
+		tree, err = hp.LoadAverages()
+		root = snmptools.LaTableRoot
+	default:
+		err = fmt.Errorf("unknown built-in tree")
+	}
+
+	return tree, root, err
+}
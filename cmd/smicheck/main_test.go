@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Learnosity/snmptools"
+)
+
+func TestRun(t *testing.T) {
+	var (
+		dir  = t.TempDir()
+		good = filepath.Join(dir, "good.snmprec")
+		bad  = filepath.Join(dir, "bad.snmprec")
+		root = snmptools.NewOID(1, 3, 6, 1)
+	)
+
+	os.WriteFile(good, []byte("1.3.6.1.2.1.1.1.0|4|router\n1.3.6.1.2.1.1.3.0|67|100\n"), 0644)
+	os.WriteFile(bad, []byte("1.3.6.1.2.1.1.1.0|4|router\n1.3.6.1.2.1.31.1.1.1.6.1|70|12345\n"), 0644)
+
+	tests := []struct {
+		paths       []string
+		passPersist bool
+		count       int
+		output      string
+	}{
+		{[]string{good}, true, 0, ""},
+		{[]string{good, bad}, false, 0, ""},
+		{[]string{good, bad}, true, 1, bad + ": .1.3.6.1.2.1.31.1.1.1.6.1: passPersist: "},
+	}
+
+	for i, test := range tests {
+		var out bytes.Buffer
+
+		count, err := run(test.paths, nil, root, test.passPersist, &out)
+		if err != nil {
+			t.Errorf("%d: unexpected error %s", i, err)
+		} else if count != test.count || !strings.HasPrefix(out.String(), test.output) {
+			t.Errorf("%d: expected %d problems, got %d: %q", i, test.count, count, out.String())
+		}
+	}
+
+	if _, err := run([]string{filepath.Join(dir, "missing.snmprec")}, nil, root, false, &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+	if _, err := run(nil, []string{"nonsense"}, root, false, &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected an error for an unknown built-in tree")
+	}
+	if _, err := run(nil, []string{"runtime"}, root, false, &bytes.Buffer{}); err != nil {
+		t.Errorf("Unexpected error checking the runtime tree: %s", err)
+	}
+
+	// The runtime tree can be served by pass persist
+	var out bytes.Buffer
+	if count, err := run(nil, []string{"runtime"}, root, true, &out); err != nil || count != 0 {
+		t.Errorf("Expected no problems in the runtime tree, got %d (%v): %s", count, err, out.String())
+	}
+}
@@ -0,0 +1,407 @@
+// Snmpsim serves recorded SNMP data as a simulated device, for testing network
+// management systems against devices that are not at hand.
+//
+// Usage:
+//
+//	snmpsim [flags] dataset...
+//
+// Each dataset is a file, or a directory of files, recorded in one of these
+// formats, chosen by extension:
+//
+//	.snmprec          snmpsim's own format
+//	.snmpwalk, .walk  the output of snmpwalk -On
+//	.json, .yaml      a tree document, as written by snmptools.DumpJSON()
+//
+// Datasets are named after their files without the extension. As a standalone
+// SNMPv1/v2c agent, the community of each request selects the dataset that
+// answers it, so that one simulator can stand in for many devices:
+//
+//	snmpsim -listen :1161 recordings/
+//	snmpwalk -v2c -c router1 localhost:1161
+//
+// As a pass persist extension of snmpd, the dataset named by -community is
+// served:
+//
+//	pass_persist .1.3.6.1 /usr/local/bin/snmpsim -pass-persist -community router1 /srv/router1.snmprec
+//
+// Values can be varied on every request with -vary, which may be given more
+// than once. Counters, and TimeTicks, increase at a rate per second, and
+// gauges and INTEGERs take random values in a range:
+//
+//	-vary .1.3.6.1.2.1.2.2.1.10=rate:125000
+//	-vary .1.3.6.1.2.1.25.3.3.1.2=range:0:100
+//
+// The -latency, -drop and -errors flags make the simulator slow or unreliable,
+// to test how managers cope. As a pass persist extension, dropped requests
+// are not answered, and failed ones are answered with NONE, as pass persist
+// cannot report a genErr.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Learnosity/snmptools"
+)
+
+// variations collects the -vary flags
+type variations []snmptools.Variation
+
+func (v *variations) String() string {
+	return fmt.Sprint(*v)
+}
+
+func (v *variations) Set(s string) error {
+	variation, err := parseVariation(s)
+	if err == nil {
+		*v = append(*v, variation)
+	}
+	return err
+}
+
+// parseVariation parses OID=rate:N or OID=range:MIN:MAX. The OID is absolute
+// until it is made relative to the root.
+func parseVariation(s string) (snmptools.Variation, error) {
+	var v snmptools.Variation
+
+	eq := strings.LastIndexByte(s, '=')
+	if eq < 0 {
+		return v, fmt.Errorf("expected OID=rate:N or OID=range:MIN:MAX")
+	}
+
+	oid, err := snmptools.NewOIDFromString(s[:eq])
+	if err != nil {
+		return v, err
+	}
+	v.OID = oid
+
+	fields := strings.Split(s[eq+1:], ":")
+	switch {
+	case fields[0] == "rate" && len(fields) == 2:
+		if v.Rate, err = strconv.ParseFloat(fields[1], 64); err == nil && v.Rate < 0 {
+			err = fmt.Errorf("negative rate %s", fields[1])
+		}
+	case fields[0] == "range" && len(fields) == 3:
+		if v.Min, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			break
+		} else if v.Max, err = strconv.ParseInt(fields[2], 10, 64); err == nil && v.Max <= v.Min {
+			err = fmt.Errorf("empty range %s:%s", fields[1], fields[2])
+		}
+	default:
+		err = fmt.Errorf("unknown variation %q", s[eq+1:])
+	}
+
+	return v, err
+}
+
+// loadDatasets reads every dataset in the given files and directories.
+func loadDatasets(paths []string, root snmptools.OID) (map[string]*snmptools.SMISparseSubtree, error) {
+	var datasets = make(map[string]*snmptools.SMISparseSubtree)
+
+	for _, path := range paths {
+		files := []string{path}
+		if info, err := os.Stat(path); err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+
+			files = nil
+			for _, entry := range entries {
+				if !entry.IsDir() && snmptools.TreeFileFormat(entry.Name()) != "" {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+
+		for _, file := range files {
+			name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			if _, ok := datasets[name]; ok {
+				return nil, fmt.Errorf("%s: there is already a dataset called %q", file, name)
+			}
+
+			tree, err := snmptools.LoadTreeFile(file, root)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			datasets[name] = tree
+		}
+	}
+
+	return datasets, nil
+}
+
+// packet is a request received by a simConn
+type packet struct {
+	b    []byte
+	addr net.Addr
+}
+
+// simConn reads requests from a UDP socket and hands each one to the agent
+// serving the dataset named by its community, dropping some requests and
+// failing others as asked.
+type simConn struct {
+	conn net.PacketConn
+	// drop and fail are the probabilities of dropping a request and of
+	// answering it with a genErr
+	drop, fail float64
+
+	mu       sync.Mutex
+	datasets map[string]*datasetConn
+}
+
+func newSimConn(conn net.PacketConn, drop, fail float64) *simConn {
+	return &simConn{
+		conn:     conn,
+		drop:     drop,
+		fail:     fail,
+		datasets: make(map[string]*datasetConn),
+	}
+}
+
+// dataset returns a connection for the agent serving a dataset.
+func (c *simConn) dataset(name string) *datasetConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dc := &datasetConn{sim: c, packets: make(chan packet, 16), closed: make(chan struct{})}
+	c.datasets[name] = dc
+	return dc
+}
+
+// serve dispatches requests until the socket is closed.
+func (c *simConn) serve() error {
+	var buf = make([]byte, 65536)
+
+	for {
+		n, addr, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		// Only community-based messages can be told apart
+		m, err := snmptools.UnmarshalMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		dc := c.datasets[m.Community]
+		c.mu.Unlock()
+
+		if dc == nil || rand.Float64() < c.drop {
+			continue
+		}
+
+		select {
+		case dc.packets <- packet{append([]byte(nil), buf[:n]...), addr}:
+		case <-dc.closed:
+		default:
+			// The agent is overloaded, as real ones sometimes are
+		}
+	}
+}
+
+// respond sends a response, turning it into a genErr if need be.
+func (c *simConn) respond(b []byte, addr net.Addr) (int, error) {
+	if rand.Float64() < c.fail {
+		if m, err := snmptools.UnmarshalMessage(b); err == nil {
+			m.PDU.ErrorStatus, m.PDU.ErrorIndex = snmptools.GenErr, 0
+			if failed, err := m.Marshal(); err == nil {
+				b = failed
+			}
+		}
+	}
+
+	return c.conn.WriteTo(b, addr)
+}
+
+// datasetConn is the net.PacketConn through which an agent serves one
+// dataset.
+type datasetConn struct {
+	sim       *simConn
+	packets   chan packet
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (dc *datasetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case p := <-dc.packets:
+		return copy(b, p.b), p.addr, nil
+	case <-dc.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (dc *datasetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return dc.sim.respond(b, addr)
+}
+
+func (dc *datasetConn) Close() error {
+	dc.closeOnce.Do(func() { close(dc.closed) })
+	return nil
+}
+
+func (dc *datasetConn) LocalAddr() net.Addr                { return dc.sim.conn.LocalAddr() }
+func (dc *datasetConn) SetDeadline(t time.Time) error      { return nil }
+func (dc *datasetConn) SetReadDeadline(t time.Time) error  { return nil }
+func (dc *datasetConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// options are the command line flags
+type options struct {
+	root        string
+	listen      string
+	passPersist bool
+	community   string
+	latency     time.Duration
+	drop, fail  float64
+	vary        variations
+}
+
+func main() {
+	var opts options
+
+	flag.StringVar(&opts.root, "root", ".1.3.6.1", "the OID the datasets are served at")
+	flag.StringVar(&opts.listen, "listen", ":1161", "the UDP address to serve SNMPv1/v2c requests on")
+	flag.BoolVar(&opts.passPersist, "pass-persist", false, "serve one dataset to snmpd as a pass persist extension")
+	flag.StringVar(&opts.community, "community", "public", "the dataset to serve with -pass-persist")
+	flag.DurationVar(&opts.latency, "latency", 0, "delay every request by this long")
+	flag.Float64Var(&opts.drop, "drop", 0, "the fraction of requests to ignore")
+	flag.Float64Var(&opts.fail, "errors", 0, "the fraction of requests to answer with a genErr, or NONE with -pass-persist")
+	flag.Var(&opts.vary, "vary", "vary values beneath an OID: OID=rate:N or OID=range:MIN:MAX")
+	flag.Parse()
+
+	if err := run(&opts, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "snmpsim: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts *options, paths []string) error {
+	root, err := snmptools.NewOIDFromString(opts.root)
+	if err != nil {
+		return err
+	} else if len(paths) == 0 {
+		return fmt.Errorf("no datasets given")
+	}
+
+	sims, err := newSimulators(paths, root, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.passPersist {
+		sim, ok := sims[opts.community]
+		if !ok {
+			return fmt.Errorf("there is no dataset called %q", opts.community)
+		}
+		input := faultyInput(os.Stdin, os.Stdout, opts.drop, opts.fail)
+		return snmptools.NewPassPersistExtension(input, os.Stdout, sim.Tree, root).Serve()
+	}
+
+	conn, err := net.ListenPacket("udp", opts.listen)
+	if err != nil {
+		return err
+	}
+	return serve(newSimConn(conn, opts.drop, opts.fail), sims, root)
+}
+
+// faultyInput passes the commands of snmpd read from r on to a pass persist
+// extension, except for requests that are dropped, which are not answered,
+// and requests that fail, which are answered with NONE on w.
+func faultyInput(r io.Reader, w io.Writer, drop, fail float64) io.Reader {
+	if drop == 0 && fail == 0 {
+		return r
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if command := strings.ToLower(line); (command == "get" || command == "getnext") && scanner.Scan() {
+				switch {
+				case rand.Float64() < drop:
+				case rand.Float64() < fail:
+					fmt.Fprintf(w, "NONE\n")
+				default:
+					fmt.Fprintf(pw, "%s\n%s\n", line, scanner.Text())
+				}
+				continue
+			}
+
+			if _, err := fmt.Fprintf(pw, "%s\n", line); err != nil {
+				return
+			}
+		}
+		pw.CloseWithError(scanner.Err())
+	}()
+	return pr
+}
+
+// newSimulators loads the datasets, with the variations and latency asked
+// for.
+func newSimulators(paths []string, root snmptools.OID, opts *options) (map[string]*snmptools.Simulator, error) {
+	trees, err := loadDatasets(paths, root)
+	if err != nil {
+		return nil, err
+	}
+
+	sims := make(map[string]*snmptools.Simulator)
+	for name, tree := range trees {
+		sim := snmptools.NewSimulator(tree)
+		sim.Latency = opts.latency
+
+		for _, v := range opts.vary {
+			relative, err := v.OID.GetRemainder(root)
+			if err != nil {
+				return nil, fmt.Errorf("cannot vary %s: it is not beneath %s", v.OID, root)
+			}
+
+			v.OID = relative
+			// Not every dataset need have every OID
+			if err := sim.Vary(v); err != nil && !errors.Is(err, snmptools.NoSuchName) {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		sims[name] = sim
+	}
+
+	return sims, nil
+}
+
+// serve runs an agent for each dataset, and dispatches requests to them until
+// the socket is closed.
+func serve(sc *simConn, sims map[string]*snmptools.Simulator, root snmptools.OID) error {
+	for name, sim := range sims {
+		agent := snmptools.NewAgent(root, sim.Tree)
+		agent.Community = name
+
+		go func(name string, dc *datasetConn) {
+			if err := agent.Serve(dc); err != nil {
+				fmt.Fprintf(os.Stderr, "snmpsim: %s: %s\n", name, err)
+			}
+		}(name, sc.dataset(name))
+	}
+
+	defer func() {
+		for _, dc := range sc.datasets {
+			dc.Close()
+		}
+	}()
+	return sc.serve()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Learnosity/snmptools"
+)
+
+func TestParseVariation(t *testing.T) {
+	tests := []struct {
+		flag     string
+		expected snmptools.Variation
+		ok       bool
+	}{
+		{".1.3.6.1.2.1.2.2.1.10=rate:1000", snmptools.Variation{OID: snmptools.NewOID(1, 3, 6, 1, 2, 1, 2, 2, 1, 10), Rate: 1000}, true},
+		{".1.3.6.1.2.1.25=range:-5:5", snmptools.Variation{OID: snmptools.NewOID(1, 3, 6, 1, 2, 1, 25), Min: -5, Max: 5}, true},
+		{".1.3.6.1=rate:-1", snmptools.Variation{}, false},
+		{".1.3.6.1=range:5:5", snmptools.Variation{}, false},
+		{".1.3.6.1=random", snmptools.Variation{}, false},
+		{".1.3.6.1", snmptools.Variation{}, false},
+	}
+
+	for _, test := range tests {
+		v, err := parseVariation(test.flag)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("Expected an error for %s", test.flag)
+			}
+		} else if err != nil {
+			t.Errorf("Unexpected error for %s: %s", test.flag, err)
+		} else if !v.OID.Equals(test.expected.OID) || v.Rate != test.expected.Rate || v.Min != test.expected.Min || v.Max != test.expected.Max {
+			t.Errorf("Bad variation for %s: %+v", test.flag, v)
+		}
+	}
+}
+
+// startSimulator serves a directory of two datasets, which answer to their
+// own communities
+func startSimulator(t *testing.T, drop, fail float64) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"router1.snmprec":  "1.3.6.1.2.1.1.5.0|4|router1\n1.3.6.1.2.1.2.2.1.10.1|65|100\n",
+		"router2.snmpwalk": ".1.3.6.1.2.1.1.5.0 = STRING: \"router2\"\n",
+		"README":           "not a dataset",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		root = snmptools.NewOID(1, 3, 6, 1)
+		opts = &options{}
+	)
+	opts.vary.Set(".1.3.6.1.2.1.2.2.1.10=rate:1000000")
+
+	sims, err := newSimulators([]string{dir}, root, opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(sims) != 2 {
+		t.Fatalf("Expected 2 datasets, got %d", len(sims))
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serve(newSimConn(conn, drop, fail), sims, root)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn.LocalAddr().String()
+}
+
+func newTestClient(t *testing.T, addr, community string) *snmptools.Client {
+	client := snmptools.NewClient(addr, community, snmptools.Version2c)
+	client.Timeout = 200 * time.Millisecond
+	client.Retries = 0
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestSimulatorCommunities(t *testing.T) {
+	var (
+		addr    = startSimulator(t, 0, 0)
+		sysName = snmptools.NewOID(1, 3, 6, 1, 2, 1, 1, 5, 0)
+		ifIn    = snmptools.NewOID(1, 3, 6, 1, 2, 1, 2, 2, 1, 10, 1)
+	)
+
+	for _, community := range []string{"router1", "router2"} {
+		vbs, err := newTestClient(t, addr, community).Get(sysName)
+		if err != nil {
+			t.Fatalf("%s: %s", community, err)
+		} else if v := vbs[0].Value; string(v.([]byte)) != community {
+			t.Errorf("%s: got %s", community, v)
+		}
+	}
+
+	// The counter is varied
+	time.Sleep(10 * time.Millisecond)
+	if vbs, err := newTestClient(t, addr, "router1").Get(ifIn); err != nil {
+		t.Fatal(err)
+	} else if v := vbs[0].Value.(uint32); v <= 100 {
+		t.Errorf("Counter was not varied: %d", v)
+	}
+
+	// Other communities get no answer
+	if _, err := newTestClient(t, addr, "public").Get(sysName); err == nil {
+		t.Errorf("Expected a timeout for an unknown community")
+	}
+}
+
+func TestSimulatorFaults(t *testing.T) {
+	var sysName = snmptools.NewOID(1, 3, 6, 1, 2, 1, 1, 5, 0)
+
+	_, err := newTestClient(t, startSimulator(t, 0, 1), "router1").Get(sysName)
+	if !errors.Is(err, snmptools.GenErr) {
+		t.Errorf("Expected a genErr, got %v", err)
+	}
+
+	_, err = newTestClient(t, startSimulator(t, 1, 0), "router1").Get(sysName)
+	if err == nil || errors.Is(err, snmptools.GenErr) {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
+
+// Test that requests from snmpd are dropped or failed before they reach a
+// pass persist extension
+func TestPassPersistFaults(t *testing.T) {
+	const commands = "PING\nget\n.1.3.6.1.2.1.1.5.0\ngetnext\n.1.3.6.1\nPING\n"
+
+	type faultTest struct {
+		drop, fail         float64
+		forwarded, answers string
+	}
+
+	tests := []faultTest{
+		{0, 0, commands, ""},
+		{1, 0, "PING\nPING\n", ""},
+		{0, 1, "PING\nPING\n", "NONE\nNONE\n"},
+	}
+
+	for _, test := range tests {
+		var answers strings.Builder
+
+		forwarded, err := io.ReadAll(faultyInput(strings.NewReader(commands), &answers, test.drop, test.fail))
+		if err != nil {
+			t.Fatal(err)
+		} else if string(forwarded) != test.forwarded || answers.String() != test.answers {
+			t.Errorf("drop %v, errors %v: forwarded %q and answered %q", test.drop, test.fail, forwarded, answers.String())
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package snmptools
+
+import (
+	"time"
+)
+
+// uptimeTolerance is how far an agent's sysUpTime may drift from our clock
+// between two samples before it is taken as a restart, on top of a tenth of
+// the time between them
+const uptimeTolerance = 5 * time.Second
+
+// CounterSample is the value of a Counter32 or Counter64 at a moment.
+type CounterSample struct {
+	Type  AsnType
+	Value uint64
+	// Uptime is the agent's sysUpTime when the counter was read, or zero if
+	// it is not known
+	Uptime uint32
+	// Time is when the counter was read, or the zero time if it is not known
+	Time time.Time
+}
+
+// CounterDelta() returns how much a counter increased between two samples.
+//
+// A Counter32 that is lower than before is taken to have wrapped once. If
+// the agent restarted between the samples its counters started again from
+// zero, so the delta is the current value, and restarted is true. Restarts
+// are found by sysUpTime disagreeing with the time between the samples, or,
+// without the times, by sysUpTime going backwards; a Counter64 going
+// backwards is always a restart.
+func CounterDelta(prev, cur CounterSample) (delta uint64, restarted bool) {
+	if uptimeRestarted(prev, cur) {
+		return cur.Value, true
+	}
+
+	if cur.Value >= prev.Value {
+		return cur.Value - prev.Value, false
+	} else if cur.Type == AsnCounter32 && prev.Value <= 0xffffffff {
+		return cur.Value + (1 << 32) - prev.Value, false
+	}
+	return cur.Value, true
+}
+
+// uptimeRestarted says whether an agent restarted between two samples.
+func uptimeRestarted(prev, cur CounterSample) bool {
+	if prev.Uptime == 0 || cur.Uptime == 0 {
+		return false
+	} else if prev.Time.IsZero() || cur.Time.IsZero() {
+		return cur.Uptime < prev.Uptime
+	}
+
+	// sysUpTime wraps after 497 days, which subtracting uint32s allows for
+	var (
+		ticks   = time.Duration(cur.Uptime-prev.Uptime) * 10 * time.Millisecond
+		elapsed = cur.Time.Sub(prev.Time)
+		drift   = ticks - elapsed
+	)
+	if drift < 0 {
+		drift = -drift
+	}
+	return drift > elapsed/10+uptimeTolerance
+}
+
+// ExtendedCounter follows a Counter32 that is polled regularly, to give a
+// Counter64 that does not wrap, for high speed interfaces of agents without
+// 64 bit counters. It must be polled more often than the Counter32 wraps.
+type ExtendedCounter struct {
+	value   uint64
+	last    CounterSample
+	started bool
+}
+
+// Update() adds the increase since the previous sample, and returns the new
+// value. The first sample sets the value to that of the counter.
+func (c *ExtendedCounter) Update(sample CounterSample) uint64 {
+	if !c.started {
+		c.value, c.started = sample.Value, true
+	} else {
+		delta, _ := CounterDelta(c.last, sample)
+		c.value += delta
+	}
+	c.last = sample
+	return c.value
+}
+
+// Value() returns the value as of the latest sample.
+func (c *ExtendedCounter) Value() uint64 {
+	return c.value
+}
+
+// CounterSnapshot is the values of a set of objects, polled together.
+type CounterSnapshot struct {
+	Time time.Time
+	// Uptime is the agent's sysUpTime, or zero if it is not known
+	Uptime   uint32
+	VarBinds []VarBind
+}
+
+// SnapshotTree() takes a snapshot of every leaf of a tree, now, given the
+// uptime of the agent serving it. The leaves are copied, so the tree may be
+// changed afterwards.
+func SnapshotTree(node SMINode, uptime uint32) CounterSnapshot {
+	return CounterSnapshot{time.Now(), uptime, snapshot(node)}
+}
+
+// SnapshotVarBinds() takes a snapshot of the results of a Client request,
+// now. If sysUpTime.0 is among them, it is the snapshot's Uptime; ask for it
+// alongside the counters to detect restarts reliably.
+func SnapshotVarBinds(vbs []VarBind) CounterSnapshot {
+	var snap = CounterSnapshot{Time: time.Now(), VarBinds: vbs}
+
+	for _, vb := range vbs {
+		if vb.OID.Equals(SysUpTimeOID) && vb.Type == AsnTimeTicks {
+			if u, ok := toUint64(vb.Value); ok {
+				snap.Uptime = uint32(u)
+			}
+		}
+	}
+
+	return snap
+}
+
+// Rate is how fast a counter increased between two snapshots.
+type Rate struct {
+	OID       OID
+	Type      AsnType
+	Delta     uint64
+	PerSecond float64
+	// Restarted is true if the agent restarted between the snapshots, so
+	// Delta only covers the time since then
+	Restarted bool
+}
+
+// Rates() returns the rate of every Counter32 and Counter64 in both
+// snapshots, in the order of cur. The time between the snapshots is taken
+// from sysUpTime if both have it and the agent did not restart, as it is
+// unaffected by network delays; otherwise it is the time between polls.
+func Rates(prev, cur CounterSnapshot) []Rate {
+	var (
+		previous = make(map[string]VarBind, len(prev.VarBinds))
+		rates    []Rate
+		restart  = uptimeRestarted(CounterSample{Uptime: prev.Uptime, Time: prev.Time}, CounterSample{Uptime: cur.Uptime, Time: cur.Time})
+		interval = cur.Time.Sub(prev.Time).Seconds()
+	)
+
+	if prev.Uptime != 0 && cur.Uptime != 0 && !restart {
+		interval = float64(cur.Uptime-prev.Uptime) / 100
+	}
+	if interval <= 0 {
+		return nil
+	}
+
+	for _, vb := range prev.VarBinds {
+		previous[vb.OID.String()] = vb
+	}
+
+	for _, vb := range cur.VarBinds {
+		old, ok := previous[vb.OID.String()]
+		if !ok || old.Type != vb.Type || (vb.Type != AsnCounter32 && vb.Type != AsnCounter64) {
+			continue
+		}
+
+		oldValue, ok := toUint64(old.Value)
+		if !ok {
+			continue
+		}
+		value, ok := toUint64(vb.Value)
+		if !ok {
+			continue
+		}
+
+		delta, restarted := CounterDelta(
+			CounterSample{old.Type, oldValue, prev.Uptime, prev.Time},
+			CounterSample{vb.Type, value, cur.Uptime, cur.Time},
+		)
+
+		perSecond := float64(delta) / interval
+		if restarted && cur.Uptime != 0 {
+			// The counter has only been counting since the restart
+			perSecond = float64(delta) / (float64(cur.Uptime) / 100)
+		}
+
+		rates = append(rates, Rate{vb.OID, vb.Type, delta, perSecond, restarted})
+	}
+
+	return rates
+}
@@ -0,0 +1,104 @@
+package snmptools
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCounterDelta(t *testing.T) {
+	var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		prev, cur CounterSample
+		delta     uint64
+		restarted bool
+	}{
+		{CounterSample{AsnCounter32, 100, 0, time.Time{}}, CounterSample{AsnCounter32, 150, 0, time.Time{}}, 50, false},
+		// Wraps
+		{CounterSample{AsnCounter32, math.MaxUint32 - 9, 0, time.Time{}}, CounterSample{AsnCounter32, 10, 0, time.Time{}}, 20, false},
+		{CounterSample{AsnCounter64, 100, 0, time.Time{}}, CounterSample{AsnCounter64, 10, 0, time.Time{}}, 10, true},
+		// sysUpTime going backwards is a restart
+		{CounterSample{AsnCounter32, 100, 5000, time.Time{}}, CounterSample{AsnCounter32, 10, 1000, time.Time{}}, 10, true},
+		// ...unless it wrapped in the time between samples
+		{
+			CounterSample{AsnCounter32, 100, math.MaxUint32 - 999, start},
+			CounterSample{AsnCounter32, 200, 1000, start.Add(20 * time.Second)},
+			100, false,
+		},
+		// A restart that brought sysUpTime back past its previous value
+		{
+			CounterSample{AsnCounter32, 100, 1000, start},
+			CounterSample{AsnCounter32, 500, 3000, start.Add(time.Hour)},
+			500, true,
+		},
+		{
+			CounterSample{AsnCounter32, 100, 1000, start},
+			CounterSample{AsnCounter32, 500, 361000, start.Add(time.Hour + time.Second)},
+			400, false,
+		},
+	}
+
+	for i, test := range tests {
+		if delta, restarted := CounterDelta(test.prev, test.cur); delta != test.delta || restarted != test.restarted {
+			t.Errorf("%d: expected %d %v, got %d %v", i, test.delta, test.restarted, delta, restarted)
+		}
+	}
+}
+
+func TestExtendedCounter(t *testing.T) {
+	var c ExtendedCounter
+
+	for i, value := range []uint64{math.MaxUint32 - 10, 100, math.MaxUint32, 5} {
+		c.Update(CounterSample{Type: AsnCounter32, Value: value})
+		if i == 0 && c.Value() != math.MaxUint32-10 {
+			t.Errorf("Expected the first sample's value, got %d", c.Value())
+		}
+	}
+
+	if expected := uint64(2<<32 + 5); c.Value() != expected {
+		t.Errorf("Expected %d, got %d", expected, c.Value())
+	}
+}
+
+func TestRates(t *testing.T) {
+	var (
+		O    = NewOID
+		tree = NewSMISparseSubtree()
+	)
+
+	tree.Insert(O(1), NewLeafNode(NewSMILeaf(AsnCounter32, uint32(1000))))
+	tree.Insert(O(2), NewLeafNode(NewSMILeaf(AsnCounter64, uint64(1<<40))))
+	tree.Insert(O(3), NewLeafNode(NewSMILeaf(AsnGauge32, uint32(5))))
+	prev := SnapshotTree(tree, 10000)
+
+	tree.Insert(O(1), NewLeafNode(NewSMILeaf(AsnCounter32, uint32(3000))))
+	tree.Insert(O(2), NewLeafNode(NewSMILeaf(AsnCounter64, uint64(1<<40+500))))
+	tree.Insert(O(3), NewLeafNode(NewSMILeaf(AsnGauge32, uint32(6))))
+	cur := SnapshotTree(tree, 11000)
+
+	// sysUpTime says 10 seconds passed, although they did not
+	cur.Time = prev.Time.Add(10 * time.Second)
+
+	rates := Rates(prev, cur)
+	if len(rates) != 2 {
+		t.Fatalf("Expected 2 rates, got %v", rates)
+	} else if r := rates[0]; !r.OID.Equals(O(1)) || r.Delta != 2000 || r.PerSecond != 200 || r.Restarted {
+		t.Errorf("Bad rate: %+v", r)
+	} else if r := rates[1]; !r.OID.Equals(O(2)) || r.Delta != 500 || r.PerSecond != 50 {
+		t.Errorf("Bad rate: %+v", r)
+	}
+
+	// Client results, with a restart 20 seconds ago
+	prev = SnapshotVarBinds([]VarBind{{SysUpTimeOID, AsnTimeTicks, uint32(100000)}, {O(1), AsnCounter32, uint32(5000)}})
+	cur = SnapshotVarBinds([]VarBind{{SysUpTimeOID, AsnTimeTicks, uint32(2000)}, {O(1), AsnCounter32, uint32(400)}})
+	if prev.Uptime != 100000 {
+		t.Errorf("Uptime not found: %d", prev.Uptime)
+	}
+	cur.Time = prev.Time.Add(time.Minute)
+
+	rates = Rates(prev, cur)
+	if len(rates) != 1 || rates[0].Delta != 400 || rates[0].PerSecond != 20 || !rates[0].Restarted {
+		t.Errorf("Bad rates after a restart: %+v", rates)
+	}
+}
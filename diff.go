@@ -0,0 +1,210 @@
+package snmptools
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ChangeKind says how a leaf differs between two trees.
+type ChangeKind int
+
+const (
+	// The leaf is only in the new tree
+	Added ChangeKind = iota
+	// The leaf is only in the old tree
+	Removed
+	// The leaf is in both trees, with a different type or value
+	Changed
+)
+
+var changeKindStrings = []string{
+	"added",
+	"removed",
+	"changed",
+}
+
+func (k ChangeKind) String() string {
+	if k >= 0 && int(k) < len(changeKindStrings) {
+		return changeKindStrings[k]
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a leaf that differs between two trees, found by Diff().
+type Change struct {
+	// OID is relative to the root of the trees
+	OID  OID
+	Kind ChangeKind
+	// Old is nil for Added leaves, and New is nil for Removed leaves
+	Old, New *SMILeaf
+}
+
+func (c Change) String() string {
+	leafString := func(l *SMILeaf) string {
+		return fmt.Sprintf("%s: %v", l.asnType.PrettyString(), l.value)
+	}
+
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("%s added: %s", c.OID, leafString(c.New))
+	case Removed:
+		return fmt.Sprintf("%s removed: %s", c.OID, leafString(c.Old))
+	}
+	return fmt.Sprintf("%s changed: %s -> %s", c.OID, leafString(c.Old), leafString(c.New))
+}
+
+// VarBind() returns the leaf as it is now, or a NULL for Removed leaves, to
+// send in a notification. Its OID is absolute, beneath the root the trees
+// are served at.
+func (c Change) VarBind(root OID) VarBind {
+	oid := root.Add(c.OID...)
+	if c.New == nil {
+		return VarBind{oid, AsnNull, nil}
+	}
+	return VarBind{oid, c.New.asnType, c.New.value}
+}
+
+// Diff() compares two trees, returning the leaves that were added, removed
+// or changed between them in OID order. Leaves are the same if they have the
+// same type and encode to the same value, so an int and an int64 holding the
+// same INTEGER are not a change.
+func Diff(old, new SMINode) []Change {
+	return diffLeaves(snapshot(old), snapshot(new))
+}
+
+// snapshot copies every leaf of a tree, so that the tree can change without
+// changing the copy.
+func snapshot(node SMINode) []VarBind {
+	var vbs []VarBind
+
+	Walk(node, func(oid OID, leaf *SMILeaf) error {
+		value := leaf.value
+		switch v := value.(type) {
+		case []byte:
+			value = append([]byte(nil), v...)
+		case OID:
+			value = v.Copy()
+		}
+		vbs = append(vbs, VarBind{oid.Copy(), leaf.asnType, value})
+		return nil
+	})
+
+	return vbs
+}
+
+// diffLeaves merges two snapshots, both in OID order.
+func diffLeaves(old, new []VarBind) []Change {
+	var changes []Change
+
+	for len(old) > 0 || len(new) > 0 {
+		var cmp int
+		switch {
+		case len(old) == 0:
+			cmp = 1
+		case len(new) == 0:
+			cmp = -1
+		default:
+			cmp = old[0].OID.Compare(new[0].OID)
+		}
+
+		switch {
+		case cmp < 0:
+			changes = append(changes, Change{old[0].OID, Removed, varBindLeaf(old[0]), nil})
+			old = old[1:]
+		case cmp > 0:
+			changes = append(changes, Change{new[0].OID, Added, nil, varBindLeaf(new[0])})
+			new = new[1:]
+		default:
+			if !sameLeaf(old[0], new[0]) {
+				changes = append(changes, Change{new[0].OID, Changed, varBindLeaf(old[0]), varBindLeaf(new[0])})
+			}
+			old, new = old[1:], new[1:]
+		}
+	}
+
+	return changes
+}
+
+func varBindLeaf(vb VarBind) *SMILeaf {
+	return &SMILeaf{vb.Type, vb.Value}
+}
+
+// sameLeaf says whether two leaves would be sent as the same value.
+func sameLeaf(a, b VarBind) bool {
+	if a.Type != b.Type {
+		return false
+	}
+
+	aBytes, aErr := berValue(a.Type, a.Value)
+	bBytes, bErr := berValue(b.Type, b.Value)
+	if aErr != nil || bErr != nil {
+		return reflect.DeepEqual(a.Value, b.Value)
+	}
+	return bytes.Equal(aBytes, bBytes)
+}
+
+// Watcher notices changes to a tree each time it is updated, and tells its
+// subscribers about them, for example to send traps when a status changes or
+// a table row appears.
+//
+// Its Update() method wraps a tree callback, and is given in its place to
+// NewPassPersistExtension(), NewAgent() and the like:
+//
+//	watcher := NewWatcher(callback)
+//	watcher.Subscribe(func(changes []Change) {
+//		for _, change := range changes {
+//			log.Print(change)
+//		}
+//	})
+//	NewPassPersistExtension(os.Stdin, os.Stdout, watcher.Update, root)
+type Watcher struct {
+	callback    func() SMINode
+	mu          sync.Mutex
+	previous    []VarBind
+	updated     bool
+	subscribers []func(changes []Change)
+}
+
+// NewWatcher() creates a Watcher of the trees returned by callback.
+func NewWatcher(callback func() SMINode) *Watcher {
+	return &Watcher{callback: callback}
+}
+
+// Subscribe() adds a function to call with the changes found by each update.
+// Subscribers are called in the order they were added, and only when there
+// are changes. They are called before Update() returns, so slow subscribers
+// should do their work in another goroutine.
+func (w *Watcher) Subscribe(fn func(changes []Change)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Update() calls the callback, compares the tree it returns with the one
+// returned by the previous update, and calls the subscribers with any
+// changes. The first update sets the tree to compare with, and so finds no
+// changes.
+func (w *Watcher) Update() SMINode {
+	tree := w.callback()
+	current := snapshot(tree)
+
+	w.mu.Lock()
+	var changes []Change
+	if w.updated {
+		changes = diffLeaves(w.previous, current)
+	}
+	w.previous, w.updated = current, true
+	subscribers := w.subscribers
+	w.mu.Unlock()
+
+	if len(changes) > 0 {
+		for _, fn := range subscribers {
+			fn(changes)
+		}
+	}
+
+	return tree
+}
@@ -0,0 +1,81 @@
+package snmptools
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	var O = NewOID
+
+	old := NewSMISparseSubtree()
+	old.Insert(O(1, 1), NewLeafNode(NewSMILeaf(AsnInteger, 1)))
+	old.Insert(O(1, 2), NewLeafNode(NewSMILeaf(AsnOctetString, "up")))
+	old.Insert(O(2, 1), NewLeafNode(NewSMILeaf(AsnCounter32, uint32(5))))
+	old.Insert(O(2, 3), NewLeafNode(NewSMILeaf(AsnCounter32, uint32(6))))
+
+	new := NewSMISparseSubtree()
+	new.Insert(O(1, 1), NewLeafNode(NewSMILeaf(AsnInteger, int64(1))))
+	new.Insert(O(1, 2), NewLeafNode(NewSMILeaf(AsnOctetString, []byte("down"))))
+	new.Insert(O(2, 2), NewLeafNode(NewSMILeaf(AsnCounter32, uint32(7))))
+	new.Insert(O(2, 3), NewLeafNode(NewSMILeaf(AsnGauge32, uint32(6))))
+	new.Insert(O(3), NewLeafNode(NewSMILeaf(AsnInteger, 2)))
+
+	expected := []struct {
+		oid  OID
+		kind ChangeKind
+	}{
+		{O(1, 2), Changed},
+		{O(2, 1), Removed},
+		{O(2, 2), Added},
+		{O(2, 3), Changed},
+		{O(3), Added},
+	}
+
+	changes := Diff(old, new)
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %v", len(expected), changes)
+	}
+	for i, change := range changes {
+		if !change.OID.Equals(expected[i].oid) || change.Kind != expected[i].kind {
+			t.Errorf("Expected %s %s, got %s", expected[i].oid, expected[i].kind, change)
+		}
+	}
+
+	if s := changes[0].String(); s != ".1.2 changed: string: up -> string: [100 111 119 110]" {
+		t.Errorf("Bad string: %q", s)
+	}
+	if vb := changes[1].VarBind(testAgentRoot); vb.Type != AsnNull {
+		t.Errorf("Expected a NULL for a removed leaf, got %s", vb)
+	} else if !vb.OID.Equals(testAgentRoot.Add(2, 1)) {
+		t.Errorf("Expected an absolute OID, got %s", vb.OID)
+	}
+	if changes := Diff(new, new); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	var (
+		leaf    = &writableLeaf{NewSMILeaf(AsnInteger, 1)}
+		tree    = NewSMISubtree(leaf)
+		watcher = NewWatcher(func() SMINode { return tree })
+		seen    [][]Change
+	)
+
+	watcher.Subscribe(func(changes []Change) { seen = append(seen, changes) })
+
+	// The tree is changed in place between updates
+	watcher.Update()
+	watcher.Update()
+	leaf.leaf = NewSMILeaf(AsnInteger, 2)
+	if watcher.Update() != tree {
+		t.Errorf("Update() did not return the tree")
+	}
+	watcher.Update()
+
+	if len(seen) != 1 || len(seen[0]) != 1 {
+		t.Fatalf("Expected one change, got %v", seen)
+	} else if change := seen[0][0]; !change.OID.Equals(NewOID(1)) || change.Old.Value() != 1 || change.New.Value() != 2 {
+		t.Errorf("Bad change: %s", change)
+	}
+}
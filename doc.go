@@ -6,10 +6,50 @@
 //
 // * an OID type with various interesting methods
 //
-// * an SMI/MIB tree data type with subtrees and leaves
+// * an SMI/MIB tree data type with subtrees, sparse subtrees whose children may be at any arcs, and leaves
 //
 // * an implementation of the pass persist extension (http://www.net-snmp.org/wiki/index.php/Tut:Extending_snmpd_using_shell_scripts) line protocol used by net-snmp's snmpd
 //
+// * an output mode for net-snmp's extend directive, and parsing of extend output back into SMI trees
+//
+// * a trap and inform sender and listener for SNMPv1 and SNMPv2c notifications
+//
+// * a standalone UDP agent serving SMI trees, and a manager client with Get, GetNext, GetBulk, Walk and Set
+//
+// * SNMPv3 support using the User-based Security Model, with MD5, SHA and SHA-2 authentication and DES or AES privacy
+//
+// * an SMUX peer (RFC 1227) for master agents that do not support AgentX or pass persist extensions
+//
+// * an HTTP handler exposing SMI trees in the Prometheus text format, optionally named after MIB metadata
+//
+// * a ready-made tree describing the Go runtime and expvar variables, with a matching MIB in the mibs directory
+//
+// * Linux host trees read from /proc and /sys, laid out like HOST-RESOURCES-MIB, IF-MIB and UCD-SNMP-MIB's laTable
+//
+// * JSON and YAML documents describing SMI trees, including tables, with loaders and serializers
+//
+// * import and export of snmpsim .snmprec recordings and snmpwalk -On output, for replaying recorded devices
+//
+// * a device simulator, cmd/snmpsim, serving recorded datasets per community with value variations and fault injection
+//
+// * a pass persist client, and a cmd/ppclient debugging tool that drives pass persist programs and reports protocol violations
+//
+// * Validate(), which finds out of order, looping and empty subtrees and unservable leaves in SMI trees, and a cmd/smicheck tool that checks recordings and the built-in trees
+//
+// * tree diffing with Diff(), and a Watcher that tells subscribers what changed each time a tree is updated, to feed traps or logs
+//
+// * counter helpers that compute deltas across wraps and agent restarts, extend Counter32s to 64 bits, and derive per-second rates from polled snapshots
+//
+// * the textual conventions of SNMPv2-TC and INET-ADDRESS-MIB, with DISPLAY-HINT formatting and parsing of values for MIB objects
+//
+// * encoding and decoding of table row instances from typed index values, including IMPLIED and fixed-size strings, OIDs and IP addresses
+//
+// * client-side retrieval of whole tables into rows keyed by their decoded indexes, defined by hand or from a MIB, tolerating sparse columns and out of order agents
+//
+// * writable tables whose rows managers create and destroy through a RowStatus column, with per-column validation and a commit callback into the application
+//
+// * atomic SET transactions, with test, commit, undo and cleanup phases, for agents and SMUX peers, and transactional leaves with validate, apply and rollback hooks
+//
 //
 // This package can be used alongside an snmp client like gosnmp,
 // the tools that come with net-snmp or a network managing system like OpenNMS.
@@ -0,0 +1,583 @@
+package snmptools
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DocumentError is an error in a tree document. Path locates the offending
+// element, for example "objects[2].table.rows[0].values[1]".
+type DocumentError struct {
+	Path string
+	Err  error
+}
+
+func (e *DocumentError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
+func (e *DocumentError) Unwrap() error {
+	return e.Err
+}
+
+// treeDocument is a tree as described in a JSON or YAML document. See
+// DumpYAML() for its layout.
+type treeDocument struct {
+	Root    string           `json:"root,omitempty" yaml:"root,omitempty"`
+	Objects []documentObject `json:"objects" yaml:"objects"`
+}
+
+type documentObject struct {
+	OID   string         `json:"oid" yaml:"oid"`
+	Type  string         `json:"type,omitempty" yaml:"type,omitempty"`
+	Value interface{}    `json:"value,omitempty" yaml:"value,omitempty"`
+	Table *documentTable `json:"table,omitempty" yaml:"table,omitempty"`
+}
+
+type documentTable struct {
+	Columns []documentColumn `json:"columns" yaml:"columns"`
+	Rows    []documentRow    `json:"rows" yaml:"rows"`
+}
+
+type documentColumn struct {
+	Arc  uint32 `json:"arc" yaml:"arc"`
+	Type string `json:"type" yaml:"type"`
+}
+
+type documentRow struct {
+	Index  interface{}   `json:"index" yaml:"index"`
+	Values []interface{} `json:"values" yaml:"values"`
+}
+
+// UnmarshalYAML() reads a row's index as written, since YAML would read an
+// unquoted index such as 1.2 as a number, and one such as 1.10 as 1.1.
+func (r *documentRow) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var row struct {
+		Index  *string       `yaml:"index"`
+		Values []interface{} `yaml:"values"`
+	}
+
+	if err := unmarshal(&row); err != nil {
+		return err
+	}
+
+	r.Index, r.Values = nil, row.Values
+	if row.Index != nil {
+		r.Index = *row.Index
+	}
+	return nil
+}
+
+// LoadJSON() reads a tree from a JSON document, returning the tree and the
+// root OID given in the document. Errors in the document are reported as
+// DocumentErrors.
+//
+// See DumpYAML() for the layout of documents.
+func LoadJSON(r io.Reader) (*SMISparseSubtree, OID, error) {
+	var (
+		doc     treeDocument
+		decoder = json.NewDecoder(r)
+	)
+
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	return doc.tree()
+}
+
+// LoadYAML() reads a tree from a YAML document, returning the tree and the
+// root OID given in the document. Errors in the document are reported as
+// DocumentErrors.
+//
+// See DumpYAML() for the layout of documents.
+func LoadYAML(r io.Reader) (*SMISparseSubtree, OID, error) {
+	var doc treeDocument
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	} else if err := yaml.UnmarshalStrict(b, &doc); err != nil {
+		return nil, nil, err
+	}
+	return doc.tree()
+}
+
+// DumpJSON() writes a tree located at root as a JSON document that LoadJSON()
+// can read back.
+//
+// See DumpYAML() for the layout of documents.
+func DumpJSON(w io.Writer, node SMINode, root OID) error {
+	doc, err := newTreeDocument(node, root)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// DumpYAML() writes a tree located at root as a YAML document that LoadYAML()
+// can read back:
+//
+//	root: .1.3.6.1.4.1.898889
+//	objects:
+//	- oid: .1.1
+//	  type: string
+//	  value: test
+//	- oid: .2
+//	  table:
+//	    columns:
+//	    - arc: 1
+//	      type: integer
+//	    - arc: 2
+//	      type: string
+//	    rows:
+//	    - index: "1"
+//	      values:
+//	      - 1
+//	      - eth0
+//	    - index: "2"
+//	      values:
+//	      - 2
+//	      - null
+//
+// Object OIDs are relative to the root. Subtrees with the shape of a
+// conceptual table - a single entry at .1, whose children are the columns -
+// are written as tables whose cells are at .1.<arc>.<index> beneath the
+// table's OID; a null value leaves a cell out. Other leaves are written as
+// scalar objects.
+//
+// The types are those written by ExtendExtension, plus "hexstring" for OCTET
+// STRINGs that are not valid UTF-8. Opaque values are always given in
+// hexadecimal.
+func DumpYAML(w io.Writer, node SMINode, root OID) error {
+	doc, err := newTreeDocument(node, root)
+	if err != nil {
+		return err
+	}
+
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// tree builds the tree described by a document.
+func (doc *treeDocument) tree() (*SMISparseSubtree, OID, error) {
+	var (
+		tree = NewSMISparseSubtree()
+		root OID
+		err  error
+	)
+
+	if doc.Root != "" {
+		if root, err = parseDocumentOID(doc.Root); err != nil {
+			return nil, nil, &DocumentError{"root", err}
+		}
+	}
+
+	for i, object := range doc.Objects {
+		path := fmt.Sprintf("objects[%d]", i)
+
+		oid, err := parseDocumentOID(object.OID)
+		if err != nil {
+			return nil, nil, &DocumentError{path + ".oid", err}
+		} else if len(oid) == 0 {
+			return nil, nil, &DocumentError{path + ".oid", fmt.Errorf("%w: an OID is required", BadOID)}
+		}
+
+		if object.Table != nil {
+			if object.Type != "" || object.Value != nil {
+				return nil, nil, &DocumentError{path, fmt.Errorf("a table cannot have a type or value")}
+			} else if err := object.Table.insert(tree, oid, path+".table"); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		t, err := parseDocumentType(object.Type)
+		if err != nil {
+			return nil, nil, &DocumentError{path + ".type", err}
+		}
+
+		leaf, err := documentLeaf(t, object.Type, object.Value)
+		if err != nil {
+			return nil, nil, &DocumentError{path + ".value", err}
+		} else if err := tree.Insert(oid, NewLeafNode(leaf)); err != nil {
+			return nil, nil, &DocumentError{path + ".oid", err}
+		}
+	}
+
+	return tree, root, nil
+}
+
+// insert adds the cells of a table at oid to a tree.
+func (table *documentTable) insert(tree *SMISparseSubtree, oid OID, path string) error {
+	var types = make([]AsnType, len(table.Columns))
+
+	for i, column := range table.Columns {
+		var err error
+		if types[i], err = parseDocumentType(column.Type); err != nil {
+			return &DocumentError{fmt.Sprintf("%s.columns[%d].type", path, i), err}
+		} else if column.Arc == 0 {
+			return &DocumentError{fmt.Sprintf("%s.columns[%d].arc", path, i), fmt.Errorf("%w: column arcs start at 1", BadOID)}
+		}
+	}
+
+	for i, row := range table.Rows {
+		rowPath := fmt.Sprintf("%s.rows[%d]", path, i)
+
+		index, err := parseDocumentIndex(row.Index)
+		if err != nil {
+			return &DocumentError{rowPath + ".index", err}
+		} else if len(row.Values) > len(table.Columns) {
+			return &DocumentError{rowPath + ".values", fmt.Errorf("%d values for %d columns", len(row.Values), len(table.Columns))}
+		}
+
+		for j, value := range row.Values {
+			if value == nil {
+				continue
+			}
+
+			valuePath := fmt.Sprintf("%s.values[%d]", rowPath, j)
+			leaf, err := documentLeaf(types[j], table.Columns[j].Type, value)
+			if err != nil {
+				return &DocumentError{valuePath, err}
+			}
+
+			cell := oid.Add(1, table.Columns[j].Arc).Add(index...)
+			if err := tree.Insert(cell, NewLeafNode(leaf)); err != nil {
+				return &DocumentError{valuePath, err}
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseDocumentOID parses an OID, with or without its leading dot.
+func parseDocumentOID(s string) (OID, error) {
+	if s != "" && !strings.HasPrefix(s, ".") {
+		s = "." + s
+	}
+	return NewOIDFromString(s)
+}
+
+// parseDocumentIndex parses the index of a table row, which may be a number
+// or a dotted string.
+func parseDocumentIndex(v interface{}) (OID, error) {
+	var s string
+
+	switch index := v.(type) {
+	case string:
+		s = index
+	case json.Number:
+		s = index.String()
+	case int:
+		s = strconv.Itoa(index)
+	case nil:
+		return nil, fmt.Errorf("%w: an index is required", BadOID)
+	default:
+		return nil, fmt.Errorf("%w: bad index %v", BadOID, v)
+	}
+
+	oid, err := parseDocumentOID(s)
+	if err == nil && len(oid) == 0 {
+		err = fmt.Errorf("%w: an index is required", BadOID)
+	}
+	return oid, err
+}
+
+func parseDocumentType(name string) (AsnType, error) {
+	if name == "hexstring" {
+		return AsnOctetString, nil
+	} else if t, ok := asnTypeNames[name]; ok {
+		return t, nil
+	}
+	return 0, fmt.Errorf("%w: unknown type %q", BadValType, name)
+}
+
+// documentLeaf converts a value from a document to a leaf of type t, which
+// was given in the document as name.
+func documentLeaf(t AsnType, name string, v interface{}) (*SMILeaf, error) {
+	var value interface{}
+
+	switch t {
+	case AsnInteger:
+		if i, ok := documentInt(v); ok && i >= math.MinInt32 && i <= math.MaxInt32 {
+			value = int(i)
+		}
+
+	case AsnGauge32, AsnCounter32, AsnTimeTicks:
+		if u, ok := documentUint(v); ok && u <= math.MaxUint32 {
+			value = uint32(u)
+		}
+
+	case AsnCounter64:
+		if u, ok := documentUint(v); ok {
+			value = u
+		}
+
+	case AsnOctetString:
+		if s, ok := documentString(v); !ok {
+			break
+		} else if name == "hexstring" {
+			if b, err := hex.DecodeString(s); err == nil {
+				value = b
+			}
+		} else {
+			value = s
+		}
+
+	case AsnOpaque:
+		if s, ok := v.(string); ok {
+			if b, err := hex.DecodeString(s); err == nil {
+				value = b
+			}
+		}
+
+	case AsnIpAddress:
+		if s, ok := v.(string); ok {
+			if ip := net.ParseIP(s).To4(); ip != nil {
+				value = ip
+			}
+		}
+
+	case AsnObjectIdentifier:
+		if s, ok := v.(string); ok {
+			if oid, err := parseDocumentOID(s); err == nil {
+				value = oid
+			}
+		}
+	}
+
+	if value == nil {
+		return nil, fmt.Errorf("%w: cannot use %v as %s", BadValType, v, name)
+	}
+	return &SMILeaf{t, value}, nil
+}
+
+// documentInt converts a number from a JSON or YAML document.
+func documentInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case float64:
+		return int64(n), n == math.Trunc(n) && math.Abs(n) < 1<<53
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return toInt64(v)
+}
+
+func documentUint(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		u, err := strconv.ParseUint(n.String(), 10, 64)
+		return u, err == nil
+	case float64:
+		return uint64(n), n == math.Trunc(n) && n >= 0 && n < 1<<53
+	case string:
+		u, err := strconv.ParseUint(n, 10, 64)
+		return u, err == nil
+	}
+	return toUint64(v)
+}
+
+// documentString accepts strings, and numbers for convenience in YAML.
+func documentString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case json.Number:
+		return s.String(), true
+	case int, int64, uint64, float64:
+		return fmt.Sprint(s), true
+	}
+	return "", false
+}
+
+// newTreeDocument describes a tree as a document.
+func newTreeDocument(node SMINode, root OID) (*treeDocument, error) {
+	var doc = &treeDocument{Objects: make([]documentObject, 0)}
+	if root != nil {
+		doc.Root = root.String()
+	}
+
+	if node == nil {
+		return doc, nil
+	} else if node.Children() == nil {
+		return nil, &DocumentError{"objects[0]", fmt.Errorf("%w: a tree cannot be a single leaf", BadOID)}
+	}
+
+	return doc, doc.addNode(node, OID{})
+}
+
+// addNode adds the objects beneath a node at oid to the document.
+func (doc *treeDocument) addNode(node SMINode, oid OID) error {
+	if entry := tableEntry(node); entry != nil {
+		if table, ok := newDocumentTable(entry); ok {
+			doc.Objects = append(doc.Objects, documentObject{OID: oid.String(), Table: table})
+			return nil
+		}
+	}
+
+	arcs := childArcs(node)
+	for i, child := range node.Children() {
+		arc := uint32(i + 1)
+		if arcs != nil {
+			arc = arcs[i]
+		}
+
+		if child == nil {
+			continue
+		} else if child.Children() != nil {
+			if err := doc.addNode(child, oid.Add(arc)); err != nil {
+				return err
+			}
+		} else if leaf := child.Value(); leaf != nil {
+			path := fmt.Sprintf("objects[%d]", len(doc.Objects))
+
+			name, value, err := documentFormat(leaf)
+			if err != nil {
+				return &DocumentError{path, fmt.Errorf("%s: %w", oid.Add(arc), err)}
+			}
+			doc.Objects = append(doc.Objects, documentObject{OID: oid.Add(arc).String(), Type: name, Value: value})
+		}
+	}
+
+	return nil
+}
+
+// newDocumentTable describes a table entry, if each of its columns holds
+// values of a single type.
+func newDocumentTable(entry SMINode) (*documentTable, bool) {
+	var (
+		table   = &documentTable{}
+		rows    = make(map[string]map[uint32]*SMILeaf)
+		indexes []OID
+		arcs    = childArcs(entry)
+	)
+
+	for i, column := range entry.Children() {
+		if column == nil {
+			continue
+		}
+
+		var col = documentColumn{Arc: uint32(i + 1)}
+		if arcs != nil {
+			col.Arc = arcs[i]
+		}
+
+		err := Walk(column, func(index OID, leaf *SMILeaf) error {
+			name, _, err := documentFormat(leaf)
+			if err != nil {
+				return err
+			}
+
+			// Strings that are not valid UTF-8 turn the column to hex
+			switch {
+			case col.Type == "" || col.Type == "string" && name == "hexstring":
+				col.Type = name
+			case col.Type == "hexstring" && name == "string":
+			case col.Type != name:
+				return BadValType
+			}
+
+			key := index.String()
+			if rows[key] == nil {
+				rows[key] = make(map[uint32]*SMILeaf)
+				indexes = append(indexes, index)
+			}
+			rows[key][col.Arc] = leaf
+			return nil
+		})
+		if err != nil || col.Type == "" {
+			return nil, false
+		}
+
+		table.Columns = append(table.Columns, col)
+	}
+
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Compare(indexes[j]) < 0
+	})
+
+	for _, index := range indexes {
+		row := documentRow{Index: instanceString(index), Values: make([]interface{}, len(table.Columns))}
+		for j, col := range table.Columns {
+			if leaf, ok := rows[index.String()][col.Arc]; ok {
+				row.Values[j] = documentValue(leaf, col.Type)
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, true
+}
+
+// documentFormat returns the type name and value of a leaf, as written in a
+// document.
+func documentFormat(leaf *SMILeaf) (string, interface{}, error) {
+	var name = leaf.asnType.PrettyString()
+	if _, ok := asnTypeNames[name]; !ok {
+		return "", nil, fmt.Errorf("%w: %s cannot be written to a document", BadValType, name)
+	}
+
+	if leaf.asnType == AsnOctetString {
+		if b, ok := leaf.value.([]byte); ok && !utf8.Valid(b) {
+			name = "hexstring"
+		}
+	}
+
+	value := documentValue(leaf, name)
+	if value == nil {
+		return "", nil, badValue(leaf.asnType, leaf.value)
+	}
+	return name, value, nil
+}
+
+// documentValue converts the value of a leaf for a document, returning nil
+// if it cannot be represented.
+func documentValue(leaf *SMILeaf, name string) interface{} {
+	value, err := canonicalValue(leaf)
+	if err != nil {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case uint32:
+		return uint64(v)
+	case uint64:
+		return v
+	case []byte:
+		if name == "hexstring" || leaf.asnType == AsnOpaque {
+			return hex.EncodeToString(v)
+		}
+		return string(v)
+	case OID:
+		return v.String()
+	case net.IP:
+		return v.String()
+	}
+	return nil
+}
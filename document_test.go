@@ -0,0 +1,206 @@
+package snmptools
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func newTestDocumentTree() SMINode {
+	var O = NewOID
+
+	return NewSMISubtree(
+		NewSMISubtree(
+			NewLeafNode(NewSMILeaf(AsnOctetString, "test")),
+			NewLeafNode(NewSMILeaf(AsnInteger, -3)),
+			NewLeafNode(NewSMILeaf(AsnOctetString, []byte{0xff, 0x00})),
+			NewLeafNode(NewSMILeaf(AsnIpAddress, net.IPv4(10, 0, 0, 1))),
+			NewLeafNode(NewSMILeaf(AsnObjectIdentifier, O(1, 3, 6, 1))),
+			NewLeafNode(&SMILeaf{AsnCounter64, uint64(1) << 40}),
+			// Other forms of values that can be encoded
+			NewLeafNode(NewSMILeaf(AsnIpAddress, []byte{10, 0, 0, 2})),
+			NewLeafNode(NewSMILeaf(AsnObjectIdentifier, []uint32{1, 3, 6})),
+		),
+		// A table with a missing cell in its second row
+		NewSMISubtree(NewSMISubtree(
+			NewSMISubtree(
+				NewLeafNode(NewSMILeaf(AsnInteger, 1)),
+				NewLeafNode(NewSMILeaf(AsnInteger, 2)),
+			),
+			NewSMISubtree(
+				NewLeafNode(NewSMILeaf(AsnOctetString, "eth0")),
+			),
+			NewSMISubtree(
+				NewLeafNode(NewSMILeaf(AsnCounter32, uint32(42))),
+				NewLeafNode(NewSMILeaf(AsnCounter32, uint32(43))),
+			),
+		)),
+	)
+}
+
+// Test that dumped trees load back into the same tree, in both formats
+func TestDocumentRoundTrip(t *testing.T) {
+	var (
+		O    = NewOID
+		tree = newTestDocumentTree()
+	)
+
+	expected := []VarBind{
+		{O(1, 1), AsnOctetString, "test"},
+		{O(1, 2), AsnInteger, -3},
+		{O(1, 3), AsnOctetString, []byte{0xff, 0x00}},
+		{O(1, 4), AsnIpAddress, "10.0.0.1"},
+		{O(1, 5), AsnObjectIdentifier, ".1.3.6.1"},
+		{O(1, 6), AsnCounter64, uint64(1) << 40},
+		{O(1, 7), AsnIpAddress, "10.0.0.2"},
+		{O(1, 8), AsnObjectIdentifier, ".1.3.6"},
+		{O(2, 1, 1, 1), AsnInteger, 1},
+		{O(2, 1, 1, 2), AsnInteger, 2},
+		{O(2, 1, 2, 1), AsnOctetString, "eth0"},
+		{O(2, 1, 3, 1), AsnCounter32, uint32(42)},
+		{O(2, 1, 3, 2), AsnCounter32, uint32(43)},
+	}
+
+	formats := []struct {
+		name string
+		dump func(io.Writer, SMINode, OID) error
+		load func(io.Reader) (*SMISparseSubtree, OID, error)
+	}{
+		{"JSON", DumpJSON, LoadJSON},
+		{"YAML", DumpYAML, LoadYAML},
+	}
+
+	for _, format := range formats {
+		var out bytes.Buffer
+		if err := format.dump(&out, tree, testAgentRoot); err != nil {
+			t.Fatalf("%s: %s", format.name, err)
+		}
+
+		// The table is written as a table
+		if !strings.Contains(out.String(), "columns") {
+			t.Errorf("%s: no table in %s", format.name, out.String())
+		}
+
+		parsed, root, err := format.load(&out)
+		if err != nil {
+			t.Fatalf("%s: %s", format.name, err)
+		} else if !root.Equals(testAgentRoot) {
+			t.Errorf("%s: bad root %s", format.name, root)
+		}
+
+		checkLeaves(t, parsed, expected)
+		if node := GetLeaf(parsed, O(2, 1, 2, 2)); node != nil {
+			t.Errorf("%s: unexpected cell %v", format.name, node)
+		}
+	}
+}
+
+// Test loading a hand-written YAML document
+func TestLoadYAML(t *testing.T) {
+	var O = NewOID
+
+	doc := `
+objects:
+  - oid: 1.1
+    type: string
+    value: 0.52
+  - oid: .1.2
+    type: hexstring
+    value: "0a0b"
+  - oid: 3
+    table:
+      columns:
+        - {arc: 2, type: gauge}
+      rows:
+        - {index: 7, values: [100]}
+        - {index: "1.2", values: [200]}
+        - {index: 1.10, values: [300]}
+`
+
+	tree, root, err := LoadYAML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	} else if root != nil {
+		t.Errorf("Unexpected root %s", root)
+	}
+
+	checkLeaves(t, tree, []VarBind{
+		{O(1, 1), AsnOctetString, "0.52"},
+		{O(1, 2), AsnOctetString, []byte{0x0a, 0x0b}},
+		{O(3, 1, 2, 7), AsnGauge32, uint32(100)},
+		{O(3, 1, 2, 1, 2), AsnGauge32, uint32(200)},
+		{O(3, 1, 2, 1, 10), AsnGauge32, uint32(300)},
+	})
+}
+
+// Test that errors in documents point at the offending element
+func TestDocumentErrors(t *testing.T) {
+	tests := []struct {
+		doc  string
+		path string
+	}{
+		{`{"root": "1.x", "objects": []}`, "root"},
+		{`{"objects": [{"oid": "", "type": "integer", "value": 1}]}`, "objects[0].oid"},
+		{`{"objects": [{"oid": "1", "type": "integer", "value": 1}, {"oid": "2", "type": "float", "value": 1}]}`, "objects[1].type"},
+		{`{"objects": [{"oid": "1", "type": "integer", "value": 2147483648}]}`, "objects[0].value"},
+		{`{"objects": [{"oid": "1", "type": "gauge", "value": -1}]}`, "objects[0].value"},
+		{`{"objects": [{"oid": "1", "type": "ipaddress", "value": "10.0.0"}]}`, "objects[0].value"},
+		{`{"objects": [{"oid": "1", "type": "string"}]}`, "objects[0].value"},
+		{`{"objects": [{"oid": "1", "type": "integer", "value": 1}, {"oid": "1.1", "type": "integer", "value": 1}]}`, "objects[1].oid"},
+		{`{"objects": [{"oid": "1", "type": "integer", "table": {"columns": [], "rows": []}}]}`, "objects[0]"},
+		{`{"objects": [{"oid": "1", "table": {"columns": [{"arc": 1, "type": "bits"}], "rows": []}}]}`, "objects[0].table.columns[0].type"},
+		{`{"objects": [{"oid": "1", "table": {"columns": [{"arc": 1, "type": "integer"}], "rows": [{"values": [1]}]}}]}`, "objects[0].table.rows[0].index"},
+		{`{"objects": [{"oid": "1", "table": {"columns": [{"arc": 1, "type": "integer"}], "rows": [{"index": 1, "values": [1, 2]}]}}]}`, "objects[0].table.rows[0].values"},
+		{`{"objects": [{"oid": "1", "table": {"columns": [{"arc": 1, "type": "integer"}, {"arc": 2, "type": "integer"}], "rows": [{"index": 1, "values": [1, null]}, {"index": 2, "values": [null, "x"]}]}}]}`, "objects[0].table.rows[1].values[1]"},
+	}
+
+	for _, test := range tests {
+		_, _, err := LoadJSON(strings.NewReader(test.doc))
+
+		var docErr *DocumentError
+		if !errors.As(err, &docErr) {
+			t.Errorf("Expected a DocumentError for %s, got %v", test.doc, err)
+		} else if docErr.Path != test.path {
+			t.Errorf("Bad path for %s: got %s, wanted %s", test.doc, docErr.Path, test.path)
+		}
+	}
+
+	// Unknown fields are rejected by the decoders themselves
+	if _, _, err := LoadJSON(strings.NewReader(`{"objects": [], "extra": 1}`)); err == nil {
+		t.Errorf("Expected an error for an unknown JSON field")
+	}
+	if _, _, err := LoadYAML(strings.NewReader("objects: []\nextra: 1\n")); err == nil {
+		t.Errorf("Expected an error for an unknown YAML field")
+	}
+}
+
+// Test that values that cannot be encoded are refused by every writer,
+// rather than written in a form that cannot be read back
+func TestWriteUnrepresentable(t *testing.T) {
+	writers := []struct {
+		name  string
+		write func(io.Writer, SMINode, OID) error
+	}{
+		{"JSON", DumpJSON},
+		{"YAML", DumpYAML},
+		{"snmprec", WriteSnmprec},
+		{"snmpwalk", WriteSnmpwalk},
+	}
+
+	for _, leaf := range []*SMILeaf{
+		{AsnIpAddress, 42},
+		{AsnObjectIdentifier, []int{1, 3}},
+		{AsnInteger, "three"},
+	} {
+		tree := NewSMISubtree(NewLeafNode(leaf))
+		for _, writer := range writers {
+			var out bytes.Buffer
+			if err := writer.write(&out, tree, testRecordingRoot); err == nil {
+				t.Errorf("%s: expected an error writing %s, got %q", writer.name, leaf, out.String())
+			}
+		}
+	}
+}
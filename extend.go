@@ -0,0 +1,223 @@
+package snmptools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Extend errors
+	MalformedExtendOutput = fmt.Errorf("Malformed extend output")
+)
+
+// NsExtendOutLine is nsExtendOutLine from NET-SNMP-EXTEND-MIB, the column
+// holding each line of output from the commands run by snmpd's extend
+// directive.
+var NsExtendOutLine = NewOID(1, 3, 6, 1, 4, 1, 8072, 1, 3, 2, 4, 1, 2)
+
+// ExtendOutLineOID() returns the OID under which snmpd publishes the output of
+// the extend directive with the given name: the first line is at .1 beneath
+// it, the second at .2 and so on.
+func ExtendOutLineOID(name string) OID {
+	// A string index always encodes
+	oid, _ := NsExtendOutLine.AddIndex([]Index{{Kind: StringIndex}}, name)
+	return oid
+}
+
+// ExtendExtension writes an SMI tree in a form that can be published through
+// net-snmp's extend (or exec) directive, for hosts where pass persist
+// extensions are not allowed.
+//
+// Each leaf is written on a line of its own, giving its OID, type and value:
+//
+//	.1.3.6.1.4.1.898889.1.1 string "test"
+//	.1.3.6.1.4.1.898889.1.2 counter 42
+//
+// snmpd exposes each line as an nsExtendOutLine, and ParseExtendOutput() turns
+// the lines back into a tree.
+type ExtendExtension struct {
+	output   io.Writer
+	callback func() SMINode
+	root     OID
+}
+
+// NewExtendExtension() creates an ExtendExtension that writes the tree
+// returned by callback, located at root, to output.
+func NewExtendExtension(output io.Writer, callback func() SMINode, root OID) *ExtendExtension {
+	return &ExtendExtension{
+		output:   output,
+		callback: callback,
+		root:     root,
+	}
+}
+
+// Serve() writes the tree once. snmpd runs the command again whenever its
+// cached output expires, so the callback is called on every run.
+func (ee *ExtendExtension) Serve() error {
+	var w = bufio.NewWriter(ee.output)
+
+	err := Walk(ee.callback(), func(oid OID, leaf *SMILeaf) error {
+		value, err := extendValue(leaf)
+		if err != nil {
+			return fmt.Errorf("%s: %w", ee.root.Add(oid...), err)
+		}
+		_, err = fmt.Fprintf(w, "%s %s %s\n", ee.root.Add(oid...), leaf.asnType.PrettyString(), value)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// extendValue formats a leaf's value for ExtendExtension. Strings are quoted,
+// so that they can hold newlines.
+func extendValue(leaf *SMILeaf) (string, error) {
+	if _, ok := asnTypeNames[leaf.asnType.PrettyString()]; !ok {
+		return "", fmt.Errorf("%w: %s", BadValType, leaf.asnType.PrettyString())
+	}
+
+	switch v := leaf.value.(type) {
+	case []byte:
+		return strconv.Quote(string(v)), nil
+	case string:
+		if leaf.asnType == AsnOctetString || leaf.asnType == AsnOpaque {
+			return strconv.Quote(v), nil
+		}
+		return v, nil
+	case net.IP:
+		return v.String(), nil
+	}
+
+	if leaf.asnType == AsnOctetString || leaf.asnType == AsnOpaque {
+		return strconv.Quote(fmt.Sprint(leaf.value)), nil
+	}
+	return fmt.Sprint(leaf.value), nil
+}
+
+// ParseExtendOutput() reads the output of an ExtendExtension back into a tree,
+// whose OIDs are relative to root. Blank lines are ignored.
+//
+// The output usually comes from walking the extend directive's
+// ExtendOutLineOID(), and joining the lines.
+//
+// The values in the tree are ints, uint32s or uint64s for the numeric types,
+// strings for OCTET STRINGs, []bytes for Opaque values, net.IPs and OIDs.
+func ParseExtendOutput(r io.Reader, root OID) (*SMISparseSubtree, error) {
+	var (
+		tree    = NewSMISparseSubtree()
+		scanner = bufio.NewScanner(r)
+	)
+
+	for n := 1; scanner.Scan(); n += 1 {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		oid, leaf, err := parseExtendLine(line, root)
+		if err == nil {
+			err = tree.Insert(oid, NewLeafNode(leaf))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", MalformedExtendOutput, n, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func parseExtendLine(line string, root OID) (OID, *SMILeaf, error) {
+	var (
+		fields = strings.SplitN(line, " ", 3)
+		value  interface{}
+	)
+
+	if len(fields) != 3 {
+		return nil, nil, fmt.Errorf("expected an OID, type and value")
+	}
+
+	oid, err := NewOIDFromString(fields[0])
+	if err != nil {
+		return nil, nil, err
+	} else if oid, err = oid.GetRemainder(root); err != nil || len(oid) == 0 {
+		return nil, nil, fmt.Errorf("%s is not beneath %s", fields[0], root)
+	}
+
+	t, ok := asnTypeNames[fields[1]]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown type %q", fields[1])
+	}
+
+	switch t {
+	case AsnInteger:
+		value, err = strconv.Atoi(fields[2])
+	case AsnGauge32, AsnCounter32, AsnTimeTicks:
+		var u uint64
+		u, err = strconv.ParseUint(fields[2], 10, 32)
+		value = uint32(u)
+	case AsnCounter64:
+		value, err = strconv.ParseUint(fields[2], 10, 64)
+	case AsnIpAddress:
+		if ip := net.ParseIP(fields[2]).To4(); ip != nil {
+			value = ip
+		} else {
+			err = fmt.Errorf("bad IP address %q", fields[2])
+		}
+	case AsnObjectIdentifier:
+		value, err = NewOIDFromString(fields[2])
+	case AsnOctetString:
+		value, err = strconv.Unquote(fields[2])
+	case AsnOpaque:
+		var s string
+		s, err = strconv.Unquote(fields[2])
+		value = []byte(s)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return oid, &SMILeaf{t, value}, nil
+}
+
+// ExtendOutputTable() maps the output of an arbitrary extend script onto a
+// conceptual table, so that it can be served again. Each line is a row and
+// each whitespace-separated field a column, both numbered from 1.
+//
+// The returned subtree is the table's entry: the cell for row r and column c
+// is at .c.r beneath it. Fields that look like integers are INTEGERs, and
+// anything else is an OCTET STRING. Rows may have different numbers of
+// fields; the missing cells are left out.
+func ExtendOutputTable(r io.Reader) (*SMISubtree, error) {
+	var (
+		entry   = NewSMISubtree()
+		scanner = bufio.NewScanner(r)
+	)
+
+	for row := uint32(1); scanner.Scan(); row += 1 {
+		for c, field := range strings.Fields(scanner.Text()) {
+			if c >= len(entry.leaves) {
+				entry.AddChild(NewSMISparseSubtree())
+			}
+
+			var leaf = &SMILeaf{AsnOctetString, field}
+			if i, err := strconv.ParseInt(field, 10, 32); err == nil {
+				leaf = &SMILeaf{AsnInteger, int(i)}
+			}
+			entry.leaves[c].(*SMISparseSubtree).SetChild(row, NewLeafNode(leaf))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
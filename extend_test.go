@@ -0,0 +1,126 @@
+package snmptools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Test that the output of an ExtendExtension parses back into the same tree
+func TestExtendRoundTrip(t *testing.T) {
+	var (
+		O    = NewOID
+		root = testAgentRoot
+		tree = NewSMISubtree(
+			NewSMISubtree(
+				NewLeafNode(NewSMILeaf(AsnOctetString, "two\nlines")),
+				NewLeafNode(NewSMILeaf(AsnInteger, -3)),
+				NewLeafNode(NewSMILeaf(AsnCounter32, uint32(42))),
+			),
+			NewSMISubtree(
+				NewLeafNode(NewSMILeaf(AsnIpAddress, net.IPv4(10, 0, 0, 1))),
+				NewLeafNode(NewSMILeaf(AsnObjectIdentifier, O(1, 3, 6, 1))),
+				NewLeafNode(&SMILeaf{AsnCounter64, uint64(1) << 40}),
+			),
+		)
+		out bytes.Buffer
+	)
+
+	if err := NewExtendExtension(&out, func() SMINode { return tree }, root).Serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 6 || lines[0] != `.1.3.6.1.4.1.898889.1.1 string "two\nlines"` {
+		t.Fatalf("Bad extend output: %q", lines)
+	}
+
+	parsed, err := ParseExtendOutput(&out, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []VarBind{
+		{O(1, 1), AsnOctetString, "two\nlines"},
+		{O(1, 2), AsnInteger, -3},
+		{O(1, 3), AsnCounter32, uint32(42)},
+		{O(2, 1), AsnIpAddress, "10.0.0.1"},
+		{O(2, 2), AsnObjectIdentifier, ".1.3.6.1"},
+		{O(2, 3), AsnCounter64, uint64(1) << 40},
+	}
+
+	var i int
+	Walk(parsed, func(oid OID, leaf *SMILeaf) error {
+		if i >= len(expected) {
+			t.Errorf("Unexpected leaf %s", oid)
+		} else if vb := expected[i]; !oid.Equals(vb.OID) || leaf.Type() != vb.Type {
+			t.Errorf("Got %s %s, wanted %s", oid, leaf, vb)
+		} else if s, ok := vb.Value.(string); ok && (leaf.Type() == AsnIpAddress || leaf.Type() == AsnObjectIdentifier) {
+			if got := fmt.Sprint(leaf.Value()); got != s {
+				t.Errorf("Got %s for %s, wanted %s", got, oid, s)
+			}
+		} else if leaf.Value() != vb.Value {
+			t.Errorf("Got %#v for %s, wanted %#v", leaf.Value(), oid, vb.Value)
+		}
+		i += 1
+		return nil
+	})
+	if i != len(expected) {
+		t.Errorf("Expected %d leaves, got %d", len(expected), i)
+	}
+}
+
+// Test rejection of malformed extend output
+func TestExtendParseErrors(t *testing.T) {
+	tests := []string{
+		".1.3.6.1.4.1.898889.1 integer",
+		".1.3.6.1.4.1.1.1 integer 1",
+		".1.3.6.1.4.1.898889.1 float 1.5",
+		".1.3.6.1.4.1.898889.1 counter -1",
+		".1.3.6.1.4.1.898889.1 string unquoted",
+		".1.3.6.1.4.1.898889.1 ipaddress 10.0.0",
+		".1.3.6.1.4.1.898889.1 integer 1\n.1.3.6.1.4.1.898889.1.2 integer 2",
+	}
+
+	for _, test := range tests {
+		if _, err := ParseExtendOutput(strings.NewReader(test), testAgentRoot); !errors.Is(err, MalformedExtendOutput) {
+			t.Errorf("Expected an error for %q, got %v", test, err)
+		}
+	}
+}
+
+// Test mapping arbitrary script output onto a table
+func TestExtendOutputTable(t *testing.T) {
+	var O = NewOID
+
+	entry, err := ExtendOutputTable(strings.NewReader("eth0 1500 up\neth1 9000\n\nlo 65536 up\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []VarBind{
+		{O(1, 1), AsnOctetString, "eth0"},
+		{O(2, 2), AsnInteger, 9000},
+		{O(3, 2), AsnNull, nil},
+		{O(3, 4), AsnOctetString, "up"},
+		{O(1, 3), AsnNull, nil},
+	}
+
+	for _, test := range tests {
+		node := GetLeaf(entry, test.OID)
+		if test.Type == AsnNull {
+			if node != nil {
+				t.Errorf("Expected nothing at %s, got %s", test.OID, node.Value())
+			}
+		} else if node == nil || node.Value().Type() != test.Type || node.Value().Value() != test.Value {
+			t.Errorf("Bad cell at %s: %v", test.OID, node)
+		}
+	}
+
+	if oid := ExtendOutLineOID("ab"); !oid.Equals(NsExtendOutLine.Add(2, 'a', 'b')) {
+		t.Errorf("Bad nsExtendOutLine OID: %s", oid)
+	}
+}
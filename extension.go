@@ -175,9 +175,8 @@ func (ppe *PassPersistExtension) handleLine(line string) (passPersistState, erro
 			leaf = GetLeaf(ppe.mibTree, partial)
 
 		} else if ppe.currentState == getNextState {
-			if oid = NextLeaf(ppe.mibTree, partial); oid == nil {
-				break
-			} else {
+			// Past the end of the tree, oid is nil and None is returned
+			if oid = NextLeaf(ppe.mibTree, partial); oid != nil {
 				leaf = GetLeaf(ppe.mibTree, oid)
 				// Combine the root OID with the OID we gave to the subtree to get
 				// what we'll use for the response
@@ -185,7 +184,7 @@ func (ppe *PassPersistExtension) handleLine(line string) (passPersistState, erro
 			}
 		}
 
-		if leaf == nil || oid == nil {
+		if leaf == nil || leaf.Value() == nil || oid == nil {
 			fmt.Fprintf(ppe.output, "None\n")
 		} else {
 			logger.Debug(fmt.Sprintf("Responding to %v request for %s with OID %s, val %s", ppe.currentState, ppe.root.Add(partial...), oid, leaf.Value()))
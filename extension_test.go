@@ -1,7 +1,11 @@
 package snmptools
 
 import (
+	"math/rand"
+	"reflect"
+	"sort"
 	"testing"
+	"testing/quick"
 )
 
 // Test getting the node at an OID in the MIB Tree
@@ -164,3 +168,169 @@ func TestGetNextOIDFromMIBTree(t *testing.T) {
 		}
 	}
 }
+
+// malformedNode is a node that is neither a subtree nor a leaf
+type malformedNode struct{}
+
+func (malformedNode) Children() []SMINode { return nil }
+func (malformedNode) Value() *SMILeaf     { return nil }
+
+// Test that GETNEXT skips over empty subtrees and malformed nodes rather than
+// stopping or panicking
+func TestGetNextSkipsEmptySubtrees(t *testing.T) {
+	var O = NewOID
+
+	tree := NewSMISubtree(
+		NewSMISubtree(NewLeafNode(NewSMILeaf(AsnInteger, 1))),
+		NewSMISubtree(),
+		malformedNode{},
+		NewSMISubtree(NewSMISubtree(), nil, NewSMISubtree(NewLeafNode(NewSMILeaf(AsnInteger, 2)))),
+		NewLeafNode(nil),
+	)
+
+	type nextTest struct {
+		target, expected OID
+	}
+
+	tests := []nextTest{
+		{O(1, 1), O(4, 3, 1)},
+		{O(2), O(4, 3, 1)},
+		{O(3, 1, 1), O(4, 3, 1)},
+		{O(4, 1), O(4, 3, 1)},
+		{O(4, 3, 1), nil},
+		{O(5, 1), nil},
+	}
+
+	for _, test := range tests {
+		if oid := NextLeaf(tree, test.target); !oid.Equals(test.expected) {
+			t.Errorf("GETNEXT with %s: got %s, wanted %s", test.target, oid, test.expected)
+		}
+	}
+
+	for _, target := range []OID{O(3), O(3, 1), O(5), O(4, 2), O(0, 1)} {
+		if node := GetLeaf(tree, target); node != nil && node.Value() != nil {
+			t.Errorf("GET with %s: got %v, expected nothing", target, node)
+		}
+	}
+}
+
+// randomTree is a randomly generated SMI tree, used for property-based tests
+type randomTree struct {
+	root SMINode
+	// queries are OIDs to ask for the next leaf of
+	queries []OID
+}
+
+func (randomTree) Generate(rand *rand.Rand, size int) reflect.Value {
+	var (
+		tree randomTree
+		n    int
+	)
+
+	var gen func(depth int, oid OID) SMINode
+	gen = func(depth int, oid OID) SMINode {
+		tree.queries = append(tree.queries, oid)
+
+		switch r := rand.Intn(10); {
+		case depth > 4 || r < 4:
+			n += 1
+			return NewLeafNode(NewSMILeaf(AsnInteger, n))
+		case r == 4:
+			return nil
+		case r == 5:
+			return malformedNode{}
+		case r == 6:
+			branch := NewSMISparseSubtree()
+			for i := rand.Intn(6); i > 0; i -= 1 {
+				arc := uint32(rand.Intn(20))
+				branch.SetChild(arc, gen(depth+1, oid.Add(arc)))
+			}
+			return branch
+		default:
+			branch := NewSMISubtree()
+			for i := rand.Intn(6); i > 0; i -= 1 {
+				branch.AddChild(gen(depth+1, oid.Add(uint32(len(branch.leaves)+1))))
+			}
+			return branch
+		}
+	}
+
+	tree.root = NewSMISubtree()
+	for i := rand.Intn(size + 1); i > 0; i -= 1 {
+		tree.root.(*SMISubtree).AddChild(gen(1, NewOID(uint32(i))))
+	}
+
+	// Also ask about some OIDs that are not in the tree
+	for i := 0; i < 10; i += 1 {
+		oid := make(OID, rand.Intn(6))
+		for j := range oid {
+			oid[j] = uint32(rand.Intn(7))
+		}
+		tree.queries = append(tree.queries, oid)
+	}
+
+	return reflect.ValueOf(tree)
+}
+
+// bruteForceLeaves lists the OIDs of every leaf in a tree, sorted
+func bruteForceLeaves(node SMINode, prefix OID) []OID {
+	var oids []OID
+
+	if node == nil {
+		return nil
+	} else if node.Children() == nil {
+		if node.Value() != nil {
+			oids = append(oids, prefix)
+		}
+		return oids
+	}
+
+	arcs := childArcs(node)
+	for i, child := range node.Children() {
+		arc := uint32(i + 1)
+		if arcs != nil {
+			arc = arcs[i]
+		}
+		oids = append(oids, bruteForceLeaves(child, prefix.Add(arc))...)
+	}
+
+	sort.Slice(oids, func(i, j int) bool {
+		return oids[i].Compare(oids[j]) < 0
+	})
+
+	return oids
+}
+
+// Test NextLeaf against a brute-force sorted list of leaves
+func TestGetNextProperty(t *testing.T) {
+	property := func(tree randomTree) bool {
+		leaves := bruteForceLeaves(tree.root, NewOID())
+
+		for _, query := range tree.queries {
+			var expected OID
+			if i := sort.Search(len(leaves), func(i int) bool {
+				return leaves[i].Compare(query) > 0
+			}); i < len(leaves) {
+				expected = leaves[i]
+			}
+
+			if got := NextLeaf(tree.root, query); !got.Equals(expected) {
+				t.Logf("GETNEXT with %s: got %s, wanted %s", query, got, expected)
+				return false
+			}
+		}
+
+		// Walking the tree must visit the same leaves in the same order
+		var walked []OID
+		Walk(tree.root, func(oid OID, leaf *SMILeaf) error {
+			walked = append(walked, oid)
+			return nil
+		})
+
+		return reflect.DeepEqual(walked, leaves) || (len(walked) == 0 && len(leaves) == 0)
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,676 @@
+package snmptools
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// Host errors
+	MalformedProcFile = fmt.Errorf("Malformed /proc file")
+)
+
+// Where the trees built by a HostProvider are laid out in the standard MIBs
+var (
+	HostResourcesRoot = NewOID(1, 3, 6, 1, 2, 1, 25)
+	InterfacesRoot    = NewOID(1, 3, 6, 1, 2, 1, 2)
+	IfXTableRoot      = NewOID(1, 3, 6, 1, 2, 1, 31, 1, 1)
+	LaTableRoot       = NewOID(1, 3, 6, 1, 4, 1, 2021, 10)
+)
+
+// HOST-RESOURCES-MIB type OIDs
+var (
+	hrStorageRam         = NewOID(1, 3, 6, 1, 2, 1, 25, 2, 1, 2)
+	hrStorageVirtual     = NewOID(1, 3, 6, 1, 2, 1, 25, 2, 1, 3)
+	hrStorageFixedDisk   = NewOID(1, 3, 6, 1, 2, 1, 25, 2, 1, 4)
+	hrStorageNetworkDisk = NewOID(1, 3, 6, 1, 2, 1, 25, 2, 1, 10)
+	hrDeviceProcessor    = NewOID(1, 3, 6, 1, 2, 1, 25, 3, 1, 3)
+	zeroDotZero          = NewOID(0, 0)
+)
+
+// The hrStorageIndex of memory, swap and the first filesystem, and the
+// hrDeviceIndex of the first CPU, as used by net-snmp
+const (
+	hrMemoryIndex     = 1
+	hrSwapIndex       = 10
+	hrFilesystemIndex = 31
+	hrCPUIndex        = 768
+)
+
+// HostProvider builds SMI trees describing a Linux host from /proc and /sys,
+// for hosts whose snmpd does not support HOST-RESOURCES-MIB or IF-MIB well.
+//
+// Each tree is laid out like the corresponding part of the standard MIB, and
+// should be served at the matching root:
+//
+//	HostResources()  HostResourcesRoot  hrSystem, hrStorage and hrDevice
+//	Interfaces()     InterfacesRoot     ifNumber and ifTable
+//	IfXTable()       IfXTableRoot       ifXTable, with 64 bit counters
+//	LoadAverages()   LaTableRoot        UCD-SNMP-MIB's laTable
+//
+// For example, to serve the interfaces with a pass persist extension:
+//
+//	hp := NewHostProvider()
+//	callback := func() SMINode {
+//		tree, err := hp.Interfaces()
+//		if err != nil {
+//			log.Print(err)
+//		}
+//		return tree
+//	}
+//	NewPassPersistExtension(os.Stdin, os.Stdout, callback, InterfacesRoot)
+type HostProvider struct {
+	// ProcPath and SysPath are where procfs and sysfs are mounted
+	ProcPath string
+	SysPath  string
+
+	// statfs reports the size of a filesystem; it is replaced in tests
+	statfs func(path string) (fsStats, error)
+
+	mu sync.Mutex
+	// cpuTimes holds the busy and total jiffies of each CPU at the last call
+	// to HostResources(), so that their load can be measured since then
+	cpuTimes map[string][2]uint64
+}
+
+// fsStats is the part of statfs(2) that HostProvider uses.
+type fsStats struct {
+	blockSize uint64
+	blocks    uint64
+	free      uint64
+}
+
+// NewHostProvider() creates a HostProvider reading /proc and /sys.
+func NewHostProvider() *HostProvider {
+	return &HostProvider{
+		ProcPath: "/proc",
+		SysPath:  "/sys",
+		statfs:   statfs,
+		cpuTimes: make(map[string][2]uint64),
+	}
+}
+
+// HostResources() builds a tree laid out like HOST-RESOURCES-MIB, with:
+//
+//   - hrSystemUptime and hrSystemProcesses;
+//   - hrMemorySize, and an hrStorageTable holding physical memory, swap space
+//     and the mounted filesystems;
+//   - an hrDeviceTable and hrProcessorTable with a row for each CPU. The load
+//     of each CPU is measured since the previous call.
+func (p *HostProvider) HostResources() (SMINode, error) {
+	var tree = NewSMISparseSubtree()
+
+	// hrSystem
+	uptime, err := p.readFields("uptime")
+	if err != nil {
+		return nil, err
+	} else if len(uptime) < 1 || len(uptime[0]) < 1 {
+		return nil, fmt.Errorf("%w: uptime", MalformedProcFile)
+	}
+	seconds, err := strconv.ParseFloat(uptime[0][0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: uptime: %s", MalformedProcFile, err)
+	}
+	if err := insertLeaf(tree, NewOID(1, 1), AsnTimeTicks, uint32(uint64(seconds*100))); err != nil {
+		return nil, err
+	}
+
+	if load, err := p.readLoadAverage(); err != nil {
+		return nil, err
+	} else if processes := strings.SplitN(load[3], "/", 2); len(processes) == 2 {
+		if n, err := strconv.ParseUint(processes[1], 10, 32); err == nil {
+			if err := insertLeaf(tree, NewOID(1, 6), AsnGauge32, uint32(n)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// hrStorage
+	meminfo, err := p.readMeminfo()
+	if err != nil {
+		return nil, err
+	}
+	if err := insertLeaf(tree, NewOID(2, 2), AsnInteger, int(meminfo["MemTotal"])); err != nil {
+		return nil, err
+	}
+
+	available, ok := meminfo["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14 do not report MemAvailable
+		available = meminfo["MemFree"] + meminfo["Buffers"] + meminfo["Cached"]
+	}
+
+	storage := NewOID(2, 3, 1)
+	if err := insertStorage(tree, storage, hrMemoryIndex, hrStorageRam, "Physical memory", 1024, meminfo["MemTotal"], meminfo["MemTotal"]-available); err != nil {
+		logger.Warning(fmt.Sprintf("Skipping physical memory: %s", err))
+	}
+	if err := insertStorage(tree, storage, hrSwapIndex, hrStorageVirtual, "Swap space", 1024, meminfo["SwapTotal"], meminfo["SwapTotal"]-meminfo["SwapFree"]); err != nil {
+		logger.Warning(fmt.Sprintf("Skipping swap space: %s", err))
+	}
+
+	mounts, err := p.readFields("mounts")
+	if err != nil {
+		return nil, err
+	}
+
+	index := hrFilesystemIndex
+	for _, mount := range mounts {
+		if len(mount) < 3 {
+			continue
+		}
+
+		var device, dir, fsType = mount[0], unescapeMountPath(mount[1]), mount[2]
+		storageType := hrStorageFixedDisk
+		switch {
+		case fsType == "nfs" || fsType == "nfs4" || fsType == "cifs" || fsType == "smb3":
+			storageType = hrStorageNetworkDisk
+		case !strings.HasPrefix(device, "/"):
+			// Pseudo-filesystems such as proc and tmpfs
+			continue
+		}
+
+		stats, err := p.statfs(dir)
+		if err != nil {
+			logger.Debug(fmt.Sprintf("Could not statfs %s: %s", dir, err))
+			continue
+		}
+
+		if err := insertStorage(tree, storage, index, storageType, dir, stats.blockSize, stats.blocks, stats.blocks-stats.free); err != nil {
+			logger.Warning(fmt.Sprintf("Skipping filesystem %s: %s", dir, err))
+			continue
+		}
+		index += 1
+	}
+
+	// hrDevice
+	cpus, err := p.cpuLoads()
+	if err != nil {
+		return nil, err
+	}
+	for i, load := range cpus {
+		var (
+			index  = uint32(hrCPUIndex + i)
+			device = NewOID(3, 2, 1)
+			cpu    = NewOID(3, 3, 1)
+		)
+
+		err := insertRow(tree, device, index, map[uint32]*SMILeaf{
+			1: {AsnInteger, int(index)},
+			2: {AsnObjectIdentifier, hrDeviceProcessor},
+			3: {AsnOctetString, fmt.Sprintf("cpu%d", i)},
+			4: {AsnObjectIdentifier, zeroDotZero},
+			// running(2)
+			5: {AsnInteger, 2},
+		})
+		if err == nil {
+			err = insertRow(tree, cpu, index, map[uint32]*SMILeaf{
+				1: {AsnObjectIdentifier, zeroDotZero},
+				2: {AsnInteger, load},
+			})
+		}
+		if err != nil {
+			logger.Warning(fmt.Sprintf("Skipping cpu%d: %s", i, err))
+		}
+	}
+
+	return tree, nil
+}
+
+// insertStorage adds a row to hrStorageTable. hrStorageSize and
+// hrStorageUsed are Integer32s, so the allocation units are scaled up until
+// the sizes fit.
+func insertStorage(tree *SMISparseSubtree, entry OID, index int, storageType OID, descr string, units, size, used uint64) error {
+	for size > 0x7fffffff {
+		units, size, used = units*2, size/2, used/2
+	}
+
+	return insertRow(tree, entry, uint32(index), map[uint32]*SMILeaf{
+		1: {AsnInteger, index},
+		2: {AsnObjectIdentifier, storageType},
+		3: {AsnOctetString, descr},
+		4: {AsnInteger, int(units)},
+		5: {AsnInteger, int(size)},
+		6: {AsnInteger, int(used)},
+		7: {AsnCounter32, uint32(0)},
+	})
+}
+
+// cpuLoads returns the load of each CPU, as a percentage, since the last
+// call.
+func (p *HostProvider) cpuLoads() ([]int, error) {
+	stat, err := p.readFields("stat")
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var loads []int
+	for _, fields := range stat {
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+
+		var busy, total uint64
+		for i, field := range fields[1:] {
+			n, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: stat: %s", MalformedProcFile, err)
+			}
+			if i >= 8 {
+				// guest time is already counted in user time
+				break
+			}
+			total += n
+			// Everything but idle and iowait
+			if i != 3 && i != 4 {
+				busy += n
+			}
+		}
+
+		prev := p.cpuTimes[fields[0]]
+		p.cpuTimes[fields[0]] = [2]uint64{busy, total}
+
+		var load int
+		if total > prev[1] && busy >= prev[0] {
+			load = int((busy - prev[0]) * 100 / (total - prev[1]))
+		}
+		loads = append(loads, load)
+	}
+
+	return loads, nil
+}
+
+// Interfaces() builds a tree laid out like the interfaces group of IF-MIB:
+// ifNumber, and an ifTable with a row for each interface in /proc/net/dev.
+//
+// The counters are Counter32s, which wrap around; IfXTable() has 64 bit
+// counters.
+func (p *HostProvider) Interfaces() (SMINode, error) {
+	ifaces, err := p.readInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		tree  = NewSMISparseSubtree()
+		entry = NewOID(2, 1)
+	)
+
+	if err := insertLeaf(tree, NewOID(1), AsnInteger, len(ifaces)); err != nil {
+		return nil, err
+	}
+
+	for _, iface := range ifaces {
+		var (
+			i   = iface.index
+			c32 = func(n uint64) uint32 { return uint32(n) }
+		)
+
+		err := insertRow(tree, entry, i, map[uint32]*SMILeaf{
+			1:  {AsnInteger, int(i)},
+			2:  {AsnOctetString, iface.name},
+			3:  {AsnInteger, iface.ifType},
+			4:  {AsnInteger, iface.mtu},
+			5:  {AsnGauge32, clampUint32(iface.speed * 1000000)},
+			6:  {AsnOctetString, iface.address},
+			7:  {AsnInteger, iface.adminStatus},
+			8:  {AsnInteger, iface.operStatus},
+			10: {AsnCounter32, c32(iface.rx[devBytes])},
+			11: {AsnCounter32, c32(iface.rx[devPackets] - iface.rx[devMulticast])},
+			12: {AsnCounter32, c32(iface.rx[devMulticast])},
+			13: {AsnCounter32, c32(iface.rx[devDrop])},
+			14: {AsnCounter32, c32(iface.rx[devErrs])},
+			16: {AsnCounter32, c32(iface.tx[devBytes])},
+			17: {AsnCounter32, c32(iface.tx[devPackets])},
+			19: {AsnCounter32, c32(iface.tx[devDrop])},
+			20: {AsnCounter32, c32(iface.tx[devErrs])},
+		})
+		if err != nil {
+			logger.Warning(fmt.Sprintf("Skipping interface %s: %s", iface.name, err))
+		}
+	}
+
+	return tree, nil
+}
+
+// IfXTable() builds a tree laid out like IF-MIB's ifXTable, with the name,
+// 64 bit counters and speed in megabits per second of each interface.
+func (p *HostProvider) IfXTable() (SMINode, error) {
+	ifaces, err := p.readInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		tree  = NewSMISparseSubtree()
+		entry = NewOID(1)
+	)
+
+	for _, iface := range ifaces {
+		err := insertRow(tree, entry, iface.index, map[uint32]*SMILeaf{
+			1:  {AsnOctetString, iface.name},
+			6:  {AsnCounter64, iface.rx[devBytes]},
+			7:  {AsnCounter64, iface.rx[devPackets] - iface.rx[devMulticast]},
+			8:  {AsnCounter64, iface.rx[devMulticast]},
+			10: {AsnCounter64, iface.tx[devBytes]},
+			11: {AsnCounter64, iface.tx[devPackets]},
+			15: {AsnGauge32, clampUint32(iface.speed)},
+		})
+		if err != nil {
+			logger.Warning(fmt.Sprintf("Skipping interface %s: %s", iface.name, err))
+		}
+	}
+
+	return tree, nil
+}
+
+// LoadAverages() builds a tree laid out like UCD-SNMP-MIB's laTable, with the
+// 1, 5 and 15 minute load averages.
+func (p *HostProvider) LoadAverages() (SMINode, error) {
+	load, err := p.readLoadAverage()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		tree  = NewSMISparseSubtree()
+		entry = NewOID(1)
+	)
+
+	for i, name := range []string{"Load-1", "Load-5", "Load-15"} {
+		f, err := strconv.ParseFloat(load[i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: loadavg: %s", MalformedProcFile, err)
+		}
+
+		err = insertRow(tree, entry, uint32(i+1), map[uint32]*SMILeaf{
+			1: {AsnInteger, i + 1},
+			2: {AsnOctetString, name},
+			3: {AsnOctetString, load[i]},
+			5: {AsnInteger, int(f*100 + 0.5)},
+		})
+		if err != nil {
+			logger.Warning(fmt.Sprintf("Skipping %s: %s", name, err))
+		}
+	}
+
+	return tree, nil
+}
+
+// Fields of /proc/net/dev, for each direction
+const (
+	devBytes = iota
+	devPackets
+	devErrs
+	devDrop
+	devFifo
+	devFrame
+	devCompressed
+	devMulticast
+)
+
+// hostInterface is a network interface, from /proc/net/dev and
+// /sys/class/net.
+type hostInterface struct {
+	name   string
+	index  uint32
+	rx, tx [8]uint64
+
+	ifType      int
+	mtu         int
+	speed       uint64
+	address     []byte
+	adminStatus int
+	operStatus  int
+}
+
+// readInterfaces lists the interfaces in /proc/net/dev. Their details are
+// read from sysfs where it is available; interfaces without an ifindex there
+// are numbered in the order they are listed, skipping the indexes of the
+// others.
+func (p *HostProvider) readInterfaces() ([]*hostInterface, error) {
+	lines, err := p.readLines(filepath.Join(p.ProcPath, "net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+
+	var ifaces []*hostInterface
+	for _, line := range lines {
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			// One of the header lines
+			continue
+		}
+
+		var (
+			iface  = &hostInterface{name: strings.TrimSpace(line[:colon])}
+			fields = strings.Fields(line[colon+1:])
+		)
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("%w: net/dev: %s", MalformedProcFile, line)
+		}
+		for i, field := range fields[:16] {
+			n, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: net/dev: %s", MalformedProcFile, err)
+			}
+			if i < 8 {
+				iface.rx[i] = n
+			} else {
+				iface.tx[i-8] = n
+			}
+		}
+
+		p.readSysInterface(iface)
+		ifaces = append(ifaces, iface)
+	}
+
+	var used = make(map[uint32]bool)
+	for _, iface := range ifaces {
+		used[iface.index] = true
+	}
+
+	var next uint32 = 1
+	for _, iface := range ifaces {
+		if iface.index != 0 {
+			continue
+		}
+		for used[next] {
+			next += 1
+		}
+		iface.index, used[next] = next, true
+	}
+
+	return ifaces, nil
+}
+
+// readSysInterface fills in the details of an interface from sysfs. The
+// index is left at zero if sysfs does not give one.
+func (p *HostProvider) readSysInterface(iface *hostInterface) {
+	var (
+		dir  = filepath.Join(p.SysPath, "class", "net", iface.name)
+		read = func(name string) string {
+			b, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return ""
+			}
+			return strings.TrimSpace(string(b))
+		}
+	)
+
+	if n, err := strconv.ParseUint(read("ifindex"), 10, 32); err == nil {
+		iface.index = uint32(n)
+	}
+
+	// ethernetCsmacd(6) and softwareLoopback(24), from the ARPHRD type, or
+	// other(1)
+	switch read("type") {
+	case "1":
+		iface.ifType = 6
+	case "772":
+		iface.ifType = 24
+	default:
+		iface.ifType = 1
+	}
+
+	iface.mtu, _ = strconv.Atoi(read("mtu"))
+	if speed, err := strconv.ParseUint(read("speed"), 10, 64); err == nil {
+		iface.speed = speed
+	}
+
+	if addr := read("address"); addr != "" {
+		for _, octet := range strings.Split(addr, ":") {
+			if b, err := strconv.ParseUint(octet, 16, 8); err == nil {
+				iface.address = append(iface.address, byte(b))
+			}
+		}
+	}
+	if iface.address == nil {
+		iface.address = []byte{}
+	}
+
+	// up(1) or down(2); IFF_UP is the lowest bit of the flags
+	iface.adminStatus = 2
+	if flags, err := strconv.ParseUint(strings.TrimPrefix(read("flags"), "0x"), 16, 32); err == nil && flags&1 != 0 {
+		iface.adminStatus = 1
+	}
+
+	switch read("operstate") {
+	case "up":
+		iface.operStatus = 1
+	case "down":
+		iface.operStatus = 2
+	case "testing":
+		iface.operStatus = 3
+	case "dormant":
+		iface.operStatus = 5
+	case "notpresent":
+		iface.operStatus = 6
+	case "lowerlayerdown":
+		iface.operStatus = 7
+	default:
+		// unknown(4)
+		iface.operStatus = 4
+	}
+}
+
+// readLoadAverage returns the fields of /proc/loadavg.
+func (p *HostProvider) readLoadAverage() ([]string, error) {
+	fields, err := p.readFields("loadavg")
+	if err != nil {
+		return nil, err
+	} else if len(fields) < 1 || len(fields[0]) < 4 {
+		return nil, fmt.Errorf("%w: loadavg", MalformedProcFile)
+	}
+	return fields[0], nil
+}
+
+// readMeminfo returns the sizes in /proc/meminfo, in kilobytes.
+func (p *HostProvider) readMeminfo() (map[string]uint64, error) {
+	fields, err := p.readFields("meminfo")
+	if err != nil {
+		return nil, err
+	}
+
+	var meminfo = make(map[string]uint64)
+	for _, field := range fields {
+		if len(field) < 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(field[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: meminfo: %s", MalformedProcFile, err)
+		}
+		meminfo[strings.TrimSuffix(field[0], ":")] = n
+	}
+	return meminfo, nil
+}
+
+// readFields reads a file in /proc, split into lines of whitespace-separated
+// fields.
+func (p *HostProvider) readFields(name string) ([][]string, error) {
+	lines, err := p.readLines(filepath.Join(p.ProcPath, name))
+	if err != nil {
+		return nil, err
+	}
+
+	var fields = make([][]string, len(lines))
+	for i, line := range lines {
+		fields[i] = strings.Fields(line)
+	}
+	return fields, nil
+}
+
+func (p *HostProvider) readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		lines   []string
+		scanner = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// unescapeMountPath undoes the octal escaping of spaces and other special
+// characters in /proc/mounts.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b []byte
+	for i := 0; i < len(s); i += 1 {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b = append(b, byte(n))
+				i += 3
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+// insertLeaf adds a leaf to a tree being built.
+func insertLeaf(tree *SMISparseSubtree, oid OID, t AsnType, value interface{}) error {
+	return tree.Insert(oid, NewLeafNode(&SMILeaf{t, value}))
+}
+
+// insertRow adds a row to a table being built, with the leaf of each column
+// at entry.column.index. It fails without adding anything if the row is
+// already in the table, or would conflict with the rest of the tree.
+func insertRow(tree *SMISparseSubtree, entry OID, index uint32, columns map[uint32]*SMILeaf) error {
+	for column := range columns {
+		oid := entry.Add(column, index)
+		if GetLeaf(tree, oid) != nil {
+			return fmt.Errorf("%w: %s already exists", OIDConflict, oid)
+		}
+		for i := range oid {
+			if node := GetLeaf(tree, oid[:i]); node != nil && node.Children() == nil {
+				return fmt.Errorf("%w: %s", OIDConflict, oid)
+			}
+		}
+	}
+
+	for column, leaf := range columns {
+		if err := insertLeaf(tree, entry.Add(column, index), leaf.asnType, leaf.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
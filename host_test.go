@@ -0,0 +1,200 @@
+package snmptools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// newTestHostProvider reads the fixtures in testdata, with every filesystem
+// 100GB in size and a quarter used
+func newTestHostProvider() *HostProvider {
+	hp := NewHostProvider()
+	hp.ProcPath = "testdata/proc"
+	hp.SysPath = "testdata/sys"
+	hp.statfs = func(path string) (fsStats, error) {
+		if path == "/mnt/nas" {
+			return fsStats{}, fmt.Errorf("stale file handle")
+		}
+		return fsStats{4096, 25000000, 18750000}, nil
+	}
+	return hp
+}
+
+// checkLeaves compares leaves of a tree with their expected values
+func checkLeaves(t *testing.T, tree SMINode, expected []VarBind) {
+	t.Helper()
+
+	for _, vb := range expected {
+		node := GetLeaf(tree, vb.OID)
+		if node == nil || node.Value() == nil {
+			t.Errorf("No leaf at %s", vb.OID)
+			continue
+		}
+
+		leaf := node.Value()
+		if leaf.Type() != vb.Type {
+			t.Errorf("Bad type at %s: got %s, wanted %s", vb.OID, leaf.Type().PrettyString(), vb.Type.PrettyString())
+		} else if b, ok := vb.Value.([]byte); ok {
+			if !bytes.Equal(leaf.Value().([]byte), b) {
+				t.Errorf("Bad value at %s: got %v, wanted %v", vb.OID, leaf.Value(), b)
+			}
+		} else if fmt.Sprint(leaf.Value()) != fmt.Sprint(vb.Value) {
+			t.Errorf("Bad value at %s: got %v, wanted %v", vb.OID, leaf.Value(), vb.Value)
+		}
+	}
+}
+
+func TestHostResources(t *testing.T) {
+	var (
+		O  = NewOID
+		hp = newTestHostProvider()
+	)
+
+	tree, err := hp.HostResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLeaves(t, tree, []VarBind{
+		{O(1, 1), AsnTimeTicks, uint32(35234567)},
+		{O(1, 6), AsnGauge32, uint32(345)},
+		{O(2, 2), AsnInteger, 8000000},
+
+		// Physical memory and swap
+		{O(2, 3, 1, 2, 1), AsnObjectIdentifier, hrStorageRam},
+		{O(2, 3, 1, 5, 1), AsnInteger, 8000000},
+		{O(2, 3, 1, 6, 1), AsnInteger, 2000000},
+		{O(2, 3, 1, 3, 10), AsnOctetString, "Swap space"},
+		{O(2, 3, 1, 6, 10), AsnInteger, 500000},
+
+		// The root filesystem, and a mount point with a space in it
+		{O(2, 3, 1, 3, 31), AsnOctetString, "/"},
+		{O(2, 3, 1, 4, 31), AsnInteger, 4096},
+		{O(2, 3, 1, 5, 31), AsnInteger, 25000000},
+		{O(2, 3, 1, 6, 31), AsnInteger, 6250000},
+		{O(2, 3, 1, 3, 32), AsnOctetString, "/srv/big data"},
+
+		// CPU load since boot
+		{O(3, 2, 1, 2, 768), AsnObjectIdentifier, hrDeviceProcessor},
+		{O(3, 2, 1, 3, 769), AsnOctetString, "cpu1"},
+		{O(3, 3, 1, 2, 768), AsnInteger, 15},
+		{O(3, 3, 1, 2, 769), AsnInteger, 25},
+	})
+
+	// Pseudo-filesystems and those that cannot be measured are left out
+	if node := GetLeaf(tree, O(2, 3, 1, 1, 33)); node != nil {
+		t.Errorf("Unexpected filesystem: %v", node)
+	}
+
+	// The load is measured between calls; nothing has changed since
+	tree, _ = hp.HostResources()
+	checkLeaves(t, tree, []VarBind{{O(3, 3, 1, 2, 768), AsnInteger, 0}})
+}
+
+func TestHostInterfaces(t *testing.T) {
+	var (
+		O  = NewOID
+		hp = newTestHostProvider()
+	)
+
+	tree, err := hp.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLeaves(t, tree, []VarBind{
+		{O(1), AsnInteger, 3},
+		{O(2, 1, 2, 1), AsnOctetString, "lo"},
+		{O(2, 1, 3, 1), AsnInteger, 24},
+		{O(2, 1, 7, 1), AsnInteger, 1},
+		{O(2, 1, 8, 1), AsnInteger, 4},
+		{O(2, 1, 3, 2), AsnInteger, 6},
+		{O(2, 1, 4, 2), AsnInteger, 1500},
+		{O(2, 1, 5, 2), AsnGauge32, uint32(0xffffffff)},
+		{O(2, 1, 6, 2), AsnOctetString, []byte{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}},
+		{O(2, 1, 8, 2), AsnInteger, 1},
+		// 9876543210 wraps around
+		{O(2, 1, 10, 2), AsnCounter32, uint32(1286608618)},
+		{O(2, 1, 11, 2), AsnCounter32, uint32(6999000)},
+		{O(2, 1, 12, 2), AsnCounter32, uint32(1000)},
+		{O(2, 1, 13, 2), AsnCounter32, uint32(5)},
+		{O(2, 1, 14, 2), AsnCounter32, uint32(3)},
+		{O(2, 1, 17, 2), AsnCounter32, uint32(4000000)},
+		// wg0 has no ifindex in sysfs, and is listed second, but eth0 has
+		// index 2
+		{O(2, 1, 1, 3), AsnInteger, 3},
+		{O(2, 1, 2, 3), AsnOctetString, "wg0"},
+		{O(2, 1, 10, 3), AsnCounter32, uint32(2000)},
+	})
+
+	tree, err = hp.IfXTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLeaves(t, tree, []VarBind{
+		{O(1, 1, 2), AsnOctetString, "eth0"},
+		{O(1, 6, 2), AsnCounter64, uint64(9876543210)},
+		{O(1, 10, 2), AsnCounter64, uint64(5000000000)},
+		{O(1, 15, 2), AsnGauge32, uint32(10000)},
+		{O(1, 15, 1), AsnGauge32, uint32(0)},
+	})
+
+	// Without sysfs, interfaces are numbered in order
+	hp.SysPath = "testdata/missing"
+	tree, err = hp.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLeaves(t, tree, []VarBind{
+		{O(2, 1, 2, 2), AsnOctetString, "wg0"},
+		{O(2, 1, 2, 3), AsnOctetString, "eth0"},
+		{O(2, 1, 3, 3), AsnInteger, 1},
+		{O(2, 1, 7, 3), AsnInteger, 2},
+	})
+}
+
+func TestInsertRow(t *testing.T) {
+	var (
+		O    = NewOID
+		tree = NewSMISparseSubtree()
+		row  = map[uint32]*SMILeaf{1: {AsnInteger, 1}, 2: {AsnOctetString, "lo"}}
+	)
+
+	if err := insertRow(tree, O(2, 1), 1, row); err != nil {
+		t.Fatal(err)
+	}
+
+	// A row that is already there, or would be beneath a leaf, is skipped
+	if err := insertRow(tree, O(2, 1), 1, map[uint32]*SMILeaf{2: {AsnOctetString, "eth0"}}); !errors.Is(err, OIDConflict) {
+		t.Errorf("Expected OIDConflict, got %v", err)
+	}
+	if err := insertRow(tree, O(2, 1, 2), 1, row); !errors.Is(err, OIDConflict) {
+		t.Errorf("Expected OIDConflict, got %v", err)
+	}
+	checkLeaves(t, tree, []VarBind{{O(2, 1, 2, 1), AsnOctetString, "lo"}})
+}
+
+func TestHostLoadAverages(t *testing.T) {
+	var O = NewOID
+
+	tree, err := newTestHostProvider().LoadAverages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLeaves(t, tree, []VarBind{
+		{O(1, 2, 1), AsnOctetString, "Load-1"},
+		{O(1, 3, 1), AsnOctetString, "0.52"},
+		{O(1, 5, 1), AsnInteger, 52},
+		{O(1, 5, 3), AsnInteger, 105},
+	})
+
+	hp := newTestHostProvider()
+	hp.ProcPath = "testdata/missing"
+	if _, err := hp.LoadAverages(); err == nil {
+		t.Errorf("Expected an error without /proc")
+	}
+}
@@ -0,0 +1,249 @@
+package snmptools
+
+import (
+	"fmt"
+	"net"
+)
+
+var (
+	// Table index errors
+	BadIndex = fmt.Errorf("Bad table index")
+)
+
+// IndexKind is the syntax of an INDEX object, which determines how its values
+// are encoded in instance OIDs (RFC 2578 section 7.7).
+type IndexKind int
+
+const (
+	// INTEGER, Unsigned32 and the like: one sub-identifier
+	IntegerIndex IndexKind = iota
+	// OCTET STRING: the length, then one sub-identifier per octet
+	StringIndex
+	// OBJECT IDENTIFIER: the length, then the sub-identifiers
+	OIDIndex
+	// IpAddress: four sub-identifiers
+	IpAddressIndex
+	// InetAddress: encoded as an OCTET STRING holding an IPv4 or IPv6
+	// address, or a DNS name
+	InetAddressIndex
+)
+
+var indexKindStrings = []string{
+	"integer",
+	"string",
+	"OID",
+	"IpAddress",
+	"InetAddress",
+}
+
+func (k IndexKind) String() string {
+	if k >= 0 && int(k) < len(indexKindStrings) {
+		return indexKindStrings[k]
+	}
+	return fmt.Sprintf("IndexKind(%d)", int(k))
+}
+
+// Index describes an object in the INDEX clause of a table.
+type Index struct {
+	Kind IndexKind
+	// Implied means the length is left out, as in an INDEX clause naming
+	// the object IMPLIED. Only the last index of a table may be implied.
+	Implied bool
+	// Size is the length of an OCTET STRING with a fixed size, which is also
+	// left out; it is zero for strings whose length varies.
+	Size int
+}
+
+// AddIndex() returns the OID with the instance of a table row appended,
+// encoding one value for each index:
+//
+//   - IntegerIndex takes any integer that fits a sub-identifier;
+//   - StringIndex takes a string or []byte;
+//   - OIDIndex takes an OID;
+//   - IpAddressIndex takes a net.IP holding an IPv4 address;
+//   - InetAddressIndex takes a net.IP, or a string holding a DNS name.
+//
+// For example, a row of ipNetToPhysicalTable, which is indexed by
+// ifIndex, InetAddressType and InetAddress, is at:
+//
+//	column.AddIndex([]Index{{Kind: IntegerIndex}, {Kind: IntegerIndex}, {Kind: InetAddressIndex}}, 2, 1, net.ParseIP("192.0.2.1"))
+func (oid OID) AddIndex(indexes []Index, values ...interface{}) (OID, error) {
+	if len(values) != len(indexes) {
+		return nil, fmt.Errorf("%w: %d values for %d indexes", BadIndex, len(values), len(indexes))
+	}
+
+	var instance = oid.Copy()
+	for i, index := range indexes {
+		if index.Implied && i != len(indexes)-1 {
+			return nil, fmt.Errorf("%w: only the last index can be implied", BadIndex)
+		}
+
+		arcs, err := index.encode(values[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w %d: %s", BadIndex, i+1, err)
+		}
+		instance = append(instance, arcs...)
+	}
+
+	return instance, nil
+}
+
+// DecodeIndex() reads the values of the indexes from the instance of a table
+// row, which must be exactly the OID. It is the inverse of AddIndex(), and
+// returns uint32s for IntegerIndex, strings for StringIndex, OIDs for
+// OIDIndex and net.IPs for IpAddressIndex. InetAddressIndex gives net.IPs for
+// four and sixteen octets, and strings for anything else.
+func (oid OID) DecodeIndex(indexes ...Index) ([]interface{}, error) {
+	var values = make([]interface{}, 0, len(indexes))
+
+	for i, index := range indexes {
+		if index.Implied && i != len(indexes)-1 {
+			return nil, fmt.Errorf("%w: only the last index can be implied", BadIndex)
+		}
+
+		value, rest, err := index.decode(oid)
+		if err != nil {
+			return nil, fmt.Errorf("%w %d: %s", BadIndex, i+1, err)
+		}
+		values = append(values, value)
+		oid = rest
+	}
+
+	if len(oid) != 0 {
+		return nil, fmt.Errorf("%w: %d sub-identifiers left over", BadIndex, len(oid))
+	}
+	return values, nil
+}
+
+// encode returns the sub-identifiers of one index value.
+func (index Index) encode(value interface{}) (OID, error) {
+	switch index.Kind {
+	case IntegerIndex:
+		if u, ok := toUint64(value); ok && u <= 0xffffffff {
+			return OID{uint32(u)}, nil
+		}
+		return nil, fmt.Errorf("%v is not a sub-identifier", value)
+
+	case StringIndex:
+		switch s := value.(type) {
+		case string:
+			return index.encodeOctets([]byte(s))
+		case []byte:
+			return index.encodeOctets(s)
+		}
+
+	case OIDIndex:
+		if o, ok := value.(OID); ok {
+			if index.Implied {
+				return o.Copy(), nil
+			}
+			return append(OID{uint32(len(o))}, o...), nil
+		}
+
+	case IpAddressIndex:
+		if ip, ok := value.(net.IP); ok && ip.To4() != nil {
+			ip = ip.To4()
+			return OID{uint32(ip[0]), uint32(ip[1]), uint32(ip[2]), uint32(ip[3])}, nil
+		}
+
+	case InetAddressIndex:
+		switch a := value.(type) {
+		case net.IP:
+			if ip4 := a.To4(); ip4 != nil {
+				return index.encodeOctets(ip4)
+			} else if len(a) == net.IPv6len {
+				return index.encodeOctets(a)
+			}
+		case string:
+			return index.encodeOctets([]byte(a))
+		}
+	}
+
+	return nil, fmt.Errorf("%T cannot be encoded as a %s", value, index.Kind)
+}
+
+func (index Index) encodeOctets(b []byte) (OID, error) {
+	var arcs = make(OID, 0, len(b)+1)
+
+	if index.Size != 0 {
+		if len(b) != index.Size {
+			return nil, fmt.Errorf("%d octets for a size of %d", len(b), index.Size)
+		}
+	} else if !index.Implied {
+		arcs = append(arcs, uint32(len(b)))
+	}
+
+	for _, c := range b {
+		arcs = append(arcs, uint32(c))
+	}
+	return arcs, nil
+}
+
+// decode reads one index value from the start of oid, returning it and the
+// rest of oid.
+func (index Index) decode(oid OID) (interface{}, OID, error) {
+	switch index.Kind {
+	case IntegerIndex:
+		if len(oid) == 0 {
+			return nil, nil, fmt.Errorf("missing")
+		}
+		return oid[0], oid[1:], nil
+
+	case OIDIndex:
+		length := len(oid)
+		if !index.Implied {
+			if len(oid) == 0 || int64(oid[0]) > int64(len(oid)-1) {
+				return nil, nil, fmt.Errorf("too short")
+			}
+			length, oid = int(oid[0]), oid[1:]
+		}
+		return oid[:length].Copy(), oid[length:], nil
+
+	case IpAddressIndex:
+		if len(oid) < 4 {
+			return nil, nil, fmt.Errorf("too short")
+		}
+		b, err := octets(oid[:4])
+		if err != nil {
+			return nil, nil, err
+		}
+		return net.IP(b), oid[4:], nil
+
+	case StringIndex, InetAddressIndex:
+		length := len(oid)
+		if index.Size != 0 {
+			length = index.Size
+		} else if !index.Implied {
+			if len(oid) == 0 {
+				return nil, nil, fmt.Errorf("missing")
+			}
+			length, oid = int(oid[0]), oid[1:]
+		}
+		if length > len(oid) {
+			return nil, nil, fmt.Errorf("too short")
+		}
+
+		b, err := octets(oid[:length])
+		if err != nil {
+			return nil, nil, err
+		}
+		if index.Kind == InetAddressIndex && (len(b) == net.IPv4len || len(b) == net.IPv6len) {
+			return net.IP(b), oid[length:], nil
+		}
+		return string(b), oid[length:], nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown kind %s", index.Kind)
+}
+
+// octets converts sub-identifiers to the octets they encode.
+func octets(oid OID) ([]byte, error) {
+	var b = make([]byte, len(oid))
+	for i, arc := range oid {
+		if arc > 255 {
+			return nil, fmt.Errorf("%d is not an octet", arc)
+		}
+		b[i] = byte(arc)
+	}
+	return b, nil
+}
@@ -0,0 +1,102 @@
+package snmptools
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	var (
+		O      = NewOID
+		column = O(1, 3, 6, 1, 2)
+	)
+
+	tests := []struct {
+		indexes  []Index
+		values   []interface{}
+		instance OID
+	}{
+		{[]Index{{Kind: IntegerIndex}}, []interface{}{uint32(7)}, O(7)},
+		{[]Index{{Kind: StringIndex}, {Kind: IntegerIndex}}, []interface{}{"ab", uint32(3)}, O(2, 97, 98, 3)},
+		{[]Index{{Kind: IntegerIndex}, {Kind: StringIndex, Implied: true}}, []interface{}{uint32(1), "ab"}, O(1, 97, 98)},
+		{[]Index{{Kind: StringIndex, Size: 3}, {Kind: IntegerIndex}}, []interface{}{"abc", uint32(1)}, O(97, 98, 99, 1)},
+		{[]Index{{Kind: OIDIndex}, {Kind: OIDIndex, Implied: true}}, []interface{}{O(1, 3), O(4, 5, 6)}, O(2, 1, 3, 4, 5, 6)},
+		{[]Index{{Kind: IpAddressIndex}, {Kind: IntegerIndex}}, []interface{}{net.IP{192, 0, 2, 1}, uint32(161)}, O(192, 0, 2, 1, 161)},
+		{
+			[]Index{{Kind: IntegerIndex}, {Kind: InetAddressIndex}},
+			[]interface{}{uint32(1), net.IP{192, 0, 2, 1}},
+			O(1, 4, 192, 0, 2, 1),
+		},
+		{
+			[]Index{{Kind: InetAddressIndex}},
+			[]interface{}{net.ParseIP("2001:db8::1")},
+			O(16, 0x20, 1, 0xd, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1),
+		},
+		{[]Index{{Kind: InetAddressIndex}}, []interface{}{"example.com"}, O(11, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm')},
+		{[]Index{{Kind: StringIndex}}, []interface{}{""}, O(0)},
+	}
+
+	for i, test := range tests {
+		oid, err := column.AddIndex(test.indexes, test.values...)
+		if err != nil {
+			t.Errorf("%d: unexpected error %s", i, err)
+			continue
+		} else if !oid.Equals(column.Add(test.instance...)) {
+			t.Errorf("%d: expected %s, got %s", i, column.Add(test.instance...), oid)
+		}
+
+		values, err := test.instance.DecodeIndex(test.indexes...)
+		if err != nil {
+			t.Errorf("%d: unexpected error decoding %s: %s", i, test.instance, err)
+		} else if !reflect.DeepEqual(values, test.values) {
+			t.Errorf("%d: expected %v, got %v", i, test.values, values)
+		}
+	}
+
+	// Integers of any type are encoded
+	if oid, err := O().AddIndex([]Index{{Kind: IntegerIndex}}, 5); err != nil || !oid.Equals(O(5)) {
+		t.Errorf("Expected .5, got %s %v", oid, err)
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	var O = NewOID
+
+	encode := []struct {
+		indexes []Index
+		values  []interface{}
+	}{
+		{[]Index{{Kind: IntegerIndex}}, nil},
+		{[]Index{{Kind: IntegerIndex}}, []interface{}{-1}},
+		{[]Index{{Kind: IntegerIndex}}, []interface{}{"1"}},
+		{[]Index{{Kind: StringIndex, Size: 2}}, []interface{}{"abc"}},
+		{[]Index{{Kind: StringIndex, Implied: true}, {Kind: IntegerIndex}}, []interface{}{"a", 1}},
+		{[]Index{{Kind: IpAddressIndex}}, []interface{}{net.ParseIP("::1")}},
+	}
+
+	for i, test := range encode {
+		if oid, err := O(1).AddIndex(test.indexes, test.values...); !errors.Is(err, BadIndex) {
+			t.Errorf("%d: expected BadIndex, got %s %v", i, oid, err)
+		}
+	}
+
+	decode := []struct {
+		indexes  []Index
+		instance OID
+	}{
+		{[]Index{{Kind: IntegerIndex}}, O()},
+		{[]Index{{Kind: IntegerIndex}}, O(1, 2)},
+		{[]Index{{Kind: StringIndex}}, O(3, 97, 98)},
+		{[]Index{{Kind: StringIndex}}, O(1, 256)},
+		{[]Index{{Kind: OIDIndex}}, O(4, 1)},
+		{[]Index{{Kind: IpAddressIndex}}, O(10, 0, 0)},
+	}
+
+	for i, test := range decode {
+		if values, err := test.instance.DecodeIndex(test.indexes...); !errors.Is(err, BadIndex) {
+			t.Errorf("%d: expected BadIndex, got %v %v", i, values, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package snmptools
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Notification is a trap or inform received by a TrapListener.
+//
+// Whatever version it was sent with, a notification is described in SNMPv2
+// terms by TrapOID, Uptime and VarBinds. SNMPv1 traps are translated
+// following RFC 3584 section 3.1, and also keep their original fields.
+type Notification struct {
+	// Addr is the address the notification was sent from
+	Addr      net.Addr
+	Version   SNMPVersion
+	Community string
+	// Type is AsnTrap, AsnTrapV2 or AsnInformRequest
+	Type AsnType
+
+	TrapOID OID
+	Uptime  uint32
+	// VarBinds excludes the sysUpTime.0 and snmpTrapOID.0 varbinds of SNMPv2
+	// notifications, which are found in Uptime and TrapOID
+	VarBinds []VarBind
+
+	// These fields are only set for SNMPv1 traps
+	Enterprise   OID
+	AgentAddress net.IP
+	GenericTrap  int
+	SpecificTrap int
+}
+
+func (n *Notification) String() string {
+	return fmt.Sprintf("Notification{%s from %s, %s %q, uptime %d, %v}", n.TrapOID, n.Addr, n.Version, n.Community, n.Uptime, n.VarBinds)
+}
+
+// TrapListener receives SNMPv1 traps and SNMPv2c traps and informs over UDP,
+// and passes them on to a handler. Informs are acknowledged once the
+// handler returns.
+type TrapListener struct {
+	// Community, if set, is the only community notifications are accepted from
+	Community string
+
+	handler func(*Notification)
+
+	mu     sync.Mutex
+	conn   net.PacketConn
+	closed bool
+}
+
+// NewTrapListener() creates a TrapListener that calls handler for each
+// notification received. The handler is called from the listener's goroutine,
+// one notification at a time.
+func NewTrapListener(handler func(*Notification)) *TrapListener {
+	return &TrapListener{handler: handler}
+}
+
+// NotificationChannel() returns a handler for NewTrapListener that delivers
+// notifications to a channel.
+func NotificationChannel(ch chan<- *Notification) func(*Notification) {
+	return func(n *Notification) {
+		ch <- n
+	}
+}
+
+// ListenAndServe() listens on the UDP address addr (usually ":162") and
+// serves notifications until Close() is called.
+func (l *TrapListener) ListenAndServe(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return l.Serve(conn)
+}
+
+// Serve() receives notifications on conn until Close() is called, at which
+// point it returns nil. If Close() was called first, Serve() closes conn and
+// returns at once.
+func (l *TrapListener) Serve(conn net.PacketConn) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	l.conn = conn
+	l.mu.Unlock()
+
+	var buf = make([]byte, maxMessageSize)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		m, err := UnmarshalMessage(buf[:n])
+		if err != nil {
+			logger.Debug(fmt.Sprintf("Ignoring bad packet from %s: %s", addr, err))
+			continue
+		}
+
+		if l.Community != "" && m.Community != l.Community {
+			logger.Debug(fmt.Sprintf("Ignoring notification from %s with community %q", addr, m.Community))
+			continue
+		}
+
+		notification := newNotification(addr, m)
+		if notification == nil {
+			logger.Debug(fmt.Sprintf("Ignoring %s PDU from %s", m.PDU.Type.PrettyString(), addr))
+			continue
+		}
+
+		l.handler(notification)
+
+		if m.PDU.Type == AsnInformRequest {
+			// Acknowledge the inform by echoing it back as a response
+			m.PDU.Type = AsnGetResponse
+			m.PDU.ErrorStatus, m.PDU.ErrorIndex = NoError, 0
+			if b, err := m.Marshal(); err == nil {
+				conn.WriteTo(b, addr)
+			}
+		}
+	}
+}
+
+// Close() stops the listener.
+func (l *TrapListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.Close()
+}
+
+// newNotification converts a received message into a Notification, or
+// returns nil if it does not contain a notification PDU.
+func newNotification(addr net.Addr, m *Message) *Notification {
+	var (
+		p = m.PDU
+		n = &Notification{
+			Addr:      addr,
+			Version:   m.Version,
+			Community: m.Community,
+			Type:      p.Type,
+		}
+	)
+
+	switch p.Type {
+	case AsnTrap:
+		n.Enterprise = p.Enterprise
+		n.AgentAddress = p.AgentAddress
+		n.GenericTrap = p.GenericTrap
+		n.SpecificTrap = p.SpecificTrap
+		n.Uptime = p.Timestamp
+		n.VarBinds = p.VarBinds
+
+		if p.GenericTrap == 6 {
+			// enterpriseSpecific: the trap OID is enterprise.0.specific
+			n.TrapOID = p.Enterprise.Add(0, uint32(p.SpecificTrap))
+		} else {
+			n.TrapOID = SnmpTrapsOID.Add(uint32(p.GenericTrap + 1))
+		}
+
+	case AsnTrapV2, AsnInformRequest:
+		vbs := p.VarBinds
+		if len(vbs) > 0 && vbs[0].OID.Equals(SysUpTimeOID) {
+			n.Uptime, _ = vbs[0].Value.(uint32)
+			vbs = vbs[1:]
+		}
+		if len(vbs) > 0 && vbs[0].OID.Equals(SnmpTrapOID) {
+			n.TrapOID, _ = vbs[0].Value.(OID)
+			vbs = vbs[1:]
+		}
+		n.VarBinds = vbs
+
+	default:
+		return nil
+	}
+
+	return n
+}
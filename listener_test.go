@@ -0,0 +1,118 @@
+package snmptools
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// startTrapListener starts a TrapListener on a local port for tests
+func startTrapListener(t *testing.T, community string) (*TrapListener, chan *Notification, string) {
+	var ch = make(chan *Notification, 10)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewTrapListener(NotificationChannel(ch))
+	l.Community = community
+	go l.Serve(conn)
+	t.Cleanup(func() { l.Close() })
+
+	return l, ch, conn.LocalAddr().String()
+}
+
+func receiveNotification(t *testing.T, ch chan *Notification) *Notification {
+	select {
+	case n := <-ch:
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a notification")
+	}
+	return nil
+}
+
+// Test receiving traps and informs from each version
+func TestTrapListener(t *testing.T) {
+	var (
+		_, ch, addr = startTrapListener(t, "public")
+		trapOID     = NewOID(1, 3, 6, 1, 4, 1, 898889, 0, 2)
+		payload     = VarBind{NewOID(1, 3, 6, 1, 4, 1, 898889, 1, 1), AsnCounter32, uint32(42)}
+	)
+
+	for _, version := range []SNMPVersion{Version1, Version2c} {
+		sender := NewTrapSender(version, "public", addr)
+		if err := sender.Trap(trapOID, payload); err != nil {
+			t.Fatal(err)
+		}
+
+		n := receiveNotification(t, ch)
+		if n.Version != version || n.Community != "public" {
+			t.Errorf("Bad notification header: %s", n)
+		}
+		if !n.TrapOID.Equals(trapOID) {
+			t.Errorf("%s trap: got trap OID %s, wanted %s", version, n.TrapOID, trapOID)
+		}
+		if len(n.VarBinds) != 1 || !n.VarBinds[0].OID.Equals(payload.OID) || n.VarBinds[0].Value != payload.Value {
+			t.Errorf("%s trap: bad varbinds %v", version, n.VarBinds)
+		}
+	}
+
+	// Informs must be acknowledged
+	sender := NewTrapSender(Version2c, "public", addr)
+	sender.Timeout = time.Second
+	if err := sender.Inform(trapOID, payload); err != nil {
+		t.Error(err)
+	}
+	if n := receiveNotification(t, ch); n.Type != AsnInformRequest {
+		t.Errorf("Expected an inform, got %s", n)
+	}
+
+	// Notifications with the wrong community are dropped
+	sender = NewTrapSender(Version2c, "wrong", addr)
+	sender.Timeout, sender.Retries = 100*time.Millisecond, 0
+	if err := sender.Inform(trapOID); err == nil {
+		t.Error("Inform with the wrong community should not have been acknowledged")
+	}
+}
+
+// Test translating generic SNMPv1 traps
+func TestTrapListenerGenericTrap(t *testing.T) {
+	_, ch, addr := startTrapListener(t, "")
+
+	sender := NewTrapSender(Version1, "any", addr)
+	if err := sender.Trap(SnmpTrapsOID.Add(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := receiveNotification(t, ch); n.GenericTrap != 0 || !n.TrapOID.Equals(SnmpTrapsOID.Add(1)) {
+		t.Errorf("Expected a coldStart trap, got %s (generic %d)", n, n.GenericTrap)
+	}
+}
+
+// Test that closing a listener before it serves stops it from serving
+func TestTrapListenerCloseFirst(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewTrapListener(func(*Notification) {})
+	l.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- l.Serve(conn) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return")
+	}
+	if _, err := conn.WriteTo([]byte{0}, conn.LocalAddr()); err == nil {
+		t.Errorf("Serve() did not close the connection")
+	}
+}
@@ -0,0 +1,96 @@
+package snmptools
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ObjectInfo is the metadata of an object defined in a MIB module.
+type ObjectInfo struct {
+	// Name is the object's descriptor, such as ifInOctets
+	Name string
+	// Description is the object's DESCRIPTION clause
+	Description string
+	// Indexes lists the descriptors of the INDEX objects of a table entry
+	Indexes []string
+	// IndexKinds, if set, gives the syntax of each of the Indexes, so that
+	// the instances of the entry's rows can be decoded
+	IndexKinds []Index
+	// Type is the base type of the object's values, if it is known
+	Type AsnType
+	// Syntax is the textual convention of the object's values, if it has one
+	Syntax *TextualConvention
+}
+
+// MIB holds metadata about the objects of one or more MIB modules, by OID.
+//
+// SMI trees only hold values; a MIB can be used alongside them to give their
+// nodes names and descriptions, and to say which subtrees are tables.
+type MIB struct {
+	mu      sync.RWMutex
+	objects map[string]*ObjectInfo
+}
+
+// NewMIB() creates an empty MIB.
+func NewMIB() *MIB {
+	return &MIB{
+		objects: make(map[string]*ObjectInfo),
+	}
+}
+
+// Define() adds the metadata of the object at oid, replacing any that was
+// already defined there.
+func (m *MIB) Define(oid OID, info ObjectInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[oid.String()] = &info
+}
+
+// Object() returns the metadata of the object at exactly oid, or nil if there
+// is none.
+func (m *MIB) Object(oid OID) *ObjectInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.objects[oid.String()]
+}
+
+// Lookup() finds the object with the longest OID that is equal to or a prefix
+// of oid. It returns the object's OID and metadata, or nils if there is no
+// such object.
+//
+// The rest of oid after the object's OID is its instance, such as .0 for a
+// scalar or the index of a table row.
+func (m *MIB) Lookup(oid OID) (OID, *ObjectInfo) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := len(oid); i > 0; i -= 1 {
+		if info, ok := m.objects[oid[:i].String()]; ok {
+			return oid[:i].Copy(), info
+		}
+	}
+	return nil, nil
+}
+
+// FormatLeaf() renders the value of the object instance at oid using its
+// textual convention, or as FormatLeaf() does if it has none or the value
+// does not match it.
+func (m *MIB) FormatLeaf(oid OID, leaf *SMILeaf) string {
+	if _, info := m.Lookup(oid); info != nil && info.Syntax != nil {
+		if s, err := info.Syntax.Format(leaf); err == nil {
+			return s
+		}
+	}
+	return FormatLeaf(leaf)
+}
+
+// ParseLeaf() reads a value to set the object instance at oid to, using its
+// textual convention. It returns UnknownSyntax if the object has none.
+func (m *MIB) ParseLeaf(oid OID, s string) (*SMILeaf, error) {
+	if _, info := m.Lookup(oid); info != nil && info.Syntax != nil {
+		return info.Syntax.Parse(s)
+	}
+	return nil, fmt.Errorf("%w: %s", UnknownSyntax, oid)
+}
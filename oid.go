@@ -11,6 +11,7 @@ var (
 	BadValType  = fmt.Errorf("Incorrect type for OID value")
 	BadOID      = fmt.Errorf("Could not convert OID from C value")
 	OIDNotMatch = fmt.Errorf("OIDS did not match")
+	OIDConflict = fmt.Errorf("OID conflicts with an existing node")
 )
 
 // An snmp OID is just an array of uint32 values
@@ -34,6 +35,26 @@ func (oid OID) Equals(other OID) bool {
 	return true
 }
 
+// Compare() compares two OIDs lexicographically, sub-identifier by
+// sub-identifier, returning -1, 0 or +1. An OID sorts before any longer OID it
+// is a prefix of.
+func (oid OID) Compare(other OID) int {
+	for i := 0; i < len(oid) && i < len(other); i += 1 {
+		if oid[i] < other[i] {
+			return -1
+		} else if oid[i] > other[i] {
+			return 1
+		}
+	}
+
+	if len(oid) < len(other) {
+		return -1
+	} else if len(oid) > len(other) {
+		return 1
+	}
+	return 0
+}
+
 func (oid OID) Copy() OID {
 	n := make(OID, len(oid))
 	for i, num := range oid {
@@ -51,6 +72,9 @@ func (oid OID) GetRemainder(root OID) (OID, error) {
 	if len(root) > len(oid) {
 		return partial, OIDNotMatch
 	} else if len(root) == len(oid) {
+		if !oid.Equals(root) {
+			return partial, OIDNotMatch
+		}
 		return NewOID(), nil
 	}
 
@@ -157,12 +181,16 @@ const (
 	AsnUinteger32       AsnType = 0x47
 	AsnNoSuchObject     AsnType = 0x80
 	AsnNoSuchInstance   AsnType = 0x81
+	AsnEndOfMibView     AsnType = 0x82
 	AsnGetRequest       AsnType = 0xa0
 	AsnGetNextRequest   AsnType = 0xa1
 	AsnGetResponse      AsnType = 0xa2
 	AsnSetRequest       AsnType = 0xa3
 	AsnTrap             AsnType = 0xa4
 	AsnGetBulkRequest   AsnType = 0xa5
+	AsnInformRequest    AsnType = 0xa6
+	AsnTrapV2           AsnType = 0xa7
+	AsnReport           AsnType = 0xa8
 )
 
 var asnStrings = map[AsnType]string{
@@ -173,4 +201,24 @@ var asnStrings = map[AsnType]string{
 	AsnIpAddress:        "ipaddress",
 	AsnObjectIdentifier: "objectid",
 	AsnOctetString:      "string",
+	AsnCounter64:        "counter64",
+	AsnOpaque:           "opaque",
+	AsnNull:             "null",
+	AsnNoSuchObject:     "noSuchObject",
+	AsnNoSuchInstance:   "noSuchInstance",
+	AsnEndOfMibView:     "endOfMibView",
+}
+
+// asnTypeNames maps the names of the types that leaves can hold in text
+// formats, such as extend output, back to their AsnTypes
+var asnTypeNames = map[string]AsnType{
+	"integer":   AsnInteger,
+	"gauge":     AsnGauge32,
+	"counter":   AsnCounter32,
+	"counter64": AsnCounter64,
+	"timeticks": AsnTimeTicks,
+	"ipaddress": AsnIpAddress,
+	"objectid":  AsnObjectIdentifier,
+	"string":    AsnOctetString,
+	"opaque":    AsnOpaque,
 }
@@ -88,6 +88,7 @@ func TestGetOIDRemainder(t *testing.T) {
 		{O(1, 2, 3, 4), O(1, 2, 3, 4), O(), false},
 		{O(1, 2, 3, 4), O(1, 2, 3, 4, 5, 6), O(), true},
 		{O(1, 2, 3, 4, 5, 6), O(1, 2, 3, 4), O(5, 6), false},
+		{O(1, 2, 3, 4), O(1, 2, 3, 5), O(), true},
 	}
 
 	for _, test := range tests {
@@ -103,3 +104,31 @@ func TestGetOIDRemainder(t *testing.T) {
 	}
 
 }
+
+// Test lexicographic OID ordering
+func TestOIDCompare(t *testing.T) {
+	var O = NewOID
+
+	type OIDCompareTest struct {
+		i, j     OID
+		expected int
+	}
+
+	var tests = []OIDCompareTest{
+		{O(1, 2, 3), O(1, 2, 3), 0},
+		{O(), O(), 0},
+		{O(1, 2, 3), O(1, 2, 3, 4), -1},
+		{O(1, 2, 4), O(1, 2, 3, 4), 1},
+		{O(), O(1), -1},
+		{O(1, 10), O(1, 9, 1), 1},
+	}
+
+	for _, test := range tests {
+		if got := test.i.Compare(test.j); got != test.expected {
+			t.Errorf("%s compared to %s: got %d, wanted %d", test.i, test.j, got, test.expected)
+		}
+		if got := test.j.Compare(test.i); got != -test.expected {
+			t.Errorf("%s compared to %s: got %d, wanted %d", test.j, test.i, got, -test.expected)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package snmptools
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync/atomic"
+)
+
+var (
+	// Message errors
+	UnsupportedVersion = fmt.Errorf("Unsupported SNMP version")
+	UnsupportedPDU     = fmt.Errorf("Unsupported PDU type")
+)
+
+// maxMessageSize is the largest message that fits in a UDP datagram
+const maxMessageSize = 65507
+
+// requestID is the last request ID handed out by nextRequestID
+var requestID = rand.Int31()
+
+// nextRequestID returns a request ID for a new PDU.
+func nextRequestID() int32 {
+	return atomic.AddInt32(&requestID, 1) & 0x7fffffff
+}
+
+// SNMPVersion is the version number carried in SNMP messages.
+type SNMPVersion int
+
+const (
+	Version1  SNMPVersion = 0
+	Version2c SNMPVersion = 1
+	Version3  SNMPVersion = 3
+)
+
+func (v SNMPVersion) String() string {
+	switch v {
+	case Version1:
+		return "v1"
+	case Version2c:
+		return "v2c"
+	case Version3:
+		return "v3"
+	}
+	return fmt.Sprintf("SNMPVersion(%d)", int(v))
+}
+
+// ErrorStatus is the error-status field of a response PDU.
+type ErrorStatus int
+
+// Error statuses, as listed in RFC 3416
+const (
+	NoError ErrorStatus = iota
+	TooBig
+	NoSuchName
+	BadValue
+	ReadOnly
+	GenErr
+	NoAccess
+	WrongType
+	WrongLength
+	WrongEncoding
+	WrongValue
+	NoCreation
+	InconsistentValue
+	ResourceUnavailable
+	CommitFailed
+	UndoFailed
+	AuthorizationError
+	NotWritable
+	InconsistentName
+)
+
+var errorStatusStrings = []string{
+	"noError",
+	"tooBig",
+	"noSuchName",
+	"badValue",
+	"readOnly",
+	"genErr",
+	"noAccess",
+	"wrongType",
+	"wrongLength",
+	"wrongEncoding",
+	"wrongValue",
+	"noCreation",
+	"inconsistentValue",
+	"resourceUnavailable",
+	"commitFailed",
+	"undoFailed",
+	"authorizationError",
+	"notWritable",
+	"inconsistentName",
+}
+
+func (e ErrorStatus) String() string {
+	if e >= 0 && int(e) < len(errorStatusStrings) {
+		return errorStatusStrings[e]
+	}
+	return fmt.Sprintf("ErrorStatus(%d)", int(e))
+}
+
+// ErrorStatus also implements error, so that it can be returned from functions
+// that fail with a specific SNMP error.
+func (e ErrorStatus) Error() string {
+	return "snmp error: " + e.String()
+}
+
+// PDU is an SNMP protocol data unit.
+//
+// The same type is used for every kind of PDU; which fields are meaningful
+// depends on Type.
+type PDU struct {
+	Type        AsnType
+	RequestID   int32
+	ErrorStatus ErrorStatus
+	ErrorIndex  int
+
+	// For GetBulkRequest PDUs, these are sent in place of ErrorStatus and
+	// ErrorIndex
+	NonRepeaters   int
+	MaxRepetitions int
+
+	VarBinds []VarBind
+
+	// These fields are only used by SNMPv1 Trap-PDUs, which have no request ID,
+	// error status or error index
+	Enterprise   OID
+	AgentAddress net.IP
+	GenericTrap  int
+	SpecificTrap int
+	Timestamp    uint32
+}
+
+// Message is an SNMPv1 or SNMPv2c message: a PDU with community-based
+// security.
+type Message struct {
+	Version   SNMPVersion
+	Community string
+	PDU       *PDU
+}
+
+// Marshal() encodes the message using BER.
+func (m *Message) Marshal() ([]byte, error) {
+	if m.Version != Version1 && m.Version != Version2c {
+		return nil, UnsupportedVersion
+	}
+
+	pdu, err := m.PDU.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return berTLV(byte(AsnSequence),
+		berTLV(byte(AsnInteger), berInt(int64(m.Version))),
+		berTLV(byte(AsnOctetString), []byte(m.Community)),
+		pdu,
+	), nil
+}
+
+// UnmarshalMessage() decodes a BER-encoded SNMPv1 or SNMPv2c message.
+func UnmarshalMessage(b []byte) (*Message, error) {
+	var (
+		m                  = &Message{}
+		msg, content, rest []byte
+		version            int64
+		err                error
+	)
+
+	if msg, rest, err = berExpect(b, byte(AsnSequence)); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, TrailingData
+	}
+
+	if version, msg, err = berReadInt(msg); err != nil {
+		return nil, err
+	} else if m.Version = SNMPVersion(version); m.Version != Version1 && m.Version != Version2c {
+		return nil, UnsupportedVersion
+	}
+
+	if content, msg, err = berExpect(msg, byte(AsnOctetString)); err != nil {
+		return nil, err
+	}
+	m.Community = string(content)
+
+	if m.PDU, rest, err = unmarshalPDU(msg); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, TrailingData
+	}
+
+	return m, nil
+}
+
+func (p *PDU) marshal() ([]byte, error) {
+	vbs, err := marshalVarBinds(p.VarBinds)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Type {
+	case AsnTrap:
+		enterprise, err := berOID(p.Enterprise)
+		if err != nil {
+			return nil, err
+		}
+		addr := p.AgentAddress.To4()
+		if addr == nil {
+			addr = net.IPv4zero.To4()
+		}
+		return berTLV(byte(p.Type),
+			berTLV(byte(AsnObjectIdentifier), enterprise),
+			berTLV(byte(AsnIpAddress), addr),
+			berTLV(byte(AsnInteger), berInt(int64(p.GenericTrap))),
+			berTLV(byte(AsnInteger), berInt(int64(p.SpecificTrap))),
+			berTLV(byte(AsnTimeTicks), berUint(uint64(p.Timestamp))),
+			vbs,
+		), nil
+
+	case AsnGetBulkRequest:
+		return berTLV(byte(p.Type),
+			berTLV(byte(AsnInteger), berInt(int64(p.RequestID))),
+			berTLV(byte(AsnInteger), berInt(int64(p.NonRepeaters))),
+			berTLV(byte(AsnInteger), berInt(int64(p.MaxRepetitions))),
+			vbs,
+		), nil
+
+	case AsnGetRequest, AsnGetNextRequest, AsnGetResponse, AsnSetRequest,
+		AsnInformRequest, AsnTrapV2, AsnReport:
+		return berTLV(byte(p.Type),
+			berTLV(byte(AsnInteger), berInt(int64(p.RequestID))),
+			berTLV(byte(AsnInteger), berInt(int64(p.ErrorStatus))),
+			berTLV(byte(AsnInteger), berInt(int64(p.ErrorIndex))),
+			vbs,
+		), nil
+	}
+
+	return nil, UnsupportedPDU
+}
+
+func marshalVarBinds(vbs []VarBind) ([]byte, error) {
+	var list = make([][]byte, len(vbs))
+
+	for i, vb := range vbs {
+		oid, err := berOID(vb.OID)
+		if err != nil {
+			return nil, err
+		}
+
+		typ := vb.Type
+		if typ == 0 {
+			// An unset type is sent as NULL, as in requests
+			typ = AsnNull
+		}
+
+		val, err := berValue(typ, vb.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", vb.OID, err)
+		}
+
+		list[i] = berTLV(byte(AsnSequence), berTLV(byte(AsnObjectIdentifier), oid), val)
+	}
+
+	return berTLV(byte(AsnSequence), list...), nil
+}
+
+// unmarshalPDU decodes a PDU from the front of b.
+func unmarshalPDU(b []byte) (*PDU, []byte, error) {
+	var (
+		p             = &PDU{}
+		tag           byte
+		content, rest []byte
+		i, j, k       int64
+		err           error
+	)
+
+	if tag, content, rest, err = berRead(b); err != nil {
+		return nil, nil, err
+	}
+	p.Type = AsnType(tag)
+
+	switch p.Type {
+	case AsnTrap:
+		var field []byte
+		if field, content, err = berExpect(content, byte(AsnObjectIdentifier)); err != nil {
+			return nil, nil, err
+		} else if p.Enterprise, err = berParseOID(field); err != nil {
+			return nil, nil, err
+		}
+
+		if field, content, err = berExpect(content, byte(AsnIpAddress)); err != nil {
+			return nil, nil, err
+		} else if len(field) != 4 {
+			return nil, nil, MalformedBER
+		}
+		p.AgentAddress = net.IPv4(field[0], field[1], field[2], field[3]).To4()
+
+		if i, content, err = berReadInt(content); err != nil {
+			return nil, nil, err
+		} else if j, content, err = berReadInt(content); err != nil {
+			return nil, nil, err
+		}
+		p.GenericTrap, p.SpecificTrap = int(i), int(j)
+
+		if field, content, err = berExpect(content, byte(AsnTimeTicks)); err != nil {
+			return nil, nil, err
+		} else if u, err := berParseUint(field); err != nil {
+			return nil, nil, err
+		} else {
+			p.Timestamp = uint32(u)
+		}
+
+	case AsnGetRequest, AsnGetNextRequest, AsnGetResponse, AsnSetRequest,
+		AsnGetBulkRequest, AsnInformRequest, AsnTrapV2, AsnReport:
+		if i, content, err = berReadInt(content); err != nil {
+			return nil, nil, err
+		} else if j, content, err = berReadInt(content); err != nil {
+			return nil, nil, err
+		} else if k, content, err = berReadInt(content); err != nil {
+			return nil, nil, err
+		}
+
+		p.RequestID = int32(i)
+		if p.Type == AsnGetBulkRequest {
+			p.NonRepeaters, p.MaxRepetitions = int(j), int(k)
+		} else {
+			p.ErrorStatus, p.ErrorIndex = ErrorStatus(j), int(k)
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("%w: 0x%02x", UnsupportedPDU, tag)
+	}
+
+	if p.VarBinds, err = unmarshalVarBinds(content); err != nil {
+		return nil, nil, err
+	}
+
+	return p, rest, nil
+}
+
+func unmarshalVarBinds(b []byte) ([]VarBind, error) {
+	var (
+		list, vb, content []byte
+		vbs               []VarBind
+		tag               byte
+		err               error
+	)
+
+	if list, b, err = berExpect(b, byte(AsnSequence)); err != nil {
+		return nil, err
+	} else if len(b) != 0 {
+		return nil, TrailingData
+	}
+
+	for len(list) > 0 {
+		var v VarBind
+
+		if vb, list, err = berExpect(list, byte(AsnSequence)); err != nil {
+			return nil, err
+		}
+
+		if content, vb, err = berExpect(vb, byte(AsnObjectIdentifier)); err != nil {
+			return nil, err
+		} else if v.OID, err = berParseOID(content); err != nil {
+			return nil, err
+		}
+
+		if tag, content, vb, err = berRead(vb); err != nil {
+			return nil, err
+		} else if len(vb) != 0 {
+			return nil, TrailingData
+		}
+
+		v.Type = AsnType(tag)
+		if v.Value, err = berParseValue(v.Type, content); err != nil {
+			return nil, err
+		}
+
+		vbs = append(vbs, v)
+	}
+
+	return vbs, nil
+}
@@ -0,0 +1,324 @@
+package snmptools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Pass persist client errors
+	ProtocolViolation = fmt.Errorf("Pass persist protocol violation")
+	ExtensionTimeout  = fmt.Errorf("Timed out waiting for the pass persist extension")
+	ExtensionClosed   = fmt.Errorf("Pass persist extension closed its output")
+)
+
+// passPersistSetErrors are the answers to a set command, as snmpd
+// understands them
+var passPersistSetErrors = map[string]ErrorStatus{
+	"not-writable":       NotWritable,
+	"wrong-type":         WrongType,
+	"wrong-length":       WrongLength,
+	"wrong-value":        WrongValue,
+	"inconsistent-value": InconsistentValue,
+}
+
+// PassPersistClient talks to a pass persist extension as snmpd would, for
+// testing and debugging extensions such as PassPersistExtension.
+//
+// Anything the extension says that snmpd would not accept is reported as a
+// ProtocolViolation: missing or extra lines, unknown types, values that do
+// not match their types, and GETNEXT answers that do not increase.
+type PassPersistClient struct {
+	// Timeout is how long to wait for each line of a response
+	Timeout time.Duration
+
+	// Transcript, if set, receives every line sent to and received from the
+	// extension, with the time since the command started
+	Transcript io.Writer
+
+	output  io.Writer
+	lines   chan string
+	started time.Time
+	mu      sync.Mutex
+}
+
+// NewPassPersistClient() creates a PassPersistClient that reads the
+// extension's output from input, and writes commands to output. The timeout
+// defaults to five seconds.
+func NewPassPersistClient(input io.Reader, output io.Writer) *PassPersistClient {
+	c := &PassPersistClient{
+		Timeout: 5 * time.Second,
+		output:  output,
+		lines:   make(chan string, 64),
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(input)
+		for scanner.Scan() {
+			c.lines <- scanner.Text()
+		}
+		close(c.lines)
+	}()
+
+	return c
+}
+
+// Ping() checks that the extension is alive.
+func (c *PassPersistClient) Ping() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.started = time.Now()
+	if err := c.send("PING"); err != nil {
+		return err
+	}
+
+	line, err := c.receive()
+	if err != nil {
+		return err
+	} else if line != "PONG" {
+		return fmt.Errorf("%w: expected PONG, got %q", ProtocolViolation, line)
+	}
+	return nil
+}
+
+// Get() asks for the value of an OID. It returns false if the extension has
+// no value there.
+func (c *PassPersistClient) Get(oid OID) (VarBind, bool, error) {
+	vb, ok, err := c.request("get", oid)
+	if err == nil && ok && !vb.OID.Equals(oid) {
+		err = fmt.Errorf("%w: asked for %s, got %s", ProtocolViolation, oid, vb.OID)
+	}
+	return vb, ok, err
+}
+
+// GetNext() asks for the value of the OID after oid. It returns false at the
+// end of the extension's tree.
+func (c *PassPersistClient) GetNext(oid OID) (VarBind, bool, error) {
+	vb, ok, err := c.request("getnext", oid)
+	if err == nil && ok && vb.OID.Compare(oid) <= 0 {
+		err = fmt.Errorf("%w: non-increasing OID %s after %s", ProtocolViolation, vb.OID, oid)
+	}
+	return vb, ok, err
+}
+
+// Walk() calls fn for every object beneath root, using GETNEXT commands.
+//
+// If fn returns an error the walk stops and that error is returned.
+func (c *PassPersistClient) Walk(root OID, fn func(vb VarBind) error) error {
+	var oid = root
+
+	for {
+		vb, ok, err := c.GetNext(oid)
+		if err != nil {
+			return err
+		} else if !ok {
+			return nil
+		} else if _, err := vb.OID.GetRemainder(root); err != nil {
+			// Walked out of the subtree
+			return nil
+		}
+
+		if err := fn(vb); err != nil {
+			return err
+		}
+		oid = vb.OID
+	}
+}
+
+// Set() asks the extension to change a value. An extension that refuses
+// returns an ErrorStatus such as NotWritable or WrongType.
+func (c *PassPersistClient) Set(vb VarBind) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, err := passPersistSetValue(vb)
+	if err != nil {
+		return err
+	}
+
+	c.started = time.Now()
+	for _, line := range []string{"set", vb.OID.String(), value} {
+		if err := c.send(line); err != nil {
+			return err
+		}
+	}
+
+	line, err := c.receive()
+	if err != nil {
+		return err
+	} else if strings.EqualFold(line, "DONE") {
+		return nil
+	} else if status, ok := passPersistSetErrors[strings.ToLower(line)]; ok {
+		return status
+	}
+	return fmt.Errorf("%w: unknown answer to set %q", ProtocolViolation, line)
+}
+
+// request sends a get or getnext command and reads its answer.
+func (c *PassPersistClient) request(command string, oid OID) (VarBind, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var vb VarBind
+
+	c.started = time.Now()
+	if err := c.send(command); err != nil {
+		return vb, false, err
+	} else if err := c.send(oid.String()); err != nil {
+		return vb, false, err
+	}
+
+	line, err := c.receive()
+	if err != nil {
+		return vb, false, err
+	} else if strings.EqualFold(line, "NONE") {
+		return vb, false, nil
+	}
+
+	if vb.OID, err = NewOIDFromString(line); err != nil {
+		return vb, false, fmt.Errorf("%w: expected an OID or NONE, got %q", ProtocolViolation, line)
+	}
+
+	var typeName, value string
+	if typeName, err = c.receive(); err != nil {
+		return vb, false, fmt.Errorf("%w: expected 3 lines, got 1: %s", ProtocolViolation, err)
+	} else if value, err = c.receive(); err != nil {
+		return vb, false, fmt.Errorf("%w: expected 3 lines, got 2: %s", ProtocolViolation, err)
+	}
+
+	vb.Type, vb.Value, err = parsePassPersistValue(typeName, value)
+	return vb, true, err
+}
+
+// Close() stops the extension by closing its input, as snmpd does, if the
+// output given to NewPassPersistClient() can be closed. It then waits up to
+// the timeout for the extension to close its own output, and reports any
+// lines it wrote after its last answer as a ProtocolViolation, which could
+// otherwise go unnoticed after the last command.
+func (c *PassPersistClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if closer, ok := c.output.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+
+	var (
+		extra   []string
+		timeout = time.After(c.Timeout)
+	)
+
+	for {
+		select {
+		case line, ok := <-c.lines:
+			if ok {
+				c.log("<", line)
+				extra = append(extra, line)
+				continue
+			}
+		case <-timeout:
+		}
+
+		if len(extra) > 0 {
+			return fmt.Errorf("%w: unexpected lines %q", ProtocolViolation, extra)
+		}
+		return nil
+	}
+}
+
+// send writes a line to the extension, first checking that there is nothing
+// left over from the previous answer.
+func (c *PassPersistClient) send(line string) error {
+	select {
+	case extra, ok := <-c.lines:
+		if ok {
+			c.log("<", extra)
+			return fmt.Errorf("%w: unexpected line %q", ProtocolViolation, extra)
+		}
+		return ExtensionClosed
+	default:
+	}
+
+	c.log(">", line)
+	_, err := fmt.Fprintln(c.output, line)
+	return err
+}
+
+// receive waits for a line from the extension.
+func (c *PassPersistClient) receive() (string, error) {
+	select {
+	case line, ok := <-c.lines:
+		if !ok {
+			return "", ExtensionClosed
+		}
+		c.log("<", line)
+		return line, nil
+	case <-time.After(c.Timeout):
+		return "", ExtensionTimeout
+	}
+}
+
+func (c *PassPersistClient) log(direction, line string) {
+	if c.Transcript != nil {
+		fmt.Fprintf(c.Transcript, "%10.3fms %s %s\n", float64(time.Since(c.started))/float64(time.Millisecond), direction, line)
+	}
+}
+
+// parsePassPersistValue parses the type and value lines of an answer.
+func parsePassPersistValue(typeName, s string) (AsnType, interface{}, error) {
+	var (
+		t, ok = asnTypeNames[strings.ToLower(typeName)]
+		value interface{}
+		err   error
+	)
+
+	if !ok || !PassPersistTypes[t] {
+		return 0, nil, fmt.Errorf("%w: unknown type %q", ProtocolViolation, typeName)
+	}
+
+	switch t {
+	case AsnInteger:
+		value, err = strconv.Atoi(s)
+	case AsnGauge32, AsnCounter32, AsnTimeTicks:
+		var u uint64
+		u, err = strconv.ParseUint(s, 10, 32)
+		value = uint32(u)
+	case AsnIpAddress:
+		if ip := net.ParseIP(s).To4(); ip != nil {
+			value = ip
+		} else {
+			err = fmt.Errorf("bad IP address %q", s)
+		}
+	case AsnObjectIdentifier:
+		value, err = NewOIDFromString(s)
+	case AsnOctetString:
+		value = s
+	}
+
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: bad %s value: %s", ProtocolViolation, typeName, err)
+	}
+	return t, value, nil
+}
+
+// passPersistSetValue formats the value line of a set command, as snmpd does.
+func passPersistSetValue(vb VarBind) (string, error) {
+	if !PassPersistTypes[vb.Type] {
+		return "", badValue(vb.Type, vb.Value)
+	}
+
+	leaf := &SMILeaf{vb.Type, vb.Value}
+	if vb.Type == AsnOctetString {
+		return fmt.Sprintf("string %s", strconv.Quote(string(leafBytes(leaf)))), nil
+	}
+	return fmt.Sprintf("%s %v", vb.Type.PrettyString(), vb.Value), nil
+}
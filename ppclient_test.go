@@ -0,0 +1,180 @@
+package snmptools
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startPassPersist connects a PassPersistClient to a PassPersistExtension
+// serving the test tree
+func startPassPersist(t *testing.T) *PassPersistClient {
+	var (
+		tree            = newTestTree()
+		cmdIn, cmdOut   = io.Pipe()
+		respIn, respOut = io.Pipe()
+	)
+
+	ppe := NewPassPersistExtension(cmdIn, respOut, func() SMINode { return tree }, testAgentRoot)
+	go func() {
+		ppe.Serve()
+		respOut.Close()
+	}()
+	t.Cleanup(func() { cmdOut.Close() })
+
+	client := NewPassPersistClient(respIn, cmdOut)
+	client.Timeout = 100 * time.Millisecond
+	return client
+}
+
+func TestPassPersistClient(t *testing.T) {
+	var (
+		client     = startPassPersist(t)
+		transcript bytes.Buffer
+	)
+	client.Transcript = &transcript
+
+	if err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	vb, ok, err := client.Get(testAgentRoot.Add(1, 1))
+	if err != nil || !ok {
+		t.Fatalf("Get failed: %v %v", ok, err)
+	} else if vb.Type != AsnOctetString || vb.Value != "test" {
+		t.Errorf("Bad value: %s", vb)
+	}
+
+	if _, ok, err := client.Get(testAgentRoot.Add(9)); err != nil || ok {
+		t.Errorf("Expected no value, got %v %v", ok, err)
+	}
+
+	// Counter64s cannot be carried by pass persist
+	err = client.Walk(testAgentRoot, func(vb VarBind) error { return nil })
+	if !errors.Is(err, ProtocolViolation) {
+		t.Errorf("Expected a protocol violation, got %v", err)
+	}
+
+	var walked []VarBind
+	err = client.Walk(testAgentRoot.Add(2), func(vb VarBind) error {
+		walked = append(walked, vb)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(walked) != 25 {
+		t.Fatalf("Walked %d objects, expected 25", len(walked))
+	}
+	for i, vb := range walked {
+		if !vb.OID.Equals(testAgentRoot.Add(2, uint32(i+1))) || vb.Value != i+1 {
+			t.Errorf("Bad object walked: %s", vb)
+		}
+	}
+
+	// PassPersistExtension does not implement set
+	if err := client.Set(VarBind{testAgentRoot.Add(1, 1), AsnOctetString, "x"}); !errors.Is(err, ExtensionTimeout) {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+
+	if lines := strings.Split(transcript.String(), "\n"); !strings.HasSuffix(lines[0], "ms > PING") || !strings.HasSuffix(lines[1], "ms < PONG") {
+		t.Errorf("Bad transcript: %q", lines[:2])
+	}
+
+	if err := client.Close(); err != nil {
+		t.Errorf("Unexpected error closing: %s", err)
+	}
+}
+
+// fakeExtension answers each command with the given lines
+func fakeExtension(answers map[string]string) *PassPersistClient {
+	var (
+		cmdIn, cmdOut   = io.Pipe()
+		respIn, respOut = io.Pipe()
+	)
+
+	go func() {
+		scanner := bufio.NewScanner(cmdIn)
+		for scanner.Scan() {
+			if answer, ok := answers[scanner.Text()]; ok {
+				fmt.Fprint(respOut, answer)
+			}
+		}
+		respOut.Close()
+	}()
+
+	client := NewPassPersistClient(respIn, cmdOut)
+	client.Timeout = 50 * time.Millisecond
+	return client
+}
+
+// Test detection of protocol violations
+func TestPassPersistClientViolations(t *testing.T) {
+	var O = NewOID
+
+	tests := []struct {
+		answers map[string]string
+		request func(c *PassPersistClient) error
+	}{
+		// Not enough lines
+		{map[string]string{".1.1": ".1.1\ninteger\n"}, func(c *PassPersistClient) error {
+			_, _, err := c.Get(O(1, 1))
+			return err
+		}},
+		// Unknown type
+		{map[string]string{".1.1": ".1.1\nfloat\n1.5\n"}, func(c *PassPersistClient) error {
+			_, _, err := c.Get(O(1, 1))
+			return err
+		}},
+		// Types that pass persist cannot carry
+		{map[string]string{".1.1": ".1.1\ncounter64\n1\n"}, func(c *PassPersistClient) error {
+			_, _, err := c.Get(O(1, 1))
+			return err
+		}},
+		// Bad value
+		{map[string]string{".1.1": ".1.1\ncounter\n-1\n"}, func(c *PassPersistClient) error {
+			_, _, err := c.Get(O(1, 1))
+			return err
+		}},
+		// Wrong OID
+		{map[string]string{".1.1": ".1.2\ninteger\n1\n"}, func(c *PassPersistClient) error {
+			_, _, err := c.Get(O(1, 1))
+			return err
+		}},
+		// Non-increasing GETNEXT
+		{map[string]string{".1.1": ".1.1\ninteger\n1\n"}, func(c *PassPersistClient) error {
+			_, _, err := c.GetNext(O(1, 1))
+			return err
+		}},
+		// Too many lines, noticed by the next command or when closing
+		{map[string]string{".1.1": "NONE\n.1.1\n", "PING": "PONG\n"}, func(c *PassPersistClient) error {
+			c.Get(O(1, 1))
+			return c.Close()
+		}},
+		// Bad answers
+		{map[string]string{"PING": "pong\n"}, func(c *PassPersistClient) error {
+			return c.Ping()
+		}},
+		{map[string]string{"integer 5": "OK\n"}, func(c *PassPersistClient) error {
+			return c.Set(VarBind{O(1, 1), AsnInteger, 5})
+		}},
+	}
+
+	for i, test := range tests {
+		if err := test.request(fakeExtension(test.answers)); !errors.Is(err, ProtocolViolation) {
+			t.Errorf("%d: expected a protocol violation, got %v", i, err)
+		}
+	}
+
+	// Refusals are not violations
+	client := fakeExtension(map[string]string{`string "x"`: "not-writable\n", "integer 5": "DONE\n"})
+	if err := client.Set(VarBind{O(1, 1), AsnOctetString, []byte("x")}); err != NotWritable {
+		t.Errorf("Expected notWritable, got %v", err)
+	} else if err := client.Set(VarBind{O(1, 1), AsnInteger, 5}); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
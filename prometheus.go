@@ -0,0 +1,389 @@
+package snmptools
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// PrometheusHandler is an http.Handler that renders an SMI tree in the
+// Prometheus text exposition format, so that it can be scraped directly.
+//
+// Counter32 and Counter64 leaves become counters, and Gauge32, UInteger32 and
+// INTEGER leaves become gauges. TimeTicks become gauges in seconds, with a
+// _seconds suffix. Leaves of other types, such as strings, are left out.
+//
+// Subtrees with the shape of a conceptual table - a single entry at .1, whose
+// children are all columns - are rendered as one metric per column, with a
+// series per row labelled by the row's index.
+//
+// Without a MIB, metrics are named after their OIDs and table rows are
+// labelled with an "index" label. With a MIB, metrics are named after their
+// objects, rows are labelled after the INDEX objects of their table entry, and
+// the objects' descriptions are used as help text. If the entry gives the
+// IndexKinds of its INDEX objects, the labels hold their decoded values, so
+// that tables indexed by strings or by several objects are labelled properly.
+type PrometheusHandler struct {
+	// Prefix is prepended to the name of every metric
+	Prefix string
+	// MIB, if set, names the metrics and their labels
+	MIB *MIB
+
+	root     OID
+	callback func() SMINode
+}
+
+// NewPrometheusHandler() creates a PrometheusHandler serving the tree returned
+// by callback, located at root.
+//
+// The callback is called once for every scrape, giving client code the
+// opportunity to update the SMINode that is being traversed.
+func NewPrometheusHandler(root OID, callback func() SMINode) *PrometheusHandler {
+	return &PrometheusHandler{
+		root:     root,
+		callback: callback,
+	}
+}
+
+func (h *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		buf      bytes.Buffer
+		families = &promFamilies{byName: make(map[string]*promFamily)}
+	)
+
+	h.collectNode(families, h.callback(), h.root.Copy())
+	for _, family := range families.ordered {
+		h.writeMetric(&buf, family.name, family.help, family.samples)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		logger.Debug(fmt.Sprintf("Could not write metrics: %s", err))
+	}
+}
+
+// promSample is one series of a metric
+type promSample struct {
+	labels []string
+	leaf   *SMILeaf
+}
+
+// promFamily is a metric and all of its series, which must be written
+// together
+type promFamily struct {
+	name, help string
+	samples    []promSample
+}
+
+// promFamilies collects the metrics of a tree, in the order they are found
+type promFamilies struct {
+	ordered []*promFamily
+	byName  map[string]*promFamily
+}
+
+// add adds samples to the metric called name, which may have been found
+// elsewhere in the tree already.
+func (f *promFamilies) add(name, help string, samples ...promSample) {
+	family, ok := f.byName[name]
+	if !ok {
+		family = &promFamily{name: name, help: help}
+		f.byName[name] = family
+		f.ordered = append(f.ordered, family)
+	}
+	family.samples = append(family.samples, samples...)
+}
+
+// collectNode collects every metric beneath node, which is at oid.
+func (h *PrometheusHandler) collectNode(families *promFamilies, node SMINode, oid OID) {
+	if node == nil {
+		return
+	}
+
+	children := node.Children()
+	if children == nil {
+		if leaf := node.Value(); leaf != nil {
+			h.collectScalar(families, oid, leaf)
+		}
+		return
+	}
+
+	if entry := GetLeaf(node, OID{1}); h.isTable(node, oid, entry) {
+		h.collectTable(families, entry, oid.Add(1))
+		return
+	}
+
+	arcs := childArcs(node)
+	for i, child := range children {
+		arc := uint32(i + 1)
+		if arcs != nil {
+			arc = arcs[i]
+		}
+		h.collectNode(families, child, oid.Add(arc))
+	}
+}
+
+// isTable says whether a subtree is a conceptual table. A table entry in the
+// MIB makes it one; otherwise its only child must be an entry at .1, whose
+// children are all columns of leaves, so that ordinary nested subtrees are
+// not mistaken for tables.
+func (h *PrometheusHandler) isTable(node SMINode, oid OID, entry SMINode) bool {
+	if entry == nil || entry.Children() == nil {
+		return false
+	} else if h.MIB != nil {
+		if info := h.MIB.Object(oid.Add(1)); info != nil && len(info.Indexes) > 0 {
+			return true
+		}
+	}
+
+	if tableEntry(node) == nil {
+		return false
+	}
+	for _, column := range entry.Children() {
+		if column == nil {
+			continue
+		}
+		for _, cell := range column.Children() {
+			if cell != nil && cell.Children() != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// collectScalar collects a leaf that is not part of a table.
+func (h *PrometheusHandler) collectScalar(families *promFamilies, oid OID, leaf *SMILeaf) {
+	var (
+		name   = oidMetricName(oid)
+		help   = oid.String()
+		labels []string
+	)
+
+	if h.MIB != nil {
+		if object, info := h.MIB.Lookup(oid); info != nil {
+			name, help = info.Name, describeMetric(info, object)
+			if instance := oid[len(object):]; len(instance) > 0 && !instance.Equals(OID{0}) {
+				labels = []string{"index", instanceString(instance)}
+			}
+		}
+	}
+
+	families.add(name, help, promSample{labels, leaf})
+}
+
+// collectTable collects each column of a table entry as a metric.
+func (h *PrometheusHandler) collectTable(families *promFamilies, entry SMINode, oid OID) {
+	var (
+		indexes []string
+		kinds   []Index
+	)
+	if h.MIB != nil {
+		if info := h.MIB.Object(oid); info != nil {
+			indexes, kinds = info.Indexes, info.IndexKinds
+		}
+	}
+
+	arcs := childArcs(entry)
+	for i, column := range entry.Children() {
+		if column == nil {
+			continue
+		}
+
+		arc := uint32(i + 1)
+		if arcs != nil {
+			arc = arcs[i]
+		}
+
+		var (
+			columnOID = oid.Add(arc)
+			name      = oidMetricName(columnOID)
+			help      = columnOID.String()
+			samples   []promSample
+		)
+
+		if h.MIB != nil {
+			if info := h.MIB.Object(columnOID); info != nil {
+				name, help = info.Name, describeMetric(info, columnOID)
+			}
+		}
+
+		Walk(column, func(instance OID, leaf *SMILeaf) error {
+			samples = append(samples, promSample{indexLabels(indexes, kinds, instance), leaf})
+			return nil
+		})
+
+		families.add(name, help, samples...)
+	}
+}
+
+// writeMetric renders one metric family, with all of its samples. Its type is taken from the first
+// sample that has a numeric type; samples of other types are left out.
+func (h *PrometheusHandler) writeMetric(w io.Writer, name, help string, samples []promSample) {
+	var metricType string
+	for _, sample := range samples {
+		if metricType = promType(sample.leaf.asnType); metricType != "" {
+			break
+		}
+	}
+	if metricType == "" {
+		return
+	}
+
+	name = h.Prefix + sanitizeMetricName(name)
+	if metricType == "seconds" {
+		name += "_seconds"
+	}
+
+	var header bool
+	for _, sample := range samples {
+		if promType(sample.leaf.asnType) != metricType {
+			continue
+		}
+
+		value, ok := promValue(sample.leaf)
+		if !ok {
+			continue
+		}
+
+		if !header {
+			fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+			if metricType == "seconds" {
+				fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+			} else {
+				fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+			}
+			header = true
+		}
+
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(sample.labels), value)
+	}
+}
+
+// promType returns the Prometheus metric type for an ASN type, "seconds" for
+// TimeTicks, or "" if the type is not numeric.
+func promType(t AsnType) string {
+	switch t {
+	case AsnCounter32, AsnCounter64:
+		return "counter"
+	case AsnGauge32, AsnUinteger32, AsnInteger:
+		return "gauge"
+	case AsnTimeTicks:
+		return "seconds"
+	}
+	return ""
+}
+
+// promValue formats the value of a numeric leaf.
+func promValue(leaf *SMILeaf) (string, bool) {
+	switch leaf.asnType {
+	case AsnInteger:
+		if i, ok := toInt64(leaf.value); ok {
+			return strconv.FormatInt(i, 10), true
+		}
+	case AsnTimeTicks:
+		if u, ok := toUint64(leaf.value); ok {
+			return strconv.FormatFloat(float64(u)/100, 'f', -1, 64), true
+		}
+	default:
+		if u, ok := toUint64(leaf.value); ok {
+			return strconv.FormatUint(u, 10), true
+		}
+	}
+	return "", false
+}
+
+// indexLabels builds the labels of a table row from its instance OID. If the
+// kinds of the index objects are known and the instance decodes, each object
+// gets a label holding its value. Otherwise, if there is one index object per
+// sub-identifier, each gets a label of its own; failing that, the whole index
+// is given in a single label.
+func indexLabels(indexes []string, kinds []Index, instance OID) []string {
+	var labels []string
+
+	if len(indexes) > 0 && len(kinds) == len(indexes) {
+		if values, err := instance.DecodeIndex(kinds...); err == nil {
+			for i, name := range indexes {
+				value := fmt.Sprint(values[i])
+				if !utf8.ValidString(value) {
+					// Label values must be UTF-8
+					labels = nil
+					break
+				}
+				labels = append(labels, name, value)
+			}
+			if labels != nil {
+				return labels
+			}
+		}
+	}
+
+	switch {
+	case len(indexes) > 1 && len(indexes) == len(instance):
+		for i, name := range indexes {
+			labels = append(labels, name, strconv.FormatUint(uint64(instance[i]), 10))
+		}
+	case len(indexes) == 1:
+		labels = []string{indexes[0], instanceString(instance)}
+	default:
+		labels = []string{"index", instanceString(instance)}
+	}
+
+	return labels
+}
+
+// instanceString formats an instance OID without its leading dot.
+func instanceString(instance OID) string {
+	return strings.TrimPrefix(instance.String(), ".")
+}
+
+func oidMetricName(oid OID) string {
+	return "oid" + strings.ReplaceAll(oid.String(), ".", "_")
+}
+
+func describeMetric(info *ObjectInfo, oid OID) string {
+	if info.Description == "" {
+		return oid.String()
+	}
+	return info.Description
+}
+
+// sanitizeMetricName replaces the characters that are not allowed in
+// Prometheus metric and label names.
+func sanitizeMetricName(name string) string {
+	var b = []byte(name)
+	for i, c := range b {
+		if !(c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", sanitizeMetricName(labels[i]), escapeLabelValue(labels[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,210 @@
+package snmptools
+
+import (
+	"expvar"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newPrometheusTestTree builds a tree with some scalars, and a table at .2
+// whose rows are indexed 1 and 3
+func newPrometheusTestTree() SMINode {
+	var (
+		columns = []*SMISparseSubtree{NewSMISparseSubtree(), NewSMISparseSubtree(), NewSMISparseSubtree()}
+		entry   = NewSMISubtree()
+	)
+
+	for _, row := range []uint32{1, 3} {
+		columns[0].SetChild(row, NewLeafNode(NewSMILeaf(AsnInteger, int(row))))
+		columns[1].SetChild(row, NewLeafNode(NewSMILeaf(AsnOctetString, "eth")))
+		columns[2].SetChild(row, NewLeafNode(&SMILeaf{AsnCounter64, uint64(row) * 1000}))
+	}
+	for _, column := range columns {
+		entry.AddChild(column)
+	}
+
+	return NewSMISubtree(
+		NewSMISubtree(
+			NewLeafNode(NewSMILeaf(AsnCounter32, uint32(5))),
+			NewLeafNode(NewSMILeaf(AsnTimeTicks, uint32(12345))),
+			NewLeafNode(NewSMILeaf(AsnOctetString, "skipped")),
+			NewLeafNode(NewSMILeaf(AsnInteger, -2)),
+		),
+		NewSMISubtree(entry),
+	)
+}
+
+// Test rendering a tree with and without metadata
+func TestPrometheusHandler(t *testing.T) {
+	var (
+		root    = testAgentRoot
+		tree    = newPrometheusTestTree()
+		handler = NewPrometheusHandler(root, func() SMINode { return tree })
+	)
+
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+			t.Errorf("Bad content type: %s", ct)
+		}
+		return w.Body.String()
+	}
+
+	expected := `# HELP oid_1_3_6_1_4_1_898889_1_1 .1.3.6.1.4.1.898889.1.1
+# TYPE oid_1_3_6_1_4_1_898889_1_1 counter
+oid_1_3_6_1_4_1_898889_1_1 5
+# HELP oid_1_3_6_1_4_1_898889_1_2_seconds .1.3.6.1.4.1.898889.1.2
+# TYPE oid_1_3_6_1_4_1_898889_1_2_seconds gauge
+oid_1_3_6_1_4_1_898889_1_2_seconds 123.45
+# HELP oid_1_3_6_1_4_1_898889_1_4 .1.3.6.1.4.1.898889.1.4
+# TYPE oid_1_3_6_1_4_1_898889_1_4 gauge
+oid_1_3_6_1_4_1_898889_1_4 -2
+# HELP oid_1_3_6_1_4_1_898889_2_1_1 .1.3.6.1.4.1.898889.2.1.1
+# TYPE oid_1_3_6_1_4_1_898889_2_1_1 gauge
+oid_1_3_6_1_4_1_898889_2_1_1{index="1"} 1
+oid_1_3_6_1_4_1_898889_2_1_1{index="3"} 3
+# HELP oid_1_3_6_1_4_1_898889_2_1_3 .1.3.6.1.4.1.898889.2.1.3
+# TYPE oid_1_3_6_1_4_1_898889_2_1_3 counter
+oid_1_3_6_1_4_1_898889_2_1_3{index="1"} 1000
+oid_1_3_6_1_4_1_898889_2_1_3{index="3"} 3000
+`
+	if got := scrape(); got != expected {
+		t.Errorf("Bad metrics without a MIB:\n%s", got)
+	}
+
+	mib := NewMIB()
+	mib.Define(root.Add(1, 1), ObjectInfo{Name: "testCount", Description: "A \\ counter\nof things"})
+	mib.Define(root.Add(1, 2), ObjectInfo{Name: "testUptime"})
+	mib.Define(root.Add(2, 1), ObjectInfo{Name: "testEntry", Indexes: []string{"testIndex"}})
+	mib.Define(root.Add(2, 1, 3), ObjectInfo{Name: "testOctets"})
+	handler.MIB = mib
+	handler.Prefix = "snmp_"
+
+	expected = `# HELP snmp_testCount A \\ counter\nof things
+# TYPE snmp_testCount counter
+snmp_testCount 5
+# HELP snmp_testUptime_seconds .1.3.6.1.4.1.898889.1.2
+# TYPE snmp_testUptime_seconds gauge
+snmp_testUptime_seconds 123.45
+# HELP snmp_oid_1_3_6_1_4_1_898889_1_4 .1.3.6.1.4.1.898889.1.4
+# TYPE snmp_oid_1_3_6_1_4_1_898889_1_4 gauge
+snmp_oid_1_3_6_1_4_1_898889_1_4 -2
+# HELP snmp_oid_1_3_6_1_4_1_898889_2_1_1 .1.3.6.1.4.1.898889.2.1.1
+# TYPE snmp_oid_1_3_6_1_4_1_898889_2_1_1 gauge
+snmp_oid_1_3_6_1_4_1_898889_2_1_1{testIndex="1"} 1
+snmp_oid_1_3_6_1_4_1_898889_2_1_1{testIndex="3"} 3
+# HELP snmp_testOctets .1.3.6.1.4.1.898889.2.1.3
+# TYPE snmp_testOctets counter
+snmp_testOctets{testIndex="1"} 1000
+snmp_testOctets{testIndex="3"} 3000
+`
+	if got := scrape(); got != expected {
+		t.Errorf("Bad metrics with a MIB:\n%s", got)
+	}
+}
+
+// Test that metrics found in several places are written as one family, and
+// that nested subtrees are not mistaken for tables
+func TestPrometheusFamilies(t *testing.T) {
+	var (
+		root = testAgentRoot
+		tree = NewSMISubtree(
+			NewSMISubtree(NewSMISubtree(NewSMISubtree(
+				NewSMISubtree(
+					NewLeafNode(NewSMILeaf(AsnGauge32, uint32(7))),
+					NewLeafNode(NewSMILeaf(AsnGauge32, uint32(8))),
+				),
+				NewLeafNode(NewSMILeaf(AsnGauge32, uint32(9))),
+			))),
+			NewSMISubtree(
+				NewLeafNode(NewSMILeaf(AsnGauge32, uint32(10))),
+				NewLeafNode(NewSMILeaf(AsnCounter32, uint32(1))),
+			),
+			NewLeafNode(NewSMILeaf(AsnGauge32, uint32(20))),
+		)
+		handler = NewPrometheusHandler(root, func() SMINode { return tree })
+	)
+
+	mib := NewMIB()
+	mib.Define(root.Add(2), ObjectInfo{Name: "fooLoad"})
+	mib.Define(root.Add(3), ObjectInfo{Name: "fooLoad"})
+	handler.MIB = mib
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `# HELP oid_1_3_6_1_4_1_898889_1_1_1_1_1 .1.3.6.1.4.1.898889.1.1.1.1.1
+# TYPE oid_1_3_6_1_4_1_898889_1_1_1_1_1 gauge
+oid_1_3_6_1_4_1_898889_1_1_1_1_1 7
+# HELP oid_1_3_6_1_4_1_898889_1_1_1_1_2 .1.3.6.1.4.1.898889.1.1.1.1.2
+# TYPE oid_1_3_6_1_4_1_898889_1_1_1_1_2 gauge
+oid_1_3_6_1_4_1_898889_1_1_1_1_2 8
+# HELP oid_1_3_6_1_4_1_898889_1_1_1_2 .1.3.6.1.4.1.898889.1.1.1.2
+# TYPE oid_1_3_6_1_4_1_898889_1_1_1_2 gauge
+oid_1_3_6_1_4_1_898889_1_1_1_2 9
+# HELP fooLoad .1.3.6.1.4.1.898889.2
+# TYPE fooLoad gauge
+fooLoad{index="1"} 10
+fooLoad 20
+`
+	if got := w.Body.String(); got != expected {
+		t.Errorf("Bad metrics:\n%s", got)
+	}
+}
+
+// Test labelling the rows of tables indexed by strings and by several
+// objects. Strings are ordered by their length first, as in their instances.
+func TestPrometheusIndexLabels(t *testing.T) {
+	var (
+		root    = testAgentRoot
+		named   = NewSMISparseSubtree()
+		neigh   = NewSMISparseSubtree()
+		kinds   = []Index{{Kind: IntegerIndex}, {Kind: IpAddressIndex}}
+		handler = NewPrometheusHandler(root, func() SMINode {
+			return NewSMISubtree(NewSMISubtree(named), NewSMISubtree(neigh))
+		})
+	)
+
+	for i, name := range []string{"alpha", "beta"} {
+		instance, _ := NewOID(1).AddIndex([]Index{{Kind: StringIndex}}, name)
+		named.Insert(instance, NewLeafNode(NewSMILeaf(AsnGauge32, uint32(i))))
+	}
+	instance, _ := NewOID(1).AddIndex(kinds, 2, net.ParseIP("192.0.2.1"))
+	neigh.Insert(instance, NewLeafNode(NewSMILeaf(AsnCounter32, uint32(7))))
+
+	mib := NewMIB()
+	mib.Define(root.Add(1, 1), ObjectInfo{Name: "testNamedEntry", Indexes: []string{"testName"}, IndexKinds: []Index{{Kind: StringIndex}}})
+	mib.Define(root.Add(1, 1, 1), ObjectInfo{Name: "testNamedValue"})
+	mib.Define(root.Add(2, 1), ObjectInfo{Name: "testNeighEntry", Indexes: []string{"testIfIndex", "testAddress"}, IndexKinds: kinds})
+	mib.Define(root.Add(2, 1, 1), ObjectInfo{Name: "testNeighPackets"})
+	handler.MIB = mib
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `# HELP testNamedValue .1.3.6.1.4.1.898889.1.1.1
+# TYPE testNamedValue gauge
+testNamedValue{testName="beta"} 1
+testNamedValue{testName="alpha"} 0
+# HELP testNeighPackets .1.3.6.1.4.1.898889.2.1.1
+# TYPE testNeighPackets counter
+testNeighPackets{testIfIndex="2",testAddress="192.0.2.1"} 7
+`
+	if got := w.Body.String(); got != expected {
+		t.Errorf("Bad metrics:\n%s", got)
+	}
+
+	// The expvar table of the runtime tree is labelled by name
+	expvar.NewInt("snmptoolsPrometheusTest").Set(3)
+	handler = NewPrometheusHandler(RuntimeRoot, RuntimeTree)
+	handler.MIB = RuntimeMIB(RuntimeRoot)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if line := `goExpvarInteger{goExpvarName="snmptoolsPrometheusTest"} 3`; !strings.Contains(w.Body.String(), line) {
+		t.Errorf("Expected %q in:\n%s", line, w.Body.String())
+	}
+}
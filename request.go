@@ -0,0 +1,178 @@
+package snmptools
+
+// requestContext holds what is needed to answer one SNMP request PDU from an
+// SMI tree. It is shared by the transports that serve SMINodes over SNMP PDUs.
+type requestContext struct {
+	// tree is the SMI tree being served, located at root
+	tree SMINode
+	root OID
+	// version selects SNMPv1 or SNMPv2 error handling
+	version SNMPVersion
+	// readable and writable say whether an OID may be read or written; they
+	// implement access control
+	readable, writable func(oid OID) bool
+}
+
+// Access functions for requestContexts
+var (
+	allOIDs = func(oid OID) bool { return true }
+	noOIDs  = func(oid OID) bool { return false }
+)
+
+// process() answers a request PDU, returning the response PDU or nil if the
+// PDU is not a request that can be answered.
+func (c *requestContext) process(req *PDU) *PDU {
+	var (
+		resp = &PDU{
+			Type:      AsnGetResponse,
+			RequestID: req.RequestID,
+		}
+		status ErrorStatus
+		index  int
+	)
+
+	switch req.Type {
+	case AsnGetRequest:
+		resp.VarBinds, status, index = c.get(req.VarBinds)
+
+	case AsnGetNextRequest:
+		resp.VarBinds, status, index = c.getNext(req.VarBinds)
+
+	case AsnGetBulkRequest:
+		if c.version == Version1 {
+			return nil
+		}
+		resp.VarBinds = getBulk(c.tree, c.root, req.NonRepeaters, req.MaxRepetitions, oidsOf(req.VarBinds), c.accept)
+
+	case AsnSetRequest:
+		status, index = c.set(req.VarBinds)
+		resp.VarBinds = req.VarBinds
+
+	default:
+		return nil
+	}
+
+	if status != NoError {
+		// Errors are reported along with the original request varbinds
+		resp.ErrorStatus = status
+		resp.ErrorIndex = index
+		resp.VarBinds = req.VarBinds
+		if c.version == Version1 {
+			resp.ErrorStatus = v1ErrorStatus(status)
+		}
+	}
+
+	return resp
+}
+
+// get() answers the varbinds of a GetRequest.
+func (c *requestContext) get(vbs []VarBind) ([]VarBind, ErrorStatus, int) {
+	var result = make([]VarBind, len(vbs))
+
+	for i, vb := range vbs {
+		result[i] = c.getOne(vb.OID)
+		if c.version == Version1 && (result[i].IsException() || result[i].Type == AsnCounter64) {
+			// SNMPv1 has no exceptions, nor Counter64
+			return nil, NoSuchName, i + 1
+		}
+	}
+
+	return result, NoError, 0
+}
+
+func (c *requestContext) getOne(oid OID) VarBind {
+	rel, err := oid.GetRemainder(c.root)
+	if err != nil || len(rel) == 0 || !c.readable(oid) {
+		return VarBind{OID: oid, Type: AsnNoSuchObject}
+	}
+
+	if node := GetLeaf(c.tree, rel); node != nil && node.Children() == nil && node.Value() != nil {
+		return NewVarBind(oid, node.Value())
+	}
+
+	// Report noSuchInstance if the parent exists, as it does for a scalar or
+	// column asked for a bad instance
+	if parent := GetLeaf(c.tree, rel[:len(rel)-1]); len(rel) > 1 && parent != nil && parent.Children() != nil {
+		return VarBind{OID: oid, Type: AsnNoSuchInstance}
+	}
+	return VarBind{OID: oid, Type: AsnNoSuchObject}
+}
+
+// getNext() answers the varbinds of a GetNextRequest.
+func (c *requestContext) getNext(vbs []VarBind) ([]VarBind, ErrorStatus, int) {
+	var (
+		result = make([]VarBind, len(vbs))
+		it     = NewIterator(c.tree)
+	)
+
+	for i, vb := range vbs {
+		seekFrom(it, c.root, vb.OID)
+		result[i] = nextVarBind(it, c.root, vb.OID, c.accept)
+
+		if c.version == Version1 && result[i].Type == AsnEndOfMibView {
+			return nil, NoSuchName, i + 1
+		}
+	}
+
+	return result, NoError, 0
+}
+
+// accept() says whether a leaf may be returned by GetNext or GetBulk.
+func (c *requestContext) accept(vb VarBind) bool {
+	if c.version == Version1 && vb.Type == AsnCounter64 {
+		// SNMPv1 managers skip over Counter64 objects
+		return false
+	}
+	return c.readable(vb.OID)
+}
+
+// set() applies the varbinds of a SetRequest, all or nothing.
+func (c *requestContext) set(vbs []VarBind) (ErrorStatus, int) {
+	tx, status, index := c.transaction(vbs)
+	if status != NoError {
+		return status, index
+	}
+	return tx.Apply()
+}
+
+// transaction() checks that the varbinds of a SetRequest may be written, and
+// returns a SetTransaction that writes them.
+func (c *requestContext) transaction(vbs []VarBind) (*SetTransaction, ErrorStatus, int) {
+	var relative = make([]VarBind, len(vbs))
+
+	for i, vb := range vbs {
+		if !c.writable(vb.OID) {
+			return nil, NoAccess, i + 1
+		}
+
+		rel, err := vb.OID.GetRemainder(c.root)
+		if err != nil {
+			return nil, NoCreation, i + 1
+		}
+		relative[i] = VarBind{rel, vb.Type, vb.Value}
+	}
+
+	return NewSetTransaction(c.tree, relative), NoError, 0
+}
+
+// v1ErrorStatus maps SNMPv2 error statuses onto those SNMPv1 understands, as
+// specified by RFC 3584 section 4.3.
+func v1ErrorStatus(status ErrorStatus) ErrorStatus {
+	switch status {
+	case WrongValue, WrongEncoding, WrongType, WrongLength, InconsistentValue:
+		return BadValue
+	case NoAccess, NotWritable, NoCreation, InconsistentName, AuthorizationError:
+		return NoSuchName
+	case ResourceUnavailable, CommitFailed, UndoFailed:
+		return GenErr
+	}
+	return status
+}
+
+func oidsOf(vbs []VarBind) []OID {
+	var oids = make([]OID, len(vbs))
+	for i, vb := range vbs {
+		oids[i] = vb.OID
+	}
+	return oids
+}
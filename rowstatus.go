@@ -0,0 +1,595 @@
+package snmptools
+
+import (
+	"fmt"
+	"sync"
+)
+
+// RowStatus is a value of the RowStatus textual convention (RFC 2579), which
+// controls the creation and deletion of table rows.
+type RowStatus int
+
+const (
+	RowActive        RowStatus = 1
+	RowNotInService  RowStatus = 2
+	RowNotReady      RowStatus = 3
+	RowCreateAndGo   RowStatus = 4
+	RowCreateAndWait RowStatus = 5
+	RowDestroy       RowStatus = 6
+)
+
+func (s RowStatus) String() string {
+	if name, ok := TextualConventions["RowStatus"].Enums[int64(s)]; ok {
+		return name
+	}
+	return fmt.Sprintf("RowStatus(%d)", int(s))
+}
+
+// WritableColumn describes a column of a RowStatusTable.
+type WritableColumn struct {
+	Arc  uint32
+	Type AsnType
+	// Required columns must have values before a row can be made active
+	Required bool
+	// Default, if set, is the value of the column in new rows
+	Default *SMILeaf
+	// ReadOnly columns can only be given values by the application, with
+	// AddRow()
+	ReadOnly bool
+	// Validate, if set, checks each value set in the column. Returning an
+	// ErrorStatus reports it to the manager; other errors are WrongValue.
+	Validate func(leaf *SMILeaf) error
+}
+
+// RowEvent says what happened to a row of a RowStatusTable.
+type RowEvent int
+
+const (
+	// The row became active
+	RowActivated RowEvent = iota
+	// A value of an active row changed
+	RowUpdated
+	// The row was taken out of service
+	RowDeactivated
+	// An active row was destroyed
+	RowDestroyed
+)
+
+var rowEventStrings = []string{
+	"activated",
+	"updated",
+	"deactivated",
+	"destroyed",
+}
+
+func (e RowEvent) String() string {
+	if e >= 0 && int(e) < len(rowEventStrings) {
+		return rowEventStrings[e]
+	}
+	return fmt.Sprintf("RowEvent(%d)", int(e))
+}
+
+// RowChange is a change to a row of a RowStatusTable that takes effect in the
+// application.
+type RowChange struct {
+	Event    RowEvent
+	Instance OID
+	// Index holds the row's index values, if the table's Indexes are set
+	Index []interface{}
+	// Values holds the row's values by column arc, as they are after the
+	// change, or were before it for RowDestroyed
+	Values map[uint32]*SMILeaf
+}
+
+// statusRow is a row of a RowStatusTable
+type statusRow struct {
+	instance OID
+	status   RowStatus
+	values   map[uint32]*SMILeaf
+	// provisional rows hold values set before the RowStatus that creates
+	// them, in the same transaction
+	provisional bool
+}
+
+// RowStatusTable is a writable conceptual table whose rows are created and
+// destroyed by managers through a RowStatus column, as described by RFC 2579.
+// It is placed in an SMI tree at the OID of the table, with its entry at .1,
+// and handles SET requests from any transport that supports them.
+//
+// Rows created with createAndWait are notReady until every required column
+// has a value, and then notInService until they are set active. Rows created
+// with createAndGo become active at once, and must be complete. The values
+// of other columns may be set in the same request as the RowStatus, before
+// or after it: a SetTransaction sets the RowStatus last, so that the row is
+// only checked once all of its values are in. Setting a column of a row that
+// does not exist fails with InconsistentName, unless the same transaction
+// creates the row.
+//
+// The application hears about rows only when they take effect: Commit is
+// called when a row becomes active, when a value of an active row changes,
+// and when an active row is taken out of service or destroyed. If it returns
+// an error the change is refused.
+type RowStatusTable struct {
+	// Indexes, if set, are used to check the instances of new rows, and to
+	// decode them for Commit
+	Indexes []Index
+
+	statusArc uint32
+	columns   map[uint32]*WritableColumn
+	commit    func(change RowChange) error
+
+	mu   sync.Mutex
+	rows map[string]*statusRow
+	// entry is rebuilt after each change, so that readers need no lock
+	entry *SMISparseSubtree
+
+	// A SET transaction is open from the first TestSet() until CleanupSet().
+	// undo holds the rows before each Set() of the transaction, and creating
+	// the instances of the rows it creates.
+	undo        []map[string]*statusRow
+	creating    map[string]bool
+	transaction bool
+}
+
+// NewRowStatusTable() creates an empty table, with the RowStatus column at
+// statusArc of the entry. commit may be nil.
+func NewRowStatusTable(statusArc uint32, columns []WritableColumn, commit func(change RowChange) error) *RowStatusTable {
+	t := &RowStatusTable{
+		statusArc: statusArc,
+		columns:   make(map[uint32]*WritableColumn),
+		commit:    commit,
+		rows:      make(map[string]*statusRow),
+		creating:  make(map[string]bool),
+		entry:     NewSMISparseSubtree(),
+	}
+	for i := range columns {
+		t.columns[columns[i].Arc] = &columns[i]
+	}
+	return t
+}
+
+func (t *RowStatusTable) Children() []SMINode {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return []SMINode{t.entry}
+}
+
+func (t *RowStatusTable) Value() *SMILeaf {
+	return nil
+}
+
+// AddRow() adds an active row from the application, such as one loaded from
+// its configuration, without calling Commit. Columns without values are
+// given their defaults.
+func (t *RowStatusTable) AddRow(instance OID, values map[uint32]*SMILeaf) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkInstance(instance); err != nil {
+		return err
+	}
+
+	row := t.newRow(instance, RowActive)
+	for arc, leaf := range values {
+		if _, ok := t.columns[arc]; !ok {
+			return fmt.Errorf("%w: no column %d", NoCreation, arc)
+		}
+		row.values[arc] = leaf
+	}
+	if !t.complete(row) {
+		return fmt.Errorf("%w: row %s is missing required columns", InconsistentValue, instance)
+	}
+
+	t.rows[instance.String()] = row
+	t.rebuild()
+	return nil
+}
+
+// Status() returns the status of the row at instance, and false if there is
+// no such row.
+func (t *RowStatusTable) Status(instance OID) (RowStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if row, ok := t.rows[instance.String()]; ok && !row.provisional {
+		return row.status, true
+	}
+	return 0, false
+}
+
+// Set() handles a SET of a RowStatus or other column, at an OID made of the
+// entry's arc, the column's arc and the row's instance.
+func (t *RowStatusTable) Set(oid OID, leaf *SMILeaf) error {
+	if len(oid) < 3 || oid[0] != 1 {
+		return NoCreation
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.transaction {
+		t.undo = append(t.undo, t.state())
+	}
+
+	var (
+		arc      = oid[1]
+		instance = oid[2:]
+		err      error
+	)
+
+	if arc == t.statusArc {
+		err = t.setStatus(instance, leaf)
+	} else {
+		err = t.setColumn(arc, instance, leaf)
+	}
+
+	if err != nil && t.transaction {
+		t.rows = t.undo[len(t.undo)-1]
+		t.undo = t.undo[:len(t.undo)-1]
+	}
+	t.rebuild()
+	return err
+}
+
+// TestSet() checks a value for a SET transaction. The state of rows is only
+// checked when the value is set, as other values of the transaction may
+// change it.
+func (t *RowStatusTable) TestSet(oid OID, leaf *SMILeaf) error {
+	if len(oid) < 3 || oid[0] != 1 {
+		return NoCreation
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.transaction = true
+
+	var (
+		arc      = oid[1]
+		instance = oid[2:]
+	)
+
+	if _, has := t.rows[instance.String()]; !has {
+		if err := t.checkInstance(instance); err != nil {
+			return err
+		}
+	}
+
+	if arc != t.statusArc {
+		return t.testColumn(arc, leaf)
+	}
+
+	status, err := t.testStatus(leaf)
+	if status == RowCreateAndGo || status == RowCreateAndWait {
+		t.creating[instance.String()] = true
+	}
+	return err
+}
+
+// SetLate() says that the RowStatus column is set after the other values of
+// a transaction, so that rows are complete when they are created or made
+// active.
+func (t *RowStatusTable) SetLate(oid OID) bool {
+	return len(oid) >= 3 && oid[0] == 1 && oid[1] == t.statusArc
+}
+
+// UndoSet() restores the rows as they were before the latest Set() of a SET
+// transaction, telling the application about any rows whose changes it had
+// been told of.
+func (t *RowStatusTable) UndoSet(oid OID) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.undo) == 0 {
+		return UndoFailed
+	}
+
+	var (
+		previous = t.undo[len(t.undo)-1]
+		err      error
+	)
+	t.undo = t.undo[:len(t.undo)-1]
+
+	for key, row := range t.rows {
+		old, had := previous[key]
+		had = had && !old.provisional
+		switch {
+		case row.status != RowActive && had && old.status == RowActive:
+			err = t.notify(RowActivated, old, old.values)
+		case row.status != RowActive:
+		case !had:
+			err = t.notify(RowDestroyed, row, row.values)
+		case old.status != RowActive:
+			err = t.notify(RowDeactivated, row, row.values)
+		case !sameValues(row.values, old.values):
+			err = t.notify(RowUpdated, old, old.values)
+		}
+		if err != nil {
+			return UndoFailed
+		}
+	}
+	for key, old := range previous {
+		if _, has := t.rows[key]; !has && old.status == RowActive {
+			if err := t.notify(RowActivated, old, old.values); err != nil {
+				return UndoFailed
+			}
+		}
+	}
+
+	t.rows = previous
+	t.rebuild()
+	return nil
+}
+
+// CleanupSet() ends a SET transaction, dropping any provisional rows that
+// were not created after all.
+func (t *RowStatusTable) CleanupSet(oid OID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, row := range t.rows {
+		if row.provisional {
+			delete(t.rows, key)
+		}
+	}
+	t.rebuild()
+
+	t.undo, t.transaction = nil, false
+	t.creating = make(map[string]bool)
+}
+
+// state copies the rows, so that they can be restored.
+func (t *RowStatusTable) state() map[string]*statusRow {
+	var rows = make(map[string]*statusRow, len(t.rows))
+
+	for key, row := range t.rows {
+		copied := *row
+		copied.values = make(map[uint32]*SMILeaf, len(row.values))
+		for arc, leaf := range row.values {
+			copied.values[arc] = leaf
+		}
+		rows[key] = &copied
+	}
+
+	return rows
+}
+
+func sameValues(a, b map[uint32]*SMILeaf) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for arc, leaf := range a {
+		if b[arc] != leaf {
+			return false
+		}
+	}
+	return true
+}
+
+// setStatus moves a row through the RowStatus state machine.
+func (t *RowStatusTable) setStatus(instance OID, leaf *SMILeaf) error {
+	status, err := t.testStatus(leaf)
+	if err != nil {
+		return err
+	}
+
+	var (
+		key      = instance.String()
+		row, has = t.rows[key]
+	)
+
+	if !has || row.provisional {
+		switch status {
+		case RowDestroy:
+			delete(t.rows, key)
+			return nil
+		case RowActive, RowNotInService:
+			return InconsistentValue
+		}
+
+		if err := t.checkInstance(instance); err != nil {
+			return err
+		}
+
+		// A provisional row already holds the values set before its status
+		created := t.newRow(instance, RowNotReady)
+		if has {
+			created.values = row.values
+		}
+
+		if status == RowCreateAndGo {
+			if !t.complete(created) {
+				return InconsistentValue
+			} else if err := t.notify(RowActivated, created, created.values); err != nil {
+				return err
+			}
+			created.status = RowActive
+		} else if t.complete(created) {
+			created.status = RowNotInService
+		}
+
+		t.rows[key] = created
+		return nil
+	}
+
+	switch status {
+	case RowCreateAndGo, RowCreateAndWait:
+		return InconsistentValue
+
+	case RowDestroy:
+		if row.status == RowActive {
+			if err := t.notify(RowDestroyed, row, row.values); err != nil {
+				return err
+			}
+		}
+		delete(t.rows, key)
+
+	case RowActive:
+		if row.status == RowNotReady {
+			return InconsistentValue
+		} else if row.status == RowNotInService {
+			if err := t.notify(RowActivated, row, row.values); err != nil {
+				return err
+			}
+			row.status = RowActive
+		}
+
+	case RowNotInService:
+		if row.status == RowNotReady {
+			return InconsistentValue
+		} else if row.status == RowActive {
+			if err := t.notify(RowDeactivated, row, row.values); err != nil {
+				return err
+			}
+			row.status = RowNotInService
+		}
+	}
+
+	return nil
+}
+
+// setColumn changes a value of a row, which may be a provisional row that
+// the transaction creates.
+func (t *RowStatusTable) setColumn(arc uint32, instance OID, leaf *SMILeaf) error {
+	if err := t.testColumn(arc, leaf); err != nil {
+		return err
+	}
+
+	key := instance.String()
+	row, has := t.rows[key]
+	if !has {
+		if err := t.checkInstance(instance); err != nil {
+			return err
+		} else if !t.transaction || !t.creating[key] {
+			return InconsistentName
+		}
+
+		row = t.newRow(instance, RowNotReady)
+		row.provisional = true
+		t.rows[key] = row
+	}
+
+	if row.status == RowActive {
+		values := make(map[uint32]*SMILeaf, len(row.values))
+		for a, v := range row.values {
+			values[a] = v
+		}
+		values[arc] = leaf
+
+		if err := t.notify(RowUpdated, row, values); err != nil {
+			return err
+		}
+	}
+
+	row.values[arc] = leaf
+	if row.status == RowNotReady && !row.provisional && t.complete(row) {
+		row.status = RowNotInService
+	}
+	return nil
+}
+
+// testStatus checks a value of the RowStatus column.
+func (t *RowStatusTable) testStatus(leaf *SMILeaf) (RowStatus, error) {
+	if leaf.asnType != AsnInteger {
+		return 0, WrongType
+	}
+	value, ok := toInt64(leaf.value)
+	if !ok || value < int64(RowActive) || value > int64(RowDestroy) || RowStatus(value) == RowNotReady {
+		return 0, WrongValue
+	}
+	return RowStatus(value), nil
+}
+
+// testColumn checks a value of another column.
+func (t *RowStatusTable) testColumn(arc uint32, leaf *SMILeaf) error {
+	column, ok := t.columns[arc]
+	if !ok {
+		return NoCreation
+	} else if column.ReadOnly {
+		return NotWritable
+	} else if leaf.asnType != column.Type {
+		return WrongType
+	} else if _, err := berValue(leaf.asnType, leaf.value); err != nil {
+		return WrongValue
+	} else if column.Validate != nil {
+		if err := column.Validate(leaf); err != nil {
+			if status, ok := err.(ErrorStatus); ok {
+				return status
+			}
+			return WrongValue
+		}
+	}
+	return nil
+}
+
+// notify calls Commit with a change to a row.
+func (t *RowStatusTable) notify(event RowEvent, row *statusRow, values map[uint32]*SMILeaf) error {
+	if t.commit == nil {
+		return nil
+	}
+
+	change := RowChange{Event: event, Instance: row.instance.Copy(), Values: make(map[uint32]*SMILeaf, len(values))}
+	for arc, leaf := range values {
+		change.Values[arc] = leaf
+	}
+	if len(t.Indexes) > 0 {
+		change.Index, _ = row.instance.DecodeIndex(t.Indexes...)
+	}
+
+	if err := t.commit(change); err != nil {
+		logger.Debug(fmt.Sprintf("Row %s was not %s: %s", row.instance, event, err))
+		if status, ok := err.(ErrorStatus); ok {
+			return status
+		}
+		return CommitFailed
+	}
+	return nil
+}
+
+func (t *RowStatusTable) newRow(instance OID, status RowStatus) *statusRow {
+	row := &statusRow{instance: instance.Copy(), status: status, values: make(map[uint32]*SMILeaf)}
+	for arc, column := range t.columns {
+		if column.Default != nil {
+			row.values[arc] = column.Default
+		}
+	}
+	return row
+}
+
+// complete says whether every required column of a row has a value.
+func (t *RowStatusTable) complete(row *statusRow) bool {
+	for arc, column := range t.columns {
+		if _, ok := row.values[arc]; column.Required && !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// checkInstance checks that a new row's instance matches the indexes.
+func (t *RowStatusTable) checkInstance(instance OID) error {
+	if len(t.Indexes) > 0 {
+		if _, err := instance.DecodeIndex(t.Indexes...); err != nil {
+			return NoCreation
+		}
+	}
+	return nil
+}
+
+// rebuild replaces the entry with one holding the current rows.
+func (t *RowStatusTable) rebuild() {
+	var entry = NewSMISparseSubtree()
+
+	for _, row := range t.rows {
+		if row.provisional {
+			continue
+		}
+		entry.Insert(NewOID(t.statusArc).Add(row.instance...), NewLeafNode(NewSMILeaf(AsnInteger, int(row.status))))
+		for arc, leaf := range row.values {
+			entry.Insert(NewOID(arc).Add(row.instance...), NewLeafNode(leaf))
+		}
+	}
+
+	t.entry = entry
+}
@@ -0,0 +1,196 @@
+package snmptools
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// newJobTable builds a table of jobs with a required name at .2, a priority
+// at .3 that defaults to 5 and must be at most 10, a read-only run count at
+// .4 and the RowStatus at .5
+func newJobTable(commit func(change RowChange) error) *RowStatusTable {
+	table := NewRowStatusTable(5, []WritableColumn{
+		{Arc: 2, Type: AsnOctetString, Required: true},
+		{Arc: 3, Type: AsnInteger, Default: NewSMILeaf(AsnInteger, 5), Validate: func(leaf *SMILeaf) error {
+			if i, _ := toInt64(leaf.Value()); i > 10 {
+				return WrongValue
+			}
+			return nil
+		}},
+		{Arc: 4, Type: AsnCounter32, ReadOnly: true},
+	}, commit)
+	table.Indexes = []Index{{Kind: IntegerIndex}}
+	return table
+}
+
+func TestRowStatusTable(t *testing.T) {
+	var (
+		O       = NewOID
+		changes []RowChange
+		refuse  bool
+		table   = newJobTable(func(change RowChange) error {
+			if refuse {
+				return errors.New("refused")
+			}
+			changes = append(changes, change)
+			return nil
+		})
+		status = func(s RowStatus) *SMILeaf { return NewSMILeaf(AsnInteger, int(s)) }
+		name   = NewSMILeaf(AsnOctetString, "backup")
+	)
+
+	steps := []struct {
+		oid    OID
+		leaf   *SMILeaf
+		err    error
+		status RowStatus
+	}{
+		// createAndWait, then fill in the row and activate it
+		{O(1, 5, 1), status(RowCreateAndWait), nil, RowNotReady},
+		{O(1, 5, 1), status(RowActive), InconsistentValue, RowNotReady},
+		{O(1, 5, 1), status(RowCreateAndWait), InconsistentValue, RowNotReady},
+		{O(1, 2, 1), NewSMILeaf(AsnInteger, 1), WrongType, RowNotReady},
+		{O(1, 3, 1), NewSMILeaf(AsnInteger, 11), WrongValue, RowNotReady},
+		{O(1, 4, 1), NewSMILeaf(AsnCounter32, uint32(1)), NotWritable, RowNotReady},
+		{O(1, 2, 1), name, nil, RowNotInService},
+		{O(1, 5, 1), status(RowActive), nil, RowActive},
+		{O(1, 5, 1), status(RowNotReady), WrongValue, RowActive},
+		{O(1, 3, 1), NewSMILeaf(AsnInteger, 7), nil, RowActive},
+		{O(1, 5, 1), status(RowNotInService), nil, RowNotInService},
+		{O(1, 5, 1), status(RowDestroy), nil, 0},
+
+		// createAndGo needs a complete row, and values can only be set for
+		// a row that does not exist in the transaction that creates it
+		{O(1, 5, 2), status(RowCreateAndGo), InconsistentValue, 0},
+		{O(1, 2, 2), name, InconsistentName, 0},
+
+		// Bad instances and columns
+		{O(1, 5, 3, 1), status(RowCreateAndGo), NoCreation, 0},
+		{O(1, 9, 3), name, NoCreation, 0},
+		{O(1, 5, 3), status(RowActive), InconsistentValue, 0},
+	}
+
+	for i, step := range steps {
+		if err := table.Set(step.oid, step.leaf); err != step.err {
+			t.Errorf("%d: setting %s to %s: expected %v, got %v", i, step.oid, step.leaf, step.err, err)
+		}
+		if s, ok := table.Status(step.oid[2:]); s != step.status || ok != (step.status != 0) {
+			t.Errorf("%d: expected status %s, got %s", i, step.status, s)
+		}
+	}
+
+	// The RowStatus is set after the other values of a transaction, wherever
+	// it is in the request
+	if s, i := NewSetTransaction(table, []VarBind{
+		{O(1, 5, 2), AsnInteger, int(RowCreateAndGo)},
+		{O(1, 2, 2), AsnOctetString, "backup"},
+	}).Apply(); s != NoError {
+		t.Errorf("Expected createAndGo before the values to succeed, got %s at %d", s, i)
+	} else if err := table.Set(O(1, 5, 2), status(RowDestroy)); err != nil {
+		t.Error(err)
+	}
+
+	expected := []struct {
+		event    RowEvent
+		instance uint32
+	}{
+		{RowActivated, 1}, {RowUpdated, 1}, {RowDeactivated, 1}, {RowActivated, 2}, {RowDestroyed, 2},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %+v", len(expected), changes)
+	}
+	for i, change := range changes {
+		if change.Event != expected[i].event || !change.Instance.Equals(O(expected[i].instance)) || change.Index[0] != expected[i].instance {
+			t.Errorf("%d: expected %s of row %d, got %+v", i, expected[i].event, expected[i].instance, change)
+		}
+	}
+	if v := changes[1].Values[3].Value(); v != 7 {
+		t.Errorf("Updates should have the new values, got %v", v)
+	}
+	if v := changes[0].Values[3].Value(); v != 5 {
+		t.Errorf("Rows should have default values, got %v", v)
+	}
+
+	// The application can refuse changes
+	refuse = true
+	if s, i := NewSetTransaction(table, []VarBind{
+		{O(1, 2, 4), AsnOctetString, "backup"},
+		{O(1, 5, 4), AsnInteger, int(RowCreateAndGo)},
+	}).Apply(); s != CommitFailed || i != 2 {
+		t.Errorf("Expected commitFailed at 2, got %s at %d", s, i)
+	} else if _, ok := table.Status(O(4)); ok {
+		t.Errorf("A refused row should not be created")
+	}
+}
+
+// Test creating rows through an agent, with the RowStatus before and after
+// the other columns
+func TestRowStatusTableAgent(t *testing.T) {
+	var (
+		O     = NewOID
+		table = newJobTable(nil)
+		root  = O(1, 3, 6, 1, 4, 1, 898889, 2)
+	)
+
+	if err := table.AddRow(O(1), map[uint32]*SMILeaf{2: NewSMILeaf(AsnOctetString, "existing"), 4: NewSMILeaf(AsnCounter32, uint32(3))}); err != nil {
+		t.Fatal(err)
+	} else if err := table.AddRow(O(2), nil); !errors.Is(err, InconsistentValue) {
+		t.Errorf("Expected an incomplete row to be refused, got %v", err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := NewSMISubtree(table)
+	agent := NewAgent(root, func() SMINode { return tree })
+	agent.WriteCommunity = "private"
+	go agent.Serve(conn)
+	t.Cleanup(func() { agent.Close() })
+
+	client := newTestClient(t, conn.LocalAddr().String(), "private", Version2c)
+	entry := root.Add(1, 1)
+
+	_, err = client.Set(
+		VarBind{entry.Add(5, 2), AsnInteger, int(RowCreateAndGo)},
+		VarBind{entry.Add(2, 2), AsnOctetString, "first"},
+	)
+	if err != nil {
+		t.Errorf("Expected createAndGo before the values to succeed: %s", err)
+	}
+
+	// Values of rows that are not created are refused
+	_, err = client.Set(VarBind{entry.Add(2, 5), AsnOctetString, "orphan"})
+	if !errors.Is(err, InconsistentName) {
+		t.Errorf("Expected inconsistentName, got %v", err)
+	}
+
+	for _, instance := range []uint32{3, 4} {
+		vbs := []VarBind{
+			{entry.Add(2, instance), AsnOctetString, "job"},
+			{entry.Add(3, instance), AsnInteger, 8},
+			{entry.Add(5, instance), AsnInteger, int(RowCreateAndGo)},
+		}
+		if instance == 4 {
+			vbs = []VarBind{vbs[2], vbs[0], vbs[1]}
+			vbs[0].Value = int(RowCreateAndWait)
+		}
+		if _, err := client.Set(vbs...); err != nil {
+			t.Fatalf("%d: %s", instance, err)
+		}
+	}
+
+	vbs, err := client.Get(entry.Add(5, 1), entry.Add(4, 1), entry.Add(5, 2), entry.Add(5, 3), entry.Add(3, 3), entry.Add(5, 4), entry.Add(2, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{int(RowActive), uint32(3), int(RowActive), int(RowActive), 8, int(RowNotInService), []byte("job")}
+	for i, vb := range vbs {
+		if b, ok := vb.Value.([]byte); ok && string(b) == string(expected[i].([]byte)) {
+			continue
+		} else if vb.Value != expected[i] {
+			t.Errorf("Expected %v, got %s", expected[i], vb)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package snmptools
+
+import (
+	"expvar"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// RuntimeRoot is where SNMPTOOLS-GO-RUNTIME-MIB (in the mibs directory) places
+// the tree built by RuntimeTree(). The tree can be served at any other root,
+// as long as the MIB's module identity is changed to match.
+var RuntimeRoot = NewOID(1, 3, 6, 1, 4, 1, 898889, 100)
+
+// startTime approximates the time the process started
+var startTime = time.Now()
+
+// runtimeObjects describes the layout of the tree built by RuntimeTree(),
+// relative to its root, for RuntimeMIB().
+var runtimeObjects = []struct {
+	oid  OID
+	info ObjectInfo
+}{
+	{NewOID(1), ObjectInfo{Name: "goProcess", Description: "The Go process and its scheduler."}},
+	{NewOID(1, 1), ObjectInfo{Name: "goGoroutines", Description: "The number of goroutines that currently exist."}},
+	{NewOID(1, 2), ObjectInfo{Name: "goNumCPU", Description: "The number of logical CPUs usable by the process."}},
+	{NewOID(1, 3), ObjectInfo{Name: "goMaxProcs", Description: "The maximum number of CPUs executing Go code simultaneously (GOMAXPROCS)."}},
+	{NewOID(1, 4), ObjectInfo{Name: "goUptime", Description: "The time since the process started."}},
+	{NewOID(1, 5), ObjectInfo{Name: "goCgoCalls", Description: "The number of cgo calls made by the process."}},
+
+	{NewOID(2), ObjectInfo{Name: "goMemory", Description: "Memory allocator statistics."}},
+	{NewOID(2, 1), ObjectInfo{Name: "goMemHeapAlloc", Description: "Kilobytes of allocated heap objects."}},
+	{NewOID(2, 2), ObjectInfo{Name: "goMemHeapInuse", Description: "Kilobytes in in-use heap spans."}},
+	{NewOID(2, 3), ObjectInfo{Name: "goMemHeapObjects", Description: "The number of allocated heap objects."}},
+	{NewOID(2, 4), ObjectInfo{Name: "goMemSys", Description: "Kilobytes of memory obtained from the operating system."}},
+	{NewOID(2, 5), ObjectInfo{Name: "goMemTotalAlloc", Description: "Cumulative kilobytes allocated for heap objects."}},
+	{NewOID(2, 6), ObjectInfo{Name: "goMemMallocs", Description: "Cumulative count of heap objects allocated."}},
+	{NewOID(2, 7), ObjectInfo{Name: "goMemFrees", Description: "Cumulative count of heap objects freed."}},
+
+	{NewOID(3), ObjectInfo{Name: "goGC", Description: "Garbage collector statistics."}},
+	{NewOID(3, 1), ObjectInfo{Name: "goGCCount", Description: "The number of completed GC cycles."}},
+	{NewOID(3, 2), ObjectInfo{Name: "goGCPauseTotal", Description: "Cumulative microseconds spent in GC stop-the-world pauses."}},
+	{NewOID(3, 3), ObjectInfo{Name: "goGCLastPause", Description: "Microseconds spent in the most recent GC stop-the-world pause."}},
+	{NewOID(3, 4), ObjectInfo{Name: "goGCSinceLast", Description: "The time since the last GC cycle completed, or zero if there has been none."}},
+	{NewOID(3, 5), ObjectInfo{Name: "goGCCPUFraction", Description: "The fraction of CPU time used by the GC since the process started, in parts per million."}},
+
+	{NewOID(4), ObjectInfo{Name: "goBuild", Description: "Build information embedded in the binary."}},
+	{NewOID(4, 1), ObjectInfo{Name: "goBuildGoVersion", Description: "The Go version that built the binary."}},
+	{NewOID(4, 2), ObjectInfo{Name: "goBuildPath", Description: "The path of the main package."}},
+	{NewOID(4, 3), ObjectInfo{Name: "goBuildModule", Description: "The main module path."}},
+	{NewOID(4, 4), ObjectInfo{Name: "goBuildVersion", Description: "The main module version."}},
+	{NewOID(4, 5), ObjectInfo{Name: "goBuildRevision", Description: "The version control revision the binary was built from, if known."}},
+	{NewOID(4, 6), ObjectInfo{Name: "goBuildTime", Description: "The time of the version control revision, if known."}},
+
+	{NewOID(5), ObjectInfo{Name: "goExpvarTable", Description: "The variables published with the expvar package."}},
+	{NewOID(5, 1), ObjectInfo{Name: "goExpvarEntry", Description: "An expvar variable.", Indexes: []string{"goExpvarName"}, IndexKinds: []Index{{Kind: StringIndex}}}},
+	{NewOID(5, 1, 1), ObjectInfo{Name: "goExpvarName", Description: "The name of the variable.", Type: AsnOctetString, Syntax: TextualConventions["DisplayString"]}},
+	{NewOID(5, 1, 2), ObjectInfo{Name: "goExpvarValue", Description: "The value of the variable, as JSON.", Type: AsnOctetString}},
+	{NewOID(5, 1, 3), ObjectInfo{Name: "goExpvarInteger", Description: "The value of an integer variable that is not negative, or 4294967295 if it is larger.", Type: AsnGauge32}},
+}
+
+// RuntimeMIB() returns the metadata of the objects in the tree built by
+// RuntimeTree(), when it is served at root.
+func RuntimeMIB(root OID) *MIB {
+	mib := NewMIB()
+	for _, object := range runtimeObjects {
+		mib.Define(root.Add(object.oid...), object.info)
+	}
+	return mib
+}
+
+// RuntimeTree() builds an SMI tree describing the Go runtime of the current
+// process: its goroutines, memory and GC statistics, uptime, build information
+// and every expvar variable. It can be used directly as the callback of any
+// transport, for example:
+//
+//	NewPassPersistExtension(os.Stdin, os.Stdout, RuntimeTree, RuntimeRoot)
+//
+// The layout is fixed, and described by SNMPTOOLS-GO-RUNTIME-MIB. Since pass
+// persist cannot carry Counter64s, cumulative counts are Counter32s that wrap
+// around, as SNMP managers expect counters to.
+func RuntimeTree() SMINode {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	var sinceGC uint32
+	if ms.LastGC != 0 {
+		sinceGC = timeTicks(time.Since(time.Unix(0, int64(ms.LastGC))))
+	}
+
+	return NewSMISubtree(
+		NewSMISubtree(
+			NewLeafNode(NewSMILeaf(AsnGauge32, uint32(runtime.NumGoroutine()))),
+			NewLeafNode(NewSMILeaf(AsnInteger, runtime.NumCPU())),
+			NewLeafNode(NewSMILeaf(AsnInteger, runtime.GOMAXPROCS(0))),
+			NewLeafNode(NewSMILeaf(AsnTimeTicks, timeTicks(time.Since(startTime)))),
+			NewLeafNode(NewSMILeaf(AsnCounter32, uint32(runtime.NumCgoCall()))),
+		),
+		NewSMISubtree(
+			NewLeafNode(NewSMILeaf(AsnGauge32, kilobytes(ms.HeapAlloc))),
+			NewLeafNode(NewSMILeaf(AsnGauge32, kilobytes(ms.HeapInuse))),
+			NewLeafNode(NewSMILeaf(AsnGauge32, clampUint32(ms.HeapObjects))),
+			NewLeafNode(NewSMILeaf(AsnGauge32, kilobytes(ms.Sys))),
+			NewLeafNode(NewSMILeaf(AsnCounter32, uint32(ms.TotalAlloc/1024))),
+			NewLeafNode(NewSMILeaf(AsnCounter32, uint32(ms.Mallocs))),
+			NewLeafNode(NewSMILeaf(AsnCounter32, uint32(ms.Frees))),
+		),
+		NewSMISubtree(
+			NewLeafNode(NewSMILeaf(AsnCounter32, ms.NumGC)),
+			NewLeafNode(NewSMILeaf(AsnCounter32, uint32(ms.PauseTotalNs/1000))),
+			NewLeafNode(NewSMILeaf(AsnGauge32, clampUint32(ms.PauseNs[(ms.NumGC+255)%256]/1000))),
+			NewLeafNode(NewSMILeaf(AsnTimeTicks, sinceGC)),
+			NewLeafNode(NewSMILeaf(AsnGauge32, uint32(ms.GCCPUFraction*1e6))),
+		),
+		buildInfoTree(),
+		expvarTree(),
+	)
+}
+
+// buildInfoTree describes the binary's build information.
+func buildInfoTree() SMINode {
+	var (
+		goVersion                      = runtime.Version()
+		path, module, version, rev, at string
+	)
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		goVersion, path = info.GoVersion, info.Path
+		module, version = info.Main.Path, info.Main.Version
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				rev = setting.Value
+			case "vcs.time":
+				at = setting.Value
+			}
+		}
+	}
+
+	tree := NewSMISubtree()
+	for _, s := range []string{goVersion, path, module, version, rev, at} {
+		tree.AddChild(NewLeafNode(NewSMILeaf(AsnOctetString, s)))
+	}
+	return tree
+}
+
+// expvarTree builds goExpvarTable, indexed by the variables' names.
+func expvarTree() SMINode {
+	var columns = []*SMISparseSubtree{NewSMISparseSubtree(), NewSMISparseSubtree(), NewSMISparseSubtree()}
+
+	expvar.Do(func(kv expvar.KeyValue) {
+		// A string index always encodes
+		index, _ := Index{Kind: StringIndex}.encode(kv.Key)
+
+		columns[0].Insert(index, NewLeafNode(NewSMILeaf(AsnOctetString, kv.Key)))
+		columns[1].Insert(index, NewLeafNode(NewSMILeaf(AsnOctetString, kv.Value.String())))
+		if i, ok := kv.Value.(*expvar.Int); ok && i.Value() >= 0 {
+			columns[2].Insert(index, NewLeafNode(NewSMILeaf(AsnGauge32, clampUint32(uint64(i.Value())))))
+		}
+	})
+
+	// A column without instances would be an empty subtree
+	entry := NewSMISubtree(columns[0], columns[1])
+	if len(columns[2].Children()) > 0 {
+		entry.AddChild(columns[2])
+	}
+	return NewSMISubtree(entry)
+}
+
+// timeTicks converts a duration to TimeTicks, which wrap around after about
+// 497 days.
+func timeTicks(d time.Duration) uint32 {
+	return uint32(d / (10 * time.Millisecond))
+}
+
+func kilobytes(n uint64) uint32 {
+	return clampUint32(n / 1024)
+}
+
+// clampUint32 converts a value to a Gauge32, which sticks at its maximum.
+func clampUint32(n uint64) uint32 {
+	if n > 0xffffffff {
+		return 0xffffffff
+	}
+	return uint32(n)
+}
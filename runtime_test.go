@@ -0,0 +1,65 @@
+package snmptools
+
+import (
+	"expvar"
+	"testing"
+)
+
+var testExpvar = expvar.NewInt("snmptoolsTest")
+
+// Test the layout of the runtime tree
+func TestRuntimeTree(t *testing.T) {
+	var (
+		O    = NewOID
+		mib  = RuntimeMIB(RuntimeRoot)
+		tree SMINode
+	)
+
+	testExpvar.Set(42)
+	tree = RuntimeTree()
+
+	get := func(oid OID) *SMILeaf {
+		node := GetLeaf(tree, oid)
+		if node == nil || node.Value() == nil {
+			t.Fatalf("No leaf at %s", oid)
+		}
+		return node.Value()
+	}
+
+	if n := get(O(1, 1)).Value().(uint32); n == 0 {
+		t.Errorf("Expected some goroutines")
+	}
+	if n := get(O(2, 1)).Value().(uint32); n == 0 {
+		t.Errorf("Expected some heap to be allocated")
+	}
+	if s := get(O(4, 1)).Value().(string); s == "" {
+		t.Errorf("Expected a Go version")
+	}
+
+	row := func(column OID, name string) OID {
+		oid, _ := column.AddIndex([]Index{{Kind: StringIndex}}, name)
+		return oid
+	}
+	if v := get(row(O(5, 1, 2), "snmptoolsTest")).Value(); v != "42" {
+		t.Errorf("Bad expvar value: %v", v)
+	}
+	if v := get(row(O(5, 1, 3), "snmptoolsTest")).Value(); v != uint32(42) {
+		t.Errorf("Bad expvar integer: %v", v)
+	}
+	if node := GetLeaf(tree, row(O(5, 1, 3), "cmdline")); node != nil {
+		t.Errorf("Expected no integer for cmdline, got %v", node)
+	}
+
+	// The tree can be served by a pass persist extension
+	if problems := Validate(tree); problems != nil {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+
+	// Every leaf must be described by the MIB
+	Walk(tree, func(oid OID, leaf *SMILeaf) error {
+		if object, info := mib.Lookup(RuntimeRoot.Add(oid...)); info == nil || len(object) < len(RuntimeRoot)+2 {
+			t.Errorf("No MIB object for %s", oid)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,142 @@
+package snmptools
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Variation changes the values of the numeric leaves beneath an OID every
+// time a Simulator's tree is served, so that recorded data looks alive.
+type Variation struct {
+	// OID is relative to the root of the tree; the whole tree is varied if
+	// it is empty
+	OID OID
+
+	// Rate is how much Counter32, Counter64 and TimeTicks leaves increase per
+	// second, starting from their recorded values. They wrap around as real
+	// counters do.
+	Rate float64
+
+	// Min and Max bound the random values given to Gauge32, UInteger32 and
+	// INTEGER leaves. They are left alone unless Max is greater than Min.
+	Min, Max int64
+}
+
+// variedLeaf is a leaf changed by a Variation
+type variedLeaf struct {
+	oid       OID
+	recorded  *SMILeaf
+	variation Variation
+}
+
+// Simulator serves a recorded tree as a simulated device would, varying some
+// of its values and delaying requests.
+//
+// Tree() is intended to be used as the callback of an Agent,
+// PassPersistExtension or other transport. The values are changed in place,
+// so the tree should only be served by one transport at a time.
+type Simulator struct {
+	// Latency delays every request, to test how managers cope with slow
+	// devices
+	Latency time.Duration
+
+	mu      sync.Mutex
+	tree    *SMISparseSubtree
+	started time.Time
+	varied  []variedLeaf
+	// now returns the current time; tests replace it
+	now func() time.Time
+}
+
+// NewSimulator() creates a Simulator serving tree, such as one read by
+// ParseSnmprec() or ParseSnmpwalk().
+func NewSimulator(tree *SMISparseSubtree) *Simulator {
+	return &Simulator{
+		tree:    tree,
+		started: time.Now(),
+		now:     time.Now,
+	}
+}
+
+// Vary() adds a Variation to the leaves beneath v.OID that it applies to.
+// Leaves already varied by an earlier Variation are left with it.
+func (s *Simulator) Vary(v Variation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v.Rate < 0 {
+		return fmt.Errorf("counters cannot decrease at a rate of %v", v.Rate)
+	}
+
+	var node SMINode = s.tree
+	if len(v.OID) > 0 {
+		if node = GetLeaf(s.tree, v.OID); node == nil {
+			return fmt.Errorf("%w: nothing to vary at %s", NoSuchName, v.OID)
+		}
+	}
+
+	varied := make(map[string]bool)
+	for _, leaf := range s.varied {
+		varied[leaf.oid.String()] = true
+	}
+
+	return Walk(node, func(oid OID, leaf *SMILeaf) error {
+		oid = v.OID.Add(oid...)
+		if _, ok := v.apply(leaf, 0); ok && !varied[oid.String()] {
+			s.varied = append(s.varied, variedLeaf{oid, leaf, v})
+		}
+		return nil
+	})
+}
+
+// Tree() returns the tree with its Variations applied, after waiting for the
+// Simulator's Latency.
+func (s *Simulator) Tree() SMINode {
+	time.Sleep(s.Latency)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elapsed := s.now().Sub(s.started).Seconds()
+	for _, leaf := range s.varied {
+		if value, ok := leaf.variation.apply(leaf.recorded, elapsed); ok {
+			s.tree.Insert(leaf.oid, NewLeafNode(&SMILeaf{leaf.recorded.asnType, value}))
+		}
+	}
+
+	return s.tree
+}
+
+// apply returns the value of a varied leaf after some seconds.
+func (v Variation) apply(leaf *SMILeaf, elapsed float64) (interface{}, bool) {
+	switch leaf.asnType {
+	case AsnCounter32, AsnTimeTicks:
+		if u, ok := toUint64(leaf.value); ok && v.Rate > 0 {
+			return uint32(u + uint64(v.Rate*elapsed)), true
+		}
+
+	case AsnCounter64:
+		if u, ok := toUint64(leaf.value); ok && v.Rate > 0 {
+			return u + uint64(v.Rate*elapsed), true
+		}
+
+	case AsnGauge32, AsnUinteger32:
+		if v.Max > v.Min && v.Max >= 0 {
+			min := v.Min
+			if min < 0 {
+				min = 0
+			}
+			return clampUint32(uint64(min + rand.Int63n(v.Max-min+1))), true
+		}
+
+	case AsnInteger:
+		if v.Max > v.Min && v.Min >= math.MinInt32 && v.Max <= math.MaxInt32 {
+			return int(v.Min + rand.Int63n(v.Max-v.Min+1)), true
+		}
+	}
+
+	return nil, false
+}
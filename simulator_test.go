@@ -0,0 +1,90 @@
+package snmptools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulatorVariations(t *testing.T) {
+	var O = NewOID
+
+	data := `1.3.6.1.2.1.1.3.0|67|100
+1.3.6.1.2.1.2.2.1.5.1|66|1000
+1.3.6.1.2.1.2.2.1.10.1|65|4294967295
+1.3.6.1.2.1.2.2.1.10.2|65|10
+1.3.6.1.2.1.25.3.3.1.2.768|2|50
+1.3.6.1.2.1.31.1.1.1.6.1|70|10
+`
+
+	tree, err := ParseSnmprec(strings.NewReader(data), testRecordingRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The simulator's clock only moves when the test says so
+	var (
+		sim   = NewSimulator(tree)
+		clock = sim.started
+	)
+	sim.now = func() time.Time { return clock }
+
+	variations := []Variation{
+		{OID: O(2, 2, 1, 10), Rate: 1e6},
+		{OID: O(25), Min: -10, Max: -5},
+		// Counters are already varied by the first variation, and there are
+		// no gauges or integers beneath .31
+		{OID: O(2), Rate: 1, Min: 1, Max: 2},
+		{OID: O(31), Rate: 1e6, Min: 1, Max: 2},
+	}
+	for _, v := range variations {
+		if err := sim.Vary(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sim.Vary(Variation{OID: O(99), Rate: 1}); err == nil {
+		t.Errorf("Expected an error varying a missing OID")
+	} else if err := sim.Vary(Variation{Rate: -1}); err == nil {
+		t.Errorf("Expected an error for a negative rate")
+	}
+
+	clock = clock.Add(20 * time.Millisecond)
+	served := sim.Tree()
+
+	value := func(oid OID) interface{} {
+		return GetLeaf(served, oid).Value().Value()
+	}
+
+	if v := value(O(1, 3, 0)); v != uint32(100) {
+		t.Errorf("TimeTicks changed without a variation: %v", v)
+	}
+	if v := value(O(2, 2, 1, 5, 1)).(uint32); v != 1 && v != 2 {
+		t.Errorf("Gauge out of range: %d", v)
+	}
+	// The first counter wraps around
+	if v := value(O(2, 2, 1, 10, 1)).(uint32); v != 19999 {
+		t.Errorf("Counter did not wrap: %d", v)
+	}
+	if v := value(O(2, 2, 1, 10, 2)).(uint32); v != 20010 {
+		t.Errorf("Counter did not increase: %d", v)
+	}
+	if v := value(O(25, 3, 3, 1, 2, 768)).(int); v < -10 || v > -5 {
+		t.Errorf("Integer out of range: %d", v)
+	}
+	if v := value(O(31, 1, 1, 1, 6, 1)).(uint64); v != 20010 {
+		t.Errorf("Counter64 did not increase: %d", v)
+	}
+
+	// Counters keep counting from their recorded values
+	clock = clock.Add(20 * time.Millisecond)
+	served = sim.Tree()
+	if v := value(O(2, 2, 1, 10, 2)).(uint32); v != 40010 {
+		t.Errorf("Counter went from 20010 to %d", v)
+	}
+
+	sim.Latency = 50 * time.Millisecond
+	if start := time.Now(); sim.Tree() != nil && time.Since(start) < sim.Latency {
+		t.Errorf("Tree() returned before its latency")
+	}
+}
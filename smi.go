@@ -1,6 +1,9 @@
 package snmptools
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 // SMINode is a node in the SMI tree.
 //
@@ -21,126 +24,173 @@ import "fmt"
 //
 // For subtrees, the order of the children is significant: the indices of the array correspond to the sequential child OIDs.
 // For example, if the SMINode is a subtree located at .1.3.6.1.4.1.89999, its first child corresponds to 1.3.6.1.4.1.89999.1
+//
+// Subtrees that also implement SMISparseNode, such as SMISparseSubtree, give the arc of each child with Arcs() instead, so
+// that tables can hold rows at arbitrary indexes. Every part of the package that walks trees understands both kinds.
 type SMINode interface {
 	Value() *SMILeaf
 	Children() []SMINode
 }
 
+// SMIWritable is implemented by nodes that accept SET requests: either a leaf
+// whose own value can be changed, or a subtree that handles writes to the OIDs
+// beneath it (for example a table that can create rows).
+type SMIWritable interface {
+	SMINode
+
+	// Set() changes the value at oid, which is relative to this node: it is
+	// empty when a leaf is asked to change its own value.
+	//
+	// Returning an ErrorStatus, such as WrongType or WrongValue, reports that
+	// specific error to the SNMP manager.
+	Set(oid OID, leaf *SMILeaf) error
+}
+
+// SMISparseNode is implemented by subtrees whose children are not numbered
+// sequentially from 1, such as conceptual tables indexed by arbitrary values.
+//
+// Arcs() returns the arc of each child returned by Children(), in the same
+// order. The arcs must be strictly increasing.
+type SMISparseNode interface {
+	SMINode
+	Arcs() []uint32
+}
+
+// childIndex returns the index in children of the child at arc, or, if
+// there is no such child, the index of the first child after it.
+func childIndex(node SMINode, children []SMINode, arc uint32) (int, bool) {
+	if sparse, ok := node.(SMISparseNode); ok {
+		arcs := sparse.Arcs()
+		i := sort.Search(len(arcs), func(i int) bool { return arcs[i] >= arc })
+		return i, i < len(arcs) && arcs[i] == arc
+	}
+
+	if arc == 0 {
+		return 0, false
+	} else if int(arc-1) >= len(children) {
+		return len(children), false
+	}
+	return int(arc - 1), true
+}
+
+// childArcs returns the arcs of a subtree's children, or nil if they are
+// numbered sequentially.
+func childArcs(node SMINode) []uint32 {
+	if sparse, ok := node.(SMISparseNode); ok {
+		return sparse.Arcs()
+	}
+	return nil
+}
+
+// tableEntry returns the entry of a subtree that has the shape of a
+// conceptual table - a single child at .1, whose children (the columns) are all
+// subtrees - or nil if the subtree does not have that shape.
+func tableEntry(node SMINode) SMINode {
+	var entry SMINode
+
+	for i, child := range node.Children() {
+		if child == nil {
+			continue
+		} else if entry != nil {
+			return nil
+		}
+		entry = child
+
+		if arcs := childArcs(node); (arcs == nil && i != 0) || (arcs != nil && arcs[i] != 1) {
+			return nil
+		}
+	}
+
+	if entry == nil || entry.Children() == nil {
+		return nil
+	}
+
+	var columns int
+	for _, column := range entry.Children() {
+		if column == nil {
+			continue
+		} else if column.Children() == nil {
+			return nil
+		}
+		columns += 1
+	}
+
+	if columns == 0 {
+		return nil
+	}
+	return entry
+}
+
 // GetLeaf gets a leaf from an SMINode by OID.
 //
 // The OID is expected to be relative to the node: for example OID(1, 3) will return the third child of the first child of this node.
 //
 // If the target OID does not match the structure of the node, the return value will be nil.
+// Note that the returned node may be a subtree if the OID points at one.
 func GetLeaf(node SMINode, oid OID) SMINode {
 	//logger.Debug(fmt.Sprintf("GetLeaf was called with %s", oid))
 	var leaves []SMINode
 
-	if len(oid) == 0 {
+	if len(oid) == 0 || node == nil {
 		// Can't get something at an empty OID
 		return nil
 
 	} else if leaves = node.Children(); leaves == nil {
 		// There are no leaves here - either GetLeaf has been called on a leaf
-		// or for some reason there is a branch with no leaves
-		//
-		// Try to return the Value from here, in case there's a leaf.
-		return NewLeafNode(node.Value())
+		// or on a malformed node. Either way, nothing lives beneath it.
+		return nil
 
-	} else if int(oid[0])-1 >= len(leaves) {
+	}
+
+	i, ok := childIndex(node, leaves, oid[0])
+	if !ok {
 		// No OID found - there is not a leaf at this index
 		return nil
 
 	} else if len(oid) == 1 {
 		// We're at the bottom level - return a single leaf
-		return leaves[oid[0]-1]
+		return leaves[i]
 
 	} else {
 		// We're not at the bottom - keep looking for our target recursively
-		return GetLeaf(leaves[oid[0]-1], oid[1:])
+		return GetLeaf(leaves[i], oid[1:])
 
 	}
 }
 
 // NextLeaf takes a node in an SMI tree and an OID relative to that node, and
-// returns the OID of the _next_ leaf.
+// returns the OID of the _next_ leaf: the first leaf whose OID is
+// lexicographically greater than the one given.
 //
 // For example, if called with .1.3.6, where that OID points at a subtreee, it may return .1.3.6.1, a leaf.
 // If called with .1.3.6.1, .1.3.6.2 may be returned.
 //
-// This is useful for implementing GETNEXT with snmp.
+// Empty subtrees are skipped over, as are malformed nodes that return nil
+// for both Children() and Value(). If there is no next leaf, nil is returned.
+//
+// This is useful for implementing GETNEXT with snmp. To retrieve many leaves in
+// sequence, an Iterator is cheaper than repeated calls to NextLeaf.
 func NextLeaf(node SMINode, oid OID) OID {
-	//logger.Debug(fmt.Sprintf("Looking for next leaf from %s", oid))
-
-	if len(oid) == 0 {
-		// Empty OID - start with .1
-		oid = NewOID(1)
-	}
+	it := NewIterator(node)
+	it.Seek(oid)
 
-	if oid[len(oid)-1] == 0 {
-		// This OID ends in a zero, which is really the address of the subtree;
-		// replace the last number with a 1
-		oid = oid.Copy()
-		oid[len(oid)-1] = 1
-	}
-
-	// Now try the various ways getting at the OID
-	if thisBranch := GetLeaf(node, oid); thisBranch == nil {
-		// There's nothing at this OID - return nil
-		return nil
-
-	} else if children := thisBranch.Children(); children != nil && len(children) == 0 {
-		// This is a subtree, but it doesn't have any children - return nil
-		return nil
-
-	} else if children != nil && children[0].Value() != nil {
-		// This is a subtree where the first child is a leaf - that'll do
-		return oid.Add(1)
-
-	} else if children != nil {
-		// Ths first child of this subtree is itself a subtree - make a recursive call
-		return oid.Add(NextLeaf(thisBranch, NewOID(1))...)
-
-	} else if val := thisBranch.Value(); val == nil {
-		// Bad situation - this is somehow a node that has no children but also no leaf
-		// TODO - log this?
-		panic(fmt.Errorf("MibNode is nil for both Children() and Value(): %#v", thisBranch))
-
-	} else {
-		// This OID actually points directly at a leaf - this means we need to
-		// shift horizontally or even vertically to find the next OID in the
-		// tree
-
-		// First, copy the OID and iterate the final number, then test
-		// whether an object exists there.
-		newOID := oid.Copy()
-		newOID[len(newOID)-1] += 1
-
-		if newNode := GetLeaf(node, newOID); newNode != nil {
-			// Found a horizontally adjacent leaf - return its OID
-			return newOID
-		}
-
-		// There's nothing horizontally adjacent - we must move horizontally
-		// until a leaf is found or the OID is exhausted
-		for len(newOID) > 0 {
-
-			// Remove the final number and increment the end
-			newOID = newOID[:len(newOID)-1]
-			newOID[len(newOID)-1] += 1
-
-			if n := GetLeaf(node, newOID.Add(1)); n != nil {
-				// There's something here
-				if n.Value() != nil {
-					return newOID.Add(1)
-				} else if o := NextLeaf(node, newOID.Add(1)); n != nil {
-					return o
-				}
-			}
-		}
+	next, _ := it.Next()
+	return next
+}
 
-		// Nothing was found and the OID was exhausted - return nil
-		return nil
+// SetLeaf sets the value at an OID in an SMI tree, relative to node.
+//
+// The write is handled by the first SMIWritable node found on the way down to
+// the target OID. If there is none, NotWritable is returned when the target
+// exists and NoCreation when it does not.
+//
+// Only one value is set; SetTransaction sets several at once.
+func SetLeaf(node SMINode, oid OID, leaf *SMILeaf) error {
+	w, rest, err := writableNode(node, oid)
+	if err != nil {
+		return err
 	}
+	return w.Set(rest, leaf)
 }
 
 // SMILeaf is a leaf in the mib tree. It has an ASN.1 type and a value.
@@ -164,6 +214,16 @@ func NewSMILeaf(asnType AsnType, value interface{}) *SMILeaf {
 	return &SMILeaf{asnType, value}
 }
 
+// Type() returns the ASN.1 type of the leaf.
+func (l *SMILeaf) Type() AsnType {
+	return l.asnType
+}
+
+// Value() returns the value held by the leaf.
+func (l *SMILeaf) Value() interface{} {
+	return l.value
+}
+
 func (l *SMILeaf) String() string {
 	return fmt.Sprintf("MibLeaf{%s, %v}", l.asnType.PrettyString(), l.value)
 }
@@ -198,7 +258,7 @@ func (node *SMISubtree) String() string {
 			}
 
 			if child.Children() != nil {
-				b = append(b, []byte(child.(*SMISubtree).String())...)
+				b = append(b, []byte(fmt.Sprint(child))...)
 			} else if child.Value() != nil {
 				b = append(b, []byte(child.Value().String())...)
 			}
@@ -223,6 +283,105 @@ func (node *SMISubtree) AddChild(leaf SMINode) {
 	node.leaves = append(node.leaves, leaf)
 }
 
+// SMISparseSubtree is a branch in the mib tree whose children may be at any
+// arcs, rather than numbered sequentially from 1. It is useful for tables,
+// whose rows are indexed by arbitrary values.
+//
+// Implements the SMINode and SMISparseNode interfaces.
+type SMISparseSubtree struct {
+	arcs   []uint32
+	leaves []SMINode
+}
+
+// NewSMISparseSubtree() creates a new, empty SMISparseSubtree.
+func NewSMISparseSubtree() *SMISparseSubtree {
+	return &SMISparseSubtree{leaves: make([]SMINode, 0)}
+}
+
+func (node *SMISparseSubtree) String() string {
+	var b = []byte("SMISparseSubtree{")
+
+	for i, child := range node.leaves {
+		if i > 0 {
+			b = append(b, []byte(", ")...)
+		}
+		b = append(b, []byte(fmt.Sprintf("%d: ", node.arcs[i]))...)
+
+		if child.Children() != nil {
+			b = append(b, []byte(fmt.Sprint(child))...)
+		} else if child.Value() != nil {
+			b = append(b, []byte(child.Value().String())...)
+		}
+	}
+
+	return string(append(b, '}'))
+}
+
+func (node *SMISparseSubtree) Children() []SMINode {
+	return node.leaves
+}
+
+func (node *SMISparseSubtree) Value() *SMILeaf {
+	return nil
+}
+
+func (node *SMISparseSubtree) Arcs() []uint32 {
+	return node.arcs
+}
+
+// Child() returns the child at arc, or nil if there is none.
+func (node *SMISparseSubtree) Child(arc uint32) SMINode {
+	if i, ok := childIndex(node, node.leaves, arc); ok {
+		return node.leaves[i]
+	}
+	return nil
+}
+
+// SetChild() sets the child at arc, replacing any existing child there.
+// Setting a nil child removes it.
+func (node *SMISparseSubtree) SetChild(arc uint32, child SMINode) {
+	i, ok := childIndex(node, node.leaves, arc)
+
+	switch {
+	case ok && child == nil:
+		node.arcs = append(node.arcs[:i], node.arcs[i+1:]...)
+		node.leaves = append(node.leaves[:i], node.leaves[i+1:]...)
+	case ok:
+		node.leaves[i] = child
+	case child != nil:
+		node.arcs = append(node.arcs[:i], append([]uint32{arc}, node.arcs[i:]...)...)
+		node.leaves = append(node.leaves[:i], append([]SMINode{child}, node.leaves[i:]...)...)
+	}
+}
+
+// Insert() adds a node at an OID relative to this subtree, creating
+// SMISparseSubtrees for any missing levels in between.
+//
+// OIDConflict is returned if the path to the OID passes through a leaf or a
+// subtree that is not an SMISparseSubtree.
+func (node *SMISparseSubtree) Insert(oid OID, child SMINode) error {
+	if len(oid) == 0 {
+		return BadOID
+	}
+
+	for _, arc := range oid[:len(oid)-1] {
+		next := node.Child(arc)
+		if next == nil {
+			next = NewSMISparseSubtree()
+			node.SetChild(arc, next)
+		}
+
+		sparse, ok := next.(*SMISparseSubtree)
+		if !ok {
+			return fmt.Errorf("%w: %s", OIDConflict, oid)
+		}
+		node = sparse
+	}
+
+	node.SetChild(oid[len(oid)-1], child)
+	return nil
+}
+
 // LeafNode is a leaf in the mib tree, containing a scalar value.
 //
 // Implements the SMINode interface.
@@ -0,0 +1,54 @@
+package snmptools
+
+import (
+	"errors"
+	"testing"
+)
+
+// Test building a sparse subtree, and reading it back in order
+func TestSMISparseSubtree(t *testing.T) {
+	var (
+		O    = NewOID
+		tree = NewSMISparseSubtree()
+	)
+
+	for _, arc := range []uint32{7, 2, 1000} {
+		if err := tree.Insert(O(1, arc), NewLeafNode(NewSMILeaf(AsnInteger, int(arc)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree.SetChild(3, NewLeafNode(NewSMILeaf(AsnInteger, 3)))
+
+	if err := tree.Insert(O(3, 1), NewLeafNode(NewSMILeaf(AsnInteger, 0))); !errors.Is(err, OIDConflict) {
+		t.Errorf("Expected OIDConflict inserting beneath a leaf, got %v", err)
+	}
+	if err := tree.Insert(nil, NewLeafNode(NewSMILeaf(AsnInteger, 0))); !errors.Is(err, BadOID) {
+		t.Errorf("Expected BadOID inserting at an empty OID, got %v", err)
+	}
+
+	// Setting a nil child removes it
+	tree.SetChild(3, nil)
+	if tree.Child(3) != nil {
+		t.Errorf("Child 3 was not removed")
+	}
+
+	checkLeaves(t, tree, []VarBind{
+		{O(1, 2), AsnInteger, 2},
+		{O(1, 7), AsnInteger, 7},
+		{O(1, 1000), AsnInteger, 1000},
+	})
+	for _, oid := range []OID{O(1, 0), O(1, 3), O(1, 1001), O(2)} {
+		if GetLeaf(tree, oid) != nil {
+			t.Errorf("Unexpected leaf at %s", oid)
+		}
+	}
+
+	var oids []OID
+	Walk(tree, func(oid OID, leaf *SMILeaf) error {
+		oids = append(oids, oid)
+		return nil
+	})
+	if len(oids) != 3 || !oids[0].Equals(O(1, 2)) || !oids[1].Equals(O(1, 7)) || !oids[2].Equals(O(1, 1000)) {
+		t.Errorf("Bad walk order: %v", oids)
+	}
+}
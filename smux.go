@@ -0,0 +1,388 @@
+package snmptools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+var (
+	// SMUX errors
+	SmuxClosed          = fmt.Errorf("SMUX association closed by the master agent")
+	RegistrationRefused = fmt.Errorf("SMUX registration refused by the master agent")
+)
+
+// SMUX PDU tags, from RFC 1227
+const (
+	smuxOpen  byte = 0x60
+	smuxClose byte = 0x41
+	smuxRReq  byte = 0x62
+	smuxRRsp  byte = 0x43
+	smuxSOut  byte = 0x44
+)
+
+// Reasons given in SMUX ClosePDUs
+const (
+	smuxGoingDown = iota
+	smuxUnsupportedVersion
+	smuxPacketFormat
+	smuxProtocolError
+	smuxInternalError
+	smuxAuthenticationFailure
+)
+
+var smuxCloseReasons = []string{
+	"goingDown",
+	"unsupportedVersion",
+	"packetFormat",
+	"protocolError",
+	"internalError",
+	"authenticationFailure",
+}
+
+func smuxCloseReason(reason int64) string {
+	if reason >= 0 && reason < int64(len(smuxCloseReasons)) {
+		return smuxCloseReasons[reason]
+	}
+	return fmt.Sprintf("reason %d", reason)
+}
+
+// SmuxPeer serves an SMI tree to a master agent using the SNMP multiplexing
+// protocol (SMUX), as specified in RFC 1227.
+//
+// It opens a TCP association with the master agent, registers the root OID
+// and answers the Get, GetNext and Set requests the master agent forwards for
+// it. This is useful for agents that support neither AgentX nor pass_persist
+// extensions.
+type SmuxPeer struct {
+	// Identity identifies the peer to the master agent; it is usually the
+	// peer's sysObjectID
+	Identity OID
+	// Description is a human-readable description of the peer
+	Description string
+	// Password authenticates the peer to the master agent
+	Password string
+
+	// Priority is the registration priority. Lower values take precedence
+	// and -1, the default, lets the master agent pick one.
+	Priority int
+	// Writable registers the subtree read-write, so that the master agent
+	// forwards SET requests for it
+	Writable bool
+
+	root     OID
+	callback func() SMINode
+
+	mu      sync.Mutex
+	conn    net.Conn
+	closing bool
+	// pending is the tested SET awaiting a commit or rollback from the
+	// master agent; it is only used by Serve()
+	pending *smuxSet
+}
+
+// smuxSet is a SET that has been tested against a tree, and is committed to
+// that same tree
+type smuxSet struct {
+	tx       *SetTransaction
+	varBinds []VarBind
+}
+
+// NewSmuxPeer() creates an SmuxPeer that authenticates with the given identity
+// and password, and serves the tree returned by callback at the given root OID.
+//
+// The callback is called once for every request, giving client code the
+// opportunity to update the SMINode that is being traversed.
+func NewSmuxPeer(identity OID, password string, root OID, callback func() SMINode) *SmuxPeer {
+	return &SmuxPeer{
+		Identity: identity,
+		Password: password,
+		Priority: -1,
+		root:     root,
+		callback: callback,
+	}
+}
+
+// DialAndServe() connects to the master agent at addr (port 199 by default)
+// and serves requests until Close() is called or the association ends.
+func (p *SmuxPeer) DialAndServe(addr string) error {
+	conn, err := net.Dial("tcp", smuxAddress(addr))
+	if err != nil {
+		return err
+	}
+	return p.Serve(conn)
+}
+
+// Serve() opens an association over conn, registers the root OID and answers
+// requests from the master agent.
+//
+// It returns nil once Close() is called, and at once if Close() was called
+// first. If the master agent closes the association, the returned error wraps
+// SmuxClosed; if it refuses the registration, the error is
+// RegistrationRefused.
+func (p *SmuxPeer) Serve(conn net.Conn) error {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	p.conn = conn
+	p.mu.Unlock()
+
+	defer conn.Close()
+	// A SET left pending by the master agent is never committed
+	defer p.finish(false)
+
+	if err := p.open(); err != nil {
+		return p.serveError(err)
+	}
+
+	var r = bufio.NewReader(conn)
+	for {
+		b, err := berReadFrom(r)
+		if err == nil {
+			err = p.handlePDU(b)
+		}
+
+		if errors.Is(err, MalformedBER) {
+			p.close(smuxPacketFormat)
+		}
+		if err != nil {
+			return p.serveError(err)
+		}
+	}
+}
+
+// Close() ends the association with the master agent.
+func (p *SmuxPeer) Close() error {
+	p.mu.Lock()
+	p.closing = true
+	p.mu.Unlock()
+
+	p.close(smuxGoingDown)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	return p.conn.Close()
+}
+
+// serveError returns the error that ends Serve(), which is nil if the peer
+// is being closed.
+func (p *SmuxPeer) serveError(err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closing {
+		return nil
+	}
+	return err
+}
+
+// open sends the OpenPDU and the registration request.
+func (p *SmuxPeer) open() error {
+	identity, err := berOID(p.Identity)
+	if err != nil {
+		return err
+	}
+	subtree, err := berOID(p.root)
+	if err != nil {
+		return err
+	}
+
+	// The operation is readOnly(1) or readWrite(2)
+	var operation int64 = 1
+	if p.Writable {
+		operation = 2
+	}
+
+	return p.write(
+		berTLV(smuxOpen,
+			berTLV(byte(AsnInteger), berInt(0)),
+			berTLV(byte(AsnObjectIdentifier), identity),
+			berTLV(byte(AsnOctetString), []byte(p.Description)),
+			berTLV(byte(AsnOctetString), []byte(p.Password)),
+		),
+		berTLV(smuxRReq,
+			berTLV(byte(AsnObjectIdentifier), subtree),
+			berTLV(byte(AsnInteger), berInt(int64(p.Priority))),
+			berTLV(byte(AsnInteger), berInt(operation)),
+		),
+	)
+}
+
+// close sends a ClosePDU, ignoring any error.
+func (p *SmuxPeer) close(reason int64) {
+	if err := p.write(berTLV(smuxClose, berInt(reason))); err != nil {
+		logger.Debug(fmt.Sprintf("Could not close SMUX association: %s", err))
+	}
+}
+
+// write sends one or more PDUs to the master agent.
+func (p *SmuxPeer) write(pdus ...[]byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return net.ErrClosed
+	}
+
+	for _, b := range pdus {
+		if _, err := p.conn.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handlePDU handles one PDU from the master agent. An error ends the
+// association.
+func (p *SmuxPeer) handlePDU(b []byte) error {
+	tag, content, _, err := berRead(b)
+	if err != nil {
+		return err
+	}
+
+	switch tag {
+	case smuxClose:
+		reason, err := berParseInt(content)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", SmuxClosed, smuxCloseReason(reason))
+
+	case smuxRRsp:
+		priority, err := berParseInt(content)
+		if err != nil {
+			return err
+		} else if priority < 0 {
+			p.close(smuxGoingDown)
+			return RegistrationRefused
+		}
+		logger.Debug(fmt.Sprintf("Registered %s with priority %d", p.root, priority))
+		return nil
+
+	case smuxSOut:
+		// commit(0) or rollback(1) the last SET
+		commit, err := berParseInt(content)
+		if err != nil {
+			return err
+		}
+		p.finish(commit == 0)
+		return nil
+	}
+
+	req, _, err := unmarshalPDU(b)
+	if err != nil {
+		return err
+	}
+
+	var resp *PDU
+	switch req.Type {
+	case AsnGetRequest, AsnGetNextRequest:
+		ctx := p.context()
+		resp = ctx.process(req)
+
+	case AsnSetRequest:
+		resp = p.set(req)
+
+	default:
+		logger.Debug(fmt.Sprintf("Ignoring unexpected SMUX PDU: %s", req.Type.PrettyString()))
+		return nil
+	}
+
+	out, err := resp.marshal()
+	if err != nil {
+		logger.Debug(fmt.Sprintf("Could not encode SMUX response: %s", err))
+		out, err = (&PDU{
+			Type:        AsnGetResponse,
+			RequestID:   req.RequestID,
+			ErrorStatus: GenErr,
+			VarBinds:    req.VarBinds,
+		}).marshal()
+		if err != nil {
+			return err
+		}
+	}
+	return p.write(out)
+}
+
+// context returns a requestContext for answering a request from the master
+// agent. SMUX carries SNMPv1 PDUs, so SNMPv1 error handling is used.
+func (p *SmuxPeer) context() *requestContext {
+	ctx := &requestContext{
+		tree:     p.callback(),
+		root:     p.root,
+		version:  Version1,
+		readable: allOIDs,
+		writable: noOIDs,
+	}
+	if p.Writable {
+		ctx.writable = allOIDs
+	}
+	return ctx
+}
+
+// set answers a SetRequest, testing the varbinds as a SetTransaction. They
+// are only applied, to the tree they were tested against, once the master
+// agent commits them.
+func (p *SmuxPeer) set(req *PDU) *PDU {
+	var resp = &PDU{
+		Type:      AsnGetResponse,
+		RequestID: req.RequestID,
+		VarBinds:  req.VarBinds,
+	}
+
+	for i, vb := range req.VarBinds {
+		if _, err := vb.OID.GetRemainder(p.root); err != nil || !p.Writable {
+			resp.ErrorStatus, resp.ErrorIndex = NoSuchName, i+1
+			return resp
+		}
+	}
+
+	// Only one SET is pending at a time
+	p.finish(false)
+
+	tx, status, index := p.context().transaction(req.VarBinds)
+	if status == NoError {
+		status, index = tx.begin()
+	}
+	if status != NoError {
+		resp.ErrorStatus, resp.ErrorIndex = v1ErrorStatus(status), index
+		return resp
+	}
+
+	p.pending = &smuxSet{tx, req.VarBinds}
+	return resp
+}
+
+// finish commits or rolls back the pending SET, if there is one. There is
+// nobody to report a failure to commit to at this point, so it is only
+// logged.
+func (p *SmuxPeer) finish(commit bool) {
+	var set = p.pending
+	if set == nil {
+		return
+	}
+	p.pending = nil
+
+	status, index := set.tx.finish(commit)
+	if status != NoError && index > 0 {
+		logger.Warning(fmt.Sprintf("Failed to commit SMUX set of %s: %s", set.varBinds[index-1].OID, status))
+	} else if status != NoError {
+		logger.Warning(fmt.Sprintf("Failed to commit SMUX set: %s", status))
+	}
+}
+
+func smuxAddress(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, "199")
+	}
+	return addr
+}
@@ -0,0 +1,265 @@
+package snmptools
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSmuxMaster is the master agent's end of a SMUX association
+type fakeSmuxMaster struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// startSmuxPeer connects a peer serving the test tree to a fake master agent,
+// returning the master and a channel that receives the result of Serve().
+func startSmuxPeer(t *testing.T, peer *SmuxPeer) (*fakeSmuxMaster, chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	errc := make(chan error, 1)
+	go func() { errc <- peer.DialAndServe(ln.Addr().String()) }()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &fakeSmuxMaster{t, conn, bufio.NewReader(conn)}, errc
+}
+
+// read reads a PDU from the peer, checking its tag.
+func (m *fakeSmuxMaster) read(tag byte) []byte {
+	b, err := berReadFrom(m.r)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	content, _, err := berExpect(b, tag)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return content
+}
+
+func (m *fakeSmuxMaster) write(b []byte) {
+	if _, err := m.conn.Write(b); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// request forwards a request to the peer and returns its response.
+func (m *fakeSmuxMaster) request(t AsnType, vbs ...VarBind) *PDU {
+	b, err := (&PDU{Type: t, RequestID: nextRequestID(), VarBinds: vbs}).marshal()
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	m.write(b)
+
+	b, err = berReadFrom(m.r)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	resp, _, err := unmarshalPDU(b)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return resp
+}
+
+// Test a SMUX association from open to close
+func TestSmuxPeer(t *testing.T) {
+	var (
+		root     = testAgentRoot
+		identity = root.Add(99)
+		tree     = newTestTree()
+		peer     = NewSmuxPeer(identity, "secret", root, func() SMINode { return tree })
+	)
+
+	peer.Description = "test peer"
+	peer.Writable = true
+	master, errc := startSmuxPeer(t, peer)
+
+	// OpenPDU
+	content := master.read(smuxOpen)
+	version, content, err := berReadInt(content)
+	if err != nil || version != 0 {
+		t.Errorf("Bad SMUX version: %d, %v", version, err)
+	}
+	field, content, _ := berExpect(content, byte(AsnObjectIdentifier))
+	if oid, _ := berParseOID(field); !oid.Equals(identity) {
+		t.Errorf("Bad identity: %s", oid)
+	}
+	description, content, _ := berExpect(content, byte(AsnOctetString))
+	password, _, _ := berExpect(content, byte(AsnOctetString))
+	if string(description) != "test peer" || string(password) != "secret" {
+		t.Errorf("Bad description or password: %q, %q", description, password)
+	}
+
+	// RReqPDU
+	content = master.read(smuxRReq)
+	field, content, _ = berExpect(content, byte(AsnObjectIdentifier))
+	priority, content, _ := berReadInt(content)
+	operation, _, _ := berReadInt(content)
+	if subtree, _ := berParseOID(field); !subtree.Equals(root) || priority != -1 || operation != 2 {
+		t.Errorf("Bad registration: %s, %d, %d", subtree, priority, operation)
+	}
+	master.write(berTLV(smuxRRsp, berInt(0)))
+
+	resp := master.request(AsnGetRequest, VarBind{OID: root.Add(1, 1)})
+	if resp.ErrorStatus != NoError || string(resp.VarBinds[0].Value.([]byte)) != "test" {
+		t.Errorf("Bad Get response: %s, %v", resp.ErrorStatus, resp.VarBinds)
+	}
+
+	resp = master.request(AsnGetRequest, VarBind{OID: root.Add(1, 2)})
+	if resp.ErrorStatus != NoSuchName || resp.ErrorIndex != 1 {
+		t.Errorf("Expected noSuchName for Counter64, got %s at %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+
+	resp = master.request(AsnGetNextRequest, VarBind{OID: NewOID(1, 3, 6, 1)}, VarBind{OID: root.Add(1, 3)})
+	if resp.ErrorStatus != NoError || !resp.VarBinds[0].OID.Equals(root.Add(1, 1)) || !resp.VarBinds[1].OID.Equals(root.Add(2, 1)) {
+		t.Errorf("Bad GetNext response: %s, %v", resp.ErrorStatus, resp.VarBinds)
+	}
+
+	resp = master.request(AsnGetNextRequest, VarBind{OID: root.Add(2, 25)})
+	if resp.ErrorStatus != NoSuchName {
+		t.Errorf("Expected noSuchName at the end of the subtree, got %s", resp.ErrorStatus)
+	}
+
+	// A SET is only applied once it is committed
+	for _, commit := range []int64{1, 0} {
+		resp = master.request(AsnSetRequest, VarBind{root.Add(1, 3), AsnInteger, 42 + commit})
+		if resp.ErrorStatus != NoError {
+			t.Errorf("Bad Set response: %s", resp.ErrorStatus)
+		}
+		if vbs := master.request(AsnGetRequest, VarBind{OID: root.Add(1, 3)}).VarBinds; vbs[0].Value != 0 {
+			t.Errorf("Set was applied before being committed: %v", vbs)
+		}
+
+		master.write(berTLV(smuxSOut, berInt(commit)))
+	}
+
+	if vbs := master.request(AsnGetRequest, VarBind{OID: root.Add(1, 3)}).VarBinds; vbs[0].Value != 42 {
+		t.Errorf("Expected the committed value, got %v", vbs)
+	}
+
+	resp = master.request(AsnSetRequest, VarBind{NewOID(1, 3, 6, 1, 2), AsnInteger, 1})
+	if resp.ErrorStatus != NoSuchName {
+		t.Errorf("Expected noSuchName outside the subtree, got %s", resp.ErrorStatus)
+	}
+	master.write(berTLV(smuxSOut, berInt(1)))
+
+	// A SET that cannot be applied is refused before it is committed
+	resp = master.request(AsnSetRequest, VarBind{root.Add(1, 3), AsnInteger, 7}, VarBind{root.Add(1, 1), AsnOctetString, "x"})
+	if resp.ErrorStatus != NoSuchName || resp.ErrorIndex != 2 {
+		t.Errorf("Expected noSuchName for a read-only object, got %s at %d", resp.ErrorStatus, resp.ErrorIndex)
+	}
+	master.write(berTLV(smuxSOut, berInt(1)))
+
+	peer.Close()
+	if reason, _ := berParseInt(master.read(smuxClose)); reason != smuxGoingDown {
+		t.Errorf("Bad close reason: %d", reason)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("Expected a clean close, got %s", err)
+	}
+}
+
+// Test that a committed SET is applied to the tree it was tested against,
+// even if the callback returns a new tree for every request
+func TestSmuxPeerCommitTree(t *testing.T) {
+	var (
+		root  = testAgentRoot
+		mu    sync.Mutex
+		trees []SMINode
+		peer  = NewSmuxPeer(root.Add(99), "", root, func() SMINode {
+			mu.Lock()
+			defer mu.Unlock()
+			trees = append(trees, newTestTree())
+			return trees[len(trees)-1]
+		})
+	)
+
+	peer.Writable = true
+	master, _ := startSmuxPeer(t, peer)
+	master.read(smuxOpen)
+	master.read(smuxRReq)
+	master.write(berTLV(smuxRRsp, berInt(0)))
+
+	if resp := master.request(AsnSetRequest, VarBind{root.Add(1, 3), AsnInteger, 42}); resp.ErrorStatus != NoError {
+		t.Fatalf("Bad Set response: %s", resp.ErrorStatus)
+	}
+	mu.Lock()
+	tested := trees[len(trees)-1]
+	mu.Unlock()
+	master.write(berTLV(smuxSOut, berInt(0)))
+
+	// A request after the commit waits for it to be handled
+	master.request(AsnGetRequest, VarBind{OID: root.Add(1, 3)})
+	if v := GetLeaf(tested, NewOID(1, 3)).Value().Value(); v != 42 {
+		t.Errorf("Expected the tested tree to be set, got %v", v)
+	}
+
+	peer.Close()
+}
+
+// Test the master agent refusing a peer
+func TestSmuxPeerRefused(t *testing.T) {
+	var tree = newTestTree()
+
+	type refusedTest struct {
+		response []byte
+		expected error
+	}
+
+	tests := []refusedTest{
+		{berTLV(smuxClose, berInt(smuxAuthenticationFailure)), SmuxClosed},
+		{berTLV(smuxRRsp, berInt(-1)), RegistrationRefused},
+	}
+
+	for _, test := range tests {
+		peer := NewSmuxPeer(testAgentRoot.Add(99), "wrong", testAgentRoot, func() SMINode { return tree })
+		master, errc := startSmuxPeer(t, peer)
+
+		master.read(smuxOpen)
+		master.read(smuxRReq)
+		master.write(test.response)
+
+		if err := <-errc; !errors.Is(err, test.expected) {
+			t.Errorf("Expected %s, got %v", test.expected, err)
+		}
+	}
+}
+
+// Test that closing a peer before it serves stops it from serving
+func TestSmuxPeerCloseFirst(t *testing.T) {
+	var (
+		peer         = NewSmuxPeer(testAgentRoot.Add(99), "", testAgentRoot, newTestTree)
+		local, other = net.Pipe()
+		done         = make(chan error, 1)
+	)
+	defer other.Close()
+
+	peer.Close()
+	go func() { done <- peer.Serve(local) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return")
+	}
+	if _, err := other.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Serve() did not close the connection")
+	}
+}
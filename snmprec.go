@@ -0,0 +1,222 @@
+package snmptools
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// snmprec errors
+	MalformedSnmprec = fmt.Errorf("Malformed snmprec data")
+)
+
+// snmprecTypes are the types that can be recorded in snmprec data, whose tags
+// are the BER tags of the types
+var snmprecTypes = map[AsnType]bool{
+	AsnInteger:          true,
+	AsnOctetString:      true,
+	AsnNull:             true,
+	AsnObjectIdentifier: true,
+	AsnIpAddress:        true,
+	AsnCounter32:        true,
+	AsnGauge32:          true,
+	AsnTimeTicks:        true,
+	AsnOpaque:           true,
+	AsnCounter64:        true,
+}
+
+// ParseSnmprec() reads data recorded in snmpsim's .snmprec format into a tree,
+// whose OIDs are relative to root. Each line gives the OID, BER tag and value
+// of a variable:
+//
+//	1.3.6.1.2.1.1.1.0|4|Linux router
+//	1.3.6.1.2.1.2.2.1.6.2|4x|525400123456
+//	1.3.6.1.2.1.1.3.0|67|35234567
+//
+// A tag ending in "x" means the value is in hexadecimal. Blank lines and
+// lines starting with "#" are ignored; variation modules are not supported.
+//
+// OCTET STRINGs are strings, or []bytes if they were in hexadecimal, and the
+// other types are as returned by ParseExtendOutput().
+func ParseSnmprec(r io.Reader, root OID) (*SMISparseSubtree, error) {
+	var (
+		tree    = NewSMISparseSubtree()
+		scanner = bufio.NewScanner(r)
+	)
+
+	for n := 1; scanner.Scan(); n += 1 {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		oid, leaf, err := parseSnmprecLine(line, root)
+		if err == nil {
+			err = tree.Insert(oid, NewLeafNode(leaf))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", MalformedSnmprec, n, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func parseSnmprecLine(line string, root OID) (OID, *SMILeaf, error) {
+	var (
+		fields = strings.SplitN(line, "|", 3)
+		value  interface{}
+	)
+
+	if len(fields) != 3 {
+		return nil, nil, fmt.Errorf("expected an OID, tag and value")
+	}
+
+	oid, err := relativeOID(fields[0], root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tag, isHex := fields[1], false
+	if strings.HasSuffix(tag, "x") {
+		tag, isHex = tag[:len(tag)-1], true
+	}
+
+	n, err := strconv.ParseUint(tag, 10, 8)
+	if err != nil || !snmprecTypes[AsnType(n)] {
+		return nil, nil, fmt.Errorf("unsupported tag %q", fields[1])
+	}
+	t, s := AsnType(n), fields[2]
+
+	if isHex {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, nil, fmt.Errorf("bad hexadecimal value %q", s)
+		} else if t == AsnOctetString || t == AsnOpaque {
+			return oid, &SMILeaf{t, b}, nil
+		}
+		s = string(b)
+	}
+
+	switch t {
+	case AsnInteger:
+		value, err = strconv.Atoi(s)
+	case AsnGauge32, AsnCounter32, AsnTimeTicks:
+		var u uint64
+		u, err = strconv.ParseUint(s, 10, 32)
+		value = uint32(u)
+	case AsnCounter64:
+		value, err = strconv.ParseUint(s, 10, 64)
+	case AsnIpAddress:
+		if ip := net.ParseIP(s).To4(); ip != nil {
+			value = ip
+		} else {
+			err = fmt.Errorf("bad IP address %q", s)
+		}
+	case AsnObjectIdentifier:
+		value, err = parseDocumentOID(s)
+	case AsnOctetString:
+		value = s
+	case AsnOpaque:
+		value = []byte(s)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return oid, &SMILeaf{t, value}, nil
+}
+
+// WriteSnmprec() writes a tree located at root in snmpsim's .snmprec format,
+// so that it can be simulated by snmpsim or read back by ParseSnmprec().
+// OCTET STRINGs that are not printable, and Opaque values, are written in
+// hexadecimal.
+func WriteSnmprec(w io.Writer, node SMINode, root OID) error {
+	var bw = bufio.NewWriter(w)
+
+	err := Walk(node, func(oid OID, leaf *SMILeaf) error {
+		var (
+			tag   = strconv.Itoa(int(leaf.asnType))
+			value string
+		)
+
+		if !snmprecTypes[leaf.asnType] {
+			return fmt.Errorf("%s: %w: %s", root.Add(oid...), BadValType, leaf.asnType.PrettyString())
+		}
+
+		canonical, err := canonicalValue(leaf)
+		if err != nil {
+			return fmt.Errorf("%s: %w", root.Add(oid...), err)
+		}
+
+		switch v := canonical.(type) {
+		case []byte:
+			if leaf.asnType == AsnOctetString && isPrintable(v) && !strings.ContainsAny(string(v), "\r\n") {
+				value = string(v)
+			} else {
+				tag, value = tag+"x", hex.EncodeToString(v)
+			}
+		case OID:
+			value = strings.TrimPrefix(v.String(), ".")
+		case net.IP:
+			value = v.String()
+		case nil:
+		default:
+			value = fmt.Sprint(v)
+		}
+
+		_, err = fmt.Fprintf(bw, "%s|%s|%s\n", instanceString(root.Add(oid...)), tag, value)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// relativeOID parses an OID, with or without its leading dot, and returns it
+// relative to root.
+func relativeOID(s string, root OID) (OID, error) {
+	oid, err := parseDocumentOID(s)
+	if err != nil {
+		return nil, err
+	} else if oid, err = oid.GetRemainder(root); err != nil || len(oid) == 0 {
+		return nil, fmt.Errorf("%s is not beneath %s", s, root)
+	}
+	return oid, nil
+}
+
+// leafBytes returns the value of an OCTET STRING or Opaque leaf as bytes.
+func leafBytes(leaf *SMILeaf) []byte {
+	switch v := leaf.value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return []byte(fmt.Sprint(leaf.value))
+}
+
+// isPrintable says whether an OCTET STRING can be shown as text.
+func isPrintable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
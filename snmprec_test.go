@@ -0,0 +1,106 @@
+package snmptools
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+var testRecordingRoot = NewOID(1, 3, 6, 1, 2, 1)
+
+// Test reading a recording as snmpsim writes it
+func TestParseSnmprec(t *testing.T) {
+	var O = NewOID
+
+	data := `# recorded from a router
+1.3.6.1.2.1.1.1.0|4|Linux router | 5.10
+1.3.6.1.2.1.1.2.0|6|1.3.6.1.4.1.8072.3.2.10
+1.3.6.1.2.1.1.3.0|67|35234567
+
+1.3.6.1.2.1.2.2.1.1.2|2|2
+1.3.6.1.2.1.2.2.1.6.2|4x|525400123456
+1.3.6.1.2.1.4.20.1.1.10.0.0.1|64|10.0.0.1
+1.3.6.1.2.1.31.1.1.1.6.2|70|9876543210
+1.3.6.1.2.1.99.1.0|5|
+`
+
+	tree, err := ParseSnmprec(strings.NewReader(data), testRecordingRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLeaves(t, tree, []VarBind{
+		{O(1, 1, 0), AsnOctetString, "Linux router | 5.10"},
+		{O(1, 2, 0), AsnObjectIdentifier, ".1.3.6.1.4.1.8072.3.2.10"},
+		{O(1, 3, 0), AsnTimeTicks, uint32(35234567)},
+		{O(2, 2, 1, 1, 2), AsnInteger, 2},
+		{O(2, 2, 1, 6, 2), AsnOctetString, []byte{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}},
+		{O(4, 20, 1, 1, 10, 0, 0, 1), AsnIpAddress, "10.0.0.1"},
+		{O(31, 1, 1, 1, 6, 2), AsnCounter64, uint64(9876543210)},
+		{O(99, 1, 0), AsnNull, nil},
+	})
+}
+
+// Test that written recordings read back into the same tree
+func TestSnmprecRoundTrip(t *testing.T) {
+	var (
+		O    = NewOID
+		tree = NewSMISubtree(
+			NewSMISubtree(
+				NewLeafNode(NewSMILeaf(AsnOctetString, "two\nlines")),
+				NewLeafNode(NewSMILeaf(AsnOctetString, []byte{0xff, 0x00})),
+				NewLeafNode(NewSMILeaf(AsnInteger, -3)),
+				NewLeafNode(NewSMILeaf(AsnIpAddress, net.IPv4(192, 168, 0, 1))),
+				NewLeafNode(&SMILeaf{AsnOpaque, []byte("abc")}),
+				NewLeafNode(NewSMILeaf(AsnIpAddress, []byte{10, 0, 0, 1})),
+				NewLeafNode(NewSMILeaf(AsnObjectIdentifier, []uint32{1, 3, 6})),
+			),
+		)
+		out bytes.Buffer
+	)
+
+	if err := WriteSnmprec(&out, tree, testRecordingRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 7 || lines[0] != "1.3.6.1.2.1.1.1|4x|74776f0a6c696e6573" || lines[3] != "1.3.6.1.2.1.1.4|64|192.168.0.1" || lines[5] != "1.3.6.1.2.1.1.6|64|10.0.0.1" || lines[6] != "1.3.6.1.2.1.1.7|6|1.3.6" {
+		t.Fatalf("Bad snmprec data: %q", lines)
+	}
+
+	parsed, err := ParseSnmprec(&out, testRecordingRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLeaves(t, parsed, []VarBind{
+		{O(1, 1), AsnOctetString, []byte("two\nlines")},
+		{O(1, 2), AsnOctetString, []byte{0xff, 0x00}},
+		{O(1, 3), AsnInteger, -3},
+		{O(1, 4), AsnIpAddress, "192.168.0.1"},
+		{O(1, 5), AsnOpaque, []byte("abc")},
+		{O(1, 6), AsnIpAddress, "10.0.0.1"},
+		{O(1, 7), AsnObjectIdentifier, ".1.3.6"},
+	})
+}
+
+// Test rejection of malformed recordings
+func TestParseSnmprecErrors(t *testing.T) {
+	tests := []string{
+		"1.3.6.1.2.1.1.1.0|4",
+		"1.3.6.1.4.1.1.0|2|1",
+		"1.3.6.1.2.1.1.1.0|3|1",
+		"1.3.6.1.2.1.1.1.0|4:numeric|1",
+		"1.3.6.1.2.1.1.1.0|4x|zz",
+		"1.3.6.1.2.1.1.1.0|65|-1",
+		"1.3.6.1.2.1.1.1.0|2|1\n1.3.6.1.2.1.1.1.0.1|2|1",
+	}
+
+	for _, test := range tests {
+		if _, err := ParseSnmprec(strings.NewReader(test), testRecordingRoot); !errors.Is(err, MalformedSnmprec) {
+			t.Errorf("Expected an error for %q, got %v", test, err)
+		}
+	}
+}
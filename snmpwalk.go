@@ -0,0 +1,332 @@
+package snmptools
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// snmpwalk errors
+	MalformedSnmpwalk = fmt.Errorf("Malformed snmpwalk output")
+)
+
+// snmpwalkLine matches the first line of each variable in snmpwalk -On output
+var snmpwalkLine = regexp.MustCompile(`^(\.?[0-9]+(?:\.[0-9]+)*) = (.*)$`)
+
+// snmpwalkUnsigned are the names snmpwalk gives to 32-bit unsigned types
+var snmpwalkUnsigned = map[string]AsnType{
+	"Gauge32":    AsnGauge32,
+	"Unsigned32": AsnGauge32,
+	"Counter32":  AsnCounter32,
+	"UInteger32": AsnUinteger32,
+}
+
+// ParseSnmpwalk() reads the output of net-snmp's snmpwalk -On into a tree,
+// whose OIDs are relative to root:
+//
+//	.1.3.6.1.2.1.1.1.0 = STRING: "Linux router"
+//	.1.3.6.1.2.1.1.3.0 = Timeticks: (35234567) 4 days, 1:52:25.67
+//	.1.3.6.1.2.1.2.2.1.6.2 = Hex-STRING: 52 54 00 12 34 56
+//
+// Values may run over several lines, as long strings and Hex-STRINGs do.
+// Enumerated INTEGERs, such as "up(1)", and values followed by their units
+// are understood. Exceptions, such as "No Such Object", are skipped.
+//
+// The values in the tree are as returned by ParseSnmprec(): STRINGs are
+// strings, and Hex-STRINGs are []bytes.
+func ParseSnmpwalk(r io.Reader, root OID) (*SMISparseSubtree, error) {
+	var (
+		tree    = NewSMISparseSubtree()
+		scanner = bufio.NewScanner(r)
+		oid     string
+		value   string
+		start   int
+	)
+
+	// Each variable is added when the next one starts
+	add := func() error {
+		if oid == "" {
+			return nil
+		}
+
+		relative, leaf, err := parseSnmpwalkValue(oid, value, root)
+		if err == nil && leaf != nil {
+			err = tree.Insert(relative, NewLeafNode(leaf))
+		}
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %s", MalformedSnmpwalk, start, err)
+		}
+		return nil
+	}
+
+	for n := 1; scanner.Scan(); n += 1 {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if match := snmpwalkLine.FindStringSubmatch(line); match != nil {
+			if err := add(); err != nil {
+				return nil, err
+			}
+			oid, value, start = match[1], match[2], n
+		} else if oid != "" {
+			value += "\n" + line
+		} else if strings.TrimSpace(line) != "" {
+			return nil, fmt.Errorf("%w: line %d: expected an OID", MalformedSnmpwalk, n)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	} else if err := add(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// parseSnmpwalkValue parses the value of one variable, returning a nil leaf
+// for exceptions.
+func parseSnmpwalkValue(s, text string, root OID) (OID, *SMILeaf, error) {
+	oid, err := relativeOID(s, root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	text = strings.TrimRight(text, " \n")
+	switch {
+	case text == `""`:
+		return oid, &SMILeaf{AsnOctetString, ""}, nil
+	case text == "NULL":
+		return oid, &SMILeaf{AsnNull, nil}, nil
+	case strings.HasPrefix(text, "No Such ") || strings.HasPrefix(text, "No more variables"):
+		return oid, nil, nil
+	case strings.HasPrefix(text, "Wrong Type "):
+		if i := strings.Index(text, "): "); i >= 0 {
+			text = text[i+3:]
+		}
+	}
+
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		return nil, nil, fmt.Errorf("expected a type and value")
+	}
+
+	var (
+		typeName = text[:i]
+		rest     = strings.TrimSpace(text[i+2:])
+		first    = rest
+		value    interface{}
+		t        AsnType
+	)
+
+	if fields := strings.Fields(rest); len(fields) > 0 {
+		first = fields[0]
+	}
+
+	switch typeName {
+	case "INTEGER":
+		t = AsnInteger
+		// Enumerations are written as name(value)
+		if open := strings.LastIndexByte(first, '('); open >= 0 && strings.HasSuffix(first, ")") {
+			first = first[open+1 : len(first)-1]
+		}
+		value, err = strconv.Atoi(first)
+
+	case "Gauge32", "Unsigned32", "Counter32", "UInteger32":
+		t = snmpwalkUnsigned[typeName]
+		var u uint64
+		u, err = strconv.ParseUint(first, 10, 32)
+		value = uint32(u)
+
+	case "Counter64":
+		t = AsnCounter64
+		value, err = strconv.ParseUint(first, 10, 64)
+
+	case "Timeticks":
+		t = AsnTimeTicks
+		var u uint64
+		u, err = strconv.ParseUint(strings.Trim(first, "()"), 10, 32)
+		value = uint32(u)
+
+	case "STRING":
+		t = AsnOctetString
+		value, err = unquoteSnmpwalk(rest)
+
+	case "Hex-STRING", "BITS", "Opaque":
+		t = AsnOctetString
+		if typeName == "Opaque" {
+			t = AsnOpaque
+		}
+		value, err = parseHexBytes(rest)
+
+	case "IpAddress":
+		t = AsnIpAddress
+		if ip := net.ParseIP(first).To4(); ip != nil {
+			value = ip
+		} else {
+			err = fmt.Errorf("bad IP address %q", first)
+		}
+
+	case "Network Address":
+		t = AsnIpAddress
+		if b, e := hex.DecodeString(strings.ReplaceAll(first, ":", "")); e == nil && len(b) == 4 {
+			value = net.IP(b)
+		} else {
+			err = fmt.Errorf("bad network address %q", first)
+		}
+
+	case "OID":
+		t = AsnObjectIdentifier
+		value, err = NewOIDFromString(first)
+
+	default:
+		err = fmt.Errorf("unknown type %q", typeName)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return oid, &SMILeaf{t, value}, nil
+}
+
+// unquoteSnmpwalk returns the contents of a STRING. Quoted strings have their
+// quotes and backslashes escaped; strings formatted with a DISPLAY-HINT are
+// not quoted at all.
+func unquoteSnmpwalk(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	} else if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return "", fmt.Errorf("unterminated string")
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i += 1 {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i += 1
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String(), nil
+}
+
+// parseHexBytes parses bytes written in hexadecimal and separated by spaces,
+// ignoring anything that follows them, such as the names of BITS.
+func parseHexBytes(s string) ([]byte, error) {
+	var b = make([]byte, 0)
+	for _, field := range strings.Fields(s) {
+		n, err := strconv.ParseUint(field, 16, 8)
+		if err != nil || len(field) != 2 {
+			break
+		}
+		b = append(b, byte(n))
+	}
+
+	if len(b) == 0 && strings.TrimSpace(s) != "" {
+		return nil, fmt.Errorf("bad hexadecimal value %q", s)
+	}
+	return b, nil
+}
+
+// WriteSnmpwalk() writes a tree located at root as snmpwalk -On would show it,
+// so that it can be read back by ParseSnmpwalk() or compared with the output
+// of a real device. OCTET STRINGs that are not printable are written as
+// Hex-STRINGs.
+func WriteSnmpwalk(w io.Writer, node SMINode, root OID) error {
+	var bw = bufio.NewWriter(w)
+
+	err := Walk(node, func(oid OID, leaf *SMILeaf) error {
+		value, err := snmpwalkValue(leaf)
+		if err != nil {
+			return fmt.Errorf("%s: %w", root.Add(oid...), err)
+		}
+		_, err = fmt.Fprintf(bw, "%s = %s\n", root.Add(oid...), value)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// snmpwalkValue formats a leaf's value as net-snmp does.
+func snmpwalkValue(leaf *SMILeaf) (string, error) {
+	value, err := canonicalValue(leaf)
+	if err != nil {
+		return "", err
+	}
+
+	switch leaf.asnType {
+	case AsnInteger:
+		return fmt.Sprintf("INTEGER: %d", value), nil
+	case AsnGauge32:
+		return fmt.Sprintf("Gauge32: %d", value), nil
+	case AsnCounter32:
+		return fmt.Sprintf("Counter32: %d", value), nil
+	case AsnUinteger32:
+		return fmt.Sprintf("UInteger32: %d", value), nil
+	case AsnCounter64:
+		return fmt.Sprintf("Counter64: %d", value), nil
+	case AsnIpAddress:
+		return "IpAddress: " + value.(net.IP).String(), nil
+	case AsnObjectIdentifier:
+		return "OID: " + value.(OID).String(), nil
+	case AsnNull:
+		return "NULL", nil
+
+	case AsnTimeTicks:
+		u := uint64(value.(uint32))
+		return fmt.Sprintf("Timeticks: (%d) %s", u, uptimeString(u)), nil
+
+	case AsnOctetString:
+		b := value.([]byte)
+		if len(b) == 0 {
+			return `""`, nil
+		} else if isPrintable(b) {
+			return fmt.Sprintf(`STRING: "%s"`, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(string(b))), nil
+		}
+		return "Hex-STRING: " + hexBytesString(b), nil
+
+	case AsnOpaque:
+		return "Opaque: " + hexBytesString(value.([]byte)), nil
+	}
+
+	return "", badValue(leaf.asnType, leaf.value)
+}
+
+// uptimeString formats TimeTicks as net-snmp does, for example
+// "4 days, 1:52:25.67".
+func uptimeString(ticks uint64) string {
+	var (
+		centis  = ticks % 100
+		seconds = ticks / 100 % 60
+		minutes = ticks / 6000 % 60
+		hours   = ticks / 360000 % 24
+		days    = ticks / 8640000
+	)
+
+	s := fmt.Sprintf("%d:%02d:%02d.%02d", hours, minutes, seconds, centis)
+	switch days {
+	case 0:
+		return s
+	case 1:
+		return "1 day, " + s
+	}
+	return fmt.Sprintf("%d days, %s", days, s)
+}
+
+// hexBytesString formats bytes as net-snmp does, sixteen to a line.
+func hexBytesString(b []byte) string {
+	var s strings.Builder
+	for i, c := range b {
+		if i > 0 && i%16 == 0 {
+			s.WriteByte('\n')
+		}
+		fmt.Fprintf(&s, "%02X ", c)
+	}
+	return s.String()
+}
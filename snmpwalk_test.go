@@ -0,0 +1,129 @@
+package snmptools
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Test reading the output of snmpwalk -On
+func TestParseSnmpwalk(t *testing.T) {
+	var O = NewOID
+
+	data := `.1.3.6.1.2.1.1.1.0 = STRING: "Linux router \"edge\"
+second line"
+.1.3.6.1.2.1.1.2.0 = OID: .1.3.6.1.4.1.8072.3.2.10
+.1.3.6.1.2.1.1.3.0 = Timeticks: (35234567) 4 days, 1:52:25.67
+.1.3.6.1.2.1.1.4.0 = ""
+.1.3.6.1.2.1.1.5.0 = No Such Object available on this agent at this OID
+.1.3.6.1.2.1.2.2.1.5.2 = Gauge32: 1000000000
+.1.3.6.1.2.1.2.2.1.6.2 = Hex-STRING: 00 01 02 03 04 05 06 07 08 09 0A 0B 0C 0D 0E 0F
+10 11
+.1.3.6.1.2.1.2.2.1.7.2 = INTEGER: up(1)
+.1.3.6.1.2.1.2.2.1.10.2 = Counter32: 1286608618
+.1.3.6.1.2.1.4.20.1.1.10.0.0.1 = IpAddress: 10.0.0.1
+.1.3.6.1.2.1.25.1.5.0 = Gauge32: 2 seconds
+.1.3.6.1.2.1.31.1.1.1.6.2 = Counter64: 9876543210
+.1.3.6.1.2.1.31.1.1.1.15.2 = Wrong Type (should be Gauge32): INTEGER: 10000
+`
+
+	tree, err := ParseSnmpwalk(strings.NewReader(data), testRecordingRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLeaves(t, tree, []VarBind{
+		{O(1, 1, 0), AsnOctetString, "Linux router \"edge\"\nsecond line"},
+		{O(1, 2, 0), AsnObjectIdentifier, ".1.3.6.1.4.1.8072.3.2.10"},
+		{O(1, 3, 0), AsnTimeTicks, uint32(35234567)},
+		{O(1, 4, 0), AsnOctetString, ""},
+		{O(2, 2, 1, 5, 2), AsnGauge32, uint32(1000000000)},
+		{O(2, 2, 1, 6, 2), AsnOctetString, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17}},
+		{O(2, 2, 1, 7, 2), AsnInteger, 1},
+		{O(2, 2, 1, 10, 2), AsnCounter32, uint32(1286608618)},
+		{O(4, 20, 1, 1, 10, 0, 0, 1), AsnIpAddress, "10.0.0.1"},
+		{O(25, 1, 5, 0), AsnGauge32, uint32(2)},
+		{O(31, 1, 1, 1, 6, 2), AsnCounter64, uint64(9876543210)},
+		{O(31, 1, 1, 1, 15, 2), AsnInteger, 10000},
+	})
+
+	if node := GetLeaf(tree, O(1, 5, 0)); node != nil {
+		t.Errorf("Unexpected leaf for an exception: %v", node)
+	}
+}
+
+// Test that written walks read back into the same tree, and look like
+// net-snmp's
+func TestSnmpwalkRoundTrip(t *testing.T) {
+	var (
+		O    = NewOID
+		tree = NewSMISubtree(
+			NewSMISubtree(
+				NewLeafNode(NewSMILeaf(AsnOctetString, `say "hi"`)),
+				NewLeafNode(NewSMILeaf(AsnOctetString, []byte{0xff, 0x00})),
+				NewLeafNode(NewSMILeaf(AsnTimeTicks, uint32(8640000+360000+6000+100+1))),
+				NewLeafNode(NewSMILeaf(AsnIpAddress, net.IPv4(192, 168, 0, 1))),
+				NewLeafNode(NewSMILeaf(AsnObjectIdentifier, O(1, 3, 6, 1))),
+				NewLeafNode(NewSMILeaf(AsnInteger, -3)),
+				NewLeafNode(NewSMILeaf(AsnIpAddress, []byte{10, 0, 0, 1})),
+				NewLeafNode(NewSMILeaf(AsnObjectIdentifier, []uint32{1, 3, 6})),
+			),
+		)
+		out bytes.Buffer
+	)
+
+	if err := WriteSnmpwalk(&out, tree, testRecordingRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`.1.3.6.1.2.1.1.1 = STRING: "say \"hi\""`,
+		`.1.3.6.1.2.1.1.2 = Hex-STRING: FF 00 `,
+		`.1.3.6.1.2.1.1.3 = Timeticks: (9006101) 1 day, 1:01:01.01`,
+		`.1.3.6.1.2.1.1.4 = IpAddress: 192.168.0.1`,
+		`.1.3.6.1.2.1.1.5 = OID: .1.3.6.1`,
+		`.1.3.6.1.2.1.1.6 = INTEGER: -3`,
+		`.1.3.6.1.2.1.1.7 = IpAddress: 10.0.0.1`,
+		`.1.3.6.1.2.1.1.8 = OID: .1.3.6`,
+	}
+	if lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Bad snmpwalk output: %q", lines)
+	}
+
+	parsed, err := ParseSnmpwalk(&out, testRecordingRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkLeaves(t, parsed, []VarBind{
+		{O(1, 1), AsnOctetString, `say "hi"`},
+		{O(1, 2), AsnOctetString, []byte{0xff, 0x00}},
+		{O(1, 3), AsnTimeTicks, uint32(9006101)},
+		{O(1, 4), AsnIpAddress, "192.168.0.1"},
+		{O(1, 5), AsnObjectIdentifier, ".1.3.6.1"},
+		{O(1, 6), AsnInteger, -3},
+		{O(1, 7), AsnIpAddress, "10.0.0.1"},
+		{O(1, 8), AsnObjectIdentifier, ".1.3.6"},
+	})
+}
+
+// Test rejection of malformed snmpwalk output
+func TestParseSnmpwalkErrors(t *testing.T) {
+	tests := []string{
+		"garbage\n.1.3.6.1.2.1.1.1.0 = INTEGER: 1",
+		".1.3.6.1.4.1.1.0 = INTEGER: 1",
+		".1.3.6.1.2.1.1.1.0 = INTEGER 1",
+		".1.3.6.1.2.1.1.1.0 = Float: 1.5",
+		".1.3.6.1.2.1.1.1.0 = STRING: \"unterminated",
+		".1.3.6.1.2.1.1.1.0 = Counter32: -1",
+		".1.3.6.1.2.1.1.1.0 = Hex-STRING: zz",
+	}
+
+	for _, test := range tests {
+		if _, err := ParseSnmpwalk(strings.NewReader(test), testRecordingRoot); !errors.Is(err, MalformedSnmpwalk) {
+			t.Errorf("Expected an error for %q, got %v", test, err)
+		}
+	}
+}
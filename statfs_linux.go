@@ -0,0 +1,15 @@
+//go:build linux
+// +build linux
+
+package snmptools
+
+import "syscall"
+
+// statfs reports the size of the filesystem mounted at path.
+func statfs(path string) (fsStats, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fsStats{}, err
+	}
+	return fsStats{uint64(st.Bsize), st.Blocks, st.Bfree}, nil
+}
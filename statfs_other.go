@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package snmptools
+
+import "fmt"
+
+// statfs is only implemented on Linux, where HostProvider is useful.
+func statfs(path string) (fsStats, error) {
+	return fsStats{}, fmt.Errorf("statfs is not supported on this platform")
+}
@@ -0,0 +1,241 @@
+package snmptools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	// Table errors
+	NotATable = fmt.Errorf("Object is not a table entry")
+)
+
+// Column is a column of a table to retrieve.
+type Column struct {
+	// Name identifies the column's values in each TableRow
+	Name string
+	// Arc is the column's sub-identifier beneath the table entry
+	Arc uint32
+}
+
+// TableDefinition describes a table for Client.Table().
+type TableDefinition struct {
+	// Entry is the OID of the table's entry, such as ifEntry
+	Entry   OID
+	Columns []Column
+	// Indexes are the objects of the entry's INDEX clause; with none, rows
+	// are only identified by their instance
+	Indexes []Index
+}
+
+// TableRow is a row of a table retrieved by Client.Table().
+type TableRow struct {
+	// Instance is the part of the row's OIDs after each column's OID
+	Instance OID
+	// Index holds the row's index values, decoded from the instance
+	Index []interface{}
+	// Values holds the row's values by column name. Columns with no value in
+	// the row are missing.
+	Values map[string]VarBind
+}
+
+// Table() retrieves every row of a table, walking all of its columns at
+// once with GetBulk requests of MaxRepetitions rows, or GetNext requests
+// with SNMPv1. Rows are returned in order of their instances.
+//
+// Columns may be sparse, with rows missing from some of them. Agents that
+// return OIDs out of order are tolerated: each value is kept, but a column
+// is finished once the agent stops making progress through it.
+func (c *Client) Table(def *TableDefinition) ([]TableRow, error) {
+	return retrieveTable(def, func(oids []OID) ([]VarBind, error) {
+		if c.Version == Version1 {
+			return c.GetNext(oids...)
+		}
+		return c.GetBulk(0, c.maxRepetitions(), oids...)
+	})
+}
+
+// tableColumn is the progress of the walk through one column
+type tableColumn struct {
+	Column
+	prefix OID
+	// last is the greatest OID returned in the column so far
+	last OID
+	done bool
+}
+
+// retrieveTable walks the columns of a table with fetch, which sends one
+// GetNext or GetBulk request.
+func retrieveTable(def *TableDefinition, fetch func(oids []OID) ([]VarBind, error)) ([]TableRow, error) {
+	var (
+		columns = make([]*tableColumn, len(def.Columns))
+		rows    = make(map[string]*TableRow)
+	)
+
+	for i, column := range def.Columns {
+		prefix := def.Entry.Add(column.Arc)
+		columns[i] = &tableColumn{column, prefix, prefix, false}
+	}
+
+	for {
+		var (
+			active []*tableColumn
+			oids   []OID
+		)
+		for _, column := range columns {
+			if !column.done {
+				active = append(active, column)
+				oids = append(oids, column.last)
+			}
+		}
+		if len(active) == 0 {
+			break
+		}
+
+		vbs, err := fetch(oids)
+		if re, ok := err.(*RequestError); ok && re.Status == NoSuchName && re.Index > 0 && re.Index <= len(active) {
+			// SNMPv1's way of saying a column has ended
+			active[re.Index-1].done = true
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var progress = make([]bool, len(active))
+		for i, vb := range vbs {
+			column := active[i%len(active)]
+
+			instance, err := vb.OID.GetRemainder(column.prefix)
+			if vb.IsException() || err != nil || len(instance) == 0 {
+				// Walked out of the column
+				column.done = true
+				continue
+			} else if column.done {
+				continue
+			}
+
+			if vb.OID.Compare(column.last) > 0 {
+				column.last = vb.OID
+				progress[i%len(active)] = true
+			}
+
+			key := instance.String()
+			row, ok := rows[key]
+			if !ok {
+				row = &TableRow{Instance: instance.Copy(), Values: make(map[string]VarBind)}
+				rows[key] = row
+			}
+			row.Values[column.Name] = vb
+		}
+
+		for i, column := range active {
+			if !progress[i] {
+				column.done = true
+			}
+		}
+	}
+
+	var table = make([]TableRow, 0, len(rows))
+	for _, row := range rows {
+		if len(def.Indexes) > 0 {
+			index, err := row.Instance.DecodeIndex(def.Indexes...)
+			if err != nil {
+				return nil, fmt.Errorf("row %s: %w", row.Instance, err)
+			}
+			row.Index = index
+		}
+		table = append(table, *row)
+	}
+
+	sort.Slice(table, func(i, j int) bool {
+		return table[i].Instance.Compare(table[j].Instance) < 0
+	})
+	return table, nil
+}
+
+// Table() builds the definition of the table whose entry is at entry, from
+// the objects defined beneath it and its INDEX objects. An INDEX object may
+// be named "IMPLIED name". The kind of each index is taken from the index
+// object's Type, or its Syntax if it has no Type.
+func (m *MIB) Table(entry OID) (*TableDefinition, error) {
+	info := m.Object(entry)
+	if info == nil || len(info.Indexes) == 0 {
+		return nil, fmt.Errorf("%w: %s", NotATable, entry)
+	}
+
+	var def = &TableDefinition{Entry: entry.Copy()}
+
+	m.mu.RLock()
+	for key, object := range m.objects {
+		oid, err := NewOIDFromString(key)
+		if err != nil || len(oid) != len(entry)+1 {
+			continue
+		} else if _, err := oid.GetRemainder(entry); err == nil {
+			def.Columns = append(def.Columns, Column{object.Name, oid[len(entry)]})
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(def.Columns, func(i, j int) bool {
+		return def.Columns[i].Arc < def.Columns[j].Arc
+	})
+
+	for _, name := range info.Indexes {
+		index, err := m.index(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry, err)
+		}
+		def.Indexes = append(def.Indexes, index)
+	}
+
+	return def, nil
+}
+
+// index finds the kind of an INDEX object by its name.
+func (m *MIB) index(name string) (Index, error) {
+	var index Index
+
+	if implied := strings.TrimPrefix(name, "IMPLIED "); implied != name {
+		index.Implied, name = true, implied
+	}
+
+	m.mu.RLock()
+	var object *ObjectInfo
+	for _, o := range m.objects {
+		if o.Name == name {
+			object = o
+			break
+		}
+	}
+	m.mu.RUnlock()
+
+	if object == nil {
+		return index, fmt.Errorf("%w: unknown INDEX object %s", NotATable, name)
+	}
+
+	t := object.Type
+	if t == 0 && object.Syntax != nil {
+		t = object.Syntax.Type
+	}
+
+	switch t {
+	case AsnInteger, AsnGauge32, AsnUinteger32, AsnCounter32, AsnTimeTicks:
+		index.Kind = IntegerIndex
+	case AsnOctetString, AsnOpaque:
+		index.Kind = StringIndex
+		if object.Syntax != nil && object.Syntax.Name == "InetAddress" {
+			index.Kind = InetAddressIndex
+		} else if object.Syntax != nil && object.Syntax.Name == "MacAddress" {
+			index.Size = 6
+		}
+	case AsnObjectIdentifier:
+		index.Kind = OIDIndex
+	case AsnIpAddress:
+		index.Kind = IpAddressIndex
+	default:
+		return index, fmt.Errorf("%w: the type of INDEX object %s is not known", NotATable, name)
+	}
+
+	return index, nil
+}
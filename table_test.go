@@ -0,0 +1,127 @@
+package snmptools
+
+import (
+	"errors"
+	"expvar"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// Test retrieving the runtime tree's expvar table from an agent
+func TestClientTable(t *testing.T) {
+	expvar.NewInt("snmptoolsTableTest").Set(42)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := NewAgent(RuntimeRoot, RuntimeTree)
+	go agent.Serve(conn)
+	t.Cleanup(func() { agent.Close() })
+
+	def, err := RuntimeMIB(RuntimeRoot).Table(RuntimeRoot.Add(5, 1))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(def.Columns) != 3 || def.Columns[2].Name != "goExpvarInteger" || def.Indexes[0].Kind != StringIndex {
+		t.Fatalf("Bad table definition: %+v", def)
+	}
+
+	for _, version := range []SNMPVersion{Version1, Version2c} {
+		client := newTestClient(t, conn.LocalAddr().String(), "public", version)
+		client.MaxRepetitions = 2
+
+		rows, err := client.Table(def)
+		if err != nil {
+			t.Fatalf("%s: %s", version, err)
+		}
+
+		var found bool
+		for i, row := range rows {
+			if i > 0 && rows[i-1].Instance.Compare(row.Instance) >= 0 {
+				t.Errorf("%s: rows out of order", version)
+			}
+			if name, _ := row.Values["goExpvarName"].Value.([]byte); len(row.Index) != 1 || string(name) != row.Index[0] {
+				t.Errorf("%s: bad row %+v", version, row)
+			}
+
+			_, hasInteger := row.Values["goExpvarInteger"]
+			if row.Index[0] == "snmptoolsTableTest" {
+				found = row.Values["goExpvarInteger"].Value == uint32(42)
+			} else if row.Index[0] == "cmdline" && hasInteger {
+				t.Errorf("%s: cmdline should have no integer value", version)
+			}
+		}
+		if !found {
+			t.Errorf("%s: the test variable was not retrieved: %+v", version, rows)
+		}
+	}
+}
+
+// Test sparse columns and agents that return OIDs out of order
+func TestRetrieveTable(t *testing.T) {
+	var (
+		O     = NewOID
+		entry = O(1, 1)
+		def   = &TableDefinition{
+			Entry:   entry,
+			Columns: []Column{{"a", 1}, {"b", 2}},
+			Indexes: []Index{{Kind: IntegerIndex}},
+		}
+		vb = func(oid OID) VarBind { return VarBind{oid, AsnInteger, int(oid[len(oid)-1])} }
+	)
+
+	// Each request is answered with the next response, for columns a and b
+	// or just one of them once the other has ended
+	responses := [][]VarBind{
+		{vb(O(1, 1, 1, 1)), vb(O(1, 1, 2, 2)), vb(O(1, 1, 1, 3)), vb(O(1, 1, 2, 3))},
+		// Column a goes backwards, but still makes progress
+		{vb(O(1, 1, 1, 2)), vb(O(1, 1, 3, 1)), vb(O(1, 1, 1, 5))},
+		// Column a is stuck, and is ended
+		{vb(O(1, 1, 1, 4))},
+	}
+
+	var requests [][]OID
+	rows, err := retrieveTable(def, func(oids []OID) ([]VarBind, error) {
+		requests = append(requests, oids)
+		if len(requests) > len(responses) {
+			t.Fatalf("Too many requests: %v", requests)
+		}
+		return responses[len(requests)-1], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[uint32][]string{1: {"a"}, 2: {"a", "b"}, 3: {"a", "b"}, 4: {"a"}, 5: {"a"}}
+	if len(rows) != len(expected) {
+		t.Fatalf("Expected %d rows, got %+v", len(expected), rows)
+	}
+	for i, row := range rows {
+		index := uint32(i + 1)
+		if !reflect.DeepEqual(row.Index, []interface{}{index}) || len(row.Values) != len(expected[index]) {
+			t.Errorf("Bad row %d: %+v", index, row)
+		}
+		for _, name := range expected[index] {
+			if row.Values[name].Value != int(index) {
+				t.Errorf("Bad value of %s in row %d: %s", name, index, row.Values[name])
+			}
+		}
+	}
+
+	if !requests[1][0].Equals(O(1, 1, 1, 3)) || !requests[2][0].Equals(O(1, 1, 1, 5)) {
+		t.Errorf("Bad requests: %v", requests)
+	}
+
+	// Instances that do not match the indexes
+	_, err = retrieveTable(def, func(oids []OID) ([]VarBind, error) {
+		return []VarBind{vb(O(1, 1, 1, 1, 1))}, nil
+	})
+	if !errors.Is(err, BadIndex) {
+		t.Errorf("Expected BadIndex, got %v", err)
+	}
+
+	if _, err := RuntimeMIB(RuntimeRoot).Table(RuntimeRoot.Add(5)); !errors.Is(err, NotATable) {
+		t.Errorf("Expected NotATable, got %v", err)
+	}
+}
@@ -0,0 +1,574 @@
+package snmptools
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// Textual convention errors
+	BadDisplayHint = fmt.Errorf("Bad DISPLAY-HINT")
+	BadTextValue   = fmt.Errorf("Value does not match its textual convention")
+	UnknownSyntax  = fmt.Errorf("The syntax of the object is not known")
+)
+
+// TextualConvention is a type refined from a base type, with its own range
+// of values and way of being displayed, as defined with TEXTUAL-CONVENTION in
+// a MIB module (RFC 2579).
+type TextualConvention struct {
+	Name string
+	// Type is the base type
+	Type AsnType
+	// DisplayHint is the DISPLAY-HINT clause, such as "255a" or "d-2"
+	DisplayHint string
+	// Enums names the values of an enumerated INTEGER
+	Enums map[int64]string
+
+	// format and parse replace the display hint for conventions that cannot
+	// be described by one
+	format func(b []byte) (string, error)
+	parse  func(s string) ([]byte, error)
+}
+
+// TextualConventions are the textual conventions of SNMPv2-TC and
+// INET-ADDRESS-MIB, by name.
+var TextualConventions = standardTextualConventions()
+
+func standardTextualConventions() map[string]*TextualConvention {
+	var (
+		tcs    = make(map[string]*TextualConvention)
+		status = map[int64]string{1: "active", 2: "notInService", 3: "notReady", 4: "createAndGo", 5: "createAndWait", 6: "destroy"}
+		inet   = map[int64]string{0: "unknown", 1: "ipv4", 2: "ipv6", 3: "ipv4z", 4: "ipv6z", 16: "dns"}
+	)
+
+	for _, tc := range []*TextualConvention{
+		// SNMPv2-TC
+		{Name: "DisplayString", Type: AsnOctetString, DisplayHint: "255a"},
+		{Name: "PhysAddress", Type: AsnOctetString, DisplayHint: "1x:"},
+		{Name: "MacAddress", Type: AsnOctetString, DisplayHint: "1x:"},
+		{Name: "TruthValue", Type: AsnInteger, Enums: map[int64]string{1: "true", 2: "false"}},
+		{Name: "TestAndIncr", Type: AsnInteger},
+		{Name: "AutonomousType", Type: AsnObjectIdentifier},
+		{Name: "InstancePointer", Type: AsnObjectIdentifier},
+		{Name: "VariablePointer", Type: AsnObjectIdentifier},
+		{Name: "RowPointer", Type: AsnObjectIdentifier},
+		{Name: "RowStatus", Type: AsnInteger, Enums: status},
+		{Name: "TimeStamp", Type: AsnTimeTicks},
+		{Name: "TimeInterval", Type: AsnInteger},
+		{Name: "DateAndTime", Type: AsnOctetString, DisplayHint: "2d-1d-1d,1d:1d:1d.1d,1a1d:1d"},
+		{Name: "StorageType", Type: AsnInteger, Enums: map[int64]string{1: "other", 2: "volatile", 3: "nonVolatile", 4: "permanent", 5: "readOnly"}},
+		{Name: "TDomain", Type: AsnObjectIdentifier},
+		{Name: "TAddress", Type: AsnOctetString, DisplayHint: "1x:"},
+		// INET-ADDRESS-MIB
+		{Name: "InetAddressType", Type: AsnInteger, Enums: inet},
+		{Name: "InetAddress", Type: AsnOctetString, format: formatInetAddress, parse: parseInetAddress},
+		{Name: "InetAddressIPv4", Type: AsnOctetString, DisplayHint: "1d.1d.1d.1d"},
+		{Name: "InetAddressIPv6", Type: AsnOctetString, DisplayHint: "2x:2x:2x:2x:2x:2x:2x:2x"},
+		{Name: "InetAddressIPv4z", Type: AsnOctetString, DisplayHint: "1d.1d.1d.1d%4d"},
+		{Name: "InetAddressIPv6z", Type: AsnOctetString, DisplayHint: "2x:2x:2x:2x:2x:2x:2x:2x%4d"},
+		{Name: "InetAddressDNS", Type: AsnOctetString, DisplayHint: "255a"},
+		{Name: "InetAddressPrefixLength", Type: AsnUinteger32, DisplayHint: "d"},
+		{Name: "InetPortNumber", Type: AsnUinteger32, DisplayHint: "d"},
+		{Name: "InetAutonomousSystemNumber", Type: AsnUinteger32, DisplayHint: "d"},
+		{Name: "InetScopeType", Type: AsnInteger, Enums: map[int64]string{1: "interfaceLocal", 2: "linkLocal", 3: "subnetLocal", 4: "adminLocal", 5: "siteLocal", 8: "organizationLocal", 14: "global"}},
+		{Name: "InetZoneIndex", Type: AsnUinteger32, DisplayHint: "d"},
+		{Name: "InetVersion", Type: AsnInteger, Enums: map[int64]string{0: "unknown", 1: "ipv4", 2: "ipv6"}},
+	} {
+		tcs[tc.Name] = tc
+	}
+	return tcs
+}
+
+// Format() renders a value of the textual convention: enumerations by name
+// and number, such as "active(1)", and other values by their display hint,
+// or as their base type would be shown if there is none.
+func (tc *TextualConvention) Format(leaf *SMILeaf) (string, error) {
+	if leaf.asnType != tc.Type {
+		return "", fmt.Errorf("%w: %s is not a %s", BadTextValue, leaf.asnType.PrettyString(), tc.Type.PrettyString())
+	}
+
+	switch tc.Type {
+	case AsnOctetString, AsnOpaque:
+		if tc.format != nil {
+			return tc.format(leafBytes(leaf))
+		} else if tc.DisplayHint != "" {
+			return formatOctetHint(tc.DisplayHint, leafBytes(leaf))
+		}
+
+	case AsnInteger, AsnCounter32, AsnGauge32, AsnTimeTicks, AsnCounter64, AsnUinteger32:
+		i, ok := new(big.Int), false
+		if n, isInt := toInt64(leaf.value); isInt {
+			i, ok = i.SetInt64(n), true
+		} else if u, isUint := toUint64(leaf.value); isUint {
+			i, ok = i.SetUint64(u), true
+		}
+		if !ok {
+			return "", fmt.Errorf("%w: %v is not a number", BadTextValue, leaf.value)
+		}
+
+		if tc.Enums != nil {
+			if name, ok := tc.Enums[i.Int64()]; ok && i.IsInt64() {
+				return fmt.Sprintf("%s(%s)", name, i), nil
+			}
+			return "", fmt.Errorf("%w: %s is not a value of %s", BadTextValue, i, tc.Name)
+		} else if tc.DisplayHint != "" {
+			return formatIntegerHint(tc.DisplayHint, i)
+		}
+	}
+
+	return FormatLeaf(leaf), nil
+}
+
+// Parse() reads a value of the textual convention, in any form Format()
+// writes it. Enumerations may also be given by name or number alone.
+func (tc *TextualConvention) Parse(s string) (*SMILeaf, error) {
+	switch tc.Type {
+	case AsnOctetString, AsnOpaque:
+		var (
+			b   []byte
+			err error
+		)
+		if tc.parse != nil {
+			b, err = tc.parse(s)
+		} else if tc.DisplayHint != "" {
+			b, err = parseOctetHint(tc.DisplayHint, s)
+		} else {
+			b = []byte(s)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return NewSMILeaf(tc.Type, b), nil
+
+	case AsnInteger, AsnCounter32, AsnGauge32, AsnTimeTicks, AsnCounter64, AsnUinteger32:
+		var (
+			i   *big.Int
+			err error
+		)
+		if tc.Enums != nil {
+			i, err = tc.parseEnum(s)
+		} else if tc.DisplayHint != "" {
+			i, err = parseIntegerHint(tc.DisplayHint, s)
+		} else if n, ok := new(big.Int).SetString(s, 10); ok {
+			i = n
+		} else {
+			err = fmt.Errorf("%w: %q is not a number", BadTextValue, s)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return integerLeaf(tc.Type, i)
+
+	case AsnObjectIdentifier:
+		oid, err := NewOIDFromString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", BadTextValue, err)
+		}
+		return NewSMILeaf(tc.Type, oid), nil
+
+	case AsnIpAddress:
+		if ip := net.ParseIP(s).To4(); ip != nil {
+			return NewSMILeaf(tc.Type, ip), nil
+		}
+		return nil, fmt.Errorf("%w: bad IP address %q", BadTextValue, s)
+	}
+
+	return nil, fmt.Errorf("%w: %s values cannot be parsed", BadTextValue, tc.Type.PrettyString())
+}
+
+// parseEnum reads an enumeration as name(number), name or number.
+func (tc *TextualConvention) parseEnum(s string) (*big.Int, error) {
+	if open := strings.IndexByte(s, '('); open > 0 && strings.HasSuffix(s, ")") {
+		s = s[:open]
+	}
+
+	for value, name := range tc.Enums {
+		if name == s {
+			return big.NewInt(value), nil
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if _, ok := tc.Enums[n]; ok {
+			return big.NewInt(n), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q is not a value of %s", BadTextValue, s, tc.Name)
+}
+
+// integerLeaf makes a leaf of an integer type, checking its range.
+func integerLeaf(t AsnType, i *big.Int) (*SMILeaf, error) {
+	var value interface{}
+
+	switch {
+	case t == AsnInteger && i.IsInt64():
+		value = int(i.Int64())
+	case t == AsnCounter64 && i.IsUint64():
+		value = i.Uint64()
+	case t != AsnInteger && t != AsnCounter64 && i.IsUint64() && i.Uint64() <= 0xffffffff:
+		value = uint32(i.Uint64())
+	}
+
+	if _, err := berValue(t, value); value == nil || err != nil {
+		return nil, fmt.Errorf("%w: %s is out of range for %s", BadTextValue, i, t.PrettyString())
+	}
+	return NewSMILeaf(t, value), nil
+}
+
+// FormatLeaf() renders a value as its base type is usually shown: printable
+// OCTET STRINGs as text and others as hex, IpAddresses in dotted decimal,
+// and numbers and OIDs as they are.
+func FormatLeaf(leaf *SMILeaf) string {
+	switch leaf.asnType {
+	case AsnOctetString, AsnOpaque:
+		if b := leafBytes(leaf); isPrintable(b) {
+			return string(b)
+		} else {
+			return hexBytes(b, " ")
+		}
+	case AsnIpAddress:
+		if ip, ok := leaf.value.(net.IP); ok {
+			return ip.String()
+		} else if b, ok := leaf.value.([]byte); ok && len(b) == 4 {
+			return net.IP(b).String()
+		}
+	case AsnNull:
+		return "NULL"
+	}
+	return fmt.Sprint(leaf.value)
+}
+
+func hexBytes(b []byte, separator string) string {
+	var parts = make([]string, len(b))
+	for i, c := range b {
+		parts[i] = hex.EncodeToString([]byte{c})
+	}
+	return strings.Join(parts, separator)
+}
+
+// octetHintSpec is one part of an OCTET STRING display hint
+type octetHintSpec struct {
+	// star means the first octet of each use of the spec is a repeat count
+	star   bool
+	length int
+	// format is one of d, x, o, a or t
+	format byte
+	// separator and terminator are 0 if there are none
+	separator, terminator byte
+}
+
+// parseOctetDisplayHint splits an OCTET STRING display hint into its specs.
+func parseOctetDisplayHint(hint string) ([]octetHintSpec, error) {
+	var specs []octetHintSpec
+
+	isDelimiter := func(i int) bool {
+		return i < len(hint) && hint[i] != '*' && (hint[i] < '0' || hint[i] > '9')
+	}
+
+	for i := 0; i < len(hint); {
+		var spec octetHintSpec
+
+		if hint[i] == '*' {
+			spec.star = true
+			i += 1
+		}
+
+		start := i
+		for i < len(hint) && hint[i] >= '0' && hint[i] <= '9' {
+			i += 1
+		}
+		if i == start || i == len(hint) || !strings.ContainsRune("dxoat", rune(hint[i])) {
+			return nil, fmt.Errorf("%w %q", BadDisplayHint, hint)
+		}
+		spec.length, _ = strconv.Atoi(hint[start:i])
+		spec.format = hint[i]
+		i += 1
+
+		if isDelimiter(i) {
+			spec.separator = hint[i]
+			i += 1
+		}
+		if spec.star && isDelimiter(i) {
+			spec.terminator = hint[i]
+			i += 1
+		}
+
+		if spec.length == 0 {
+			return nil, fmt.Errorf("%w %q", BadDisplayHint, hint)
+		}
+		specs = append(specs, spec)
+	}
+
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("%w %q", BadDisplayHint, hint)
+	}
+	return specs, nil
+}
+
+// formatOctetHint renders an OCTET STRING with a display hint. The last spec
+// of the hint is used again until the value runs out.
+func formatOctetHint(hint string, b []byte) (string, error) {
+	specs, err := parseOctetDisplayHint(hint)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for i := 0; len(b) > 0; i += 1 {
+		spec := specs[len(specs)-1]
+		if i < len(specs) {
+			spec = specs[i]
+		}
+
+		repeat := 1
+		if spec.star {
+			repeat, b = int(b[0]), b[1:]
+		}
+
+		for r := 0; r < repeat && len(b) > 0; r += 1 {
+			n := spec.length
+			if n > len(b) {
+				n = len(b)
+			}
+			chunk := b[:n]
+			b = b[n:]
+
+			switch spec.format {
+			case 'a', 't':
+				if spec.format == 't' && !utf8.Valid(chunk) {
+					return "", fmt.Errorf("%w: bad UTF-8 for %q", BadTextValue, hint)
+				}
+				sb.Write(chunk)
+			case 'x':
+				sb.WriteString(hex.EncodeToString(chunk))
+			default:
+				base := 10
+				if spec.format == 'o' {
+					base = 8
+				}
+				sb.WriteString(new(big.Int).SetBytes(chunk).Text(base))
+			}
+
+			last := r == repeat-1 && spec.terminator != 0
+			if spec.separator != 0 && len(b) > 0 && !last {
+				sb.WriteByte(spec.separator)
+			}
+		}
+
+		if spec.terminator != 0 && len(b) > 0 {
+			sb.WriteByte(spec.terminator)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// parseOctetHint reads an OCTET STRING written with a display hint.
+func parseOctetHint(hint string, s string) ([]byte, error) {
+	specs, err := parseOctetDisplayHint(hint)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	for i := 0; len(s) > 0; i += 1 {
+		spec := specs[len(specs)-1]
+		if i < len(specs) {
+			spec = specs[i]
+		}
+
+		// Repeated items end at the terminator, or the end of the value
+		var (
+			count     int
+			countAt   = len(b)
+			remaining = 1
+		)
+		if spec.star {
+			b = append(b, 0)
+			remaining = 255
+		}
+
+		for ; remaining > 0 && len(s) > 0; remaining -= 1 {
+			var item []byte
+			if item, s, err = parseOctetHintItem(spec, s); err != nil {
+				return nil, fmt.Errorf("%w: %q does not match %q: %s", BadTextValue, s, hint, err)
+			}
+			b = append(b, item...)
+			count += 1
+
+			if spec.terminator != 0 && len(s) > 0 && s[0] == spec.terminator {
+				s = s[1:]
+				break
+			} else if spec.separator != 0 && len(s) > 0 && s[0] == spec.separator {
+				s = s[1:]
+			}
+		}
+
+		if spec.star {
+			b[countAt] = byte(count)
+		}
+	}
+
+	return b, nil
+}
+
+// parseOctetHintItem reads one use of a spec from the start of s, returning
+// its octets and the rest of s.
+func parseOctetHintItem(spec octetHintSpec, s string) ([]byte, string, error) {
+	var end int
+
+	switch spec.format {
+	case 'a', 't':
+		// Text runs until the separator or terminator, or the length
+		for end < len(s) && end < spec.length && s[end] != spec.separator && s[end] != spec.terminator {
+			end += 1
+		}
+		if end == 0 {
+			end = 1
+		}
+		return []byte(s[:end]), s[end:], nil
+	}
+
+	base, digits := 10, "0123456789"
+	switch spec.format {
+	case 'x':
+		base, digits = 16, "0123456789abcdefABCDEF"
+	case 'o':
+		base, digits = 8, "01234567"
+	}
+
+	for end < len(s) && strings.IndexByte(digits, s[end]) >= 0 {
+		end += 1
+		// Without a separator, hex takes just as many digits as its length
+		if spec.format == 'x' && spec.separator == 0 && spec.terminator == 0 && end == 2*spec.length {
+			break
+		}
+	}
+
+	n, ok := new(big.Int).SetString(s[:end], base)
+	if end == 0 || !ok {
+		return nil, s, fmt.Errorf("expected a number")
+	} else if n.BitLen() > 8*spec.length {
+		return nil, s, fmt.Errorf("%s does not fit in %d octets", s[:end], spec.length)
+	}
+
+	item := make([]byte, spec.length)
+	n.FillBytes(item)
+	return item, s[end:], nil
+}
+
+// parseIntegerDisplayHint splits an INTEGER display hint into its format,
+// and for d the number of decimal places.
+func parseIntegerDisplayHint(hint string) (byte, int, error) {
+	if len(hint) == 0 || !strings.ContainsRune("dxob", rune(hint[0])) {
+		return 0, 0, fmt.Errorf("%w %q", BadDisplayHint, hint)
+	} else if len(hint) == 1 {
+		return hint[0], 0, nil
+	}
+
+	places, err := strconv.Atoi(strings.TrimPrefix(hint[1:], "-"))
+	if hint[0] != 'd' || hint[1] != '-' || err != nil || places < 0 {
+		return 0, 0, fmt.Errorf("%w %q", BadDisplayHint, hint)
+	}
+	return 'd', places, nil
+}
+
+// formatIntegerHint renders a number with a display hint.
+func formatIntegerHint(hint string, i *big.Int) (string, error) {
+	format, places, err := parseIntegerDisplayHint(hint)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case 'x':
+		return i.Text(16), nil
+	case 'o':
+		return i.Text(8), nil
+	case 'b':
+		return i.Text(2), nil
+	}
+
+	s, sign := new(big.Int).Abs(i).String(), ""
+	if i.Sign() < 0 {
+		sign = "-"
+	}
+	if places > 0 {
+		if len(s) <= places {
+			s = strings.Repeat("0", places-len(s)+1) + s
+		}
+		s = s[:len(s)-places] + "." + s[len(s)-places:]
+	}
+	return sign + s, nil
+}
+
+// parseIntegerHint reads a number written with a display hint.
+func parseIntegerHint(hint string, s string) (*big.Int, error) {
+	format, places, err := parseIntegerDisplayHint(hint)
+	if err != nil {
+		return nil, err
+	}
+
+	base := map[byte]int{'d': 10, 'x': 16, 'o': 8, 'b': 2}[format]
+	if places > 0 {
+		parts := append(strings.SplitN(s, ".", 2), "")
+		whole, fraction := parts[0], parts[1]
+		if len(fraction) > places {
+			return nil, fmt.Errorf("%w: %q has more than %d decimal places", BadTextValue, s, places)
+		}
+		s = whole + fraction + strings.Repeat("0", places-len(fraction))
+	}
+
+	i, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q does not match %q", BadTextValue, s, hint)
+	}
+	return i, nil
+}
+
+// formatInetAddress renders an InetAddress by its length, as its
+// InetAddressType is not at hand.
+func formatInetAddress(b []byte) (string, error) {
+	switch len(b) {
+	case 4:
+		return net.IP(b).String(), nil
+	case 8:
+		return formatOctetHint("1d.1d.1d.1d%4d", b)
+	case 16:
+		return net.IP(b).String(), nil
+	case 20:
+		zone, _ := formatOctetHint("4d", b[16:])
+		return net.IP(b[:16]).String() + "%" + zone, nil
+	}
+	return string(b), nil
+}
+
+// parseInetAddress reads an IPv4 or IPv6 address with an optional numeric
+// zone, or a DNS name.
+func parseInetAddress(s string) ([]byte, error) {
+	var (
+		parts = strings.SplitN(s, "%", 2)
+		ip    = net.ParseIP(parts[0])
+	)
+
+	if ip == nil {
+		return []byte(s), nil
+	}
+
+	b := []byte(ip.To16())
+	if ip4 := ip.To4(); ip4 != nil {
+		b = []byte(ip4)
+	}
+	if len(parts) == 2 {
+		z, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad zone %q", BadTextValue, parts[1])
+		}
+		b = append(b, byte(z>>24), byte(z>>16), byte(z>>8), byte(z))
+	}
+	return b, nil
+}
@@ -0,0 +1,125 @@
+package snmptools
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTextualConventionFormat(t *testing.T) {
+	var tc = func(name string) *TextualConvention { return TextualConventions[name] }
+
+	tests := []struct {
+		tc       *TextualConvention
+		leaf     *SMILeaf
+		expected string
+	}{
+		{tc("DisplayString"), NewSMILeaf(AsnOctetString, "eth0"), "eth0"},
+		{tc("MacAddress"), NewSMILeaf(AsnOctetString, []byte{0, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}), "00:1a:2b:3c:4d:5e"},
+		{tc("DateAndTime"), NewSMILeaf(AsnOctetString, []byte{0x07, 0xe4, 1, 2, 3, 4, 5, 6, '+', 10, 0}), "2020-1-2,3:4:5.6,+10:0"},
+		{tc("DateAndTime"), NewSMILeaf(AsnOctetString, []byte{0x07, 0xe4, 1, 2, 3, 4, 5, 6}), "2020-1-2,3:4:5.6"},
+		{tc("TruthValue"), NewSMILeaf(AsnInteger, 2), "false(2)"},
+		{tc("RowStatus"), NewSMILeaf(AsnInteger, 1), "active(1)"},
+		{tc("InetAddress"), NewSMILeaf(AsnOctetString, []byte{192, 0, 2, 1}), "192.0.2.1"},
+		{tc("InetAddress"), NewSMILeaf(AsnOctetString, []byte{0x20, 1, 0xd, 0xb8, 15: 1}), "2001:db8::1"},
+		{tc("InetAddress"), NewSMILeaf(AsnOctetString, []byte{0xfe, 0x80, 15: 1, 19: 3}), "fe80::1%3"},
+		{tc("InetAddress"), NewSMILeaf(AsnOctetString, "example.com"), "example.com"},
+		{tc("InetAddressIPv4z"), NewSMILeaf(AsnOctetString, []byte{10, 0, 0, 1, 0, 0, 0, 2}), "10.0.0.1%2"},
+		{tc("InetAddressIPv6"), NewSMILeaf(AsnOctetString, []byte{0x20, 1, 0xd, 0xb8, 15: 1}), "2001:0db8:0000:0000:0000:0000:0000:0001"},
+		{tc("InetPortNumber"), NewSMILeaf(AsnUinteger32, uint32(161)), "161"},
+		{tc("TimeStamp"), NewSMILeaf(AsnTimeTicks, uint32(100)), "100"},
+		{tc("RowPointer"), NewSMILeaf(AsnObjectIdentifier, NewOID(1, 3, 6)), ".1.3.6"},
+		{&TextualConvention{Name: "Celsius", Type: AsnInteger, DisplayHint: "d-2"}, NewSMILeaf(AsnInteger, -1205), "-12.05"},
+		{&TextualConvention{Name: "Small", Type: AsnInteger, DisplayHint: "d-3"}, NewSMILeaf(AsnInteger, 5), "0.005"},
+		{&TextualConvention{Name: "Flags", Type: AsnInteger, DisplayHint: "x"}, NewSMILeaf(AsnInteger, 255), "ff"},
+		{&TextualConvention{Name: "List", Type: AsnOctetString, DisplayHint: "*1d,/"}, NewSMILeaf(AsnOctetString, []byte{3, 1, 2, 3, 2, 4, 5}), "1,2,3/4,5"},
+	}
+
+	for _, test := range tests {
+		if s, err := test.tc.Format(test.leaf); err != nil {
+			t.Errorf("%s: unexpected error %s", test.tc.Name, err)
+		} else if s != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.tc.Name, test.expected, s)
+		}
+
+		// Every value read back as it was written
+		if leaf, err := test.tc.Parse(test.expected); err != nil {
+			t.Errorf("%s: unexpected error parsing %q: %s", test.tc.Name, test.expected, err)
+		} else if s, _ := test.tc.Format(leaf); s != test.expected {
+			t.Errorf("%s: %q was parsed as %s", test.tc.Name, test.expected, leaf)
+		}
+	}
+}
+
+func TestTextualConventionParse(t *testing.T) {
+	var tc = func(name string) *TextualConvention { return TextualConventions[name] }
+
+	tests := []struct {
+		tc       *TextualConvention
+		s        string
+		expected *SMILeaf
+	}{
+		{tc("RowStatus"), "createAndGo", NewSMILeaf(AsnInteger, 4)},
+		{tc("RowStatus"), "6", NewSMILeaf(AsnInteger, 6)},
+		{tc("MacAddress"), "0:1a:2b:3c:4d:5e", NewSMILeaf(AsnOctetString, []byte{0, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e})},
+		{tc("InetAddress"), "fe80::1%3", NewSMILeaf(AsnOctetString, []byte{0xfe, 0x80, 15: 1, 19: 3})},
+		{&TextualConvention{Name: "Celsius", Type: AsnInteger, DisplayHint: "d-2"}, "21.5", NewSMILeaf(AsnInteger, 2150)},
+		{&TextualConvention{Name: "Hex", Type: AsnOctetString, DisplayHint: "1x"}, "0a0b", NewSMILeaf(AsnOctetString, []byte{10, 11})},
+	}
+
+	for _, test := range tests {
+		leaf, err := test.tc.Parse(test.s)
+		if err != nil {
+			t.Errorf("%s: unexpected error parsing %q: %s", test.tc.Name, test.s, err)
+		} else if leaf.Type() != test.expected.Type() {
+			t.Errorf("%s: expected %s, got %s", test.tc.Name, test.expected, leaf)
+		} else if b, ok := leaf.Value().([]byte); ok && !bytes.Equal(b, test.expected.Value().([]byte)) {
+			t.Errorf("%s: expected %s, got %s", test.tc.Name, test.expected, leaf)
+		} else if !ok && leaf.Value() != test.expected.Value() {
+			t.Errorf("%s: expected %s, got %s", test.tc.Name, test.expected, leaf)
+		}
+	}
+
+	bad := []struct {
+		tc *TextualConvention
+		s  string
+	}{
+		{tc("RowStatus"), "running"},
+		{tc("TruthValue"), "3"},
+		{tc("MacAddress"), "00:zz"},
+		{tc("MacAddress"), "100:00"},
+		{tc("InetPortNumber"), "-1"},
+		{&TextualConvention{Name: "Celsius", Type: AsnInteger, DisplayHint: "d-2"}, "21.555"},
+		{&TextualConvention{Name: "Broken", Type: AsnOctetString, DisplayHint: "1q"}, "x"},
+	}
+
+	for _, test := range bad {
+		if leaf, err := test.tc.Parse(test.s); err == nil {
+			t.Errorf("%s: expected an error parsing %q, got %s", test.tc.Name, test.s, leaf)
+		}
+	}
+}
+
+func TestMIBFormatLeaf(t *testing.T) {
+	var (
+		O   = NewOID
+		mib = NewMIB()
+	)
+
+	mib.Define(O(1, 1), ObjectInfo{Name: "ifPhysAddress", Syntax: TextualConventions["PhysAddress"]})
+	mib.Define(O(1, 2), ObjectInfo{Name: "ifDescr"})
+
+	if s := mib.FormatLeaf(O(1, 1, 7), NewSMILeaf(AsnOctetString, []byte{1, 2})); s != "01:02" {
+		t.Errorf("Expected 01:02, got %q", s)
+	} else if s := mib.FormatLeaf(O(1, 2, 7), NewSMILeaf(AsnOctetString, []byte{1, 2})); s != "01 02" {
+		t.Errorf("Expected 01 02, got %q", s)
+	} else if s := mib.FormatLeaf(O(1, 1, 7), NewSMILeaf(AsnInteger, 5)); s != "5" {
+		t.Errorf("Expected a mismatched value as it is, got %q", s)
+	}
+
+	if leaf, err := mib.ParseLeaf(O(1, 1, 7), "0a:0b"); err != nil || !bytes.Equal(leaf.Value().([]byte), []byte{10, 11}) {
+		t.Errorf("Bad parse: %v %v", leaf, err)
+	} else if _, err := mib.ParseLeaf(O(1, 2, 7), "x"); !errors.Is(err, UnknownSyntax) {
+		t.Errorf("Expected UnknownSyntax, got %v", err)
+	}
+}
@@ -0,0 +1,399 @@
+package snmptools
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SMITransactional is implemented by writable nodes that take part in SET
+// transactions, so that the varbinds of a SET request are applied all or
+// nothing. The phases follow those of net-snmp and AgentX:
+//
+//  1. TestSet() is called for every varbind of the request. It checks that
+//     the value could be set, without changing anything.
+//  2. If every test passes, Set() applies each value in turn, leaving those
+//     of SMILateSetters until last.
+//  3. If a Set() fails, UndoSet() is called for each value already applied,
+//     most recent first.
+//  4. CleanupSet() is called for every varbind tested, whatever the outcome,
+//     to release anything held by the earlier phases.
+//
+// All OIDs are relative to the node, as for Set(). Returning an ErrorStatus
+// from any phase reports it to the manager.
+type SMITransactional interface {
+	SMIWritable
+
+	TestSet(oid OID, leaf *SMILeaf) error
+	UndoSet(oid OID) error
+	CleanupSet(oid OID)
+}
+
+// SMILateSetter is implemented by SMITransactional nodes with values that
+// must be set after every other value of a transaction, such as the RowStatus
+// column of a RowStatusTable, which checks that the row it activates has all
+// of its values. SetLate() says whether the value at oid is one of them.
+type SMILateSetter interface {
+	SMITransactional
+
+	SetLate(oid OID) bool
+}
+
+// setTransactions serialises SET transactions, so that each one sees the
+// values left by the last
+var setTransactions sync.Mutex
+
+// setTarget is one varbind of a SetTransaction, and the node handling it
+type setTarget struct {
+	node SMIWritable
+	// oid is relative to node
+	oid  OID
+	leaf *SMILeaf
+	// previous is the value before the set, to undo the changes of nodes
+	// that are not SMITransactional
+	previous *SMILeaf
+}
+
+// SetTransaction applies the varbinds of a SET request to an SMI tree, all or
+// nothing. Each varbind is handled by the first SMIWritable node on the way
+// down to its OID, as with SetLeaf().
+//
+// Nodes that are SMITransactional take part in every phase. Other writable
+// nodes are not tested, and are undone by setting the value they held
+// before; if they held none, undoing them fails with UndoFailed.
+//
+// Apply() runs every phase, and is what agents use. The phases are also
+// available one at a time, for protocols such as SMUX or AgentX in which the
+// master agent drives them.
+type SetTransaction struct {
+	tree    SMINode
+	targets []setTarget
+	// order is the order in which the targets are set
+	order []int
+	// tested and committed count the targets that have been through each
+	// phase, tested including one whose test failed
+	tested, committed int
+	// passed says whether every target passed Test()
+	passed bool
+}
+
+// NewSetTransaction() creates a transaction setting each varbind, whose OIDs
+// are relative to tree.
+func NewSetTransaction(tree SMINode, vbs []VarBind) *SetTransaction {
+	tx := &SetTransaction{tree: tree, targets: make([]setTarget, len(vbs))}
+	for i, vb := range vbs {
+		tx.targets[i] = setTarget{oid: vb.OID, leaf: &SMILeaf{vb.Type, vb.Value}}
+	}
+	return tx
+}
+
+// Apply() runs the transaction, returning NoError if every value was set.
+// Otherwise it returns the error status and the 1-based index of the varbind
+// that caused it, having undone any values it set.
+func (tx *SetTransaction) Apply() (ErrorStatus, int) {
+	setTransactions.Lock()
+	defer setTransactions.Unlock()
+	defer tx.Cleanup()
+
+	if status, index := tx.Test(); status != NoError {
+		return status, index
+	}
+
+	if status, index := tx.Commit(); status != NoError {
+		if undoStatus, undoIndex := tx.Undo(); undoStatus != NoError {
+			return undoStatus, undoIndex
+		}
+		return status, index
+	}
+
+	return NoError, 0
+}
+
+// begin() tests the transaction and leaves it open, for peers whose master
+// agent commits or rolls it back later with finish(). A transaction that
+// fails its test is cleaned up at once.
+func (tx *SetTransaction) begin() (ErrorStatus, int) {
+	setTransactions.Lock()
+	defer setTransactions.Unlock()
+
+	status, index := tx.Test()
+	if status != NoError {
+		tx.Cleanup()
+	}
+	return status, index
+}
+
+// finish() commits a transaction opened by begin(), undoing it if that fails,
+// or only cleans it up if it is not to be committed.
+func (tx *SetTransaction) finish(commit bool) (ErrorStatus, int) {
+	setTransactions.Lock()
+	defer setTransactions.Unlock()
+	defer tx.Cleanup()
+
+	if !commit {
+		return NoError, 0
+	}
+
+	if status, index := tx.Commit(); status != NoError {
+		if undoStatus, undoIndex := tx.Undo(); undoStatus != NoError {
+			return undoStatus, undoIndex
+		}
+		return status, index
+	}
+	return NoError, 0
+}
+
+// Test() finds the node that handles each varbind, and tests the varbinds
+// of SMITransactional nodes.
+func (tx *SetTransaction) Test() (ErrorStatus, int) {
+	tx.passed = false
+
+	for i := range tx.targets {
+		target := &tx.targets[i]
+
+		node, oid, err := writableNode(tx.tree, target.oid)
+		if err == nil {
+			// The node is cleaned up even if its test fails
+			target.node, target.oid = node, oid
+			tx.tested = i + 1
+			if t, ok := node.(SMITransactional); ok {
+				err = t.TestSet(oid, target.leaf)
+			}
+		}
+		if err != nil {
+			return errorStatus(err, target.oid, GenErr), i + 1
+		}
+	}
+
+	tx.passed = true
+	return NoError, 0
+}
+
+// Commit() sets each value in turn, stopping at the first failure. Values
+// that their nodes ask to set late are set after all the others. Test() must
+// have succeeded first.
+func (tx *SetTransaction) Commit() (ErrorStatus, int) {
+	if !tx.passed {
+		return GenErr, 0
+	}
+
+	tx.order = tx.order[:0]
+	for _, late := range []bool{false, true} {
+		for i, target := range tx.targets {
+			if setLate(target) == late {
+				tx.order = append(tx.order, i)
+			}
+		}
+	}
+
+	for n, i := range tx.order {
+		target := &tx.targets[i]
+
+		if _, ok := target.node.(SMITransactional); !ok {
+			if len(target.oid) == 0 {
+				target.previous = target.node.Value()
+			} else if leaf := GetLeaf(target.node, target.oid); leaf != nil && leaf.Children() == nil {
+				target.previous = leaf.Value()
+			}
+		}
+
+		if err := target.node.Set(target.oid, target.leaf); err != nil {
+			return errorStatus(err, target.oid, CommitFailed), i + 1
+		}
+		tx.committed = n + 1
+	}
+
+	return NoError, 0
+}
+
+// Undo() reverts the values set by Commit(), most recent first. It returns
+// UndoFailed, or another error status, if any could not be reverted.
+func (tx *SetTransaction) Undo() (ErrorStatus, int) {
+	var (
+		status = NoError
+		index  int
+	)
+
+	for n := tx.committed - 1; n >= 0; n -= 1 {
+		var (
+			i      = tx.order[n]
+			target = &tx.targets[i]
+			err    error
+		)
+
+		if t, ok := target.node.(SMITransactional); ok {
+			err = t.UndoSet(target.oid)
+		} else if target.previous != nil {
+			err = target.node.Set(target.oid, target.previous)
+		} else {
+			err = UndoFailed
+		}
+
+		if err != nil && status == NoError {
+			status, index = errorStatus(err, target.oid, UndoFailed), i+1
+		}
+	}
+
+	tx.committed = 0
+	return status, index
+}
+
+// Cleanup() ends the transaction, telling every SMITransactional node that
+// was tested.
+func (tx *SetTransaction) Cleanup() {
+	for i := 0; i < tx.tested; i += 1 {
+		if t, ok := tx.targets[i].node.(SMITransactional); ok {
+			t.CleanupSet(tx.targets[i].oid)
+		}
+	}
+	tx.tested, tx.passed = 0, false
+}
+
+// setLate says whether a target is set after the others.
+func setLate(target setTarget) bool {
+	l, ok := target.node.(SMILateSetter)
+	return ok && l.SetLate(target.oid)
+}
+
+// errorStatus turns an error from a node into the error status to report.
+func errorStatus(err error, oid OID, otherwise ErrorStatus) ErrorStatus {
+	if status, ok := err.(ErrorStatus); ok {
+		return status
+	}
+	logger.Debug(fmt.Sprintf("Failed to set %s: %s", oid, err))
+	return otherwise
+}
+
+// writableNode finds the node that handles a write to oid, relative to node,
+// and returns it with the rest of oid.
+func writableNode(node SMINode, oid OID) (SMIWritable, OID, error) {
+	for i := 0; ; i += 1 {
+		if node == nil {
+			return nil, nil, NoCreation
+		} else if w, ok := node.(SMIWritable); ok {
+			return w, oid[i:], nil
+		} else if i == len(oid) {
+			return nil, nil, NotWritable
+		}
+
+		node = GetLeaf(node, oid[i:i+1])
+	}
+}
+
+// TransactionalLeaf is a writable leaf whose changes are checked and made to
+// take effect by the application, for use in SET transactions.
+type TransactionalLeaf struct {
+	// Validate, if set, checks a new value. The value's type has already
+	// been checked against the current one.
+	Validate func(leaf *SMILeaf) error
+	// Apply, if set, makes a new value take effect in the application
+	Apply func(leaf *SMILeaf) error
+	// Rollback, if set, reverses Apply when a later value of the same
+	// transaction fails. If it is not set, Apply is called with the previous
+	// value instead.
+	Rollback func(previous *SMILeaf) error
+
+	mu   sync.Mutex
+	leaf *SMILeaf
+	// previous holds the values replaced during a transaction, which is
+	// open from the first TestSet() until CleanupSet()
+	previous    []*SMILeaf
+	transaction bool
+}
+
+// NewTransactionalLeaf() creates a TransactionalLeaf with an initial value,
+// which fixes its type.
+func NewTransactionalLeaf(leaf *SMILeaf) *TransactionalLeaf {
+	return &TransactionalLeaf{leaf: leaf}
+}
+
+func (l *TransactionalLeaf) Children() []SMINode {
+	return nil
+}
+
+func (l *TransactionalLeaf) Value() *SMILeaf {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.leaf
+}
+
+func (l *TransactionalLeaf) TestSet(oid OID, leaf *SMILeaf) error {
+	l.mu.Lock()
+	l.transaction = true
+	l.mu.Unlock()
+
+	return l.test(oid, leaf)
+}
+
+func (l *TransactionalLeaf) test(oid OID, leaf *SMILeaf) error {
+	l.mu.Lock()
+	current := l.leaf
+	l.mu.Unlock()
+
+	if len(oid) != 0 {
+		return NoCreation
+	} else if leaf.asnType != current.asnType {
+		return WrongType
+	} else if _, err := berValue(leaf.asnType, leaf.value); err != nil {
+		return WrongValue
+	} else if l.Validate != nil {
+		return l.Validate(leaf)
+	}
+	return nil
+}
+
+// Set() applies a new value, which is tested first.
+func (l *TransactionalLeaf) Set(oid OID, leaf *SMILeaf) error {
+	if err := l.test(oid, leaf); err != nil {
+		return err
+	}
+
+	if l.Apply != nil {
+		if err := l.Apply(leaf); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.transaction {
+		l.previous = append(l.previous, l.leaf)
+	}
+	l.leaf = leaf
+	return nil
+}
+
+func (l *TransactionalLeaf) UndoSet(oid OID) error {
+	l.mu.Lock()
+	if len(l.previous) == 0 {
+		l.mu.Unlock()
+		return UndoFailed
+	}
+	previous := l.previous[len(l.previous)-1]
+	l.mu.Unlock()
+
+	var err error
+	if l.Rollback != nil {
+		err = l.Rollback(previous)
+	} else if l.Apply != nil {
+		err = l.Apply(previous)
+	}
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.leaf = previous
+	l.previous = l.previous[:len(l.previous)-1]
+	return nil
+}
+
+func (l *TransactionalLeaf) CleanupSet(oid OID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.previous, l.transaction = nil, false
+}
@@ -0,0 +1,161 @@
+package snmptools
+
+import (
+	"errors"
+	"testing"
+)
+
+// Test that a failing varbind undoes the values set before it
+func TestSetTransaction(t *testing.T) {
+	var (
+		O       = NewOID
+		applied []interface{}
+		refuse  bool
+		leaf    = NewTransactionalLeaf(NewSMILeaf(AsnInteger, 1))
+		plain   = &writableLeaf{NewSMILeaf(AsnInteger, 0)}
+		empty   = &writableLeaf{}
+		table   = newJobTable(func(change RowChange) error {
+			applied = append(applied, change.Event)
+			return nil
+		})
+		tree = NewSMISubtree(NewSMISubtree(leaf, plain, empty), table)
+	)
+
+	leaf.Validate = func(l *SMILeaf) error {
+		if i, _ := toInt64(l.Value()); i < 0 {
+			return WrongValue
+		}
+		return nil
+	}
+	leaf.Apply = func(l *SMILeaf) error {
+		if refuse {
+			return errors.New("refused")
+		}
+		applied = append(applied, l.Value())
+		return nil
+	}
+
+	type transactionTest struct {
+		vbs    []VarBind
+		status ErrorStatus
+		index  int
+	}
+
+	tests := []transactionTest{
+		// Tests fail before anything is set
+		{[]VarBind{{O(1, 2), AsnInteger, 5}, {O(1, 1), AsnInteger, -1}}, WrongValue, 2},
+		{[]VarBind{{O(1, 1), AsnInteger, 2}, {O(1, 1), AsnOctetString, "x"}}, WrongType, 2},
+		{[]VarBind{{O(1, 1), AsnInteger, 2}, {O(3), AsnInteger, 1}}, NoCreation, 2},
+		{[]VarBind{{O(2, 1, 2, 1), AsnInteger, 1}}, WrongType, 1},
+
+		// A row's values can only be set in the transaction creating it
+		{[]VarBind{{O(1, 1), AsnInteger, 2}, {O(2, 1, 2, 1), AsnOctetString, "job"}}, InconsistentName, 2},
+
+		// The row cannot be created, so the leaves are undone
+		{[]VarBind{{O(1, 1), AsnInteger, 2}, {O(1, 2), AsnInteger, 5}, {O(2, 1, 5, 1), AsnInteger, int(RowCreateAndGo)}}, InconsistentValue, 3},
+
+		// Everything is set
+		{[]VarBind{{O(1, 1), AsnInteger, 3}, {O(2, 1, 2, 1), AsnOctetString, "job"}, {O(2, 1, 5, 1), AsnInteger, int(RowCreateAndGo)}, {O(1, 2), AsnInteger, 6}}, NoError, 0},
+	}
+
+	for i, test := range tests {
+		if status, index := NewSetTransaction(tree, test.vbs).Apply(); status != test.status || index != test.index {
+			t.Errorf("%d: expected %s at %d, got %s at %d", i, test.status, test.index, status, index)
+		}
+	}
+
+	expected := []interface{}{2, 1, 2, 1, 3, RowActivated}
+	if len(applied) != len(expected) {
+		t.Fatalf("Expected %v to be applied, got %v", expected, applied)
+	}
+	for i := range expected {
+		if applied[i] != expected[i] {
+			t.Errorf("Expected %v to be applied, got %v", expected, applied)
+		}
+	}
+	if leaf.Value().Value() != 3 || plain.Value().Value() != 6 {
+		t.Errorf("Expected the last values, got %s and %s", leaf.Value(), plain.Value())
+	}
+
+	// Undoing an update of the row tells the application
+	applied, refuse = nil, true
+	status, index := NewSetTransaction(tree, []VarBind{
+		{O(2, 1, 3, 1), AsnInteger, 9},
+		{O(1, 1), AsnInteger, 5},
+	}).Apply()
+	if status != CommitFailed || index != 2 {
+		t.Errorf("Expected commitFailed at 2, got %s at %d", status, index)
+	}
+	if priority := GetLeaf(table, O(1, 3, 1)); priority == nil || priority.Value().Value() != 5 {
+		t.Errorf("Expected the row to be undone, got %v", priority)
+	}
+	if len(applied) != 2 || applied[0] != RowUpdated || applied[1] != RowUpdated {
+		t.Errorf("Expected the update and its undoing, got %v", applied)
+	}
+
+	// A plain writable leaf with no previous value cannot be undone
+	status, index = NewSetTransaction(tree, []VarBind{
+		{O(1, 3), AsnInteger, 1},
+		{O(1, 1), AsnInteger, 5},
+	}).Apply()
+	if status != UndoFailed || index != 1 {
+		t.Errorf("Expected undoFailed at 1, got %s at %d", status, index)
+	}
+}
+
+// Test the hooks of a TransactionalLeaf
+func TestTransactionalLeaf(t *testing.T) {
+	var (
+		leaf   = NewTransactionalLeaf(NewSMILeaf(AsnOctetString, "a"))
+		rolled []interface{}
+	)
+	leaf.Rollback = func(previous *SMILeaf) error {
+		rolled = append(rolled, previous.Value())
+		return nil
+	}
+
+	if err := leaf.TestSet(OID{}, NewSMILeaf(AsnInteger, 1)); err != WrongType {
+		t.Errorf("Expected wrongType, got %v", err)
+	} else if err := leaf.TestSet(NewOID(1), NewSMILeaf(AsnOctetString, "b")); err != NoCreation {
+		t.Errorf("Expected noCreation, got %v", err)
+	}
+
+	for _, value := range []string{"b", "c"} {
+		if err := leaf.TestSet(OID{}, NewSMILeaf(AsnOctetString, value)); err != nil {
+			t.Fatal(err)
+		} else if err := leaf.Set(OID{}, NewSMILeaf(AsnOctetString, value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []string{"b", "a"} {
+		if err := leaf.UndoSet(OID{}); err != nil {
+			t.Fatal(err)
+		} else if v := leaf.Value().Value(); v != expected {
+			t.Errorf("Expected %q after undoing, got %v", expected, v)
+		}
+	}
+	if err := leaf.UndoSet(OID{}); err != UndoFailed {
+		t.Errorf("Expected undoFailed with nothing to undo, got %v", err)
+	}
+	if len(rolled) != 2 || rolled[0] != "b" || rolled[1] != "a" {
+		t.Errorf("Expected rollbacks to b and a, got %v", rolled)
+	}
+
+	// Outside a transaction, nothing is kept to undo
+	leaf.CleanupSet(OID{})
+	leaf.Set(OID{}, NewSMILeaf(AsnOctetString, "d"))
+	if err := leaf.UndoSet(OID{}); err != UndoFailed {
+		t.Errorf("Expected undoFailed outside a transaction, got %v", err)
+	}
+
+	// A transaction whose test fails still ends, so later sets keep nothing
+	tree := NewSMISubtree(leaf)
+	if status, index := NewSetTransaction(tree, []VarBind{{NewOID(1), AsnInteger, 1}}).Apply(); status != WrongType || index != 1 {
+		t.Errorf("Expected wrongType at 1, got %s at %d", status, index)
+	}
+	leaf.Set(OID{}, NewSMILeaf(AsnOctetString, "e"))
+	if err := leaf.UndoSet(OID{}); err != UndoFailed {
+		t.Errorf("Expected undoFailed after a failed transaction, got %v", err)
+	}
+}
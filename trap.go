@@ -0,0 +1,293 @@
+package snmptools
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// Notification errors
+	InformNotAcknowledged = fmt.Errorf("Inform was not acknowledged")
+	NotInView             = fmt.Errorf("Notification is not in the notify view")
+	NoEnterprise          = fmt.Errorf("Trap OID has no enterprise for an SNMPv1 trap")
+)
+
+// Well-known OIDs used in notifications
+var (
+	// sysUpTime.0, the first varbind of every SNMPv2 notification
+	SysUpTimeOID = OID{1, 3, 6, 1, 2, 1, 1, 3, 0}
+	// snmpTrapOID.0, the second varbind of every SNMPv2 notification
+	SnmpTrapOID = OID{1, 3, 6, 1, 6, 3, 1, 1, 4, 1, 0}
+	// snmpTrapEnterprise.0, used when translating notifications to SNMPv1
+	SnmpTrapEnterpriseOID = OID{1, 3, 6, 1, 6, 3, 1, 1, 4, 3, 0}
+	// snmpTraps, the parent of the generic traps coldStart ... egpNeighborLoss
+	SnmpTrapsOID = OID{1, 3, 6, 1, 6, 3, 1, 1, 5}
+)
+
+// TrapSender sends notifications - traps and informs - to one or more
+// receivers over UDP.
+type TrapSender struct {
+	// Version selects SNMPv1 Trap-PDUs or SNMPv2c SNMPv2-Trap-PDUs
+	Version   SNMPVersion
+	Community string
+	// Receivers are host:port addresses; the port defaults to 162
+	Receivers []string
+
+	// Timeout and Retries govern how long to wait for informs to be
+	// acknowledged. A zero Timeout is five seconds, and a TrapSender that was
+	// not made by NewTrapSender() also retries twice if Retries is zero.
+	Timeout time.Duration
+	Retries int
+
+	// AgentAddress is the agent-addr reported in SNMPv1 traps
+	AgentAddress net.IP
+
+	// Access, if set, restricts notifications to those whose trap OID and
+	// varbinds are all in the community's notify view
+	Access *VACM
+
+	// started is used to compute sysUpTime. A TrapSender that was not made by
+	// NewTrapSender() starts when it is first used.
+	started  time.Time
+	defaults sync.Once
+}
+
+// NewTrapSender() creates a TrapSender with a five second timeout and two
+// retries for informs.
+func NewTrapSender(version SNMPVersion, community string, receivers ...string) *TrapSender {
+	return &TrapSender{
+		Version:   version,
+		Community: community,
+		Receivers: receivers,
+		Timeout:   defaultTimeout,
+		Retries:   defaultRetries,
+		started:   time.Now(),
+	}
+}
+
+// setDefaults fills in the fields of a TrapSender that was not made by
+// NewTrapSender() the first time it is used.
+func (s *TrapSender) setDefaults() {
+	s.defaults.Do(func() {
+		if s.started.IsZero() {
+			s.started = time.Now()
+			if s.Retries == 0 {
+				s.Retries = defaultRetries
+			}
+		}
+	})
+}
+
+// timeout is how long to wait for an inform to be acknowledged.
+func (s *TrapSender) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return defaultTimeout
+	}
+	return s.Timeout
+}
+
+// Uptime() returns the time since the sender was created in TimeTicks
+// (hundredths of a second); it is reported as sysUpTime in notifications.
+func (s *TrapSender) Uptime() uint32 {
+	s.setDefaults()
+	return uint32(time.Since(s.started) / (10 * time.Millisecond))
+}
+
+// Trap() sends a notification identified by trapOID, with the given varbinds,
+// to every receiver. Delivery is not confirmed.
+//
+// For SNMPv1 the notification is translated to a Trap-PDU following RFC 3584
+// section 3.2; Counter64 varbinds are dropped since SNMPv1 cannot carry them.
+func (s *TrapSender) Trap(trapOID OID, varBinds ...VarBind) error {
+	var pdu *PDU
+
+	if !s.inView(trapOID, varBinds) {
+		return NotInView
+	}
+
+	if s.Version == Version1 {
+		var err error
+		if pdu, err = s.v1Trap(trapOID, varBinds); err != nil {
+			return err
+		}
+	} else {
+		pdu = s.v2Notification(AsnTrapV2, trapOID, varBinds)
+	}
+
+	b, err := (&Message{s.Version, s.Community, pdu}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	for _, receiver := range s.Receivers {
+		conn, err := net.Dial("udp", receiverAddress(receiver))
+		if err != nil {
+			return err
+		}
+		_, err = conn.Write(b)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Inform() sends an InformRequest identified by trapOID to every receiver, and
+// waits for each of them to acknowledge it, resending up to Retries times.
+//
+// Informs require SNMPv2c. The first receiver that fails to acknowledge the
+// inform causes an error to be returned, but every receiver is still tried.
+func (s *TrapSender) Inform(trapOID OID, varBinds ...VarBind) error {
+	var firstErr error
+
+	if s.Version == Version1 {
+		return fmt.Errorf("%w: informs cannot be sent with %s", UnsupportedVersion, s.Version)
+	} else if !s.inView(trapOID, varBinds) {
+		return NotInView
+	}
+
+	for _, receiver := range s.Receivers {
+		pdu := s.v2Notification(AsnInformRequest, trapOID, varBinds)
+		if err := s.inform(receiver, pdu); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", receiver, err)
+		}
+	}
+
+	return firstErr
+}
+
+func (s *TrapSender) inform(receiver string, pdu *PDU) error {
+	s.setDefaults()
+
+	b, err := (&Message{s.Version, s.Community, pdu}).Marshal()
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.Dial("udp", receiverAddress(receiver))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var buf = make([]byte, maxMessageSize)
+
+	for attempt := 0; attempt <= s.Retries; attempt += 1 {
+		if _, err = conn.Write(b); err != nil {
+			return err
+		}
+
+		deadline := time.Now().Add(s.timeout())
+		conn.SetReadDeadline(deadline)
+
+		for {
+			n, err := conn.Read(buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			} else if err != nil {
+				return err
+			}
+
+			// Ignore anything that isn't the acknowledgement we are after
+			if resp, err := UnmarshalMessage(buf[:n]); err != nil {
+				logger.Debug(fmt.Sprintf("Ignoring bad inform response from %s: %s", receiver, err))
+			} else if resp.PDU.Type == AsnGetResponse && resp.PDU.RequestID == pdu.RequestID {
+				return nil
+			}
+		}
+	}
+
+	return InformNotAcknowledged
+}
+
+// inView checks a notification against the notify view.
+func (s *TrapSender) inView(trapOID OID, varBinds []VarBind) bool {
+	if s.Access == nil {
+		return true
+	}
+
+	allowed, ok := s.Access.viewFunc(s.Version, s.Community, NoAuthNoPriv, NotifyView)
+	if !ok || !allowed(trapOID) {
+		return false
+	}
+	for _, vb := range varBinds {
+		if !allowed(vb.OID) {
+			return false
+		}
+	}
+	return true
+}
+
+// v2Notification builds an SNMPv2-Trap-PDU or InformRequest-PDU.
+func (s *TrapSender) v2Notification(typ AsnType, trapOID OID, varBinds []VarBind) *PDU {
+	vbs := make([]VarBind, 0, len(varBinds)+2)
+	vbs = append(vbs,
+		VarBind{SysUpTimeOID, AsnTimeTicks, s.Uptime()},
+		VarBind{SnmpTrapOID, AsnObjectIdentifier, trapOID},
+	)
+	vbs = append(vbs, varBinds...)
+
+	return &PDU{
+		Type:      typ,
+		RequestID: nextRequestID(),
+		VarBinds:  vbs,
+	}
+}
+
+// v1Trap builds an SNMPv1 Trap-PDU from an SNMPv2 notification OID, as
+// specified by RFC 3584 section 3.2. It fails if the trap OID is too short to
+// give an enterprise.
+func (s *TrapSender) v1Trap(trapOID OID, varBinds []VarBind) (*PDU, error) {
+	var pdu = &PDU{
+		Type:         AsnTrap,
+		AgentAddress: s.AgentAddress,
+		Timestamp:    s.Uptime(),
+	}
+
+	for _, vb := range varBinds {
+		if vb.OID.Equals(SnmpTrapEnterpriseOID) {
+			if o, ok := vb.Value.(OID); ok {
+				pdu.Enterprise = o
+			}
+		} else if vb.Type != AsnCounter64 {
+			pdu.VarBinds = append(pdu.VarBinds, vb)
+		}
+	}
+
+	if rem, err := trapOID.GetRemainder(SnmpTrapsOID); err == nil && len(rem) == 1 && rem[0] >= 1 && rem[0] <= 6 {
+		// One of the generic traps, coldStart(0) to egpNeighborLoss(5)
+		pdu.GenericTrap = int(rem[0]) - 1
+		if pdu.Enterprise == nil {
+			pdu.Enterprise = SnmpTrapsOID
+		}
+	} else {
+		// enterpriseSpecific(6): the enterprise is the trap OID without its
+		// last sub-identifier, and without a trailing zero
+		if len(trapOID) < 2 {
+			return nil, fmt.Errorf("%w: %s", NoEnterprise, trapOID)
+		}
+		pdu.GenericTrap = 6
+		pdu.SpecificTrap = int(trapOID[len(trapOID)-1])
+		pdu.Enterprise = trapOID[:len(trapOID)-1]
+		if pdu.Enterprise[len(pdu.Enterprise)-1] == 0 {
+			pdu.Enterprise = pdu.Enterprise[:len(pdu.Enterprise)-1]
+		}
+		if len(pdu.Enterprise) == 0 {
+			return nil, fmt.Errorf("%w: %s", NoEnterprise, trapOID)
+		}
+	}
+
+	return pdu, nil
+}
+
+// receiverAddress adds the standard trap port to an address lacking one.
+func receiverAddress(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, "162")
+	}
+	return addr
+}
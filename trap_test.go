@@ -0,0 +1,188 @@
+package snmptools
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// listenUDP starts a local UDP listener for tests
+func listenUDP(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readMessage reads and decodes one message from a listener
+func readMessage(t *testing.T, conn *net.UDPConn) (*Message, *net.UDPAddr) {
+	var buf = make([]byte, maxMessageSize)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, addr, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := UnmarshalMessage(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, addr
+}
+
+// Test sending an SNMPv2c trap
+func TestTrapV2(t *testing.T) {
+	var (
+		conn    = listenUDP(t)
+		sender  = NewTrapSender(Version2c, "public", conn.LocalAddr().String())
+		trapOID = NewOID(1, 3, 6, 1, 4, 1, 898889, 0, 1)
+		leafOID = NewOID(1, 3, 6, 1, 4, 1, 898889, 1, 1)
+	)
+
+	if err := sender.Trap(trapOID, NewVarBind(leafOID, NewSMILeaf(AsnOctetString, "queue full"))); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := readMessage(t, conn)
+	if m.Version != Version2c || m.Community != "public" || m.PDU.Type != AsnTrapV2 {
+		t.Fatalf("Bad trap: %#v", m)
+	}
+
+	vbs := m.PDU.VarBinds
+	if len(vbs) != 3 {
+		t.Fatalf("Expected 3 varbinds, got %v", vbs)
+	}
+	if !vbs[0].OID.Equals(SysUpTimeOID) || vbs[0].Type != AsnTimeTicks {
+		t.Errorf("First varbind should be sysUpTime, got %s", vbs[0])
+	}
+	if !vbs[1].OID.Equals(SnmpTrapOID) || !vbs[1].Value.(OID).Equals(trapOID) {
+		t.Errorf("Second varbind should be snmpTrapOID, got %s", vbs[1])
+	}
+	if !vbs[2].OID.Equals(leafOID) || string(vbs[2].Value.([]byte)) != "queue full" {
+		t.Errorf("Bad payload varbind: %s", vbs[2])
+	}
+}
+
+// Test translating notifications into SNMPv1 traps
+func TestTrapV1(t *testing.T) {
+	var O = NewOID
+
+	type v1Test struct {
+		trapOID, enterprise OID
+		generic, specific   int
+	}
+
+	tests := []v1Test{
+		{O(1, 3, 6, 1, 4, 1, 898889, 0, 3), O(1, 3, 6, 1, 4, 1, 898889), 6, 3},
+		{O(1, 3, 6, 1, 4, 1, 898889, 7), O(1, 3, 6, 1, 4, 1, 898889), 6, 7},
+		// linkDown
+		{SnmpTrapsOID.Add(3), SnmpTrapsOID, 2, 0},
+	}
+
+	conn := listenUDP(t)
+	sender := NewTrapSender(Version1, "public", conn.LocalAddr().String())
+	sender.AgentAddress = net.IPv4(10, 0, 0, 1)
+
+	for _, test := range tests {
+		err := sender.Trap(test.trapOID,
+			VarBind{O(1, 3, 6, 1, 4, 1, 898889, 1, 1), AsnInteger, 5},
+			VarBind{O(1, 3, 6, 1, 4, 1, 898889, 1, 2), AsnCounter64, uint64(5)},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, _ := readMessage(t, conn)
+		p := m.PDU
+		if m.Version != Version1 || p.Type != AsnTrap {
+			t.Fatalf("Bad trap: %#v", m)
+		}
+		if !p.Enterprise.Equals(test.enterprise) || p.GenericTrap != test.generic || p.SpecificTrap != test.specific {
+			t.Errorf("%s translated to enterprise %s, generic %d, specific %d", test.trapOID, p.Enterprise, p.GenericTrap, p.SpecificTrap)
+		}
+		if !p.AgentAddress.Equal(sender.AgentAddress) {
+			t.Errorf("Bad agent address %s", p.AgentAddress)
+		}
+		if len(p.VarBinds) != 1 {
+			t.Errorf("Counter64 varbinds should be dropped from v1 traps: %v", p.VarBinds)
+		}
+	}
+
+	// Trap OIDs that leave no enterprise cannot be sent
+	for _, trapOID := range []OID{O(5), O(0, 5)} {
+		if err := sender.Trap(trapOID); !errors.Is(err, NoEnterprise) {
+			t.Errorf("%s: expected NoEnterprise, got %v", trapOID, err)
+		}
+	}
+}
+
+// Test that a TrapSender made without NewTrapSender() starts its uptime and
+// gets its defaults when first used
+func TestTrapSenderLiteral(t *testing.T) {
+	var (
+		conn   = listenUDP(t)
+		sender = &TrapSender{Version: Version2c, Community: "public", Receivers: []string{conn.LocalAddr().String()}}
+	)
+
+	if err := sender.Trap(NewOID(1, 3, 6, 1, 4, 1, 898889, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := readMessage(t, conn)
+	if uptime := m.PDU.VarBinds[0].Value.(uint32); uptime > 100 {
+		t.Errorf("Expected an uptime of under a second, got %d", uptime)
+	}
+
+	// Informs wait for the default timeout rather than none at all
+	_, ch, addr := startTrapListener(t, "")
+	sender = &TrapSender{Version: Version2c, Community: "public", Receivers: []string{addr}}
+	if err := sender.Inform(NewOID(1, 3, 6, 1, 4, 1, 898889, 0, 1)); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	receiveNotification(t, ch)
+	if sender.Retries != 2 {
+		t.Errorf("Expected two retries, got %d", sender.Retries)
+	}
+}
+
+// Test that informs are retried until acknowledged
+func TestInform(t *testing.T) {
+	var (
+		conn    = listenUDP(t)
+		sender  = NewTrapSender(Version2c, "private", conn.LocalAddr().String())
+		trapOID = NewOID(1, 3, 6, 1, 4, 1, 898889, 0, 1)
+		done    = make(chan error)
+	)
+
+	sender.Timeout = 100 * time.Millisecond
+
+	go func() {
+		done <- sender.Inform(trapOID)
+	}()
+
+	// Ignore the first attempt, then acknowledge the retry
+	first, _ := readMessage(t, conn)
+	m, addr := readMessage(t, conn)
+
+	if m.PDU.Type != AsnInformRequest || m.PDU.RequestID != first.PDU.RequestID {
+		t.Fatalf("Expected a retry of the same inform, got %#v", m.PDU)
+	}
+
+	m.PDU.Type = AsnGetResponse
+	b, _ := m.Marshal()
+	conn.WriteToUDP(b, addr)
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+
+	// Nobody acknowledges this one
+	sender.Retries = 1
+	if err := sender.Inform(trapOID); err == nil {
+		t.Error("Expected an unacknowledged inform to fail")
+	}
+}
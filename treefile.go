@@ -0,0 +1,70 @@
+package snmptools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TreeFileFormat() returns the format LoadTreeFile() will read a file as,
+// chosen by its extension: "snmprec", "snmpwalk", "json" or "yaml". It
+// returns "" for files in no known format.
+func TreeFileFormat(path string) string {
+	switch filepath.Ext(path) {
+	case ".snmprec":
+		return "snmprec"
+	case ".snmpwalk", ".walk":
+		return "snmpwalk"
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return ""
+}
+
+// LoadTreeFile() reads a tree located at root from a recording or document,
+// in the format given by TreeFileFormat(). Documents with roots of their own
+// are moved beneath root.
+func LoadTreeFile(path string, root OID) (*SMISparseSubtree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		tree    *SMISparseSubtree
+		docRoot OID
+	)
+
+	switch TreeFileFormat(path) {
+	case "snmprec":
+		return ParseSnmprec(f, root)
+	case "snmpwalk":
+		return ParseSnmpwalk(f, root)
+	case "json":
+		tree, docRoot, err = LoadJSON(f)
+	case "yaml":
+		tree, docRoot, err = LoadYAML(f)
+	default:
+		return nil, fmt.Errorf("unknown format")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if docRoot == nil {
+		return tree, nil
+	}
+
+	relative, err := docRoot.GetRemainder(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not beneath %s", docRoot, root)
+	} else if len(relative) == 0 {
+		return tree, nil
+	}
+
+	moved := NewSMISparseSubtree()
+	return moved, moved.Insert(relative, tree)
+}
@@ -0,0 +1,340 @@
+package snmptools
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sync/atomic"
+)
+
+var (
+	// USM errors
+	AuthenticationFailure = fmt.Errorf("Message authentication failed")
+	DecryptionFailure     = fmt.Errorf("Message decryption failed")
+)
+
+// AuthProtocol is an authentication protocol of the User-based Security Model.
+type AuthProtocol int
+
+const (
+	AuthNone AuthProtocol = iota
+	// HMAC-MD5-96 and HMAC-SHA-96, from RFC 3414
+	AuthMD5
+	AuthSHA
+	// HMAC-SHA-2 variants, from RFC 7860
+	AuthSHA224
+	AuthSHA256
+	AuthSHA384
+	AuthSHA512
+)
+
+var authProtocolStrings = []string{"none", "MD5", "SHA", "SHA-224", "SHA-256", "SHA-384", "SHA-512"}
+
+func (p AuthProtocol) String() string {
+	if p >= 0 && int(p) < len(authProtocolStrings) {
+		return authProtocolStrings[p]
+	}
+	return fmt.Sprintf("AuthProtocol(%d)", int(p))
+}
+
+// hash returns the hash function the protocol is based on.
+func (p AuthProtocol) hash() func() hash.Hash {
+	switch p {
+	case AuthMD5:
+		return md5.New
+	case AuthSHA:
+		return sha1.New
+	case AuthSHA224:
+		return sha256.New224
+	case AuthSHA256:
+		return sha256.New
+	case AuthSHA384:
+		return sha512.New384
+	case AuthSHA512:
+		return sha512.New
+	}
+	return nil
+}
+
+// macLength returns the length of msgAuthenticationParameters.
+func (p AuthProtocol) macLength() int {
+	switch p {
+	case AuthMD5, AuthSHA:
+		return 12
+	case AuthSHA224:
+		return 16
+	case AuthSHA256:
+		return 24
+	case AuthSHA384:
+		return 32
+	case AuthSHA512:
+		return 48
+	}
+	return 0
+}
+
+// PrivProtocol is a privacy (encryption) protocol of the User-based Security
+// Model.
+type PrivProtocol int
+
+const (
+	PrivNone PrivProtocol = iota
+	// CBC-DES, from RFC 3414
+	PrivDES
+	// CFB128-AES-128, from RFC 3826
+	PrivAES
+)
+
+var privProtocolStrings = []string{"none", "DES", "AES"}
+
+func (p PrivProtocol) String() string {
+	if p >= 0 && int(p) < len(privProtocolStrings) {
+		return privProtocolStrings[p]
+	}
+	return fmt.Sprintf("PrivProtocol(%d)", int(p))
+}
+
+// SecurityLevel is the level of security of an SNMPv3 message.
+type SecurityLevel int
+
+const (
+	NoAuthNoPriv SecurityLevel = iota
+	AuthNoPriv
+	AuthPriv
+)
+
+func (l SecurityLevel) String() string {
+	switch l {
+	case NoAuthNoPriv:
+		return "noAuthNoPriv"
+	case AuthNoPriv:
+		return "authNoPriv"
+	case AuthPriv:
+		return "authPriv"
+	}
+	return fmt.Sprintf("SecurityLevel(%d)", int(l))
+}
+
+// USMUser is a user of the User-based Security Model (RFC 3414), identified by
+// name, with optional authentication and privacy.
+//
+// Privacy requires authentication.
+type USMUser struct {
+	Name           string
+	AuthProtocol   AuthProtocol
+	AuthPassphrase string
+	PrivProtocol   PrivProtocol
+	PrivPassphrase string
+}
+
+// SecurityLevel() returns the highest security level the user supports.
+func (u *USMUser) SecurityLevel() SecurityLevel {
+	if u.AuthProtocol == AuthNone {
+		return NoAuthNoPriv
+	} else if u.PrivProtocol == PrivNone {
+		return AuthNoPriv
+	}
+	return AuthPriv
+}
+
+// usmKeys are a user's keys, localised to one SNMP engine.
+type usmKeys struct {
+	user    *USMUser
+	authKey []byte
+	privKey []byte
+}
+
+// localize() derives a user's keys for an engine.
+func (u *USMUser) localize(engineID []byte) *usmKeys {
+	var keys = &usmKeys{user: u}
+
+	if u.AuthProtocol != AuthNone {
+		keys.authKey = LocalizeKey(u.AuthProtocol, u.AuthPassphrase, engineID)
+		if u.PrivProtocol != PrivNone {
+			// The privacy key is derived using the authentication protocol
+			keys.privKey = LocalizeKey(u.AuthProtocol, u.PrivPassphrase, engineID)
+		}
+	}
+
+	return keys
+}
+
+// LocalizeKey() converts a passphrase into a key localised to an SNMP engine,
+// using the password-to-key algorithm of RFC 3414 appendix A.2 with the
+// protocol's hash function.
+func LocalizeKey(proto AuthProtocol, passphrase string, engineID []byte) []byte {
+	var h = proto.hash()
+	if h == nil {
+		return nil
+	}
+	return localizeKey(h, passwordToKey(h, passphrase), engineID)
+}
+
+// passwordToKey hashes a megabyte of the repeated passphrase.
+func passwordToKey(h func() hash.Hash, passphrase string) []byte {
+	var (
+		d   = h()
+		buf = make([]byte, 64)
+		pw  = []byte(passphrase)
+		i   int
+	)
+
+	if len(pw) == 0 {
+		return d.Sum(nil)
+	}
+
+	for count := 0; count < 1048576; count += 64 {
+		for j := range buf {
+			buf[j] = pw[i%len(pw)]
+			i += 1
+		}
+		d.Write(buf)
+	}
+
+	return d.Sum(nil)
+}
+
+// localizeKey computes H(Ku || engineID || Ku).
+func localizeKey(h func() hash.Hash, ku, engineID []byte) []byte {
+	d := h()
+	d.Write(ku)
+	d.Write(engineID)
+	d.Write(ku)
+	return d.Sum(nil)
+}
+
+// authenticate computes the truncated HMAC of a whole message.
+func (k *usmKeys) authenticate(msg []byte) []byte {
+	mac := hmac.New(k.user.AuthProtocol.hash(), k.authKey)
+	mac.Write(msg)
+	return mac.Sum(nil)[:k.user.AuthProtocol.macLength()]
+}
+
+// verify checks the authentication parameters of a received message, found at
+// offset within it.
+func (k *usmKeys) verify(msg []byte, offset int, params []byte) bool {
+	if len(params) != k.user.AuthProtocol.macLength() {
+		return false
+	}
+
+	// The MAC is computed with the parameters zeroed out
+	var zeroed = make([]byte, len(msg))
+	copy(zeroed, msg)
+	for i := range params {
+		zeroed[offset+i] = 0
+	}
+
+	return subtle.ConstantTimeCompare(k.authenticate(zeroed), params) == 1
+}
+
+// saltCounter provides the non-repeating part of privacy salts
+var saltCounter uint64
+
+// encrypt encrypts a scoped PDU, returning the ciphertext and
+// msgPrivacyParameters.
+func (k *usmKeys) encrypt(data []byte, boots, engineTime int) ([]byte, []byte, error) {
+	var (
+		salt = make([]byte, 8)
+		n    = atomic.AddUint64(&saltCounter, 1)
+	)
+
+	switch k.user.PrivProtocol {
+	case PrivDES:
+		if len(k.privKey) < 16 {
+			return nil, nil, DecryptionFailure
+		}
+
+		// The salt is engineBoots followed by a local counter
+		binary.BigEndian.PutUint32(salt, uint32(boots))
+		binary.BigEndian.PutUint32(salt[4:], uint32(n))
+
+		block, err := des.NewCipher(k.privKey[:8])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if pad := len(data) % 8; pad != 0 {
+			data = append(append([]byte(nil), data...), make([]byte, 8-pad)...)
+		}
+
+		out := make([]byte, len(data))
+		cipher.NewCBCEncrypter(block, desIV(k.privKey, salt)).CryptBlocks(out, data)
+		return out, salt, nil
+
+	case PrivAES:
+		binary.BigEndian.PutUint64(salt, n)
+
+		block, err := aes.NewCipher(k.privKey[:16])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		out := make([]byte, len(data))
+		cipher.NewCFBEncrypter(block, aesIV(boots, engineTime, salt)).XORKeyStream(out, data)
+		return out, salt, nil
+	}
+
+	return nil, nil, fmt.Errorf("Unsupported privacy protocol %s", k.user.PrivProtocol)
+}
+
+// decrypt decrypts an encrypted scoped PDU.
+func (k *usmKeys) decrypt(data, salt []byte, boots, engineTime int) ([]byte, error) {
+	if len(salt) != 8 {
+		return nil, DecryptionFailure
+	}
+
+	switch k.user.PrivProtocol {
+	case PrivDES:
+		if len(data)%8 != 0 || len(k.privKey) < 16 {
+			return nil, DecryptionFailure
+		}
+
+		block, err := des.NewCipher(k.privKey[:8])
+		if err != nil {
+			return nil, err
+		}
+
+		out := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, desIV(k.privKey, salt)).CryptBlocks(out, data)
+		return out, nil
+
+	case PrivAES:
+		block, err := aes.NewCipher(k.privKey[:16])
+		if err != nil {
+			return nil, err
+		}
+
+		out := make([]byte, len(data))
+		cipher.NewCFBDecrypter(block, aesIV(boots, engineTime, salt)).XORKeyStream(out, data)
+		return out, nil
+	}
+
+	return nil, DecryptionFailure
+}
+
+// desIV is the pre-IV (the second half of the privacy key) XORed with the salt.
+func desIV(key, salt []byte) []byte {
+	var iv = make([]byte, 8)
+	for i := range iv {
+		iv[i] = key[8+i] ^ salt[i]
+	}
+	return iv
+}
+
+// aesIV is engineBoots, engineTime and the salt, concatenated.
+func aesIV(boots, engineTime int, salt []byte) []byte {
+	var iv = make([]byte, 16)
+	binary.BigEndian.PutUint32(iv, uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(engineTime))
+	copy(iv[8:], salt)
+	return iv
+}
@@ -0,0 +1,282 @@
+package snmptools
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// Test password to key conversion and localisation against the vectors in
+// RFC 3414 appendix A.3, and the same passphrase and engine for the SHA-2
+// protocols of RFC 7860
+func TestLocalizeKey(t *testing.T) {
+	var engineID, _ = hex.DecodeString("000000000000000000000002")
+
+	type keyTest struct {
+		proto     AuthProtocol
+		ku, local string
+	}
+
+	tests := []keyTest{
+		{AuthMD5, "9faf3283884e92834ebc9847d8edd963", "526f5eed9fcce26f8964c2930787d82b"},
+		{AuthSHA, "9fb5cc0381497b3793528939ff788d5d79145211", "6695febc9288e36282235fc7151f128497b38f3f"},
+		{AuthSHA224, "282a5867ee9aac639ad59df9572c7d3ac0fbc13a905b6df07dbbf00b", "0bd8827c6e29f8065e08e09237f177e410f69b90e1782be682075674"},
+		{AuthSHA256, "ab51014d1e077f6017df2b12bee5f5aa72993177e9bb569c4dff5a4ca0b4afac", "8982e0e549e866db361a6b625d84cccc11162d453ee8ce3a6445c2d6776f0f8b"},
+		{AuthSHA384, "e06eccdf2c68a06ed034723c9c26e0db3b669e1e2efed49150b55377a2e98f383c86fb836857444654b287c93f51ff64", "3b298f16164a11184279d5432bf169e2d2a48307de02b3d3f7e2b4f36eb6f0455a53689a3937eea07319a633d2ccba78"},
+		{AuthSHA512, "7e4396de5aadc77be853819b98c9406265b3a9c37cc3176569847a4e4f6fba63dd3a73d04924d31a63f95a601f9385af6be4ed1b37f87d040f7c6ed6f8d38a91", "22a5a36cedfcc085807a128d7bc6c2382167ad6c0dbc5fdff856740f3d84c099ad1ea87a8db096714d9788bd544047c9021e4229ce27e4c0a69250adfcffbb0b"},
+	}
+
+	for _, test := range tests {
+		h := test.proto.hash()
+		if ku := hex.EncodeToString(passwordToKey(h, "maplesyrup")); ku != test.ku {
+			t.Errorf("%s Ku: got %s, wanted %s", test.proto, ku, test.ku)
+		}
+		if kul := hex.EncodeToString(LocalizeKey(test.proto, "maplesyrup", engineID)); kul != test.local {
+			t.Errorf("%s Kul: got %s, wanted %s", test.proto, kul, test.local)
+		}
+	}
+}
+
+// Test the truncated HMACs of each authentication protocol, with the keys
+// localised above, against values computed with Python's hmac module
+func TestUSMAuthentication(t *testing.T) {
+	var (
+		engineID, _ = hex.DecodeString("000000000000000000000002")
+		msg         = []byte("a whole message to authenticate")
+	)
+
+	tests := map[AuthProtocol]string{
+		AuthMD5:    "4d9c4d371cf10a07bfabb32d",
+		AuthSHA:    "bc952a34067d1a8b04c9b7fe",
+		AuthSHA224: "88a31be14f87249aab420c2fcd79c9c7",
+		AuthSHA256: "846314b04746f155ac074fe04f5115366321ec3ccdc2ffa8",
+		AuthSHA384: "06f458168d8a535df462df006f3a4a76b593a2d2489cd9facd165e5704fc1d3a",
+		AuthSHA512: "582a2d5e5984f02c137ec0de18e016c782907b471bc4fa270b14585159ff58fcfc8411e93ad6342bf9088153e567550a",
+	}
+
+	for proto, expected := range tests {
+		keys := (&USMUser{"test", proto, "maplesyrup", PrivNone, ""}).localize(engineID)
+		if mac := hex.EncodeToString(keys.authenticate(msg)); mac != expected {
+			t.Errorf("%s MAC: got %s, wanted %s", proto, mac, expected)
+		}
+	}
+}
+
+// Test decryption against ciphertexts produced by OpenSSL, for DES-CBC as in
+// RFC 3414 section 8 with the MD5 key above, and AES-128-CFB as in RFC 3826
+// with the SHA key above
+func TestUSMPrivacyKnownAnswer(t *testing.T) {
+	type privTest struct {
+		proto      PrivProtocol
+		key, salt  string
+		ciphertext string
+		plaintext  string
+	}
+
+	tests := []privTest{
+		{PrivDES, "526f5eed9fcce26f8964c2930787d82b", "0000000300000001", "fe433f9e04433c3c13454cae6607774c39e34f8befa1990c9951a56a12d39224", "a scoped PDU of sixteen+ bytes!!"},
+		{PrivAES, "6695febc9288e36282235fc7151f1284", "0000000000000001", "6c7b70c180858560e300ab0a0012d42eb0abb0d13ae3f288360c2ee651", "a scoped PDU, 29 bytes long!!"},
+	}
+
+	for _, test := range tests {
+		var (
+			key, _        = hex.DecodeString(test.key)
+			salt, _       = hex.DecodeString(test.salt)
+			ciphertext, _ = hex.DecodeString(test.ciphertext)
+			keys          = &usmKeys{user: &USMUser{PrivProtocol: test.proto}, privKey: key}
+		)
+
+		if plaintext, err := keys.decrypt(ciphertext, salt, 3, 1234); err != nil {
+			t.Errorf("%s: %s", test.proto, err)
+		} else if string(plaintext) != test.plaintext {
+			t.Errorf("%s: got %q, wanted %q", test.proto, plaintext, test.plaintext)
+		}
+	}
+}
+
+// Test that encryption round-trips for each privacy protocol
+func TestUSMPrivacy(t *testing.T) {
+	var (
+		engineID  = randomEngineID()
+		plaintext = []byte("a scoped PDU that is not a multiple of eight bytes")
+	)
+
+	for _, priv := range []PrivProtocol{PrivDES, PrivAES} {
+		user := &USMUser{"test", AuthSHA, "authpassword", priv, "privpassword"}
+		keys := user.localize(engineID)
+
+		encrypted, salt, err := keys.encrypt(plaintext, 3, 1234)
+		if err != nil {
+			t.Fatal(err)
+		} else if bytes.Contains(encrypted, plaintext[:8]) {
+			t.Errorf("%s did not encrypt", priv)
+		}
+
+		decrypted, err := keys.decrypt(encrypted, salt, 3, 1234)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.HasPrefix(decrypted, plaintext) {
+			t.Errorf("%s round trip gave %q", priv, decrypted)
+		}
+
+		// A second message must use a different salt
+		if _, salt2, _ := keys.encrypt(plaintext, 3, 1234); bytes.Equal(salt, salt2) {
+			t.Errorf("%s reused a salt", priv)
+		}
+	}
+}
+
+// Test SNMPv3 requests against an agent at each security level
+func TestClientV3(t *testing.T) {
+	users := []USMUser{
+		{"noauth", AuthNone, "", PrivNone, ""},
+		{"md5", AuthMD5, "md5password", PrivNone, ""},
+		{"sha", AuthSHA, "shapassword", PrivDES, "despassword"},
+		{"sha224", AuthSHA224, "sha224password", PrivAES, "aespassword"},
+		{"sha256", AuthSHA256, "sha256password", PrivAES, "aespassword"},
+		{"sha384", AuthSHA384, "sha384password", PrivDES, "despassword"},
+		{"sha512", AuthSHA512, "sha512password", PrivAES, "aespassword"},
+	}
+
+	agent, addr := startTestAgent(t)
+	for _, user := range users {
+		agent.AddUser(user, user.Name == "sha512")
+	}
+
+	for i := range users {
+		client := newTestClient(t, addr, "", Version3)
+		client.User = &users[i]
+
+		vbs, err := client.Get(testAgentRoot.Add(1, 1))
+		if err != nil {
+			t.Errorf("%s: %s", users[i].Name, err)
+			continue
+		} else if string(vbs[0].Value.([]byte)) != "test" {
+			t.Errorf("%s: bad value %s", users[i].Name, vbs[0])
+		}
+
+		var cnt int
+		client.BulkWalk(testAgentRoot, func(vb VarBind) error {
+			cnt += 1
+			return nil
+		})
+		if cnt != 28 {
+			t.Errorf("%s: walked %d objects, wanted 28", users[i].Name, cnt)
+		}
+
+		_, err = client.Set(VarBind{testAgentRoot.Add(1, 3), AsnInteger, i})
+		if writable := users[i].Name == "sha512"; writable && err != nil {
+			t.Errorf("%s: %s", users[i].Name, err)
+		} else if !writable && !errors.Is(err, NoAccess) {
+			t.Errorf("%s: expected noAccess, got %v", users[i].Name, err)
+		}
+	}
+}
+
+// Test the reports sent for SNMPv3 security failures
+func TestClientV3Failures(t *testing.T) {
+	agent, addr := startTestAgent(t)
+	agent.AddUser(USMUser{"user", AuthSHA, "password1", PrivAES, "password2"}, false)
+
+	type failureTest struct {
+		user     USMUser
+		expected error
+	}
+
+	tests := []failureTest{
+		{USMUser{"nobody", AuthNone, "", PrivNone, ""}, UnknownUser},
+		{USMUser{"user", AuthSHA, "wrong password", PrivAES, "password2"}, AuthenticationFailure},
+		{USMUser{"user", AuthSHA, "password1", PrivAES, "wrong password"}, DecryptionFailure},
+	}
+
+	for _, test := range tests {
+		client := newTestClient(t, addr, "", Version3)
+		client.User = &test.user
+
+		if _, err := client.Get(testAgentRoot.Add(1, 1)); err != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.user.Name, test.expected, err)
+		}
+	}
+
+	// A lower security level than the user's is not authorised
+	client := newTestClient(t, addr, "", Version3)
+	client.User = &USMUser{"user", AuthSHA, "password1", PrivNone, ""}
+	if _, err := client.Get(testAgentRoot.Add(1, 1)); !errors.Is(err, AuthorizationError) {
+		t.Errorf("Expected authorizationError, got %v", err)
+	}
+
+	// Clients re-synchronise with an agent whose clock they have lost track of
+	client = newTestClient(t, addr, "", Version3)
+	client.User = &USMUser{"user", AuthSHA, "password1", PrivAES, "password2"}
+	if _, err := client.Get(testAgentRoot.Add(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	client.engineTime -= 1000
+	if _, err := client.Get(testAgentRoot.Add(1, 1)); err != nil {
+		t.Errorf("Expected the client to recover from notInTimeWindow: %s", err)
+	}
+	if client.engineTime < 0 {
+		t.Errorf("Client did not learn the engine time")
+	}
+}
+
+// Test that a client ignores responses below its user's security level, as an
+// attacker could send them without knowing the user's keys
+func TestClientV3Spoofed(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	engineID := randomEngineID()
+	go func() {
+		var buf = make([]byte, maxMessageSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			m, err := unmarshalV3Message(buf[:n])
+			if err != nil {
+				continue
+			}
+
+			resp := &v3Message{
+				MsgID:           m.MsgID,
+				MaxSize:         maxMessageSize,
+				EngineID:        engineID,
+				UserName:        m.UserName,
+				ContextEngineID: engineID,
+				PDU: &PDU{
+					Type:     AsnGetResponse,
+					VarBinds: []VarBind{{testAgentRoot.Add(1, 1), AsnOctetString, "SPOOFED"}},
+				},
+			}
+			if len(m.EngineID) == 0 {
+				// Discovery is answered honestly
+				resp.PDU = &PDU{Type: AsnReport, VarBinds: []VarBind{{UsmStatsUnknownEngineIDs, AsnCounter32, 1}}}
+			}
+
+			if b, err := resp.marshal(nil); err == nil {
+				conn.WriteTo(b, addr)
+			}
+		}
+	}()
+
+	for _, user := range []USMUser{
+		{"authpriv", AuthSHA, "password1", PrivAES, "password2"},
+		{"authnopriv", AuthSHA, "password1", PrivNone, ""},
+	} {
+		client := newTestClient(t, conn.LocalAddr().String(), "", Version3)
+		client.Timeout = 200 * time.Millisecond
+		client.User = &user
+
+		if vbs, err := client.Get(testAgentRoot.Add(1, 1)); err != RequestTimeout {
+			t.Errorf("%s: expected the spoofed response to be ignored, got %v, %v", user.Name, vbs, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package snmptools
+
+import (
+	"fmt"
+)
+
+// msgFlags bits
+const (
+	v3FlagAuth       = 0x01
+	v3FlagPriv       = 0x02
+	v3FlagReportable = 0x04
+)
+
+// usmSecurityModel is the msgSecurityModel of the User-based Security Model
+const usmSecurityModel = 3
+
+// timeWindow is how far, in seconds, an authenticated message's engine time
+// may be from the receiver's notion of it
+const timeWindow = 150
+
+// Counters reported in USM Report-PDUs, from the usmStats group
+var (
+	usmStats = OID{1, 3, 6, 1, 6, 3, 15, 1, 1}
+
+	UsmStatsUnsupportedSecLevels = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 1, 0}
+	UsmStatsNotInTimeWindows     = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 2, 0}
+	UsmStatsUnknownUserNames     = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 3, 0}
+	UsmStatsUnknownEngineIDs     = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 4, 0}
+	UsmStatsWrongDigests         = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 5, 0}
+	UsmStatsDecryptionErrors     = OID{1, 3, 6, 1, 6, 3, 15, 1, 1, 6, 0}
+)
+
+// v3Message is an SNMPv3 message secured by the User-based Security Model.
+type v3Message struct {
+	MsgID   int32
+	MaxSize int
+	Flags   byte
+
+	// msgSecurityParameters
+	EngineID    []byte
+	EngineBoots int
+	EngineTime  int
+	UserName    string
+	AuthParams  []byte
+	PrivParams  []byte
+
+	// The scoped PDU
+	ContextEngineID []byte
+	ContextName     string
+	PDU             *PDU
+
+	// Set on received messages: the whole message, where the authentication
+	// parameters are within it, and the encrypted scoped PDU if there is one
+	raw        []byte
+	authOffset int
+	encrypted  []byte
+}
+
+// level returns the security level given by the message's flags.
+func (m *v3Message) level() SecurityLevel {
+	switch m.Flags & (v3FlagAuth | v3FlagPriv) {
+	case v3FlagAuth:
+		return AuthNoPriv
+	case v3FlagAuth | v3FlagPriv:
+		return AuthPriv
+	}
+	return NoAuthNoPriv
+}
+
+// levelFlags returns msgFlags for a security level.
+func levelFlags(level SecurityLevel) byte {
+	switch level {
+	case AuthNoPriv:
+		return v3FlagAuth
+	case AuthPriv:
+		return v3FlagAuth | v3FlagPriv
+	}
+	return 0
+}
+
+// marshal encodes the message, encrypting and authenticating it with keys
+// as its flags demand.
+func (m *v3Message) marshal(keys *usmKeys) ([]byte, error) {
+	pdu, err := m.PDU.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		level   = m.level()
+		msgData = berTLV(byte(AsnSequence),
+			berTLV(byte(AsnOctetString), m.ContextEngineID),
+			berTLV(byte(AsnOctetString), []byte(m.ContextName)),
+			pdu,
+		)
+		authParams []byte
+	)
+
+	if level != NoAuthNoPriv && keys == nil {
+		return nil, AuthenticationFailure
+	}
+
+	if level == AuthPriv {
+		encrypted, salt, err := keys.encrypt(msgData, m.EngineBoots, m.EngineTime)
+		if err != nil {
+			return nil, err
+		}
+		m.PrivParams = salt
+		msgData = berTLV(byte(AsnOctetString), encrypted)
+	}
+
+	if level != NoAuthNoPriv {
+		// Authentication parameters are zeroed while computing the MAC
+		authParams = make([]byte, keys.user.AuthProtocol.macLength())
+	}
+
+	var (
+		privTLV = berTLV(byte(AsnOctetString), m.PrivParams)
+		secSeq  = berTLV(byte(AsnSequence),
+			berTLV(byte(AsnOctetString), m.EngineID),
+			berTLV(byte(AsnInteger), berInt(int64(m.EngineBoots))),
+			berTLV(byte(AsnInteger), berInt(int64(m.EngineTime))),
+			berTLV(byte(AsnOctetString), []byte(m.UserName)),
+			berTLV(byte(AsnOctetString), authParams),
+			privTLV,
+		)
+		header = berTLV(byte(AsnSequence),
+			berTLV(byte(AsnInteger), berInt(int64(m.MsgID))),
+			berTLV(byte(AsnInteger), berInt(int64(m.MaxSize))),
+			berTLV(byte(AsnOctetString), []byte{m.Flags}),
+			berTLV(byte(AsnInteger), berInt(usmSecurityModel)),
+		)
+		b = berTLV(byte(AsnSequence),
+			berTLV(byte(AsnInteger), berInt(int64(Version3))),
+			header,
+			berTLV(byte(AsnOctetString), secSeq),
+			msgData,
+		)
+	)
+
+	if level != NoAuthNoPriv {
+		// The authentication parameters end just before the privacy
+		// parameters, which are followed by the scoped PDU
+		offset := len(b) - len(msgData) - len(privTLV) - len(authParams)
+		copy(b[offset:], keys.authenticate(b))
+	}
+
+	return b, nil
+}
+
+// unmarshalV3Message decodes an SNMPv3 message. Authentication is not checked
+// and encrypted scoped PDUs are not decrypted; see open().
+func unmarshalV3Message(b []byte) (*v3Message, error) {
+	var (
+		m                       = &v3Message{raw: b}
+		msg, header, sec, field []byte
+		i                       int64
+		err                     error
+	)
+
+	if msg, _, err = berExpect(b, byte(AsnSequence)); err != nil {
+		return nil, err
+	}
+
+	if i, msg, err = berReadInt(msg); err != nil {
+		return nil, err
+	} else if SNMPVersion(i) != Version3 {
+		return nil, UnsupportedVersion
+	}
+
+	// msgGlobalData
+	if header, msg, err = berExpect(msg, byte(AsnSequence)); err != nil {
+		return nil, err
+	}
+	if i, header, err = berReadInt(header); err != nil {
+		return nil, err
+	}
+	m.MsgID = int32(i)
+	if i, header, err = berReadInt(header); err != nil {
+		return nil, err
+	}
+	m.MaxSize = int(i)
+	if field, header, err = berExpect(header, byte(AsnOctetString)); err != nil {
+		return nil, err
+	} else if len(field) != 1 {
+		return nil, MalformedBER
+	}
+	m.Flags = field[0]
+	if i, _, err = berReadInt(header); err != nil {
+		return nil, err
+	} else if i != usmSecurityModel {
+		return nil, fmt.Errorf("Unsupported security model %d", i)
+	}
+
+	// msgSecurityParameters
+	if sec, msg, err = berExpect(msg, byte(AsnOctetString)); err != nil {
+		return nil, err
+	} else if sec, _, err = berExpect(sec, byte(AsnSequence)); err != nil {
+		return nil, err
+	}
+	if m.EngineID, sec, err = berExpect(sec, byte(AsnOctetString)); err != nil {
+		return nil, err
+	}
+	if i, sec, err = berReadInt(sec); err != nil {
+		return nil, err
+	}
+	m.EngineBoots = int(i)
+	if i, sec, err = berReadInt(sec); err != nil {
+		return nil, err
+	}
+	m.EngineTime = int(i)
+	if field, sec, err = berExpect(sec, byte(AsnOctetString)); err != nil {
+		return nil, err
+	}
+	m.UserName = string(field)
+	if m.AuthParams, sec, err = berExpect(sec, byte(AsnOctetString)); err != nil {
+		return nil, err
+	}
+	// The parameters are a slice of b, so their offset follows from capacity
+	m.authOffset = cap(b) - cap(m.AuthParams)
+	if m.PrivParams, _, err = berExpect(sec, byte(AsnOctetString)); err != nil {
+		return nil, err
+	}
+
+	// msgData
+	if m.Flags&v3FlagPriv != 0 {
+		if m.encrypted, _, err = berExpect(msg, byte(AsnOctetString)); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	return m, m.parseScopedPDU(msg)
+}
+
+// parseScopedPDU decodes a plaintext scoped PDU. Anything following it, such
+// as padding left over from decryption, is ignored.
+func (m *v3Message) parseScopedPDU(b []byte) error {
+	var (
+		scoped, field []byte
+		err           error
+	)
+
+	if scoped, _, err = berExpect(b, byte(AsnSequence)); err != nil {
+		return err
+	}
+	if m.ContextEngineID, scoped, err = berExpect(scoped, byte(AsnOctetString)); err != nil {
+		return err
+	}
+	if field, scoped, err = berExpect(scoped, byte(AsnOctetString)); err != nil {
+		return err
+	}
+	m.ContextName = string(field)
+
+	m.PDU, _, err = unmarshalPDU(scoped)
+	return err
+}
+
+// open authenticates a received message with keys and decrypts its scoped
+// PDU, as its flags demand. Messages below the minimum security level fail
+// authentication, unless they are reports of usmStats counters, which agents
+// send unauthenticated when they cannot authenticate a request.
+func (m *v3Message) open(keys *usmKeys, minimum SecurityLevel) error {
+	level := m.level()
+
+	if level < minimum && !m.usmReport() {
+		return AuthenticationFailure
+	}
+
+	if level != NoAuthNoPriv {
+		if keys == nil || keys.user.AuthProtocol == AuthNone || !keys.verify(m.raw, m.authOffset, m.AuthParams) {
+			return AuthenticationFailure
+		}
+	}
+
+	if level == AuthPriv {
+		if keys.user.PrivProtocol == PrivNone {
+			return DecryptionFailure
+		}
+		plain, err := keys.decrypt(m.encrypted, m.PrivParams, m.EngineBoots, m.EngineTime)
+		if err != nil {
+			return DecryptionFailure
+		}
+		if err = m.parseScopedPDU(plain); err != nil {
+			return DecryptionFailure
+		}
+	}
+
+	return nil
+}
+
+// usmReport says whether a message is a Report-PDU of usmStats counters.
+func (m *v3Message) usmReport() bool {
+	if m.PDU == nil || m.PDU.Type != AsnReport || len(m.PDU.VarBinds) == 0 {
+		return false
+	}
+	for _, vb := range m.PDU.VarBinds {
+		if rel, err := vb.OID.GetRemainder(usmStats); err != nil || len(rel) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// messageVersion reads the version number at the start of a message.
+func messageVersion(b []byte) (SNMPVersion, error) {
+	msg, _, err := berExpect(b, byte(AsnSequence))
+	if err != nil {
+		return 0, err
+	}
+	v, _, err := berReadInt(msg)
+	return SNMPVersion(v), err
+}
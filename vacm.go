@@ -0,0 +1,193 @@
+package snmptools
+
+import (
+	"sync"
+)
+
+// ViewType selects one of the three views a VACM group is given.
+type ViewType int
+
+const (
+	ReadView ViewType = iota
+	WriteView
+	NotifyView
+)
+
+// VACM implements view-based access control for an agent, after the
+// View-based Access Control Model of RFC 3415.
+//
+// Views are named sets of OIDs, built from subtrees that are included in or
+// excluded from the view. Communities and SNMPv3 users are members of groups,
+// and each group is given a read view, a write view and a notify view, along
+// with the minimum security level its members must use.
+//
+// Only the default context is supported.
+type VACM struct {
+	mu     sync.RWMutex
+	views  map[string][]viewFamily
+	groups map[vacmMember]string
+	access map[string]vacmAccess
+}
+
+// viewFamily is a subtree included in or excluded from a view. The mask
+// allows some sub-identifiers of the subtree to act as wildcards.
+type viewFamily struct {
+	subtree  OID
+	mask     []byte
+	included bool
+}
+
+// vacmMember is a community (for SNMPv1 and SNMPv2c) or an SNMPv3 user.
+type vacmMember struct {
+	v3   bool
+	name string
+}
+
+// vacmAccess is the access given to a group.
+type vacmAccess struct {
+	level SecurityLevel
+	views [3]string
+}
+
+// NewVACM() creates an empty VACM, which grants no access to anything.
+func NewVACM() *VACM {
+	return &VACM{
+		views:  make(map[string][]viewFamily),
+		groups: make(map[vacmMember]string),
+		access: make(map[string]vacmAccess),
+	}
+}
+
+// Include() adds a subtree to a view, creating the view if need be.
+//
+// The optional mask marks which sub-identifiers of the subtree must match:
+// the most significant bit of the first byte is the first sub-identifier,
+// and a 0 bit makes that sub-identifier a wildcard. Sub-identifiers beyond
+// the end of the mask must match.
+func (v *VACM) Include(view string, subtree OID, mask ...byte) {
+	v.addFamily(view, viewFamily{subtree.Copy(), mask, true})
+}
+
+// Exclude() removes a subtree from a view; see Include().
+func (v *VACM) Exclude(view string, subtree OID, mask ...byte) {
+	v.addFamily(view, viewFamily{subtree.Copy(), mask, false})
+}
+
+func (v *VACM) addFamily(view string, family viewFamily) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.views[view] = append(v.views[view], family)
+}
+
+// AddCommunity() makes an SNMPv1/SNMPv2c community a member of a group.
+func (v *VACM) AddCommunity(group, community string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.groups[vacmMember{false, community}] = group
+}
+
+// AddUser() makes an SNMPv3 user a member of a group.
+func (v *VACM) AddUser(group, userName string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.groups[vacmMember{true, userName}] = group
+}
+
+// SetAccess() gives a group its read, write and notify views. Members must
+// use at least the given security level; communities always use
+// NoAuthNoPriv. An empty view name grants no access.
+func (v *VACM) SetAccess(group string, level SecurityLevel, read, write, notify string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.access[group] = vacmAccess{level, [3]string{read, write, notify}}
+}
+
+// InView() reports whether an OID is in a named view.
+//
+// When several subtrees of the view contain the OID, the one with the most
+// sub-identifiers decides; between equally long ones, the lexicographically
+// greatest decides. OIDs in none of them are not in the view.
+func (v *VACM) InView(view string, oid OID) bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return inView(v.views[view], oid)
+}
+
+func inView(families []viewFamily, oid OID) bool {
+	var best *viewFamily
+
+	for i := range families {
+		f := &families[i]
+		if !f.contains(oid) {
+			continue
+		}
+
+		if best == nil || len(f.subtree) > len(best.subtree) ||
+			(len(f.subtree) == len(best.subtree) && f.subtree.Compare(best.subtree) > 0) {
+			best = f
+		}
+	}
+
+	return best != nil && best.included
+}
+
+// contains reports whether an OID is in the family's subtree, taking the mask
+// into account.
+func (f *viewFamily) contains(oid OID) bool {
+	if len(oid) < len(f.subtree) {
+		return false
+	}
+
+	for i, arc := range f.subtree {
+		wildcard := i/8 < len(f.mask) && f.mask[i/8]&(0x80>>uint(i%8)) == 0
+		if !wildcard && oid[i] != arc {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsAccessAllowed() reports whether a community or SNMPv3 user may access an
+// OID through one of its group's views, at the given security level.
+//
+// For SNMPv1 and SNMPv2c, securityName is the community.
+func (v *VACM) IsAccessAllowed(version SNMPVersion, securityName string, level SecurityLevel, viewType ViewType, oid OID) bool {
+	allowed, ok := v.viewFunc(version, securityName, level, viewType)
+	return ok && allowed(oid)
+}
+
+// viewFunc returns a function that tells whether an OID is in one of the views
+// of a community or user. ok is false if the community or user has no access
+// at all at this security level.
+func (v *VACM) viewFunc(version SNMPVersion, securityName string, level SecurityLevel, viewType ViewType) (allowed func(oid OID) bool, ok bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	group, ok := v.groups[vacmMember{version == Version3, securityName}]
+	if !ok {
+		return noOIDs, false
+	}
+
+	access, ok := v.access[group]
+	if !ok || level < access.level {
+		return noOIDs, false
+	}
+
+	name := access.views[viewType]
+	if name == "" {
+		return noOIDs, true
+	}
+
+	families := v.views[name]
+	return func(oid OID) bool {
+		v.mu.RLock()
+		defer v.mu.RUnlock()
+		return inView(families, oid)
+	}, true
+}
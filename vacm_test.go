@@ -0,0 +1,144 @@
+package snmptools
+
+import (
+	"errors"
+	"testing"
+)
+
+// Test view membership with nested subtrees and masks
+func TestVACMViews(t *testing.T) {
+	var (
+		O    = NewOID
+		vacm = NewVACM()
+		// ifEntry, with a mask that wildcards the column
+		ifEntry = O(1, 3, 6, 1, 2, 1, 2, 2, 1)
+	)
+
+	vacm.Include("system", O(1, 3, 6, 1, 2, 1, 1))
+	vacm.Include("restricted", O(1, 3, 6, 1))
+	vacm.Exclude("restricted", O(1, 3, 6, 1, 4, 1, 898889, 2))
+	vacm.Include("restricted", O(1, 3, 6, 1, 4, 1, 898889, 2, 5))
+	// Interface 3 only, for every column
+	vacm.Include("if3", ifEntry.Add(0, 3), 0xff, 0xa0)
+
+	type viewTest struct {
+		view     string
+		oid      OID
+		expected bool
+	}
+
+	tests := []viewTest{
+		{"system", O(1, 3, 6, 1, 2, 1, 1, 1, 0), true},
+		{"system", O(1, 3, 6, 1, 2, 1, 1), true},
+		{"system", O(1, 3, 6, 1, 2, 1), false},
+		{"system", O(1, 3, 6, 1, 2, 1, 2), false},
+		{"missing", O(1, 3, 6, 1, 2, 1, 1, 1, 0), false},
+
+		{"restricted", O(1, 3, 6, 1, 4, 1, 898889, 1, 1), true},
+		{"restricted", O(1, 3, 6, 1, 4, 1, 898889, 2, 1), false},
+		{"restricted", O(1, 3, 6, 1, 4, 1, 898889, 2, 5, 1), true},
+		{"restricted", O(1, 3, 6, 2), false},
+
+		{"if3", ifEntry.Add(2, 3), true},
+		{"if3", ifEntry.Add(10, 3), true},
+		{"if3", ifEntry.Add(10, 4), false},
+		{"if3", ifEntry.Add(10), false},
+	}
+
+	for _, test := range tests {
+		if got := vacm.InView(test.view, test.oid); got != test.expected {
+			t.Errorf("%s in view %s: got %v, wanted %v", test.oid, test.view, got, test.expected)
+		}
+	}
+}
+
+// Test an agent enforcing views for a restricted community
+func TestAgentVACM(t *testing.T) {
+	var (
+		agent, addr = startTestAgent(t)
+		vacm        = NewVACM()
+		root        = testAgentRoot
+	)
+
+	// "public" sees everything but the second column beyond row 5, and
+	// "private" may also write the scalars
+	vacm.Include("all", root)
+	vacm.Include("limited", root)
+	vacm.Exclude("limited", root.Add(2))
+	vacm.Include("limited", root.Add(2, 1))
+	vacm.Include("limited", root.Add(2, 2))
+	vacm.Include("scalars", root.Add(1))
+
+	vacm.AddCommunity("readers", "public")
+	vacm.AddCommunity("writers", "private")
+	vacm.AddUser("writers", "admin")
+	vacm.SetAccess("readers", NoAuthNoPriv, "limited", "", "")
+	vacm.SetAccess("writers", AuthPriv, "all", "scalars", "")
+
+	agent.Access = vacm
+	agent.AddUser(USMUser{"admin", AuthSHA, "password1", PrivAES, "password2"}, false)
+
+	reader := newTestClient(t, addr, "public", Version2c)
+
+	vbs, err := reader.Get(root.Add(2, 1), root.Add(2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vbs[0].Value != 1 || vbs[1].Type != AsnNoSuchObject {
+		t.Errorf("Expected the first row and noSuchObject, got %v", vbs)
+	}
+
+	var walked []OID
+	reader.BulkWalk(root, func(vb VarBind) error {
+		walked = append(walked, vb.OID)
+		return nil
+	})
+	if len(walked) != 5 || !walked[4].Equals(root.Add(2, 2)) {
+		t.Errorf("Bad restricted walk: %v", walked)
+	}
+
+	if vbs, err := reader.GetNext(root.Add(2, 2)); err != nil || vbs[0].Type != AsnEndOfMibView {
+		t.Errorf("Expected endOfMibView after the last row in view, got %v, %v", vbs, err)
+	}
+
+	if _, err := reader.Set(VarBind{root.Add(1, 3), AsnInteger, 1}); !errors.Is(err, NoAccess) {
+		t.Errorf("Expected noAccess, got %v", err)
+	}
+
+	// The writers group requires authPriv, so its community cannot be used
+	writer := newTestClient(t, addr, "private", Version2c)
+	writer.Timeout = 100e6
+	if _, err := writer.Get(root.Add(1, 1)); err != RequestTimeout {
+		t.Errorf("Expected the writers' community to be ignored, got %v", err)
+	}
+
+	admin := newTestClient(t, addr, "", Version3)
+	admin.User = &USMUser{"admin", AuthSHA, "password1", PrivAES, "password2"}
+	if _, err := admin.Set(VarBind{root.Add(1, 3), AsnInteger, 1}); err != nil {
+		t.Errorf("Expected admin to be able to write: %s", err)
+	}
+	if _, err := admin.Set(VarBind{root.Add(2, 3), AsnInteger, 1}); !errors.Is(err, NoAccess) {
+		t.Errorf("Expected noAccess outside the write view, got %v", err)
+	}
+}
+
+// Test the notify view of a TrapSender
+func TestTrapSenderVACM(t *testing.T) {
+	var (
+		conn   = listenUDP(t)
+		sender = NewTrapSender(Version2c, "public", conn.LocalAddr().String())
+		vacm   = NewVACM()
+	)
+
+	vacm.Include("traps", NewOID(1, 3, 6, 1, 4, 1, 898889))
+	vacm.AddCommunity("notifiers", "public")
+	vacm.SetAccess("notifiers", NoAuthNoPriv, "", "", "traps")
+	sender.Access = vacm
+
+	if err := sender.Trap(NewOID(1, 3, 6, 1, 4, 1, 898889, 0, 1)); err != nil {
+		t.Error(err)
+	}
+	if err := sender.Trap(NewOID(1, 3, 6, 1, 4, 1, 1, 0, 1)); err != NotInView {
+		t.Errorf("Expected NotInView, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package snmptools
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// maxOIDLength is the most sub-identifiers an OID may have (RFC 2578)
+const maxOIDLength = 128
+
+// ProblemKind classifies the Problems found by Validate().
+type ProblemKind int
+
+const (
+	// The arcs of a sparse subtree are not increasing, or do not match its
+	// children
+	ProblemOrder ProblemKind = iota
+	// Two children of a subtree have the same OID
+	ProblemDuplicate
+	// A subtree contains itself, so walking it never ends
+	ProblemLoop
+	// A leaf's type is not one that SNMP can carry
+	ProblemType
+	// A leaf's type cannot be served by a pass persist extension, although
+	// other transports can serve it
+	ProblemPassPersist
+	// A leaf's value does not fit its type
+	ProblemValue
+	// A node is neither a leaf nor a subtree, or a subtree has no leaves
+	ProblemEmpty
+)
+
+var problemKindStrings = []string{
+	"order",
+	"duplicate",
+	"loop",
+	"type",
+	"passPersist",
+	"value",
+	"empty",
+}
+
+func (k ProblemKind) String() string {
+	if k >= 0 && int(k) < len(problemKindStrings) {
+		return problemKindStrings[k]
+	}
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+// Problem is something wrong with an SMI tree, found by Validate().
+type Problem struct {
+	// OID is where the problem is, relative to the validated node
+	OID         OID
+	Kind        ProblemKind
+	Description string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.OID, p.Kind, p.Description)
+}
+
+// validator holds the state of a call to Validate()
+type validator struct {
+	problems []Problem
+	// ancestors are the subtrees on the path to the current node, that can
+	// be told apart
+	ancestors map[uintptr]bool
+}
+
+// Validate() walks every node of an SMI tree, and returns its problems: any
+// reason that walking it would not visit each leaf once and in order, and
+// any leaf that could not be served. A tree with no problems returns nil.
+//
+// Leaves whose types are valid SNMP types, but not in PassPersistTypes, are
+// reported as ProblemPassPersist; they may be ignored if the tree is not
+// served by a PassPersistExtension.
+func Validate(node SMINode) []Problem {
+	var v = &validator{ancestors: make(map[uintptr]bool)}
+
+	if node == nil {
+		v.report(OID{}, ProblemEmpty, "the tree is nil")
+	} else {
+		v.validate(node, OID{})
+	}
+	return v.problems
+}
+
+func (v *validator) report(oid OID, kind ProblemKind, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{oid.Copy(), kind, fmt.Sprintf(format, args...)})
+}
+
+// validate checks a node at oid, returning the number of leaves beneath it.
+func (v *validator) validate(node SMINode, oid OID) int {
+	children := node.Children()
+	if children == nil {
+		leaf := node.Value()
+		if leaf == nil {
+			v.report(oid, ProblemEmpty, "the node is neither a leaf nor a subtree")
+			return 0
+		}
+		v.validateLeaf(leaf, oid)
+		return 1
+	}
+
+	if len(oid) >= maxOIDLength {
+		v.report(oid, ProblemLoop, "the tree is deeper than the longest OID allowed")
+		return 0
+	}
+
+	// Only pointers can be recognised when they are seen again
+	if value := reflect.ValueOf(node); value.Kind() == reflect.Ptr {
+		if v.ancestors[value.Pointer()] {
+			v.report(oid, ProblemLoop, "the subtree contains itself")
+			return 0
+		}
+		v.ancestors[value.Pointer()] = true
+		defer delete(v.ancestors, value.Pointer())
+	}
+
+	arcs := childArcs(node)
+	if arcs != nil && len(arcs) != len(children) {
+		v.report(oid, ProblemOrder, "the subtree has %d arcs for %d children", len(arcs), len(children))
+		return 0
+	}
+
+	var leaves int
+	for i, child := range children {
+		arc := uint32(i + 1)
+		if arcs != nil {
+			arc = arcs[i]
+			if i > 0 && arc == arcs[i-1] {
+				v.report(oid.Add(arc), ProblemDuplicate, "there are two children at this arc")
+			} else if i > 0 && arc < arcs[i-1] {
+				v.report(oid.Add(arc), ProblemOrder, "the arc comes after %d", arcs[i-1])
+			}
+		}
+
+		if child != nil {
+			leaves += v.validate(child, oid.Add(arc))
+		}
+	}
+
+	if leaves == 0 {
+		v.report(oid, ProblemEmpty, "the subtree has no leaves")
+	}
+	return leaves
+}
+
+// validateLeaf checks the type and value of a leaf at oid.
+func (v *validator) validateLeaf(leaf *SMILeaf, oid OID) {
+	switch leaf.asnType {
+	case AsnInteger, AsnOctetString, AsnObjectIdentifier, AsnIpAddress, AsnCounter32,
+		AsnGauge32, AsnTimeTicks, AsnOpaque, AsnCounter64, AsnUinteger32, AsnNull:
+	default:
+		v.report(oid, ProblemType, "%#02x is not the type of a value", byte(leaf.asnType))
+		return
+	}
+
+	if _, err := berValue(leaf.asnType, leaf.value); err != nil {
+		v.report(oid, ProblemValue, "%s", err)
+	} else if !PassPersistTypes[leaf.asnType] {
+		v.report(oid, ProblemPassPersist, "%s cannot be served by pass persist", leaf.asnType.PrettyString())
+	}
+}
@@ -0,0 +1,88 @@
+package snmptools
+
+import (
+	"testing"
+)
+
+// badNode is a node that is neither a leaf nor a subtree
+type badNode struct{}
+
+func (badNode) Children() []SMINode { return nil }
+func (badNode) Value() *SMILeaf     { return nil }
+
+// badSparseNode has arcs out of order
+type badSparseNode struct {
+	*SMISubtree
+	arcs []uint32
+}
+
+func (node badSparseNode) Arcs() []uint32 {
+	return node.arcs
+}
+
+func TestValidate(t *testing.T) {
+	var (
+		O    = NewOID
+		leaf = func(t AsnType, v interface{}) SMINode { return NewLeafNode(&SMILeaf{t, v}) }
+		loop = NewSMISubtree(leaf(AsnInteger, 1))
+	)
+	loop.AddChild(loop)
+
+	tests := []struct {
+		tree     SMINode
+		problems []Problem
+	}{
+		{newTestTree(), []Problem{{O(1, 2), ProblemPassPersist, ""}}},
+		{NewSMISubtree(leaf(AsnInteger, 1), nil, leaf(AsnGauge32, uint32(3))), nil},
+		{NewSMISubtree(leaf(AsnInteger, 1), badNode{}), []Problem{{O(2), ProblemEmpty, ""}}},
+		{NewSMISubtree(leaf(AsnInteger, 1), NewSMISubtree()), []Problem{{O(2), ProblemEmpty, ""}}},
+		{nil, []Problem{{OID{}, ProblemEmpty, ""}}},
+		{loop, []Problem{{O(2), ProblemLoop, ""}}},
+		{
+			NewSMISubtree(
+				leaf(AsnInteger, int64(1)<<40),
+				leaf(AsnCounter32, -1),
+				leaf(AsnOctetString, 5),
+				leaf(AsnSequence, nil),
+			),
+			[]Problem{
+				{O(1), ProblemValue, ""},
+				{O(2), ProblemValue, ""},
+				{O(3), ProblemValue, ""},
+				{O(4), ProblemType, ""},
+			},
+		},
+		{
+			badSparseNode{NewSMISubtree(leaf(AsnInteger, 1), leaf(AsnInteger, 2), leaf(AsnInteger, 3)), []uint32{5, 5, 2}},
+			[]Problem{{O(5), ProblemDuplicate, ""}, {O(2), ProblemOrder, ""}},
+		},
+		{
+			badSparseNode{NewSMISubtree(leaf(AsnInteger, 1)), []uint32{1, 2}},
+			[]Problem{{OID{}, ProblemOrder, ""}},
+		},
+	}
+
+	for i, test := range tests {
+		problems := Validate(test.tree)
+		if len(problems) != len(test.problems) {
+			t.Errorf("%d: expected %d problems, got %v", i, len(test.problems), problems)
+			continue
+		}
+		for j, problem := range problems {
+			if expected := test.problems[j]; !problem.OID.Equals(expected.OID) || problem.Kind != expected.Kind {
+				t.Errorf("%d: expected %s problem at %s, got %s", i, expected.Kind, expected.OID, problem)
+			}
+		}
+	}
+}
+
+// Nodes that are neither leaves nor subtrees are skipped by walks
+func TestWalkBadNode(t *testing.T) {
+	tree := NewSMISubtree(badNode{}, NewLeafNode(NewSMILeaf(AsnInteger, 1)), badNode{})
+
+	if oid := NextLeaf(tree, OID{}); !oid.Equals(NewOID(2)) {
+		t.Errorf("Expected .2, got %s", oid)
+	} else if oid := NextLeaf(tree, oid); oid != nil {
+		t.Errorf("Expected the end of the tree, got %s", oid)
+	}
+}
@@ -0,0 +1,195 @@
+package snmptools
+
+// Walk() visits every leaf beneath node in lexicographic OID order, calling
+// fn with the OID of each leaf (relative to node) and its value.
+//
+// The walk is depth-first and visits each node exactly once, so walking a
+// whole tree is linear in its size. If fn returns an error the walk stops and
+// that error is returned.
+//
+// Walk does not hold on to the OID passed to fn, so it is safe to keep it.
+func Walk(node SMINode, fn func(oid OID, leaf *SMILeaf) error) error {
+	if node == nil {
+		return nil
+	}
+
+	if node.Children() == nil {
+		// Walking a single leaf - visit it at the empty OID
+		if val := node.Value(); val != nil {
+			return fn(OID{}, val)
+		}
+		return nil
+	}
+
+	return walkChildren(node, make(OID, 0, 16), fn)
+}
+
+func walkChildren(node SMINode, prefix OID, fn func(oid OID, leaf *SMILeaf) error) error {
+	var arcs = childArcs(node)
+
+	for i, child := range node.Children() {
+		if child == nil {
+			continue
+		}
+
+		oid := append(prefix, uint32(i+1))
+		if arcs != nil {
+			oid[len(oid)-1] = arcs[i]
+		}
+
+		if child.Children() != nil {
+			if err := walkChildren(child, oid, fn); err != nil {
+				return err
+			}
+		} else if val := child.Value(); val != nil {
+			if err := fn(oid.Copy(), val); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Iterator is a stateful, single-pass cursor over the leaves of an SMI tree.
+//
+// Leaves are yielded in lexicographic OID order. Moving from one leaf to the
+// next does not re-descend from the root, so iterating over a whole tree is
+// linear in its size.
+//
+// The OIDs yielded by an Iterator are relative to the node it was created with.
+type Iterator struct {
+	root  SMINode
+	stack []iterFrame
+
+	// rootLeaf is set when the iterator was created on a leaf rather than a
+	// subtree, and that leaf has not been yielded yet
+	rootLeaf bool
+}
+
+// iterFrame is a subtree on the path from the root to the current position.
+type iterFrame struct {
+	children []SMINode
+	// arcs are the arcs of the children of a sparse subtree, or nil if they
+	// are numbered sequentially
+	arcs []uint32
+	// next is the index of the next child to be visited
+	next int
+	// arc is the number of this subtree within its parent
+	arc uint32
+}
+
+// NewIterator() creates an Iterator positioned before the first leaf of node.
+func NewIterator(node SMINode) *Iterator {
+	it := &Iterator{root: node}
+	it.Seek(nil)
+	return it
+}
+
+// Seek() repositions the iterator so that the next call to Next() returns the
+// first leaf whose OID is lexicographically greater than oid; this is the
+// leaf that a GETNEXT request for oid should return.
+//
+// Seeking to a nil or empty OID rewinds the iterator to the start of the tree.
+func (it *Iterator) Seek(oid OID) {
+	it.stack = it.stack[:0]
+	it.rootLeaf = false
+
+	if it.root == nil {
+		return
+	}
+
+	children := it.root.Children()
+	if children == nil {
+		// Iterating over a single leaf: it only comes after the empty OID
+		it.rootLeaf = len(oid) == 0 && it.root.Value() != nil
+		return
+	}
+
+	it.stack = append(it.stack, iterFrame{children: children, arcs: childArcs(it.root)})
+	node := it.root
+
+	for depth, arc := range oid {
+		frame := &it.stack[len(it.stack)-1]
+
+		i, ok := childIndex(node, frame.children, arc)
+		if !ok {
+			// Nothing at this arc - continue from the first child after it
+			frame.next = i
+			return
+		}
+
+		child := frame.children[i]
+
+		if child == nil || child.Children() == nil {
+			// A leaf (or nothing at all) at this arc - it is either equal to or
+			// a prefix of the OID, so continue from the following sibling
+			frame.next = i + 1
+			return
+
+		} else if depth == len(oid)-1 {
+			// The OID names this subtree itself; all of its leaves come after it
+			frame.next = i
+			return
+		}
+
+		// Descend into the subtree; once it is exhausted, carry on with the
+		// sibling after it
+		frame.next = i + 1
+		it.stack = append(it.stack, iterFrame{children: child.Children(), arcs: childArcs(child), arc: arc})
+		node = child
+	}
+}
+
+// Next() advances the iterator and returns the OID and value of the next
+// leaf. Once the tree is exhausted, the returned OID and leaf are both nil.
+func (it *Iterator) Next() (OID, *SMILeaf) {
+	if it.rootLeaf {
+		it.rootLeaf = false
+		return OID{}, it.root.Value()
+	}
+
+	for len(it.stack) > 0 {
+		frame := &it.stack[len(it.stack)-1]
+
+		if frame.next >= len(frame.children) {
+			// This subtree is exhausted - go back up a level
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+
+		child := frame.children[frame.next]
+		arc := uint32(frame.next + 1)
+		if frame.arcs != nil {
+			arc = frame.arcs[frame.next]
+		}
+		frame.next += 1
+
+		if child == nil {
+			continue
+
+		} else if children := child.Children(); children != nil {
+			it.stack = append(it.stack, iterFrame{children: children, arcs: childArcs(child), arc: arc})
+
+		} else if val := child.Value(); val != nil {
+			return it.path().Add(arc), val
+		}
+	}
+
+	return nil, nil
+}
+
+// exhaust moves the iterator to the end of the tree.
+func (it *Iterator) exhaust() {
+	it.stack = it.stack[:0]
+	it.rootLeaf = false
+}
+
+// path returns the OID of the subtree currently being iterated over.
+func (it *Iterator) path() OID {
+	var oid = make(OID, 0, len(it.stack))
+	for _, frame := range it.stack[1:] {
+		oid = append(oid, frame.arc)
+	}
+	return oid
+}
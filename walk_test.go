@@ -0,0 +1,160 @@
+package snmptools
+
+import (
+	"fmt"
+	"testing"
+)
+
+// buildTestTree creates a tree of depth three, with `width` children at each
+// level below the root and integer leaves at the bottom.
+func buildTestTree(width int) *SMISubtree {
+	var (
+		root = NewSMISubtree()
+		n    = 0
+	)
+
+	for i := 0; i < width; i += 1 {
+		outer := NewSMISubtree()
+		for j := 0; j < width; j += 1 {
+			inner := NewSMISubtree()
+			for k := 0; k < width; k += 1 {
+				n += 1
+				inner.AddChild(NewLeafNode(&SMILeaf{AsnInteger, n}))
+			}
+			outer.AddChild(inner)
+		}
+		root.AddChild(outer)
+	}
+
+	return root
+}
+
+// Test that Walk visits every leaf in order
+func TestWalk(t *testing.T) {
+	var (
+		tree = buildTestTree(3)
+		prev OID
+		cnt  int
+	)
+
+	err := Walk(tree, func(oid OID, leaf *SMILeaf) error {
+		cnt += 1
+		if prev != nil && prev.Compare(oid) >= 0 {
+			t.Errorf("Walk is not in order: %s came after %s", oid, prev)
+		}
+		if v := leaf.value.(int); v != cnt {
+			t.Errorf("Wrong leaf at %s: got %d, wanted %d", oid, v, cnt)
+		}
+		prev = oid
+		return nil
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+	if cnt != 27 {
+		t.Errorf("Walk visited %d leaves, wanted 27", cnt)
+	}
+}
+
+// Test that an error returned by the visitor stops the walk
+func TestWalkStops(t *testing.T) {
+	var (
+		stop = fmt.Errorf("stop")
+		cnt  int
+	)
+
+	err := Walk(buildTestTree(3), func(oid OID, leaf *SMILeaf) error {
+		if cnt += 1; cnt == 5 {
+			return stop
+		}
+		return nil
+	})
+
+	if err != stop {
+		t.Errorf("Walk returned %v, wanted %v", err, stop)
+	}
+	if cnt != 5 {
+		t.Errorf("Walk visited %d leaves after being stopped at 5", cnt)
+	}
+}
+
+// Test seeking the iterator to various OIDs
+func TestIteratorSeek(t *testing.T) {
+	var O = NewOID
+
+	type seekTest struct {
+		target, expected OID
+	}
+
+	tests := []seekTest{
+		{nil, O(1, 1, 1)},
+		{O(), O(1, 1, 1)},
+		{O(0), O(1, 1, 1)},
+		{O(1), O(1, 1, 1)},
+		{O(1, 1, 1), O(1, 1, 2)},
+		{O(1, 1, 1, 5), O(1, 1, 2)},
+		{O(1, 1, 3), O(1, 2, 1)},
+		{O(1, 3, 3), O(2, 1, 1)},
+		{O(2, 0), O(2, 1, 1)},
+		{O(2, 2, 0, 7), O(2, 2, 1)},
+		{O(2, 9), O(3, 1, 1)},
+		{O(3, 3, 3), nil},
+		{O(4), nil},
+	}
+
+	it := NewIterator(buildTestTree(3))
+
+	for _, test := range tests {
+		it.Seek(test.target)
+		oid, leaf := it.Next()
+
+		if !oid.Equals(test.expected) {
+			t.Errorf("Seek to %s: got %s, wanted %s", test.target, oid, test.expected)
+		} else if (leaf == nil) != (test.expected == nil) {
+			t.Errorf("Seek to %s: got leaf %s", test.target, leaf)
+		}
+	}
+}
+
+// Test iterating over a single leaf
+func TestIteratorLeaf(t *testing.T) {
+	it := NewIterator(NewLeafNode(&SMILeaf{AsnInteger, 1}))
+
+	if oid, leaf := it.Next(); oid == nil || len(oid) != 0 || leaf == nil {
+		t.Errorf("Expected the leaf itself at the empty OID, got %s %s", oid, leaf)
+	}
+	if oid, _ := it.Next(); oid != nil {
+		t.Errorf("Expected the iterator to be exhausted, got %s", oid)
+	}
+}
+
+func benchmarkSizes(b *testing.B, fn func(b *testing.B, tree SMINode)) {
+	// 10^3, 22^3 and 47^3 leaves: roughly 1k, 10k and 100k
+	for _, width := range []int{10, 22, 47} {
+		tree := buildTestTree(width)
+		b.Run(fmt.Sprintf("leaves=%d", width*width*width), func(b *testing.B) {
+			fn(b, tree)
+		})
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, tree SMINode) {
+		for i := 0; i < b.N; i += 1 {
+			Walk(tree, func(oid OID, leaf *SMILeaf) error {
+				return nil
+			})
+		}
+	})
+}
+
+func BenchmarkIterator(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, tree SMINode) {
+		for i := 0; i < b.N; i += 1 {
+			it := NewIterator(tree)
+			for oid, _ := it.Next(); oid != nil; oid, _ = it.Next() {
+			}
+		}
+	})
+}